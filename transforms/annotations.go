@@ -0,0 +1,115 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package transforms
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// A FieldBehavior mirrors the google.api.FieldBehavior enum, which annotates
+// fields via the google.api.field_behavior option (see AIP-203).
+type FieldBehavior int32
+
+const (
+	FieldBehaviorUnspecified     = FieldBehavior(0)
+	FieldBehaviorOptional        = FieldBehavior(1)
+	FieldBehaviorRequired        = FieldBehavior(2)
+	FieldBehaviorOutputOnly      = FieldBehavior(3)
+	FieldBehaviorInputOnly       = FieldBehavior(4)
+	FieldBehaviorImmutable       = FieldBehavior(5)
+	FieldBehaviorUnorderedList   = FieldBehavior(6)
+	FieldBehaviorNonEmptyDefault = FieldBehavior(7)
+	FieldBehaviorIdentifier      = FieldBehavior(8)
+)
+
+// fieldBehaviorNumber is the field number of the google.api.field_behavior
+// extension of google.protobuf.FieldOptions.
+const fieldBehaviorNumber = 1052
+
+// GetFieldBehaviors returns the field behaviors a field has been annotated
+// with. The annotation is read from the field's options, regardless of
+// whether the google.api.field_behavior extension is linked into the binary.
+func GetFieldBehaviors(fd protoreflect.FieldDescriptor) []FieldBehavior {
+	opts := fd.Options()
+	if opts == nil {
+		return nil
+	}
+	m, ok := opts.(interface{ ProtoReflect() protoreflect.Message })
+	if !ok {
+		return nil
+	}
+	var fbs []FieldBehavior
+	m.ProtoReflect().Range(func(xd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if xd.IsExtension() && xd.Number() == fieldBehaviorNumber && xd.IsList() {
+			for i := 0; i < v.List().Len(); i += 1 {
+				fbs = append(fbs, FieldBehavior(v.List().Get(i).Enum()))
+			}
+		}
+		return true
+	})
+	return append(fbs, parseFieldBehaviors(m.ProtoReflect().GetUnknown())...)
+}
+
+// parseFieldBehaviors reads field behaviors from unknown fields, both packed
+// and unpacked.
+func parseFieldBehaviors(b []byte) []FieldBehavior {
+	var fbs []FieldBehavior
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fbs
+		}
+		b = b[n:]
+		if num == fieldBehaviorNumber && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return fbs
+			}
+			fbs = append(fbs, FieldBehavior(v))
+			b = b[n:]
+			continue
+		}
+		if num == fieldBehaviorNumber && typ == protowire.BytesType {
+			packed, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return fbs
+			}
+			for len(packed) > 0 {
+				v, m := protowire.ConsumeVarint(packed)
+				if m < 0 {
+					break
+				}
+				fbs = append(fbs, FieldBehavior(v))
+				packed = packed[m:]
+			}
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return fbs
+		}
+		b = b[n:]
+	}
+	return fbs
+}
+
+// HasFieldBehavior reports whether a field has been annotated with the given
+// field behavior.
+func HasFieldBehavior(fd protoreflect.FieldDescriptor, fb FieldBehavior) bool {
+	for _, x := range GetFieldBehaviors(fd) {
+		if x == fb {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRequired reports whether a field is required: either by its proto2 label
+// or by its REQUIRED field behavior.
+func IsRequired(fd protoreflect.FieldDescriptor) bool {
+	return fd.Cardinality() == protoreflect.Required || HasFieldBehavior(fd, FieldBehaviorRequired)
+}
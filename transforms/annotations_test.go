@@ -0,0 +1,88 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package transforms
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"reflect"
+	"testing"
+)
+
+func withFieldBehaviors(packed bool, fbs ...FieldBehavior) *descriptorpb.FieldOptions {
+	var b []byte
+	if packed {
+		var p []byte
+		for _, fb := range fbs {
+			p = protowire.AppendVarint(p, uint64(fb))
+		}
+		b = protowire.AppendTag(b, fieldBehaviorNumber, protowire.BytesType)
+		b = protowire.AppendBytes(b, p)
+	} else {
+		for _, fb := range fbs {
+			b = protowire.AppendTag(b, fieldBehaviorNumber, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(fb))
+		}
+	}
+	opts := &descriptorpb.FieldOptions{Deprecated: proto.Bool(true)}
+	opts.ProtoReflect().SetUnknown(b)
+	return opts
+}
+
+func TestGetFieldBehaviors(t *testing.T) {
+	field := func(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, opts *descriptorpb.FieldOptions) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:    proto.String(name),
+			Number:  proto.Int32(number),
+			Label:   label.Enum(),
+			Type:    descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			Options: opts,
+		}
+	}
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("annotated.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto2"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Annotated"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("plain", 1, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, nil),
+				field("unpacked", 2, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL,
+					withFieldBehaviors(false, FieldBehaviorRequired, FieldBehaviorImmutable)),
+				field("packed", 3, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL,
+					withFieldBehaviors(true, FieldBehaviorOutputOnly, FieldBehaviorIdentifier)),
+				field("label", 4, descriptorpb.FieldDescriptorProto_LABEL_REQUIRED, nil),
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	md := fd.Messages().Get(0)
+
+	cases := []struct {
+		field    string
+		expected []FieldBehavior
+		required bool
+	}{
+		{"plain", nil, false},
+		{"unpacked", []FieldBehavior{FieldBehaviorRequired, FieldBehaviorImmutable}, true},
+		{"packed", []FieldBehavior{FieldBehaviorOutputOnly, FieldBehaviorIdentifier}, false},
+		{"label", nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.field, func(t *testing.T) {
+			fd := md.Fields().ByName(protoreflect.Name(c.field))
+			if actual := GetFieldBehaviors(fd); !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.field, c.expected, actual)
+			}
+			if actual := IsRequired(fd); actual != c.required {
+				t.Errorf("%s: expected required %v, got %v", c.field, c.required, actual)
+			}
+		})
+	}
+}
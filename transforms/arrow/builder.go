@@ -0,0 +1,278 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package arrow
+
+import (
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"github.com/apache/arrow/go/v10/arrow"
+	"github.com/apache/arrow/go/v10/arrow/array"
+	"github.com/apache/arrow/go/v10/arrow/memory"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	defaultMaxDepth  = 10
+	defaultBatchSize = 1024
+)
+
+type config struct {
+	maxDepth  int
+	batchSize int
+	mem       memory.Allocator
+}
+
+type Option interface {
+	// Apply applies the Option to the configuration.
+	Apply(c *config)
+}
+
+type optionMaxDepth struct {
+	value int
+}
+
+func (o *optionMaxDepth) Apply(c *config) {
+	c.maxDepth = o.value
+}
+
+// OptionMaxDepth sets a maximum message recursion depth. Message fields beyond
+// it are left out of the schema. Defaults to 10. See transforms.OptionMaxDepth.
+func OptionMaxDepth(v int) Option {
+	return &optionMaxDepth{value: v}
+}
+
+type optionBatchSize struct {
+	value int
+}
+
+func (o *optionBatchSize) Apply(c *config) {
+	c.batchSize = o.value
+}
+
+// OptionBatchSize sets the number of rows at which a Writer writes a record.
+// Defaults to 1024.
+func OptionBatchSize(v int) Option {
+	if v <= 0 {
+		panic(fmt.Sprintf("invalid batch size %d", v))
+	}
+	return &optionBatchSize{value: v}
+}
+
+type optionAllocator struct {
+	value memory.Allocator
+}
+
+func (o *optionAllocator) Apply(c *config) {
+	c.mem = o.value
+}
+
+// OptionAllocator sets the memory allocator for arrays. Defaults to
+// memory.DefaultAllocator.
+func OptionAllocator(v memory.Allocator) Option {
+	if v == nil {
+		panic("allocator cannot be nil")
+	}
+	return &optionAllocator{value: v}
+}
+
+func newConfig(options []Option) *config {
+	c := &config{
+		maxDepth:  defaultMaxDepth,
+		batchSize: defaultBatchSize,
+		mem:       memory.DefaultAllocator,
+	}
+	for _, o := range options {
+		o.Apply(c)
+	}
+	return c
+}
+
+// A RecordBuilder appends messages of a single type to an
+// array.RecordBuilder. It is not safe for concurrent use.
+type RecordBuilder struct {
+	name   protoreflect.FullName
+	fields []*node
+	walker transforms.Walker
+	b      *array.RecordBuilder
+	rows   int
+}
+
+// NewRecordBuilder creates a new RecordBuilder for messages of the given type.
+// The RecordBuilder should be released after use.
+func NewRecordBuilder(md protoreflect.MessageDescriptor, options ...Option) *RecordBuilder {
+	c := newConfig(options)
+	fields := fieldNodes(md, c.maxDepth-1)
+	return &RecordBuilder{
+		name:   md.FullName(),
+		fields: fields,
+		walker: transforms.NewWalker(
+			transforms.OptionKeepSet(true),
+			transforms.OptionMaxDepth(c.maxDepth),
+			transforms.OptionDefaultScalarFunc(convertScalar),
+			transforms.OptionMapStrategy(transforms.MapEntries),
+			transforms.OptionAddTypeOverride(timestampName, convertTimestamp),
+		),
+		b: array.NewRecordBuilder(c.mem, schema(fields)),
+	}
+}
+
+// Schema returns the schema of the records.
+func (rb *RecordBuilder) Schema() *arrow.Schema {
+	return rb.b.Schema()
+}
+
+// Len returns the number of rows appended since the last record was created.
+func (rb *RecordBuilder) Len() int {
+	return rb.rows
+}
+
+// NewRecord creates a record from the appended rows and resets the builder.
+// The record should be released after use.
+func (rb *RecordBuilder) NewRecord() arrow.Record {
+	rb.rows = 0
+	return rb.b.NewRecord()
+}
+
+// Release releases the underlying array.RecordBuilder.
+func (rb *RecordBuilder) Release() {
+	rb.b.Release()
+}
+
+func convertScalar(fd protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		return int64(v.Enum())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return v.Int()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return v.Uint()
+	case protoreflect.FloatKind:
+		return v.Float()
+	}
+	return v.Interface()
+}
+
+func convertTimestamp(_ protoreflect.FieldDescriptor, kvs []transforms.KeyValue) interface{} {
+	micros := int64(0)
+	for _, kv := range kvs {
+		switch kv.Key {
+		case "seconds":
+			micros += kv.Value.(int64) * 1e6
+		case "nanos":
+			micros += kv.Value.(int64) / 1e3
+		}
+	}
+	return arrow.Timestamp(micros)
+}
+
+// Append appends messages as rows.
+func (rb *RecordBuilder) Append(ms ...proto.Message) error {
+	for _, m := range ms {
+		if name := m.ProtoReflect().Descriptor().FullName(); name != rb.name {
+			return fmt.Errorf("expected message of type %s, got %s", rb.name, name)
+		}
+		row := rb.walker.Apply(m).(map[string]interface{})
+		for i, n := range rb.fields {
+			if err := appendValue(rb.b.Field(i), n, row[n.name]); err != nil {
+				return err
+			}
+		}
+		rb.rows += 1
+	}
+	return nil
+}
+
+// appendValue appends a value to the builder of a node.
+func appendValue(b array.Builder, n *node, v interface{}) error {
+	if v == nil {
+		if n.nullable {
+			b.AppendNull()
+			return nil
+		}
+		v = n.zero
+	}
+	switch x := b.(type) {
+	case *array.StructBuilder:
+		m, _ := v.(map[string]interface{})
+		x.Append(true)
+		for i, c := range n.children {
+			if err := appendValue(x.FieldBuilder(i), c, m[c.name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *array.MapBuilder:
+		es, _ := v.([]map[string]interface{})
+		x.Append(true)
+		for _, e := range es {
+			if err := appendValue(x.KeyBuilder(), n.children[0], e["key"]); err != nil {
+				return err
+			}
+			if err := appendValue(x.ItemBuilder(), n.children[1], e["value"]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *array.ListBuilder:
+		xs, _ := v.([]interface{})
+		x.Append(true)
+		for _, item := range xs {
+			if err := appendValue(x.ValueBuilder(), n.children[0], item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *array.BooleanBuilder:
+		if y, ok := v.(bool); ok {
+			x.Append(y)
+			return nil
+		}
+	case *array.Int64Builder:
+		switch y := v.(type) {
+		case int64:
+			x.Append(y)
+			return nil
+		case int32:
+			// map keys
+			x.Append(int64(y))
+			return nil
+		}
+	case *array.Uint64Builder:
+		switch y := v.(type) {
+		case uint64:
+			x.Append(y)
+			return nil
+		case uint32:
+			// map keys
+			x.Append(uint64(y))
+			return nil
+		}
+	case *array.Float64Builder:
+		if y, ok := v.(float64); ok {
+			x.Append(y)
+			return nil
+		}
+	case *array.StringBuilder:
+		if y, ok := v.(string); ok {
+			x.Append(y)
+			return nil
+		}
+	case *array.BinaryBuilder:
+		if y, ok := v.([]byte); ok {
+			x.Append(y)
+			return nil
+		}
+	case *array.TimestampBuilder:
+		if y, ok := v.(arrow.Timestamp); ok {
+			x.Append(y)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: unexpected value of type %T for %s", n.name, v, n.type_)
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package arrow
+
+import (
+	"encoding/json"
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"github.com/apache/arrow/go/v10/arrow/memory"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"reflect"
+	"testing"
+)
+
+var eventInputs = []string{
+	`{
+  "id": "1",
+  "name": "a",
+  "flag": true,
+  "ratio": 0.5,
+  "count": 4294967295,
+  "status": "ACTIVE",
+  "tags": ["x", "y"],
+  "attrs": {"b": "2", "a": "1"},
+  "children": [{"id": "2", "tags": ["z"]}, {"id": "3"}],
+  "parent": {"name": "p"},
+  "created": "1970-01-01T00:00:01.000002Z",
+  "alias": "q",
+  "place": {"lat": 1.5, "status": "ACTIVE"},
+  "stops": [{"lat": 2.5}],
+  "states": ["ACTIVE", "UNKNOWN"]
+}`,
+	`{}`,
+	`{"tags": [""], "children": [{}], "alias": ""}`,
+}
+
+// eventRows holds the expected rows for eventInputs at depth one, as
+// rendered by arrow.Record.MarshalJSON.
+const eventRows = `[
+  {"id": 1, "name": "a", "flag": true, "ratio": 0.5, "count": 4294967295, "status": 1,
+   "tags": ["x", "y"], "attrs": [{"key": "a", "value": 1}, {"key": "b", "value": 2}],
+   "children": [
+     {"id": 2, "name": "", "flag": false, "ratio": 0, "count": 0, "status": 0, "tags": ["z"], "attrs": [], "alias": null, "states": []},
+     {"id": 3, "name": "", "flag": false, "ratio": 0, "count": 0, "status": 0, "tags": [], "attrs": [], "alias": null, "states": []}
+   ],
+   "parent": {"id": 0, "name": "p", "flag": false, "ratio": 0, "count": 0, "status": 0, "tags": [], "attrs": [], "alias": null, "states": []},
+   "created": "1970-01-01 00:00:01.000002",
+   "alias": "q",
+   "place": {"lat": 1.5, "status": 1},
+   "stops": [{"lat": 2.5, "status": 0}],
+   "states": [1, 0]},
+  {"id": 0, "name": "", "flag": false, "ratio": 0, "count": 0, "status": 0,
+   "tags": [], "attrs": [], "children": [], "parent": null, "created": null, "alias": null,
+   "place": null, "stops": [], "states": []},
+  {"id": 0, "name": "", "flag": false, "ratio": 0, "count": 0, "status": 0,
+   "tags": [""], "attrs": [],
+   "children": [
+     {"id": 0, "name": "", "flag": false, "ratio": 0, "count": 0, "status": 0, "tags": [], "attrs": [], "alias": null, "states": []}
+   ],
+   "parent": null, "created": null, "alias": "",
+   "place": null, "stops": [], "states": []}
+]`
+
+func unmarshalRows(t *testing.T, bs []byte) []interface{} {
+	var out []interface{}
+	if err := json.Unmarshal(bs, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return out
+}
+
+func TestRecordBuilder(t *testing.T) {
+	event := (&testpb.Event{}).ProtoReflect().Descriptor()
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	rb := NewRecordBuilder(event, OptionMaxDepth(1), OptionAllocator(mem))
+	defer rb.Release()
+	var ms []proto.Message
+	for _, s := range eventInputs {
+		ms = append(ms, testpb.NewEvent(t, s))
+	}
+	if err := rb.Append(ms...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual := rb.Len(); actual != len(eventInputs) {
+		t.Errorf("expected %v, got %v", len(eventInputs), actual)
+	}
+	rec := rb.NewRecord()
+	defer rec.Release()
+	if actual := rb.Len(); actual != 0 {
+		t.Errorf("expected 0, got %v", actual)
+	}
+	if !rec.Schema().Equal(NewSchema(event, OptionMaxDepth(1))) {
+		t.Errorf("unexpected schema %v", rec.Schema())
+	}
+	bs, err := rec.MarshalJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := unmarshalRows(t, []byte(eventRows))
+	if actual := unmarshalRows(t, bs); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("\nexpected %v, \ngot      %v", expected, actual)
+	}
+}
+
+func TestRecordBuilder_Append_WrongType(t *testing.T) {
+	rb := NewRecordBuilder((&testpb.Event{}).ProtoReflect().Descriptor())
+	defer rb.Release()
+	if err := rb.Append(&timestamppb.Timestamp{}); err == nil {
+		t.Errorf("expected error")
+	}
+}
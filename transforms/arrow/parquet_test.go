@@ -0,0 +1,150 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package arrow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"github.com/HayoVanLoon/go-proto/transforms/parquet"
+	"github.com/apache/arrow/go/v10/arrow/array"
+	"github.com/apache/arrow/go/v10/arrow/memory"
+	"github.com/apache/arrow/go/v10/parquet/pqarrow"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"testing"
+)
+
+// parquetInputs nest repeated messages two levels deep.
+var parquetInputs = []string{
+	`{
+  "id": "1",
+  "status": "ACTIVE",
+  "tags": ["x", "y"],
+  "attrs": {"b": "2", "a": "1"},
+  "children": [
+    {"id": "2", "children": [{"id": "3", "tags": ["z"]}, {"attrs": {"c": "3"}}], "parent": {"name": "p"}},
+    {"id": "4", "status": 7}
+  ],
+  "parent": {"tags": ["w"], "children": [{"name": "c"}]},
+  "created": "1970-01-01T00:00:01.000002Z",
+  "alias": "q",
+  "place": {"lat": 1.5, "seen": ["1970-01-01T00:00:02Z"]},
+  "stops": [{"status": "ACTIVE"}],
+  "states": ["ACTIVE"]
+}`,
+	`{}`,
+	`{"tags": [""], "children": [{}], "alias": ""}`,
+}
+
+// parquetRows holds the expected rows for parquetInputs at depth two, as
+// rendered by arrow.Record.MarshalJSON. Enums are binary, hence base64
+// encoded: "QUNUSVZF" is ACTIVE, "VU5LTk9XTg==" is UNKNOWN and "Nw==" is 7.
+const parquetRows = `[
+  {"id": 1, "name": "", "flag": false, "ratio": 0, "count": 0, "status": "QUNUSVZF",
+   "tags": ["x", "y"], "attrs": [{"key": "a", "value": 1}, {"key": "b", "value": 2}],
+   "children": [
+     {"id": 2, "name": "", "flag": false, "ratio": 0, "count": 0, "status": "VU5LTk9XTg==", "tags": [], "attrs": [],
+      "children": [
+        {"id": 3, "name": "", "flag": false, "ratio": 0, "count": 0, "status": "VU5LTk9XTg==", "tags": ["z"], "attrs": [], "alias": null, "states": []},
+        {"id": 0, "name": "", "flag": false, "ratio": 0, "count": 0, "status": "VU5LTk9XTg==", "tags": [], "attrs": [{"key": "c", "value": 3}], "alias": null, "states": []}
+      ],
+      "parent": {"id": 0, "name": "p", "flag": false, "ratio": 0, "count": 0, "status": "VU5LTk9XTg==", "tags": [], "attrs": [], "alias": null, "states": []},
+      "created": null, "alias": null, "place": null, "stops": [], "states": []},
+     {"id": 4, "name": "", "flag": false, "ratio": 0, "count": 0, "status": "Nw==", "tags": [], "attrs": [],
+      "children": [], "parent": null, "created": null, "alias": null, "place": null, "stops": [], "states": []}
+   ],
+   "parent": {"id": 0, "name": "", "flag": false, "ratio": 0, "count": 0, "status": "VU5LTk9XTg==", "tags": ["w"], "attrs": [],
+     "children": [
+       {"id": 0, "name": "c", "flag": false, "ratio": 0, "count": 0, "status": "VU5LTk9XTg==", "tags": [], "attrs": [], "alias": null, "states": []}
+     ],
+     "parent": null, "created": null, "alias": null, "place": null, "stops": [], "states": []},
+   "created": "1970-01-01 00:00:01.000002",
+   "alias": "q",
+   "place": {"lat": 1.5, "status": "VU5LTk9XTg==", "seen": ["1970-01-01 00:00:02"]},
+   "stops": [{"lat": 0, "status": "QUNUSVZF", "seen": []}],
+   "states": ["QUNUSVZF"]},
+  {"id": 0, "name": "", "flag": false, "ratio": 0, "count": 0, "status": "VU5LTk9XTg==",
+   "tags": [], "attrs": [], "children": [], "parent": null, "created": null, "alias": null,
+   "place": null, "stops": [], "states": []},
+  {"id": 0, "name": "", "flag": false, "ratio": 0, "count": 0, "status": "VU5LTk9XTg==",
+   "tags": [""], "attrs": [],
+   "children": [
+     {"id": 0, "name": "", "flag": false, "ratio": 0, "count": 0, "status": "VU5LTk9XTg==", "tags": [], "attrs": [],
+      "children": [], "parent": null, "created": null, "alias": null, "place": null, "stops": [], "states": []}
+   ],
+   "parent": null, "created": null, "alias": "",
+   "place": null, "stops": [], "states": []}
+]`
+
+// readParquet reads a Parquet file with the Arrow implementation and returns
+// its rows as rendered by arrow.Record.MarshalJSON.
+func readParquet(t *testing.T, bs []byte) []interface{} {
+	tbl, err := pqarrow.ReadTable(context.Background(), bytes.NewReader(bs), nil, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tbl.Release()
+	tr := array.NewTableReader(tbl, tbl.NumRows())
+	defer tr.Release()
+	var rows []interface{}
+	for tr.Next() {
+		data, err := tr.Record().MarshalJSON()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var xs []interface{}
+		if err := json.Unmarshal(data, &xs); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		rows = append(rows, xs...)
+	}
+	return rows
+}
+
+// TestParquetWriter reads the files written by the parquet package back with
+// the Arrow Parquet reader. It lives in this module, as the transforms module
+// does not depend on Arrow.
+func TestParquetWriter(t *testing.T) {
+	event := (&testpb.Event{}).ProtoReflect().Descriptor()
+	expected := unmarshalRows(t, []byte(parquetRows))
+
+	// The Arrow reader fails on row groups in which a list of messages holding
+	// a message field has no items at all, hence the last case skips the
+	// second input.
+	cases := []struct {
+		inputs  []int
+		options []parquet.Option
+		name    string
+	}{
+		{[]int{0, 1, 2}, nil, "single row group"},
+		{[]int{0, 1, 2}, []parquet.Option{parquet.OptionCompression(parquet.Gzip)}, "gzip"},
+		{[]int{0, 2}, []parquet.Option{parquet.OptionRowGroupSize(1)}, "row groups"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var ms []proto.Message
+			var rows []interface{}
+			for _, i := range c.inputs {
+				ms = append(ms, testpb.NewEvent(t, parquetInputs[i]))
+				rows = append(rows, expected[i])
+			}
+			buf := &bytes.Buffer{}
+			w, err := parquet.NewWriter(buf, event, append(c.options, parquet.OptionMaxDepth(2))...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := w.Write(ms...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual := readParquet(t, buf.Bytes()); !reflect.DeepEqual(actual, rows) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, rows, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package arrow converts message descriptors into Arrow schemas and messages
+// into Arrow records.
+//
+// Types follow the conventions of the bigquery package: messages map to
+// structs, repeated fields to lists and google.protobuf.Timestamp to
+// microsecond timestamps in UTC. Maps map to Arrow maps. Fields that track
+// presence (message fields, oneof members and optional fields) are nullable;
+// other fields hold their default value when unset.
+//
+// Arrow schemas cannot be recursive. Message fields beyond the maximum depth
+// (see OptionMaxDepth) are left out.
+package arrow
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v10/arrow"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const timestampName = "google.protobuf.Timestamp"
+
+var timestampType = &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+
+// GetArrowType returns the Arrow type for the values of a scalar field.
+// Signed integers and enums map to int64, holding the enum value's number,
+// unsigned integers to uint64 and floating point numbers to float64.
+func GetArrowType(fd protoreflect.FieldDescriptor) arrow.DataType {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return arrow.FixedWidthTypes.Boolean
+	case protoreflect.EnumKind, protoreflect.Int32Kind, protoreflect.Int64Kind,
+		protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+		protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind:
+		return arrow.PrimitiveTypes.Int64
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind,
+		protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		return arrow.PrimitiveTypes.Uint64
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return arrow.PrimitiveTypes.Float64
+	case protoreflect.StringKind:
+		return arrow.BinaryTypes.String
+	case protoreflect.BytesKind:
+		return arrow.BinaryTypes.Binary
+	default:
+		panic(fmt.Sprintf("unsupported type %v", fd.Kind()))
+	}
+}
+
+// A node is a field in an Arrow schema. Structs hold their fields as
+// children, lists their element and maps their key and value.
+type node struct {
+	name     string
+	type_    arrow.DataType
+	nullable bool
+	children []*node
+	// zero is the value of a scalar when its field is unset
+	zero interface{}
+}
+
+func (n *node) field() arrow.Field {
+	return arrow.Field{Name: n.name, Type: n.type_, Nullable: n.nullable}
+}
+
+// NewSchema creates the Arrow schema for a message type. Of the options, only
+// OptionMaxDepth applies.
+func NewSchema(md protoreflect.MessageDescriptor, options ...Option) *arrow.Schema {
+	c := newConfig(options)
+	return schema(fieldNodes(md, c.maxDepth-1))
+}
+
+func schema(ns []*node) *arrow.Schema {
+	fs := make([]arrow.Field, len(ns))
+	for i, n := range ns {
+		fs[i] = n.field()
+	}
+	return arrow.NewSchema(fs, nil)
+}
+
+// fieldNodes creates the nodes for the fields of a message. The allowed depth
+// mirrors that of the Walker: message values are only included if it is not
+// negative.
+func fieldNodes(md protoreflect.MessageDescriptor, allowedDepth int) []*node {
+	var out []*node
+	for i := 0; i < md.Fields().Len(); i += 1 {
+		if n := fieldNode(md.Fields().Get(i), allowedDepth); n != nil {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func fieldNode(fd protoreflect.FieldDescriptor, allowedDepth int) *node {
+	name := string(fd.Name())
+	switch {
+	case fd.IsMap():
+		value := valueNode("value", fd.MapValue(), allowedDepth)
+		if value == nil {
+			return nil
+		}
+		key := valueNode("key", fd.MapKey(), allowedDepth)
+		// map values are always nullable in Arrow
+		value.nullable = true
+		return &node{
+			name:     name,
+			type_:    arrow.MapOf(key.type_, value.type_),
+			children: []*node{key, value},
+		}
+	case fd.IsList():
+		element := valueNode("item", fd, allowedDepth)
+		if element == nil {
+			return nil
+		}
+		return &node{
+			name:     name,
+			type_:    arrow.ListOfNonNullable(element.type_),
+			children: []*node{element},
+		}
+	}
+	n := valueNode(name, fd, allowedDepth)
+	if n != nil {
+		n.nullable = fd.HasPresence()
+	}
+	return n
+}
+
+// valueNode creates a non-nullable node for a single value of a field, or nil
+// if it is a message beyond the maximum depth.
+func valueNode(name string, fd protoreflect.FieldDescriptor, allowedDepth int) *node {
+	n := &node{name: name}
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if allowedDepth < 0 {
+			return nil
+		}
+		if fd.Message().FullName() == timestampName {
+			n.type_, n.zero = timestampType, arrow.Timestamp(0)
+			break
+		}
+		n.children = fieldNodes(fd.Message(), allowedDepth-1)
+		fs := make([]arrow.Field, len(n.children))
+		for i, c := range n.children {
+			fs[i] = c.field()
+		}
+		n.type_ = arrow.StructOf(fs...)
+	default:
+		n.type_ = GetArrowType(fd)
+		v := fd.Default()
+		if fd.IsList() {
+			// lists have no default, so use that of a new element
+			v = dynamicpb.NewMessage(fd.ContainingMessage()).NewField(fd).List().NewElement()
+		}
+		n.zero = convertScalar(fd, &v)
+	}
+	return n
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package arrow
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"github.com/apache/arrow/go/v10/arrow"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"testing"
+)
+
+func field(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, type_ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+	f := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    label.Enum(),
+		Type:     type_.Enum(),
+	}
+	if typeName != "" {
+		f.TypeName = proto.String(typeName)
+	}
+	return f
+}
+
+// scalarEventFields holds the fields of test.Event that are not messages.
+var scalarEventFields = []arrow.Field{
+	{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+	{Name: "name", Type: arrow.BinaryTypes.String},
+	{Name: "flag", Type: arrow.FixedWidthTypes.Boolean},
+	{Name: "ratio", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "count", Type: arrow.PrimitiveTypes.Uint64},
+	{Name: "status", Type: arrow.PrimitiveTypes.Int64},
+	{Name: "tags", Type: arrow.ListOfNonNullable(arrow.BinaryTypes.String)},
+	{Name: "attrs", Type: arrow.MapOf(arrow.BinaryTypes.String, arrow.PrimitiveTypes.Int64)},
+}
+
+var aliasField = arrow.Field{Name: "alias", Type: arrow.BinaryTypes.String, Nullable: true}
+
+var statesField = arrow.Field{Name: "states", Type: arrow.ListOfNonNullable(arrow.PrimitiveTypes.Int64)}
+
+func fields(fs ...[]arrow.Field) []arrow.Field {
+	var out []arrow.Field
+	for _, f := range fs {
+		out = append(out, f...)
+	}
+	return out
+}
+
+func TestNewSchema(t *testing.T) {
+	event := (&testpb.Event{}).ProtoReflect().Descriptor()
+	nested := arrow.StructOf(fields(scalarEventFields, []arrow.Field{aliasField, statesField})...)
+	place := arrow.StructOf(
+		arrow.Field{Name: "lat", Type: arrow.PrimitiveTypes.Float64},
+		arrow.Field{Name: "status", Type: arrow.PrimitiveTypes.Int64},
+	)
+
+	cases := []struct {
+		options  []Option
+		expected *arrow.Schema
+		name     string
+	}{
+		{
+			[]Option{OptionMaxDepth(0)},
+			arrow.NewSchema(fields(scalarEventFields, []arrow.Field{aliasField, statesField}), nil),
+			"depth zero",
+		},
+		{
+			[]Option{OptionMaxDepth(1)},
+			arrow.NewSchema(fields(scalarEventFields, []arrow.Field{
+				{Name: "children", Type: arrow.ListOfNonNullable(nested)},
+				{Name: "parent", Type: nested, Nullable: true},
+				{Name: "created", Type: &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}, Nullable: true},
+				aliasField,
+				{Name: "place", Type: place, Nullable: true},
+				{Name: "stops", Type: arrow.ListOfNonNullable(place)},
+				statesField,
+			}), nil),
+			"depth one",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := NewSchema(event, c.options...)
+			if !actual.Equal(c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestGetArrowType(t *testing.T) {
+	event := (&testpb.Event{}).ProtoReflect().Descriptor()
+
+	cases := []struct {
+		field    string
+		expected arrow.DataType
+		name     string
+	}{
+		{"id", arrow.PrimitiveTypes.Int64, "int64"},
+		{"count", arrow.PrimitiveTypes.Uint64, "uint32"},
+		{"status", arrow.PrimitiveTypes.Int64, "enum"},
+		{"ratio", arrow.PrimitiveTypes.Float64, "float"},
+		{"tags", arrow.BinaryTypes.String, "repeated string"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := GetArrowType(event.Fields().ByName(protoreflect.Name(c.field)))
+			if !arrow.TypeEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestNewSchema_RepeatedScalars(t *testing.T) {
+	const repeated = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("lists.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Lists"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("ratios", 1, repeated, descriptorpb.FieldDescriptorProto_TYPE_FLOAT, ""),
+				field("counts", 2, repeated, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+				field("states", 3, repeated, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".test.State"),
+			},
+		}},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name:  proto.String("State"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{{Name: proto.String("NONE"), Number: proto.Int32(0)}},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := arrow.NewSchema([]arrow.Field{
+		{Name: "ratios", Type: arrow.ListOfNonNullable(arrow.PrimitiveTypes.Float64)},
+		{Name: "counts", Type: arrow.ListOfNonNullable(arrow.PrimitiveTypes.Int64)},
+		{Name: "states", Type: arrow.ListOfNonNullable(arrow.PrimitiveTypes.Int64)},
+	}, nil)
+	if actual := NewSchema(fd.Messages().ByName("Lists")); !actual.Equal(expected) {
+		t.Errorf("\nexpected %v, \ngot      %v", expected, actual)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package arrow
+
+import (
+	"github.com/apache/arrow/go/v10/arrow"
+	"github.com/apache/arrow/go/v10/arrow/ipc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"io"
+)
+
+// recordWriter is implemented by ipc.Writer and ipc.FileWriter.
+type recordWriter interface {
+	Write(rec arrow.Record) error
+	Close() error
+}
+
+// A Writer writes messages of a single type in the Arrow IPC format. It is not
+// safe for concurrent use.
+//
+// Rows are buffered until the batch size is reached (see OptionBatchSize) and
+// then written as a single record.
+type Writer struct {
+	rb        *RecordBuilder
+	w         recordWriter
+	batchSize int
+	err       error
+}
+
+// NewFileWriter creates a new Writer for messages of the given type, writing
+// an Arrow IPC file.
+func NewFileWriter(w io.WriteSeeker, md protoreflect.MessageDescriptor, options ...Option) (*Writer, error) {
+	c := newConfig(options)
+	rb := NewRecordBuilder(md, options...)
+	fw, err := ipc.NewFileWriter(w, ipc.WithSchema(rb.Schema()), ipc.WithAllocator(c.mem))
+	if err != nil {
+		rb.Release()
+		return nil, err
+	}
+	return &Writer{rb: rb, w: fw, batchSize: c.batchSize}, nil
+}
+
+// NewStreamWriter creates a new Writer for messages of the given type,
+// writing an Arrow IPC stream.
+func NewStreamWriter(w io.Writer, md protoreflect.MessageDescriptor, options ...Option) *Writer {
+	c := newConfig(options)
+	rb := NewRecordBuilder(md, options...)
+	sw := ipc.NewWriter(w, ipc.WithSchema(rb.Schema()), ipc.WithAllocator(c.mem))
+	return &Writer{rb: rb, w: sw, batchSize: c.batchSize}
+}
+
+// Schema returns the schema of the records.
+func (aw *Writer) Schema() *arrow.Schema {
+	return aw.rb.Schema()
+}
+
+// Write adds messages to the current batch, writing it when it reaches the
+// batch size.
+func (aw *Writer) Write(ms ...proto.Message) error {
+	if aw.err != nil {
+		return aw.err
+	}
+	for _, m := range ms {
+		if aw.err = aw.rb.Append(m); aw.err != nil {
+			return aw.err
+		}
+		if aw.rb.Len() >= aw.batchSize {
+			if err := aw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Flush writes the current batch as a record, if it holds any rows.
+func (aw *Writer) Flush() error {
+	if aw.err != nil {
+		return aw.err
+	}
+	if aw.rb.Len() == 0 {
+		return nil
+	}
+	rec := aw.rb.NewRecord()
+	defer rec.Release()
+	aw.err = aw.w.Write(rec)
+	return aw.err
+}
+
+// Close flushes the current batch and completes the stream or file. It does
+// not close the underlying writer.
+func (aw *Writer) Close() error {
+	defer aw.rb.Release()
+	if err := aw.Flush(); err != nil {
+		return err
+	}
+	return aw.w.Close()
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package arrow
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"github.com/apache/arrow/go/v10/arrow"
+	"github.com/apache/arrow/go/v10/arrow/ipc"
+	"google.golang.org/protobuf/proto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// readRecords reads all records from an IPC file or stream and returns their
+// combined rows and the number of records.
+func readRecords(t *testing.T, file bool, bs []byte) ([]interface{}, int, *arrow.Schema) {
+	var rows []interface{}
+	n := 0
+	add := func(rec arrow.Record) {
+		data, err := rec.MarshalJSON()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var xs []interface{}
+		if err := json.Unmarshal(data, &xs); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		rows = append(rows, xs...)
+		n += 1
+	}
+	if file {
+		r, err := ipc.NewFileReader(bytes.NewReader(bs))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer r.Close()
+		for i := 0; i < r.NumRecords(); i += 1 {
+			rec, err := r.Record(i)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			add(rec)
+		}
+		return rows, n, r.Schema()
+	}
+	r, err := ipc.NewReader(bytes.NewReader(bs))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer r.Release()
+	for r.Next() {
+		add(r.Record())
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return rows, n, r.Schema()
+}
+
+func TestWriter(t *testing.T) {
+	event := (&testpb.Event{}).ProtoReflect().Descriptor()
+	expected := unmarshalRows(t, []byte(eventRows))
+
+	cases := []struct {
+		file    bool
+		options []Option
+		records int
+		name    string
+	}{
+		{true, []Option{OptionMaxDepth(1)}, 1, "file"},
+		{true, []Option{OptionMaxDepth(1), OptionBatchSize(2)}, 2, "file in batches"},
+		{false, []Option{OptionMaxDepth(1)}, 1, "stream"},
+		{false, []Option{OptionMaxDepth(1), OptionBatchSize(1)}, 3, "stream in batches"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var ms []proto.Message
+			for _, s := range eventInputs {
+				ms = append(ms, testpb.NewEvent(t, s))
+			}
+
+			var bs []byte
+			if c.file {
+				f, err := os.Create(filepath.Join(t.TempDir(), "events.arrow"))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				defer f.Close()
+				w, err := NewFileWriter(f, event, c.options...)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err := w.Write(ms...); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if bs, err = os.ReadFile(f.Name()); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else {
+				buf := &bytes.Buffer{}
+				w := NewStreamWriter(buf, event, c.options...)
+				if err := w.Write(ms...); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				bs = buf.Bytes()
+			}
+
+			rows, records, schema := readRecords(t, c.file, bs)
+			if !schema.Equal(NewSchema(event, c.options...)) {
+				t.Errorf("%s: unexpected schema %v", c.name, schema)
+			}
+			if records != c.records {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.records, records)
+			}
+			if !reflect.DeepEqual(rows, expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, expected, rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package avro
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"math"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// A RowConverter converts messages into records of Go values, as expected by
+// Schema.Append. It is safe for concurrent use by multiple goroutines.
+//
+// Values are of the types that Avro libraries commonly use for their native
+// form: bool, int32, int64, float32, float64, string, []byte, string for enum
+// symbols, time.Time for timestamps and dates, *big.Rat for decimals,
+// []interface{} for arrays and map[string]interface{} for maps and records.
+// Unset fields are omitted. Unknown enum values are kept as their
+// protoreflect.EnumNumber and invalid decimals as their string, for which
+// Schema.Append returns an error.
+type RowConverter interface {
+	Apply(m proto.Message) map[string]interface{}
+}
+
+type rowConverter struct {
+	walker transforms.Walker
+}
+
+// NewRowConverter creates a new RowConverter.
+func NewRowConverter() RowConverter {
+	opts := []transforms.Option{
+		transforms.OptionKeepSet(true),
+		transforms.OptionDefaultScalarFunc(convertRowScalar),
+		transforms.OptionMapStrategy(transforms.MapStringKeys),
+		transforms.OptionAddTypeOverride(timestampName, convertRowTimestamp),
+		transforms.OptionAddTypeOverride(dateName, convertRowDate),
+		transforms.OptionAddTypeOverride(decimalName, convertRowDecimal),
+	}
+	return &rowConverter{walker: transforms.NewWalker(opts...)}
+}
+
+func (rc *rowConverter) Apply(m proto.Message) map[string]interface{} {
+	return rc.walker.Apply(m).(map[string]interface{})
+}
+
+func convertRowScalar(fd protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return v.Bool()
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		// Avro enums have no symbol for it; Append reports the number
+		return v.Enum()
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return int32(v.Int())
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return v.Int()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return int64(v.Uint())
+	case protoreflect.FloatKind:
+		return float32(v.Float())
+	case protoreflect.DoubleKind:
+		return v.Float()
+	case protoreflect.StringKind:
+		return v.String()
+	case protoreflect.BytesKind:
+		return v.Bytes()
+	default:
+		return nil
+	}
+}
+
+func convertRowTimestamp(_ protoreflect.FieldDescriptor, kvs []transforms.KeyValue) interface{} {
+	seconds := int64(0)
+	nanos := int64(0)
+	for _, kv := range kvs {
+		switch kv.Key {
+		case "seconds":
+			seconds = kv.Value.(int64)
+		case "nanos":
+			nanos = int64(kv.Value.(int32))
+		}
+	}
+	return time.Unix(seconds, nanos).UTC()
+}
+
+func convertRowDate(_ protoreflect.FieldDescriptor, kvs []transforms.KeyValue) interface{} {
+	year, month, day := 0, 0, 0
+	for _, kv := range kvs {
+		switch kv.Key {
+		case "year":
+			year = int(kv.Value.(int32))
+		case "month":
+			month = int(kv.Value.(int32))
+		case "day":
+			day = int(kv.Value.(int32))
+		}
+	}
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+func convertRowDecimal(_ protoreflect.FieldDescriptor, kvs []transforms.KeyValue) interface{} {
+	s := "0"
+	for _, kv := range kvs {
+		if kv.Key == "value" {
+			s = kv.Value.(string)
+		}
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		// Append reports the invalid string
+		return s
+	}
+	return r
+}
+
+// Append appends the Avro binary encoding of a record to buf. The record is
+// expected to be in the form produced by a RowConverter.
+func (s *Schema) Append(buf []byte, record map[string]interface{}) ([]byte, error) {
+	return s.root.append(buf, record)
+}
+
+func (s *schema) append(buf []byte, v interface{}) ([]byte, error) {
+	switch s.type_ {
+	case nullType:
+		if v != nil {
+			return nil, fmt.Errorf("expected nil, got %T", v)
+		}
+		return buf, nil
+	case booleanType:
+		x, _ := v.(bool)
+		if x {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case intType:
+		if t, ok := v.(time.Time); ok && s.logicalType == "date" {
+			return appendLong(buf, daysSinceEpoch(t)), nil
+		}
+		x, err := toInt64(v)
+		if err != nil {
+			return nil, err
+		}
+		if x < math.MinInt32 || x > math.MaxInt32 {
+			return nil, fmt.Errorf("value %d out of range for int", x)
+		}
+		return appendLong(buf, x), nil
+	case longType:
+		if t, ok := v.(time.Time); ok && s.logicalType == "timestamp-micros" {
+			return appendLong(buf, t.Unix()*1e6+int64(t.Nanosecond())/1e3), nil
+		}
+		x, err := toInt64(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendLong(buf, x), nil
+	case floatType:
+		var x float32
+		switch y := v.(type) {
+		case float32:
+			x = y
+		case float64:
+			x = float32(y)
+		case nil:
+		default:
+			return nil, fmt.Errorf("expected float, got %T", v)
+		}
+		return appendUint32(buf, math.Float32bits(x)), nil
+	case doubleType:
+		var x float64
+		switch y := v.(type) {
+		case float32:
+			x = float64(y)
+		case float64:
+			x = y
+		case nil:
+		default:
+			return nil, fmt.Errorf("expected double, got %T", v)
+		}
+		return appendUint64(buf, math.Float64bits(x)), nil
+	case bytesType:
+		if s.logicalType == "decimal" {
+			if r, ok := v.(*big.Rat); ok {
+				bs, err := s.decimalBytes(r)
+				if err != nil {
+					return nil, err
+				}
+				return appendBytes(buf, bs), nil
+			}
+			if x, ok := v.(string); ok {
+				return nil, fmt.Errorf("invalid decimal %q", x)
+			}
+		}
+		switch y := v.(type) {
+		case []byte:
+			return appendBytes(buf, y), nil
+		case nil:
+			return appendLong(buf, 0), nil
+		}
+		return nil, fmt.Errorf("expected bytes, got %T", v)
+	case stringType:
+		switch y := v.(type) {
+		case string:
+			return appendBytes(buf, []byte(y)), nil
+		case nil:
+			return appendLong(buf, 0), nil
+		}
+		return nil, fmt.Errorf("expected string, got %T", v)
+	case enumType:
+		switch y := v.(type) {
+		case string:
+			for i, sym := range s.symbols {
+				if sym == y {
+					return appendLong(buf, int64(i)), nil
+				}
+			}
+			return nil, fmt.Errorf("unknown symbol %q for enum %s", y, s.name)
+		case protoreflect.EnumNumber:
+			if i, ok := s.indices[y]; ok {
+				return appendLong(buf, int64(i)), nil
+			}
+			return nil, fmt.Errorf("unknown value %d for enum %s", y, s.name)
+		case nil:
+			return appendLong(buf, int64(s.indices[0])), nil
+		}
+		return nil, fmt.Errorf("expected enum symbol, got %T", v)
+	case arrayType:
+		xs, ok := v.([]interface{})
+		if !ok && v != nil {
+			return nil, fmt.Errorf("expected []interface{}, got %T", v)
+		}
+		if len(xs) > 0 {
+			buf = appendLong(buf, int64(len(xs)))
+			for _, x := range xs {
+				var err error
+				if buf, err = s.items.append(buf, x); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return appendLong(buf, 0), nil
+	case mapType:
+		m, ok := v.(map[string]interface{})
+		if !ok && v != nil {
+			return nil, fmt.Errorf("expected map[string]interface{}, got %T", v)
+		}
+		if len(m) > 0 {
+			buf = appendLong(buf, int64(len(m)))
+			for _, k := range sortedKeys(m) {
+				buf = appendBytes(buf, []byte(k))
+				var err error
+				if buf, err = s.items.append(buf, m[k]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return appendLong(buf, 0), nil
+	case recordType:
+		m, ok := v.(map[string]interface{})
+		if !ok && v != nil {
+			return nil, fmt.Errorf("expected map[string]interface{}, got %T", v)
+		}
+		for _, f := range s.fields {
+			var err error
+			if buf, err = f.type_.append(buf, m[f.name]); err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", s.name, f.name, err)
+			}
+		}
+		return buf, nil
+	case unionType:
+		// unions are always of null and another type
+		if v == nil {
+			return appendLong(buf, 0), nil
+		}
+		return s.branches[1].append(appendLong(buf, 1), v)
+	}
+	return nil, fmt.Errorf("unsupported type %s", s.type_)
+}
+
+// decimalBytes returns the unscaled value of a decimal as a big-endian two's
+// complement integer.
+func (s *schema) decimalBytes(r *big.Rat) ([]byte, error) {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(s.scale)), nil)))
+	if !scaled.IsInt() {
+		return nil, fmt.Errorf("decimal %s exceeds scale %d", r.RatString(), s.scale)
+	}
+	n := scaled.Num()
+	if len(new(big.Int).Abs(n).String()) > s.precision {
+		return nil, fmt.Errorf("decimal %s exceeds precision %d", r.RatString(), s.precision)
+	}
+	if n.Sign() >= 0 {
+		bs := n.Bytes()
+		if len(bs) == 0 || bs[0]&0x80 != 0 {
+			bs = append([]byte{0}, bs...)
+		}
+		return bs, nil
+	}
+	// two's complement: 2^(8*l) + n, for the smallest l that fits
+	l := (new(big.Int).Not(n).BitLen() + 8) / 8
+	c := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), uint(8*l)), n)
+	bs := c.Bytes()
+	for len(bs) < l {
+		bs = append([]byte{0xff}, bs...)
+	}
+	return bs, nil
+}
+
+func daysSinceEpoch(t time.Time) int64 {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), nil
+	case int32:
+		return int64(x), nil
+	case int64:
+		return x, nil
+	case nil:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("expected integer, got %T", v)
+}
+
+func appendLong(buf []byte, x int64) []byte {
+	// zig-zag encoding
+	var bs [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(bs[:], uint64(x<<1)^uint64(x>>63))
+	return append(buf, bs[:n]...)
+}
+
+func appendUint32(buf []byte, x uint32) []byte {
+	var bs [4]byte
+	binary.LittleEndian.PutUint32(bs[:], x)
+	return append(buf, bs[:]...)
+}
+
+func appendUint64(buf []byte, x uint64) []byte {
+	var bs [8]byte
+	binary.LittleEndian.PutUint64(bs[:], x)
+	return append(buf, bs[:]...)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+func appendBytes(buf []byte, bs []byte) []byte {
+	return append(appendLong(buf, int64(len(bs))), bs...)
+}
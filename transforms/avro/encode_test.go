@@ -0,0 +1,209 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package avro
+
+import (
+	"bytes"
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newRecord(t *testing.T, md protoreflect.MessageDescriptor, s string) *dynamicpb.Message {
+	m := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal([]byte(s), m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return m
+}
+
+const fullRecord = `{
+  "id": "-42",
+  "name": "foo",
+  "flag": true,
+  "ratio": 0.5,
+  "score": -1.25,
+  "count": -3,
+  "big": "18446744073709551615",
+  "data": "AQI=",
+  "status": "DELETED",
+  "tags": ["a", "", "b"],
+  "attrs": {"7": "seven"},
+  "children": [{"id": "1"}, {}],
+  "parent": {"name": "bar", "alias": ""},
+  "created": "2022-06-01T12:30:00.123456Z",
+  "day": {"year": 2022, "month": 6, "day": 1},
+  "amount": {"value": "-123.45"},
+  "alias": "baz"
+}`
+
+func TestRowConverter(t *testing.T) {
+	record := createRecordDescriptor(t)
+
+	cases := []struct {
+		input    string
+		expected map[string]interface{}
+		name     string
+	}{
+		{`{}`, map[string]interface{}{}, "empty"},
+		{
+			fullRecord,
+			map[string]interface{}{
+				"id":     int64(-42),
+				"name":   "foo",
+				"flag":   true,
+				"ratio":  float32(0.5),
+				"score":  -1.25,
+				"count":  int32(-3),
+				"big":    int64(-1),
+				"data":   []byte{1, 2},
+				"status": "DELETED",
+				"tags":   []interface{}{"a", "", "b"},
+				"attrs":  map[string]interface{}{"7": "seven"},
+				"children": []interface{}{
+					map[string]interface{}{"id": int64(1)},
+					map[string]interface{}{},
+				},
+				"parent":  map[string]interface{}{"name": "bar", "alias": ""},
+				"created": time.Date(2022, 6, 1, 12, 30, 0, 123456000, time.UTC),
+				"day":     time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC),
+				"amount":  big.NewRat(-12345, 100),
+				"alias":   "baz",
+			},
+			"full",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := NewRowConverter().Apply(newRecord(t, record, c.input))
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSchema_Append(t *testing.T) {
+	record := createRecordDescriptor(t)
+	schema := NewSchemaConverter().Apply(record)
+	codec, err := goavro.NewCodec(schema.String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		input    string
+		expected map[string]interface{}
+		name     string
+	}{
+		{
+			`{}`,
+			map[string]interface{}{"id": int64(0), "status": "UNKNOWN", "parent": nil, "alias": nil},
+			"empty",
+		},
+		{
+			fullRecord,
+			map[string]interface{}{
+				"id":      int64(-42),
+				"big":     int64(-1),
+				"status":  "DELETED",
+				"created": map[string]interface{}{"long.timestamp-micros": time.Date(2022, 6, 1, 12, 30, 0, 123456000, time.UTC)},
+				"day":     map[string]interface{}{"int.date": time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)},
+				"amount":  map[string]interface{}{"bytes.decimal": big.NewRat(-12345, 100)},
+				"alias":   map[string]interface{}{"string": "baz"},
+			},
+			"full",
+		},
+		{
+			`{"status": "ENABLED", "amount": {"value": "-1.28"}}`,
+			map[string]interface{}{
+				"status": "ACTIVE",
+				"amount": map[string]interface{}{"bytes.decimal": big.NewRat(-128, 100)},
+			},
+			"alias and negative byte boundary",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := schema.Append(nil, NewRowConverter().Apply(newRecord(t, record, c.input)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			native, rest, err := codec.NativeFromBinary(actual)
+			if err != nil {
+				t.Fatalf("%s: could not decode: %v", c.name, err)
+			}
+			if len(rest) > 0 {
+				t.Errorf("%s: %d bytes left after decoding", c.name, len(rest))
+			}
+			decoded := native.(map[string]interface{})
+			for k, e := range c.expected {
+				if a := decoded[k]; !equalNative(a, e) {
+					t.Errorf("%s: %s: \nexpected %v, \ngot      %v", c.name, k, e, a)
+				}
+			}
+			// the re-encoded record must be identical
+			expected, err := codec.BinaryFromNative(nil, native)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(actual, expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, expected, actual)
+			}
+		})
+	}
+}
+
+func equalNative(a, e interface{}) bool {
+	switch x := e.(type) {
+	case *big.Rat:
+		y, ok := a.(*big.Rat)
+		return ok && x.Cmp(y) == 0
+	case time.Time:
+		y, ok := a.(time.Time)
+		return ok && x.Equal(y)
+	case map[string]interface{}:
+		y, ok := a.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k := range x {
+			if !equalNative(y[k], x[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, e)
+}
+
+func TestSchema_Append_Errors(t *testing.T) {
+	record := createRecordDescriptor(t)
+	schema := NewSchemaConverter(OptionDecimal(4, 1)).Apply(record)
+
+	cases := []struct {
+		input map[string]interface{}
+		name  string
+	}{
+		{map[string]interface{}{"amount": big.NewRat(1, 100)}, "exceeds scale"},
+		{map[string]interface{}{"amount": big.NewRat(12345, 1)}, "exceeds precision"},
+		{map[string]interface{}{"status": "FOO"}, "unknown symbol"},
+		{map[string]interface{}{"count": int64(1 << 40)}, "out of range"},
+		{map[string]interface{}{"name": 1}, "wrong type"},
+		{NewRowConverter().Apply(newRecord(t, record, `{"status": 99}`)), "unknown enum value"},
+		{NewRowConverter().Apply(newRecord(t, record, `{"amount": {"value": "1.2.3"}}`)), "invalid decimal"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := schema.Append(nil, c.input); err == nil {
+				t.Errorf("%s: expected error", c.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+module github.com/HayoVanLoon/go-proto/transforms/avro
+
+go 1.18
+
+require (
+	github.com/HayoVanLoon/go-proto/transforms v0.1.0
+	github.com/linkedin/goavro/v2 v2.11.1
+	google.golang.org/protobuf v1.28.0
+)
+
+require github.com/golang/snappy v0.0.1 // indirect
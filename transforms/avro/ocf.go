@@ -0,0 +1,136 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package avro
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"io"
+)
+
+// Codec is a compression codec for Object Container File blocks.
+type Codec string
+
+const (
+	CodecNull    = Codec("null")
+	CodecDeflate = Codec("deflate")
+)
+
+const defaultBlockSize = 100
+
+var magic = []byte{'O', 'b', 'j', 1}
+
+// An OCFWriter writes messages to an Avro Object Container File. It is not
+// safe for concurrent use.
+type OCFWriter struct {
+	w         io.Writer
+	schema    *Schema
+	converter RowConverter
+	codec     Codec
+	blockSize int
+	sync      [16]byte
+
+	block []byte
+	count int
+	err   error
+}
+
+// NewOCFWriter creates a new OCFWriter for messages of the schema's type and
+// writes the file header. Records are collected in blocks of blockSize records,
+// or 100 if blockSize is not positive.
+func NewOCFWriter(w io.Writer, schema *Schema, codec Codec, blockSize int) (*OCFWriter, error) {
+	if codec != CodecNull && codec != CodecDeflate {
+		return nil, fmt.Errorf("unsupported codec %q", codec)
+	}
+	if blockSize <= 0 {
+		blockSize = defaultBlockSize
+	}
+	ow := &OCFWriter{
+		w:         w,
+		schema:    schema,
+		converter: NewRowConverter(),
+		codec:     codec,
+		blockSize: blockSize,
+	}
+	if _, err := rand.Read(ow.sync[:]); err != nil {
+		return nil, err
+	}
+
+	buf := append([]byte{}, magic...)
+	buf = appendLong(buf, 2)
+	buf = appendBytes(buf, []byte("avro.schema"))
+	buf = appendBytes(buf, []byte(schema.String()))
+	buf = appendBytes(buf, []byte("avro.codec"))
+	buf = appendBytes(buf, []byte(codec))
+	buf = appendLong(buf, 0)
+	buf = append(buf, ow.sync[:]...)
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+	return ow, nil
+}
+
+// Write adds a message to the current block, flushing the block when it is
+// full. A message that cannot be encoded is left out; the error is returned
+// and the writer remains usable.
+func (ow *OCFWriter) Write(m proto.Message) error {
+	if ow.err != nil {
+		return ow.err
+	}
+	block, err := ow.schema.Append(ow.block, ow.converter.Apply(m))
+	if err != nil {
+		// the block keeps its length, dropping any partially encoded record
+		return err
+	}
+	ow.block = block
+	ow.count += 1
+	if ow.count >= ow.blockSize {
+		return ow.Flush()
+	}
+	return nil
+}
+
+// Flush writes the current block, if it holds any records.
+func (ow *OCFWriter) Flush() error {
+	if ow.err != nil || ow.count == 0 {
+		return ow.err
+	}
+	data := ow.block
+	if ow.codec == CodecDeflate {
+		b := &bytes.Buffer{}
+		fw, err := flate.NewWriter(b, flate.DefaultCompression)
+		if err != nil {
+			ow.err = err
+			return err
+		}
+		if _, err := fw.Write(data); err != nil {
+			ow.err = err
+			return err
+		}
+		if err := fw.Close(); err != nil {
+			ow.err = err
+			return err
+		}
+		data = b.Bytes()
+	}
+	buf := appendLong(nil, int64(ow.count))
+	buf = appendBytes(buf, data)
+	buf = append(buf, ow.sync[:]...)
+	if _, ow.err = ow.w.Write(buf); ow.err != nil {
+		return ow.err
+	}
+	ow.block = ow.block[:0]
+	ow.count = 0
+	return nil
+}
+
+// Close flushes any remaining records. It does not close the underlying
+// writer.
+func (ow *OCFWriter) Close() error {
+	return ow.Flush()
+}
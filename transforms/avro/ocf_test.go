@@ -0,0 +1,112 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package avro
+
+import (
+	"bytes"
+	"github.com/linkedin/goavro/v2"
+	"testing"
+)
+
+func TestOCFWriter(t *testing.T) {
+	record := createRecordDescriptor(t)
+	schema := NewSchemaConverter().Apply(record)
+	inputs := []string{fullRecord, `{}`, `{"id": "3", "tags": ["x"]}`}
+
+	cases := []struct {
+		codec     Codec
+		blockSize int
+		name      string
+	}{
+		{CodecNull, 0, "null codec"},
+		{CodecDeflate, 0, "deflate codec"},
+		{CodecDeflate, 2, "multiple blocks"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w, err := NewOCFWriter(buf, schema, c.codec, c.blockSize)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, s := range inputs {
+				if err := w.Write(newRecord(t, record, s)); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			r, err := goavro.NewOCFReader(buf)
+			if err != nil {
+				t.Fatalf("%s: could not read: %v", c.name, err)
+			}
+			if actual := r.CompressionName(); actual != string(c.codec) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.codec, actual)
+			}
+			var ids []interface{}
+			for r.Scan() {
+				x, err := r.Read()
+				if err != nil {
+					t.Fatalf("%s: could not read: %v", c.name, err)
+				}
+				ids = append(ids, x.(map[string]interface{})["id"])
+			}
+			if err := r.Err(); err != nil {
+				t.Fatalf("%s: could not read: %v", c.name, err)
+			}
+			expected := []interface{}{int64(-42), int64(0), int64(3)}
+			if !equalNative(map[string]interface{}{"ids": ids}, map[string]interface{}{"ids": expected}) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, expected, ids)
+			}
+		})
+	}
+}
+
+func TestOCFWriter_Write_Error(t *testing.T) {
+	record := createRecordDescriptor(t)
+	schema := NewSchemaConverter().Apply(record)
+	buf := &bytes.Buffer{}
+	w, err := NewOCFWriter(buf, schema, CodecNull, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, s := range []string{`{"id": "1"}`, `{"id": "2", "status": 99}`, `{"id": "3"}`} {
+		err := w.Write(newRecord(t, record, s))
+		if expectErr := s == `{"id": "2", "status": 99}`; (err != nil) != expectErr {
+			t.Fatalf("%s: unexpected error: %v", s, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r, err := goavro.NewOCFReader(buf)
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	var ids []interface{}
+	for r.Scan() {
+		x, err := r.Read()
+		if err != nil {
+			t.Fatalf("could not read: %v", err)
+		}
+		ids = append(ids, x.(map[string]interface{})["id"])
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	expected := []interface{}{int64(1), int64(3)}
+	if !equalNative(map[string]interface{}{"ids": ids}, map[string]interface{}{"ids": expected}) {
+		t.Errorf("\nexpected %v, \ngot      %v", expected, ids)
+	}
+}
+
+func TestNewOCFWriter_UnsupportedCodec(t *testing.T) {
+	schema := NewSchemaConverter().Apply(createRecordDescriptor(t))
+	if _, err := NewOCFWriter(&bytes.Buffer{}, schema, Codec("snappy"), 0); err == nil {
+		t.Errorf("expected error")
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package avro converts message descriptors into Avro schemas and messages
+// into Avro binary data and Object Container Files.
+//
+// Messages map to records, named after their full names. Repeated fields map
+// to arrays and map fields to maps; map keys are formatted as strings. Enums
+// map to enums, with a symbol per distinct number. Fields that track presence
+// (message fields, oneof members and optional fields) are unions of null and
+// their type, with a default of null.
+//
+// Integers map to int or long, depending on their size. Unsigned 64-bit
+// integers are stored as long, so values beyond the range of int64 wrap
+// around.
+//
+// The following types map to logical types:
+//
+//	google.protobuf.Timestamp  long, timestamp-micros
+//	google.type.Date           int, date
+//	google.type.Decimal        bytes, decimal (see OptionDecimal)
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+)
+
+const (
+	timestampName = "google.protobuf.Timestamp"
+	dateName      = "google.type.Date"
+	decimalName   = "google.type.Decimal"
+
+	defaultPrecision = 38
+	defaultScale     = 9
+)
+
+type schemaType string
+
+const (
+	nullType    = schemaType("null")
+	booleanType = schemaType("boolean")
+	intType     = schemaType("int")
+	longType    = schemaType("long")
+	floatType   = schemaType("float")
+	doubleType  = schemaType("double")
+	bytesType   = schemaType("bytes")
+	stringType  = schemaType("string")
+	recordType  = schemaType("record")
+	enumType    = schemaType("enum")
+	arrayType   = schemaType("array")
+	mapType     = schemaType("map")
+	unionType   = schemaType("union")
+	// refType is a placeholder for a record that has yet to be resolved
+	refType = schemaType("ref")
+)
+
+// A schema is a node in an Avro schema. Records may refer to themselves.
+type schema struct {
+	type_ schemaType
+	// name is the full name of records and enums
+	name string
+
+	fields []*recordField
+	// symbols and indices are the symbols of an enum and their indices per
+	// enum number
+	symbols []string
+	indices map[protoreflect.EnumNumber]int
+	// items holds the type of array items and map values
+	items *schema
+	// branches holds the types of a union
+	branches []*schema
+
+	logicalType string
+	precision   int
+	scale       int
+
+	md protoreflect.MessageDescriptor
+}
+
+type recordField struct {
+	name     string
+	type_    *schema
+	nullable bool
+}
+
+// A Schema is the Avro schema for a message type.
+type Schema struct {
+	root *schema
+}
+
+// MarshalJSON returns the schema in its JSON form. Named types are defined
+// at their first occurrence and referred to by name afterwards.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.root.toJSON(map[string]bool{}))
+}
+
+// String returns the schema in its JSON form.
+func (s *Schema) String() string {
+	bs, err := s.MarshalJSON()
+	if err != nil {
+		panic(err)
+	}
+	return string(bs)
+}
+
+func (s *schema) toJSON(defined map[string]bool) interface{} {
+	switch s.type_ {
+	case recordType:
+		if defined[s.name] {
+			return s.name
+		}
+		defined[s.name] = true
+		fs := make([]interface{}, len(s.fields))
+		for i, f := range s.fields {
+			x := map[string]interface{}{"name": f.name, "type": f.type_.toJSON(defined)}
+			if f.nullable {
+				x["default"] = nil
+			}
+			fs[i] = x
+		}
+		name, namespace := splitName(s.name)
+		return map[string]interface{}{
+			"type":      "record",
+			"name":      name,
+			"namespace": namespace,
+			"fields":    fs,
+		}
+	case enumType:
+		if defined[s.name] {
+			return s.name
+		}
+		defined[s.name] = true
+		name, namespace := splitName(s.name)
+		return map[string]interface{}{
+			"type":      "enum",
+			"name":      name,
+			"namespace": namespace,
+			"symbols":   s.symbols,
+		}
+	case arrayType:
+		return map[string]interface{}{"type": "array", "items": s.items.toJSON(defined)}
+	case mapType:
+		return map[string]interface{}{"type": "map", "values": s.items.toJSON(defined)}
+	case unionType:
+		bs := make([]interface{}, len(s.branches))
+		for i, b := range s.branches {
+			bs[i] = b.toJSON(defined)
+		}
+		return bs
+	}
+	if s.logicalType == "" {
+		return string(s.type_)
+	}
+	x := map[string]interface{}{"type": string(s.type_), "logicalType": s.logicalType}
+	if s.logicalType == "decimal" {
+		x["precision"] = s.precision
+		x["scale"] = s.scale
+	}
+	return x
+}
+
+func splitName(fullName string) (string, string) {
+	i := strings.LastIndexByte(fullName, '.')
+	if i < 0 {
+		return fullName, ""
+	}
+	return fullName[i+1:], fullName[:i]
+}
+
+type config struct {
+	precision int
+	scale     int
+}
+
+type Option interface {
+	// Apply applies the Option to the converter.
+	Apply(c *config)
+}
+
+type optionDecimal struct {
+	precision int
+	scale     int
+}
+
+func (o *optionDecimal) Apply(c *config) {
+	c.precision = o.precision
+	c.scale = o.scale
+}
+
+// OptionDecimal sets the precision and scale of google.type.Decimal values.
+// Defaults to a precision of 38 and a scale of 9.
+func OptionDecimal(precision, scale int) Option {
+	if precision < 1 || scale < 0 || scale > precision {
+		panic(fmt.Sprintf("invalid precision and scale: %d, %d", precision, scale))
+	}
+	return &optionDecimal{precision: precision, scale: scale}
+}
+
+func newConfig(options []Option) *config {
+	c := &config{precision: defaultPrecision, scale: defaultScale}
+	for _, o := range options {
+		o.Apply(c)
+	}
+	return c
+}
+
+// A SchemaConverter converts message descriptors into Avro schemas. It is safe
+// for concurrent use by multiple goroutines.
+type SchemaConverter interface {
+	Apply(md protoreflect.MessageDescriptor) *Schema
+}
+
+type schemaConverter struct {
+	config *config
+}
+
+// NewSchemaConverter creates a new SchemaConverter.
+func NewSchemaConverter(options ...Option) SchemaConverter {
+	sc := &schemaConverter{config: newConfig(options)}
+	return sc
+}
+
+// fieldSchema returns the schema of a field, disregarding whether it is
+// nullable.
+func (sc *schemaConverter) fieldSchema(fd protoreflect.FieldDescriptor) *schema {
+	switch {
+	case fd.IsMap():
+		return &schema{type_: mapType, items: sc.valueSchema(fd.MapValue())}
+	case fd.IsList():
+		return &schema{type_: arrayType, items: sc.valueSchema(fd)}
+	}
+	return sc.valueSchema(fd)
+}
+
+// valueSchema returns the schema for a single value of a field, disregarding
+// whether it is repeated or nullable.
+func (sc *schemaConverter) valueSchema(fd protoreflect.FieldDescriptor) *schema {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return &schema{type_: booleanType}
+	case protoreflect.EnumKind:
+		return enumSchema(fd.Enum())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return &schema{type_: intType}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return &schema{type_: longType}
+	case protoreflect.FloatKind:
+		return &schema{type_: floatType}
+	case protoreflect.DoubleKind:
+		return &schema{type_: doubleType}
+	case protoreflect.StringKind:
+		return &schema{type_: stringType}
+	case protoreflect.BytesKind:
+		return &schema{type_: bytesType}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		switch fd.Message().FullName() {
+		case timestampName:
+			return &schema{type_: longType, logicalType: "timestamp-micros"}
+		case dateName:
+			return &schema{type_: intType, logicalType: "date"}
+		case decimalName:
+			return &schema{type_: bytesType, logicalType: "decimal", precision: sc.config.precision, scale: sc.config.scale}
+		}
+		return &schema{type_: refType, name: string(fd.Message().FullName()), md: fd.Message()}
+	default:
+		panic(fmt.Sprintf("unsupported type %v", fd.Kind()))
+	}
+}
+
+func enumSchema(ed protoreflect.EnumDescriptor) *schema {
+	s := &schema{type_: enumType, name: string(ed.FullName()), indices: map[protoreflect.EnumNumber]int{}}
+	for i := 0; i < ed.Values().Len(); i += 1 {
+		v := ed.Values().Get(i)
+		// aliases share their number
+		if _, ok := s.indices[v.Number()]; !ok {
+			s.indices[v.Number()] = len(s.symbols)
+			s.symbols = append(s.symbols, string(v.Name()))
+		}
+	}
+	return s
+}
+
+func (sc *schemaConverter) Apply(md protoreflect.MessageDescriptor) *Schema {
+	return &Schema{root: sc.record(md, map[string]*schema{})}
+}
+
+// record creates the schema for a message type, resolving references to other
+// records. Records are shared by full name.
+func (sc *schemaConverter) record(md protoreflect.MessageDescriptor, records map[string]*schema) *schema {
+	s := &schema{type_: recordType, name: string(md.FullName())}
+	records[s.name] = s
+	for _, fd := range transforms.DescriptorFields(md) {
+		f := &recordField{name: string(fd.Name()), type_: sc.resolve(sc.fieldSchema(fd), records)}
+		if fd.HasPresence() && !fd.IsList() && !fd.IsMap() {
+			f.nullable = true
+			f.type_ = &schema{type_: unionType, branches: []*schema{{type_: nullType}, f.type_}}
+		}
+		s.fields = append(s.fields, f)
+	}
+	return s
+}
+
+func (sc *schemaConverter) resolve(s *schema, records map[string]*schema) *schema {
+	switch s.type_ {
+	case refType:
+		if r, ok := records[s.name]; ok {
+			return r
+		}
+		return sc.record(s.md, records)
+	case arrayType, mapType:
+		s.items = sc.resolve(s.items, records)
+	}
+	return s
+}
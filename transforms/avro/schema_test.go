@@ -0,0 +1,224 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package avro
+
+import (
+	"encoding/json"
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"reflect"
+	"testing"
+)
+
+const (
+	optional = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	repeated = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+)
+
+func field(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, type_ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+	f := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    label.Enum(),
+		Type:     type_.Enum(),
+	}
+	if typeName != "" {
+		f.TypeName = proto.String(typeName)
+	}
+	return f
+}
+
+// createRecordDescriptor creates a recursive message type, with all scalar
+// kinds, repeated fields, maps, enums, a oneof and logical types.
+func createRecordDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	files := &protoregistry.Files{}
+	if err := files.RegisterFile(timestamppb.File_google_protobuf_timestamp_proto); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, f := range []*descriptorpb.FileDescriptorProto{
+		{
+			Name:    proto.String("google/type/date.proto"),
+			Package: proto.String("google.type"),
+			Syntax:  proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Date"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("year", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+					field("month", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+					field("day", 3, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+				},
+			}},
+		},
+		{
+			Name:    proto.String("google/type/decimal.proto"),
+			Package: proto.String("google.type"),
+			Syntax:  proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Decimal"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("value", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				},
+			}},
+		},
+	} {
+		fd, err := protodesc.NewFile(f, files)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := files.RegisterFile(fd); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	alias := field("alias", 17, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	alias.OneofIndex = proto.Int32(0)
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("record.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		Dependency: []string{
+			"google/protobuf/timestamp.proto",
+			"google/type/date.proto",
+			"google/type/decimal.proto",
+		},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Record"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+				field("name", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("flag", 3, optional, descriptorpb.FieldDescriptorProto_TYPE_BOOL, ""),
+				field("ratio", 4, optional, descriptorpb.FieldDescriptorProto_TYPE_FLOAT, ""),
+				field("score", 5, optional, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+				field("count", 6, optional, descriptorpb.FieldDescriptorProto_TYPE_SINT32, ""),
+				field("big", 7, optional, descriptorpb.FieldDescriptorProto_TYPE_UINT64, ""),
+				field("data", 8, optional, descriptorpb.FieldDescriptorProto_TYPE_BYTES, ""),
+				field("status", 9, optional, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".test.Status"),
+				field("tags", 10, repeated, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("attrs", 11, repeated, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Record.AttrsEntry"),
+				field("children", 12, repeated, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Record"),
+				field("parent", 13, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Record"),
+				field("created", 14, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+				field("day", 15, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.type.Date"),
+				field("amount", 16, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.type.Decimal"),
+				alias,
+			},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("AttrsEntry"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("key", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+					field("value", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				},
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+			}},
+			OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("choice")}},
+		}},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name:    proto.String("Status"),
+			Options: &descriptorpb.EnumOptions{AllowAlias: proto.Bool(true)},
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("ACTIVE"), Number: proto.Int32(1)},
+				{Name: proto.String("ENABLED"), Number: proto.Int32(1)},
+				{Name: proto.String("DELETED"), Number: proto.Int32(3)},
+			},
+		}},
+	}, files)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return fd.Messages().ByName("Record")
+}
+
+const recordSchema = `{
+  "type": "record",
+  "name": "Record",
+  "namespace": "test",
+  "fields": [
+    {"name": "id", "type": "long"},
+    {"name": "name", "type": "string"},
+    {"name": "flag", "type": "boolean"},
+    {"name": "ratio", "type": "float"},
+    {"name": "score", "type": "double"},
+    {"name": "count", "type": "int"},
+    {"name": "big", "type": "long"},
+    {"name": "data", "type": "bytes"},
+    {"name": "status", "type": {
+      "type": "enum",
+      "name": "Status",
+      "namespace": "test",
+      "symbols": ["UNKNOWN", "ACTIVE", "DELETED"]
+    }},
+    {"name": "tags", "type": {"type": "array", "items": "string"}},
+    {"name": "attrs", "type": {"type": "map", "values": "string"}},
+    {"name": "children", "type": {"type": "array", "items": "test.Record"}},
+    {"name": "parent", "type": ["null", "test.Record"], "default": null},
+    {"name": "created", "type": ["null", {"type": "long", "logicalType": "timestamp-micros"}], "default": null},
+    {"name": "day", "type": ["null", {"type": "int", "logicalType": "date"}], "default": null},
+    {"name": "amount", "type": ["null", {"type": "bytes", "logicalType": "decimal", "precision": 38, "scale": 9}], "default": null},
+    {"name": "alias", "type": ["null", "string"], "default": null}
+  ]
+}`
+
+func TestSchemaConverter(t *testing.T) {
+	record := createRecordDescriptor(t)
+
+	cases := []struct {
+		converter SchemaConverter
+		input     protoreflect.MessageDescriptor
+		expected  string
+		name      string
+	}{
+		{
+			NewSchemaConverter(),
+			record,
+			recordSchema,
+			"record",
+		},
+		{
+			NewSchemaConverter(OptionDecimal(10, 2)),
+			record.Fields().ByName("amount").Message(),
+			`{"type": "record", "name": "Decimal", "namespace": "google.type", "fields": [{"name": "value", "type": "string"}]}`,
+			"logical type as root",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := c.converter.Apply(c.input)
+			var actual, expected interface{}
+			if err := json.Unmarshal([]byte(s.String()), &actual); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := json.Unmarshal([]byte(c.expected), &expected); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, expected, actual)
+			}
+			if _, err := goavro.NewCodec(s.String()); err != nil {
+				t.Errorf("%s: invalid schema: %v", c.name, err)
+			}
+		})
+	}
+}
+
+func TestOptionDecimal(t *testing.T) {
+	record := createRecordDescriptor(t)
+	s := NewSchemaConverter(OptionDecimal(10, 2)).Apply(record)
+	var actual map[string]interface{}
+	if err := json.Unmarshal([]byte(s.String()), &actual); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fs := actual["fields"].([]interface{})
+	amount := fs[15].(map[string]interface{})["type"].([]interface{})[1]
+	expected := map[string]interface{}{"type": "bytes", "logicalType": "decimal", "precision": 10.0, "scale": 2.0}
+	if !reflect.DeepEqual(amount, expected) {
+		t.Errorf("expected %v, \ngot      %v", expected, amount)
+	}
+}
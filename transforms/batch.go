@@ -0,0 +1,146 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package transforms
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"runtime"
+	"sync"
+)
+
+// A Result holds the outcome of converting one message of a batch.
+type Result struct {
+	// Index is the position of the message in the input.
+	Index int
+	Value interface{}
+	Err   error
+}
+
+type job struct {
+	index int
+	m     proto.Message
+	out   chan<- Result
+}
+
+func workerCount(workers int) int {
+	if workers < 1 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return workers
+}
+
+// convert applies fn to m. An error returned by fn is wrapped in the Result's
+// error, as is a panic during conversion.
+func convert(fn BatchFunc, index int, m proto.Message) (r Result) {
+	r.Index = index
+	defer func() {
+		if x := recover(); x != nil {
+			r.Value = nil
+			r.Err = fmt.Errorf("error converting message %d: %v", index, x)
+		}
+	}()
+	v, err := fn(m)
+	if err != nil {
+		r.Err = fmt.Errorf("error converting message %d: %w", index, err)
+		return r
+	}
+	r.Value = v
+	return r
+}
+
+// A BatchFunc converts a single message of a batch.
+type BatchFunc func(m proto.Message) (interface{}, error)
+
+// walkerFunc returns the BatchFunc for a Walker.
+func walkerFunc(w Walker) BatchFunc {
+	return func(m proto.Message) (interface{}, error) {
+		return w.Apply(m), nil
+	}
+}
+
+// ApplyBatch applies the Walker to a batch of messages, using the given number
+// of goroutines. If workers is less than one, runtime.GOMAXPROCS(0) goroutines
+// are used.
+//
+// The results are in the same order as the input. A failure to convert one
+// message does not affect the others; it is reported in the Err field of that
+// message's Result.
+func ApplyBatch(w Walker, ms []proto.Message, workers int) []Result {
+	return ApplyBatchFunc(walkerFunc(w), ms, workers)
+}
+
+// ApplyBatchFunc is like ApplyBatch, but with a custom conversion function.
+// This function will be called from multiple goroutines. The errors it returns
+// are wrapped in the Err field of the message's Result.
+func ApplyBatchFunc(fn BatchFunc, ms []proto.Message, workers int) []Result {
+	results := make([]Result, len(ms))
+	indices := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := workerCount(workers); i > 0; i -= 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range indices {
+				results[j] = convert(fn, j, ms[j])
+			}
+		}()
+	}
+	for i := range ms {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return results
+}
+
+// ApplyChan applies the Walker to all messages received from a channel, using
+// the given number of goroutines. If workers is less than one,
+// runtime.GOMAXPROCS(0) goroutines are used.
+//
+// The results are sent on the returned channel in the same order as the
+// messages were received. The channel is closed after the input channel has
+// been closed and all of its messages have been processed. The caller must
+// receive all results; otherwise, the goroutines of the conversion will leak.
+func ApplyChan(w Walker, in <-chan proto.Message, workers int) <-chan Result {
+	return ApplyChanFunc(walkerFunc(w), in, workers)
+}
+
+// ApplyChanFunc is like ApplyChan, but with a custom conversion function. This
+// function will be called from multiple goroutines. The errors it returns are
+// wrapped in the Err field of the message's Result.
+func ApplyChanFunc(fn BatchFunc, in <-chan proto.Message, workers int) <-chan Result {
+	workers = workerCount(workers)
+	jobs := make(chan job, workers)
+	// pending holds the result channels in input order
+	pending := make(chan chan Result, workers)
+	out := make(chan Result, workers)
+
+	go func() {
+		i := 0
+		for m := range in {
+			c := make(chan Result, 1)
+			pending <- c
+			jobs <- job{index: i, m: m, out: c}
+			i += 1
+		}
+		close(jobs)
+		close(pending)
+	}()
+	for i := 0; i < workers; i += 1 {
+		go func() {
+			for j := range jobs {
+				j.out <- convert(fn, j.index, j.m)
+			}
+		}()
+	}
+	go func() {
+		for c := range pending {
+			out <- <-c
+		}
+		close(out)
+	}()
+	return out
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package transforms
+
+import (
+	"errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"reflect"
+	"testing"
+)
+
+func createBatch(n int) []proto.Message {
+	ms := make([]proto.Message, n)
+	for i := range ms {
+		ms[i] = &timestamppb.Timestamp{Seconds: int64(i) + 1}
+	}
+	return ms
+}
+
+func TestApplyBatch(t *testing.T) {
+	walker := NewWalker(OptionAddNameOverride(
+		"seconds",
+		func(_ protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+			if v.Int() == 13 {
+				panic("unlucky")
+			}
+			return v.Int()
+		},
+	))
+
+	cases := []struct {
+		workers int
+		name    string
+	}{
+		{1, "single worker"},
+		{4, "multiple workers"},
+		{0, "default workers"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ms := createBatch(100)
+			actual := ApplyBatch(walker, ms, c.workers)
+			if len(actual) != len(ms) {
+				t.Fatalf("expected %d results, got %d", len(ms), len(actual))
+			}
+			for i, r := range actual {
+				if r.Index != i {
+					t.Errorf("expected index %d, got %d", i, r.Index)
+				}
+				if i == 12 {
+					if r.Err == nil || r.Value != nil {
+						t.Errorf("expected error for item %d, got %v", i, r)
+					}
+					continue
+				}
+				expected := map[string]interface{}{"seconds": int64(i) + 1}
+				if r.Err != nil || !reflect.DeepEqual(r.Value, expected) {
+					t.Errorf("expected %v, got %v", expected, r)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyBatchFunc_Error(t *testing.T) {
+	unlucky := errors.New("unlucky")
+	fn := func(m proto.Message) (interface{}, error) {
+		if s := m.(*timestamppb.Timestamp).Seconds; s != 13 {
+			return s, nil
+		}
+		return nil, unlucky
+	}
+	for i, r := range ApplyBatchFunc(fn, createBatch(20), 4) {
+		if i == 12 {
+			if !errors.Is(r.Err, unlucky) || r.Value != nil {
+				t.Errorf("expected wrapped error for item %d, got %v", i, r)
+			}
+			continue
+		}
+		if expected := int64(i) + 1; r.Err != nil || r.Value != expected {
+			t.Errorf("expected %v, got %v", expected, r)
+		}
+	}
+}
+
+func TestApplyChan(t *testing.T) {
+	walker := NewWalker()
+
+	cases := []struct {
+		workers int
+		name    string
+	}{
+		{1, "single worker"},
+		{4, "multiple workers"},
+		{0, "default workers"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ms := createBatch(100)
+			ms[12] = nil
+
+			in := make(chan proto.Message)
+			go func() {
+				for _, m := range ms {
+					in <- m
+				}
+				close(in)
+			}()
+
+			i := 0
+			for r := range ApplyChan(walker, in, c.workers) {
+				if r.Index != i {
+					t.Errorf("expected index %d, got %d", i, r.Index)
+				}
+				if i == 12 {
+					if r.Err == nil {
+						t.Errorf("expected error for item %d, got %v", i, r)
+					}
+				} else {
+					expected := map[string]interface{}{"seconds": int64(i) + 1}
+					if r.Err != nil || !reflect.DeepEqual(r.Value, expected) {
+						t.Errorf("expected %v, got %v", expected, r)
+					}
+				}
+				i += 1
+			}
+			if i != len(ms) {
+				t.Errorf("expected %d results, got %d", len(ms), i)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package beam converts message descriptors into Apache Beam schemas and
+// messages into Beam rows, for pipelines using the Go SDK.
+//
+// The type mapping follows that of the bigquery package: integers and enums
+// map to INT64, floating point numbers to DOUBLE, and maps to arrays of rows
+// with a 'key' and a 'value' field. Unsigned 64-bit integers beyond the range
+// of INT64 wrap around. Messages map to nested rows and
+// google.protobuf.Timestamp to the Go SDK's time.Time logical type.
+//
+// Fields that track presence (message fields, oneof members and optional
+// fields) are nullable. Message fields beyond the maximum depth (see
+// OptionMaxDepth) are left out.
+package beam
+
+import (
+	"fmt"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	timestampName = "google.protobuf.Timestamp"
+
+	defaultMaxDepth = 10
+)
+
+// GetBeamType returns the Beam type for the values of a scalar field.
+func GetBeamType(fd protoreflect.FieldDescriptor) pipepb.AtomicType {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return pipepb.AtomicType_BOOLEAN
+	case protoreflect.EnumKind, protoreflect.Int32Kind, protoreflect.Int64Kind,
+		protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+		protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Uint64Kind,
+		protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		return pipepb.AtomicType_INT64
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return pipepb.AtomicType_DOUBLE
+	case protoreflect.StringKind:
+		return pipepb.AtomicType_STRING
+	case protoreflect.BytesKind:
+		return pipepb.AtomicType_BYTES
+	default:
+		panic(fmt.Sprintf("unsupported type %v", fd.Kind()))
+	}
+}
+
+type config struct {
+	maxDepth int
+}
+
+type Option interface {
+	// Apply applies the Option to the converter.
+	Apply(c *config)
+}
+
+type optionMaxDepth struct {
+	value int
+}
+
+func (o *optionMaxDepth) Apply(c *config) {
+	c.maxDepth = o.value
+}
+
+// OptionMaxDepth sets a maximum message recursion depth. Message fields beyond
+// it are left out. Defaults to 10. See transforms.OptionMaxDepth.
+func OptionMaxDepth(v int) Option {
+	return &optionMaxDepth{value: v}
+}
+
+func newConfig(options []Option) *config {
+	c := &config{maxDepth: defaultMaxDepth}
+	for _, o := range options {
+		o.Apply(c)
+	}
+	return c
+}
@@ -0,0 +1,20 @@
+module github.com/HayoVanLoon/go-proto/transforms/beam
+
+go 1.18
+
+require (
+	github.com/HayoVanLoon/go-proto/transforms v0.1.0
+	github.com/apache/beam/sdks/v2 v2.40.0
+	google.golang.org/protobuf v1.28.0
+)
+
+require (
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/google/uuid v1.3.0 // indirect
+	golang.org/x/net v0.0.0-20220607020251-c690dde0001d // indirect
+	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
+	golang.org/x/text v0.3.7 // indirect
+	google.golang.org/genproto v0.0.0-20220602131408-e326c6e8e9c8 // indirect
+	google.golang.org/grpc v1.47.0 // indirect
+)
+
@@ -0,0 +1,211 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package beam
+
+import (
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx/schema"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// A RowConverter converts messages into Beam rows. It is safe for concurrent
+// use by multiple goroutines.
+//
+// Rows are values of the struct type that the Go SDK derives from the
+// schema of the message type (see schema.ToType). Nullable fields are
+// pointers, arrays are slices and timestamps are time.Time values.
+type RowConverter interface {
+	// Type returns the Go type of the rows of a message type. Register it
+	// with beam.RegisterType before constructing a pipeline.
+	Type(md protoreflect.MessageDescriptor) reflect.Type
+	Apply(m proto.Message) (interface{}, error)
+}
+
+type rowConverter struct {
+	r      *resolver
+	walker transforms.Walker
+	types  sync.Map
+}
+
+// rowInfo holds the nodes and Go type for a message type.
+type rowInfo struct {
+	nodes []*node
+	typ   reflect.Type
+}
+
+// NewRowConverter creates a new RowConverter.
+func NewRowConverter(options ...Option) RowConverter {
+	c := newConfig(options)
+	return &rowConverter{
+		r: newResolver(c),
+		walker: transforms.NewWalker(
+			transforms.OptionKeepSet(true),
+			transforms.OptionMaxDepth(c.maxDepth),
+			transforms.OptionDefaultScalarFunc(convertRowScalar),
+			transforms.OptionMapStrategy(transforms.MapEntries),
+			transforms.OptionAddTypeOverride(timestampName, convertRowTimestamp),
+		),
+	}
+}
+
+// ApplyBatch converts a batch of messages into rows, using the given number of
+// goroutines. See transforms.ApplyBatch.
+func ApplyBatch(rc RowConverter, ms []proto.Message, workers int) []transforms.Result {
+	return transforms.ApplyBatchFunc(func(m proto.Message) (interface{}, error) {
+		return rc.Apply(m)
+	}, ms, workers)
+}
+
+func convertRowScalar(fd protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		return int64(v.Enum())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return v.Int()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return int64(v.Uint())
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return v.Float()
+	}
+	return v.Interface()
+}
+
+func convertRowTimestamp(_ protoreflect.FieldDescriptor, kvs []transforms.KeyValue) interface{} {
+	seconds, nanos := int64(0), int64(0)
+	for _, kv := range kvs {
+		switch kv.Key {
+		case "seconds":
+			seconds = kv.Value.(int64)
+		case "nanos":
+			nanos = kv.Value.(int64)
+		}
+	}
+	return time.Unix(seconds, nanos).UTC()
+}
+
+func (rc *rowConverter) rowInfo(md protoreflect.MessageDescriptor) *rowInfo {
+	if rt, ok := rc.types.Load(md.FullName()); ok {
+		return rt.(*rowInfo)
+	}
+	ns := rc.r.nodes(md)
+	typ, err := schema.ToType(newSchema(ns))
+	if err != nil {
+		panic(fmt.Sprintf("cannot create row type for %s: %v", md.FullName(), err))
+	}
+	rt, _ := rc.types.LoadOrStore(md.FullName(), &rowInfo{nodes: ns, typ: typ})
+	return rt.(*rowInfo)
+}
+
+func (rc *rowConverter) Type(md protoreflect.MessageDescriptor) reflect.Type {
+	return rc.rowInfo(md).typ
+}
+
+func (rc *rowConverter) Apply(m proto.Message) (interface{}, error) {
+	rt := rc.rowInfo(m.ProtoReflect().Descriptor())
+	x, _ := rc.walker.Apply(m).(map[string]interface{})
+	v, err := row(rt.nodes, rt.typ, x)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// row converts a value of the walker into a row of the given struct type.
+func row(ns []*node, t reflect.Type, x map[string]interface{}) (reflect.Value, error) {
+	out := reflect.New(t).Elem()
+	for i, n := range ns {
+		v, err := field(n, t.Field(i).Type, x[n.name])
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		out.Field(i).Set(v)
+	}
+	return out, nil
+}
+
+// field converts a value of the walker into a value for a field, which is a
+// pointer if the field is nullable.
+func field(n *node, t reflect.Type, x interface{}) (reflect.Value, error) {
+	if !n.nullable {
+		return value(n, t, x)
+	}
+	if x == nil {
+		return reflect.Zero(t), nil
+	}
+	v, err := value(n, t.Elem(), x)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	p := reflect.New(t.Elem())
+	p.Elem().Set(v)
+	return p, nil
+}
+
+// value converts a value of the walker into a value of the given type. Unset
+// values are replaced by defaults.
+func value(n *node, t reflect.Type, x interface{}) (reflect.Value, error) {
+	switch n.kind {
+	case rowNode:
+		m, _ := x.(map[string]interface{})
+		return row(n.children, t, m)
+	case listNode:
+		xs, _ := x.([]interface{})
+		out := reflect.MakeSlice(t, len(xs), len(xs))
+		for i, item := range xs {
+			v, err := value(n.children[0], t.Elem(), item)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			out.Index(i).Set(v)
+		}
+		return out, nil
+	case mapNode:
+		es, _ := x.([]map[string]interface{})
+		out := reflect.MakeSlice(t, len(es), len(es))
+		for i, e := range es {
+			v, err := row(n.children, t.Elem(), e)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			out.Index(i).Set(v)
+		}
+		return out, nil
+	case timestampNode:
+		if x == nil {
+			return reflect.Zero(t), nil
+		}
+	}
+	if x == nil {
+		d := n.fd.Default()
+		x = convertRowScalar(n.fd, &d)
+	}
+	v := reflect.ValueOf(x)
+	switch {
+	case v.Type() == t:
+		return v, nil
+	case n.kind == scalarNode && isInt(v.Kind()) && t.Kind() == reflect.Int64:
+		// map keys are passed as is by the walker
+		return v.Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("%s: unexpected value of type %T", n.name, x)
+}
+
+func isInt(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int32, reflect.Int64, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package beam
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"testing"
+)
+
+const fullEvent = `{
+  "id": "1",
+  "name": "a",
+  "ratio": 0.5,
+  "count": 4294967295,
+  "status": "ACTIVE",
+  "tags": ["x", "y"],
+  "attrs": {"b": "2", "a": "1"},
+  "created": "1970-01-01T00:00:01.000002Z",
+  "alias": "q",
+  "place": {"lat": 1.5, "seen": ["1970-01-01T00:00:02Z"]},
+  "stops": [{"status": "ACTIVE"}],
+  "states": ["ACTIVE", "UNKNOWN"]
+}`
+
+// The row types are unnamed structs; their fields are compared through their
+// JSON representation.
+
+func TestRowConverter(t *testing.T) {
+	event := (&testpb.FlatEvent{}).ProtoReflect().Descriptor()
+
+	cases := []struct {
+		options  []Option
+		input    string
+		expected string
+		name     string
+	}{
+		{
+			nil,
+			fullEvent,
+			`{"Id":1,"Name":"a","Ratio":0.5,"Count":4294967295,"Status":1,` +
+				`"Tags":["x","y"],"Attrs":[{"Key":"a","Value":1},{"Key":"b","Value":2}],` +
+				`"Created":"1970-01-01T00:00:01.000002Z","Alias":"q",` +
+				`"Place":{"Lat":1.5,"Status":0,"Seen":["1970-01-01T00:00:02Z"]},` +
+				`"Stops":[{"Lat":0,"Status":1,"Seen":[]}],"States":[1,0]}`,
+			"default",
+		},
+		{
+			nil,
+			`{}`,
+			`{"Id":0,"Name":"","Ratio":0,"Count":0,"Status":0,"Tags":[],"Attrs":[],` +
+				`"Created":null,"Alias":null,"Place":null,"Stops":[],"States":[]}`,
+			"empty",
+		},
+		{
+			[]Option{OptionMaxDepth(1)},
+			fullEvent,
+			`{"Id":1,"Name":"a","Ratio":0.5,"Count":4294967295,"Status":1,` +
+				`"Tags":["x","y"],"Attrs":[{"Key":"a","Value":1},{"Key":"b","Value":2}],` +
+				`"Created":"1970-01-01T00:00:01.000002Z","Alias":"q",` +
+				`"Place":{"Lat":1.5,"Status":0},` +
+				`"Stops":[{"Lat":0,"Status":1}],"States":[1,0]}`,
+			"max depth",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rc := NewRowConverter(c.options...)
+			row, err := rc.Apply(testpb.NewFlatEvent(t, c.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reflect.TypeOf(row) != rc.Type(event) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, rc.Type(event), reflect.TypeOf(row))
+			}
+			bs, err := json.Marshal(row)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual := string(bs); actual != c.expected {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRowConverter_Coder(t *testing.T) {
+	event := (&testpb.FlatEvent{}).ProtoReflect().Descriptor()
+	rc := NewRowConverter()
+	typ := rc.Type(event)
+	enc, err := coder.RowEncoderForStruct(typ)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dec, err := coder.RowDecoderForStruct(typ)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		input string
+		name  string
+	}{
+		{fullEvent, "full"},
+		{`{}`, "empty"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			expected, err := rc.Apply(testpb.NewFlatEvent(t, c.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			buf := &bytes.Buffer{}
+			if err := enc(expected, buf); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			actual, err := dec(buf)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, expected, actual)
+			}
+		})
+	}
+}
+
+func TestApplyBatch(t *testing.T) {
+	rc := NewRowConverter()
+	ms := []proto.Message{testpb.NewFlatEvent(t, fullEvent), testpb.NewFlatEvent(t, `{}`)}
+
+	rs := ApplyBatch(rc, ms, 2)
+	if len(rs) != len(ms) {
+		t.Fatalf("expected %d results, got %d", len(ms), len(rs))
+	}
+	for i, r := range rs {
+		expected, _ := rc.Apply(ms[i])
+		if r.Err != nil || !reflect.DeepEqual(r.Value, expected) {
+			t.Errorf("%d: \nexpected %v, \ngot      %v (%v)", i, expected, r.Value, r.Err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package beam
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms"
+	// registers the time.Time logical type
+	_ "github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx/schema"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"reflect"
+	"time"
+)
+
+// timeFieldType is the field type of time.Time, as registered by the Go SDK.
+var timeFieldType = func() *pipepb.FieldType {
+	s, err := schema.FromType(reflect.TypeOf(struct{ T time.Time }{}))
+	if err != nil {
+		panic(err)
+	}
+	return s.GetFields()[0].GetType()
+}()
+
+type nodeKind int
+
+const (
+	scalarNode = nodeKind(iota)
+	timestampNode
+	rowNode
+	listNode
+	mapNode
+)
+
+// A node is a field, list item or map key or value.
+type node struct {
+	name     string
+	kind     nodeKind
+	nullable bool
+	fd       protoreflect.FieldDescriptor
+	// children holds the fields of a row, the item of a list or the key and
+	// value of a map
+	children []*node
+}
+
+// fieldType returns the Beam type of the node.
+func (n *node) fieldType() *pipepb.FieldType {
+	var ft *pipepb.FieldType
+	switch n.kind {
+	case timestampNode:
+		ft = proto.Clone(timeFieldType).(*pipepb.FieldType)
+	case rowNode:
+		ft = rowType(n.children)
+	case listNode:
+		ft = arrayType(n.children[0].fieldType())
+	case mapNode:
+		ft = arrayType(rowType(n.children))
+	default:
+		ft = &pipepb.FieldType{TypeInfo: &pipepb.FieldType_AtomicType{AtomicType: GetBeamType(n.fd)}}
+	}
+	ft.Nullable = n.nullable
+	return ft
+}
+
+func rowType(ns []*node) *pipepb.FieldType {
+	return &pipepb.FieldType{TypeInfo: &pipepb.FieldType_RowType{RowType: &pipepb.RowType{Schema: newSchema(ns)}}}
+}
+
+func arrayType(item *pipepb.FieldType) *pipepb.FieldType {
+	return &pipepb.FieldType{TypeInfo: &pipepb.FieldType_ArrayType{ArrayType: &pipepb.ArrayType{ElementType: item}}}
+}
+
+func newSchema(ns []*node) *pipepb.Schema {
+	s := &pipepb.Schema{}
+	for i, n := range ns {
+		s.Fields = append(s.Fields, &pipepb.Field{Name: n.name, Type: n.fieldType(), EncodingPosition: int32(i)})
+	}
+	return s
+}
+
+// A SchemaConverter converts message descriptors into Beam schemas. It is safe
+// for concurrent use by multiple goroutines.
+type SchemaConverter interface {
+	Apply(md protoreflect.MessageDescriptor) *pipepb.Schema
+}
+
+type schemaConverter struct {
+	r *resolver
+}
+
+// NewSchemaConverter creates a new SchemaConverter.
+func NewSchemaConverter(options ...Option) SchemaConverter {
+	return &schemaConverter{r: newResolver(newConfig(options))}
+}
+
+func (sc *schemaConverter) Apply(md protoreflect.MessageDescriptor) *pipepb.Schema {
+	return newSchema(sc.r.nodes(md))
+}
+
+// A resolver resolves the nodes for the fields of a message type.
+type resolver struct {
+	maxDepth int
+}
+
+func newResolver(c *config) *resolver {
+	return &resolver{
+		maxDepth: c.maxDepth,
+	}
+}
+
+// nodes returns the nodes for the fields of a message.
+func (r *resolver) nodes(md protoreflect.MessageDescriptor) []*node {
+	return r.fields(md, r.maxDepth-1)
+}
+
+// fields returns the nodes for the fields of a message. The allowed depth
+// mirrors that of the Walker: message values are only included if it is not
+// negative.
+func (r *resolver) fields(md protoreflect.MessageDescriptor, allowedDepth int) []*node {
+	var out []*node
+	for _, fd := range transforms.DescriptorFields(md) {
+		if n := r.field(fd, allowedDepth); n != nil {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func (r *resolver) field(fd protoreflect.FieldDescriptor, allowedDepth int) *node {
+	name := string(fd.Name())
+	switch {
+	case fd.IsMap():
+		value := r.value("value", fd.MapValue(), allowedDepth)
+		if value == nil {
+			return nil
+		}
+		key := r.value("key", fd.MapKey(), allowedDepth)
+		return &node{name: name, kind: mapNode, fd: fd, children: []*node{key, value}}
+	case fd.IsList():
+		item := r.value(name, fd, allowedDepth)
+		if item == nil {
+			return nil
+		}
+		return &node{name: name, kind: listNode, fd: fd, children: []*node{item}}
+	}
+	n := r.value(name, fd, allowedDepth)
+	if n != nil {
+		n.nullable = fd.HasPresence()
+	}
+	return n
+}
+
+// value returns the non-nullable node for a single value of a field, or nil
+// if it is a message beyond the maximum depth.
+func (r *resolver) value(name string, fd protoreflect.FieldDescriptor, allowedDepth int) *node {
+	switch {
+	case fd.Message() == nil:
+		return &node{name: name, kind: scalarNode, fd: fd}
+	case allowedDepth < 0:
+		return nil
+	case fd.Message().FullName() == timestampName:
+		return &node{name: name, kind: timestampNode, fd: fd}
+	}
+	return &node{name: name, kind: rowNode, fd: fd, children: r.fields(fd.Message(), allowedDepth-1)}
+}
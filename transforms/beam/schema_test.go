@@ -0,0 +1,85 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package beam
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"google.golang.org/protobuf/proto"
+	"testing"
+)
+
+func atomic(t pipepb.AtomicType, nullable bool) *pipepb.FieldType {
+	return &pipepb.FieldType{Nullable: nullable, TypeInfo: &pipepb.FieldType_AtomicType{AtomicType: t}}
+}
+
+func array(item *pipepb.FieldType) *pipepb.FieldType {
+	return &pipepb.FieldType{TypeInfo: &pipepb.FieldType_ArrayType{ArrayType: &pipepb.ArrayType{ElementType: item}}}
+}
+
+func rowOf(nullable bool, fs ...*pipepb.Field) *pipepb.FieldType {
+	for i, f := range fs {
+		f.EncodingPosition = int32(i)
+	}
+	return &pipepb.FieldType{Nullable: nullable, TypeInfo: &pipepb.FieldType_RowType{RowType: &pipepb.RowType{Schema: &pipepb.Schema{Fields: fs}}}}
+}
+
+func timestamp(nullable bool) *pipepb.FieldType {
+	ft := proto.Clone(timeFieldType).(*pipepb.FieldType)
+	ft.Nullable = nullable
+	return ft
+}
+
+func TestSchemaConverter(t *testing.T) {
+	event := (&testpb.FlatEvent{}).ProtoReflect().Descriptor()
+	place := func(depth int) *pipepb.FieldType {
+		fs := []*pipepb.Field{
+			{Name: "lat", Type: atomic(pipepb.AtomicType_DOUBLE, false)},
+			{Name: "status", Type: atomic(pipepb.AtomicType_INT64, false)},
+		}
+		if depth > 1 {
+			fs = append(fs, &pipepb.Field{Name: "seen", Type: array(timestamp(false))})
+		}
+		return rowOf(false, fs...)
+	}
+	expected := func(depth int) *pipepb.Schema {
+		placeType := place(depth)
+		nullablePlace := proto.Clone(placeType).(*pipepb.FieldType)
+		nullablePlace.Nullable = true
+		return rowOf(false,
+			&pipepb.Field{Name: "id", Type: atomic(pipepb.AtomicType_INT64, false)},
+			&pipepb.Field{Name: "name", Type: atomic(pipepb.AtomicType_STRING, false)},
+			&pipepb.Field{Name: "ratio", Type: atomic(pipepb.AtomicType_DOUBLE, false)},
+			&pipepb.Field{Name: "count", Type: atomic(pipepb.AtomicType_INT64, false)},
+			&pipepb.Field{Name: "status", Type: atomic(pipepb.AtomicType_INT64, false)},
+			&pipepb.Field{Name: "tags", Type: array(atomic(pipepb.AtomicType_STRING, false))},
+			&pipepb.Field{Name: "attrs", Type: array(rowOf(false,
+				&pipepb.Field{Name: "key", Type: atomic(pipepb.AtomicType_STRING, false)},
+				&pipepb.Field{Name: "value", Type: atomic(pipepb.AtomicType_INT64, false)},
+			))},
+			&pipepb.Field{Name: "created", Type: timestamp(true)},
+			&pipepb.Field{Name: "alias", Type: atomic(pipepb.AtomicType_STRING, true)},
+			&pipepb.Field{Name: "place", Type: nullablePlace},
+			&pipepb.Field{Name: "stops", Type: array(placeType)},
+			&pipepb.Field{Name: "states", Type: array(atomic(pipepb.AtomicType_INT64, false))},
+		).GetRowType().GetSchema()
+	}
+
+	cases := []struct {
+		options  []Option
+		expected *pipepb.Schema
+		name     string
+	}{
+		{nil, expected(10), "default"},
+		{[]Option{OptionMaxDepth(1)}, expected(1), "max depth"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := NewSchemaConverter(c.options...).Apply(event)
+			if !proto.Equal(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
@@ -28,6 +28,8 @@ func GetBigQueryType(fd protoreflect.FieldDescriptor) bigquery.FieldType {
 	}
 }
 
+// A SchemaConverter converts message descriptors into BigQuery schemas. It is
+// safe for concurrent use by multiple goroutines.
 type SchemaConverter interface {
 	Apply(descriptor protoreflect.MessageDescriptor) []*bigquery.FieldSchema
 }
@@ -136,6 +138,8 @@ func (sc *schemaConverter) Apply(md protoreflect.MessageDescriptor) []*bigquery.
 	return fs
 }
 
+// A RowConverter converts messages into BigQuery rows. It is safe for
+// concurrent use by multiple goroutines.
 type RowConverter interface {
 	Apply(proto.Message) map[string]interface{}
 }
@@ -153,6 +157,26 @@ func (rc *rowConverter) Apply(m proto.Message) map[string]interface{} {
 	}
 }
 
+// ApplyBatch converts a batch of messages into rows, using the given number of
+// goroutines. The Value of each Result is a map[string]interface{}. See
+// transforms.ApplyBatch.
+func ApplyBatch(rc RowConverter, ms []proto.Message, workers int) []transforms.Result {
+	return transforms.ApplyBatchFunc(applyFunc(rc), ms, workers)
+}
+
+// ApplyChan converts all messages received from a channel into rows, using the
+// given number of goroutines. The Value of each Result is a
+// map[string]interface{}. See transforms.ApplyChan.
+func ApplyChan(rc RowConverter, in <-chan proto.Message, workers int) <-chan transforms.Result {
+	return transforms.ApplyChanFunc(applyFunc(rc), in, workers)
+}
+
+func applyFunc(rc RowConverter) transforms.BatchFunc {
+	return func(m proto.Message) (interface{}, error) {
+		return rc.Apply(m), nil
+	}
+}
+
 func convertRowScalar(fd protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
 	if v == nil {
 		return nil
@@ -178,23 +202,6 @@ func convertRowScalar(fd protoreflect.FieldDescriptor, v *protoreflect.Value) in
 	}
 }
 
-func convertRowMapFunc(fd protoreflect.FieldDescriptor, m map[interface{}]interface{}) interface{} {
-	var keys []interface{}
-	for k := range m {
-		keys = append(keys, k)
-	}
-	// hvl: sort keys by their natural ordering for stability
-	sortMapKeys(fd, keys)
-	var kvs []map[string]interface{}
-	for _, k := range keys {
-		kvs = append(kvs, map[string]interface{}{
-			"key":   k,
-			"value": m[k],
-		})
-	}
-	return kvs
-}
-
 func convertRowTimestamp(_ protoreflect.FieldDescriptor, kvs []transforms.KeyValue) interface{} {
 	if len(kvs) == 0 {
 		return nil
@@ -226,7 +233,7 @@ func convertRowTimestamp(_ protoreflect.FieldDescriptor, kvs []transforms.KeyVal
 func NewRowConverter(options ...transforms.Option) RowConverter {
 	opts := []transforms.Option{
 		transforms.OptionDefaultScalarFunc(convertRowScalar),
-		transforms.OptionMapFunc(convertRowMapFunc),
+		transforms.OptionMapStrategy(transforms.MapEntries),
 		transforms.OptionAddTypeOverride(string(timestampDescriptor.FullName()), convertRowTimestamp),
 	}
 	for _, option := range options {
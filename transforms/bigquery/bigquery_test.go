@@ -9,6 +9,7 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -122,6 +123,64 @@ func TestRowConverter(t *testing.T) {
 	}
 }
 
+func TestRowConverter_Concurrent(t *testing.T) {
+	input := &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"foo": structpb.NewNumberValue(1.2),
+			"bar": structpb.NewStringValue("bla"),
+		},
+	}
+	expected := NewRowConverter().Apply(input)
+
+	rowConverter := NewRowConverter()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 16; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j += 1 {
+				if actual := rowConverter.Apply(input); !reflect.DeepEqual(actual, expected) {
+					t.Errorf("expected %v, \ngot      %v", expected, actual)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestApplyBatch(t *testing.T) {
+	ms := []proto.Message{
+		&timestamppb.Timestamp{Seconds: 1},
+		&timestamppb.Timestamp{Seconds: 2},
+		&timestamppb.Timestamp{Seconds: 3},
+	}
+	expected := []transforms.Result{
+		{Index: 0, Value: map[string]interface{}{"seconds": int64(1)}},
+		{Index: 1, Value: map[string]interface{}{"seconds": int64(2)}},
+		{Index: 2, Value: map[string]interface{}{"seconds": int64(3)}},
+	}
+
+	actual := ApplyBatch(NewRowConverter(), ms, 2)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, \ngot      %v", expected, actual)
+	}
+
+	in := make(chan proto.Message)
+	go func() {
+		for _, m := range ms {
+			in <- m
+		}
+		close(in)
+	}()
+	actual = nil
+	for r := range ApplyChan(NewRowConverter(), in, 2) {
+		actual = append(actual, r)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, \ngot      %v", expected, actual)
+	}
+}
+
 func pretty(v interface{}) string {
 	return pretty2(v, "", ", ", false)
 }
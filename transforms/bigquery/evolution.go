@@ -0,0 +1,202 @@
+package bigquery
+
+import (
+	"cloud.google.com/go/bigquery"
+	"fmt"
+	"strings"
+)
+
+// A ChangeKind classifies a difference between an existing schema and the
+// schema of a message type.
+type ChangeKind int
+
+const (
+	// ColumnAdded is a new NULLABLE or REPEATED column. It is safe.
+	ColumnAdded = ChangeKind(iota)
+	// ModeRelaxed is a REQUIRED column that has become NULLABLE. It is safe.
+	ModeRelaxed
+	// RequiredAdded is a new REQUIRED column. It is breaking.
+	RequiredAdded
+	// ColumnRemoved is a column that is no longer in the schema. It is
+	// breaking.
+	ColumnRemoved
+	// TypeChanged is a column with a different type. It is breaking.
+	TypeChanged
+	// ModeChanged is a column that has become REPEATED, is no longer
+	// REPEATED, or has become REQUIRED. It is breaking.
+	ModeChanged
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ColumnAdded:
+		return "column added"
+	case ModeRelaxed:
+		return "mode relaxed"
+	case RequiredAdded:
+		return "required column added"
+	case ColumnRemoved:
+		return "column removed"
+	case TypeChanged:
+		return "type changed"
+	case ModeChanged:
+		return "mode changed"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Breaking reports whether the change prevents the existing table from
+// accepting rows of the new schema.
+func (k ChangeKind) Breaking() bool {
+	return k != ColumnAdded && k != ModeRelaxed
+}
+
+// A Change is a difference between an existing schema and the schema of a
+// message type.
+type Change struct {
+	Kind ChangeKind
+	// Path is the dotted path of the column.
+	Path string
+	// Old is the existing column; it is nil for added columns.
+	Old *bigquery.FieldSchema
+	// New is the column of the new schema; it is nil for removed columns.
+	New *bigquery.FieldSchema
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Old == nil:
+		return fmt.Sprintf("%s: %s (%s)", c.Path, c.Kind, mode(c.New))
+	case c.New == nil:
+		return fmt.Sprintf("%s: %s", c.Path, c.Kind)
+	case c.Kind == TypeChanged:
+		return fmt.Sprintf("%s: %s from %s to %s", c.Path, c.Kind, c.Old.Type, c.New.Type)
+	}
+	return fmt.Sprintf("%s: %s from %s to %s", c.Path, c.Kind, mode(c.Old), mode(c.New))
+}
+
+func mode(f *bigquery.FieldSchema) string {
+	switch {
+	case f.Repeated:
+		return "REPEATED"
+	case f.Required:
+		return "REQUIRED"
+	}
+	return "NULLABLE"
+}
+
+// An Evolution is the result of comparing an existing schema with the schema
+// of a message type.
+type Evolution struct {
+	// Changes holds the differences, in column order of the existing schema
+	// followed by added columns.
+	Changes []Change
+	// Schema is the existing schema with the safe changes applied. Columns
+	// are never removed and keep their existing types and modes if these
+	// changed in a breaking way.
+	Schema bigquery.Schema
+}
+
+// Breaking reports whether any of the changes is breaking.
+func (e *Evolution) Breaking() bool {
+	for _, c := range e.Changes {
+		if c.Kind.Breaking() {
+			return true
+		}
+	}
+	return false
+}
+
+// BreakingChanges returns the breaking changes.
+func (e *Evolution) BreakingChanges() []Change {
+	var out []Change
+	for _, c := range e.Changes {
+		if c.Kind.Breaking() {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Update returns the table update that applies the safe changes.
+func (e *Evolution) Update() bigquery.TableMetadataToUpdate {
+	return bigquery.TableMetadataToUpdate{Schema: e.Schema}
+}
+
+// CompareSchemas compares an existing schema, as found in the table metadata
+// or read with bigquery.SchemaFromJSON, with a new one, as created by a
+// SchemaConverter. Column names are compared case-insensitively, like
+// BigQuery does, and type aliases such as INT64 and INTEGER are considered
+// equal.
+//
+// The existing schema is not modified.
+func CompareSchemas(existing, next []*bigquery.FieldSchema) *Evolution {
+	e := &Evolution{}
+	e.Schema = e.compare("", existing, next)
+	return e
+}
+
+func (e *Evolution) compare(prefix string, existing, next []*bigquery.FieldSchema) bigquery.Schema {
+	byName := make(map[string]*bigquery.FieldSchema, len(next))
+	for _, f := range next {
+		byName[strings.ToLower(f.Name)] = f
+	}
+	out := make(bigquery.Schema, 0, len(existing))
+	seen := make(map[string]bool, len(existing))
+	for _, old := range existing {
+		key := strings.ToLower(old.Name)
+		seen[key] = true
+		path := prefix + old.Name
+		f := byName[key]
+		if f == nil {
+			e.Changes = append(e.Changes, Change{Kind: ColumnRemoved, Path: path, Old: old})
+			out = append(out, old)
+			continue
+		}
+		patched := *old
+		if normaliseType(old.Type) != normaliseType(f.Type) {
+			e.Changes = append(e.Changes, Change{Kind: TypeChanged, Path: path, Old: old, New: f})
+			out = append(out, &patched)
+			continue
+		}
+		switch {
+		case old.Repeated != f.Repeated, !old.Required && f.Required && !f.Repeated:
+			e.Changes = append(e.Changes, Change{Kind: ModeChanged, Path: path, Old: old, New: f})
+		case old.Required && !f.Required:
+			e.Changes = append(e.Changes, Change{Kind: ModeRelaxed, Path: path, Old: old, New: f})
+			patched.Required = false
+		}
+		if normaliseType(old.Type) == bigquery.RecordFieldType {
+			patched.Schema = e.compare(path+".", old.Schema, f.Schema)
+		}
+		out = append(out, &patched)
+	}
+	for _, f := range next {
+		if seen[strings.ToLower(f.Name)] {
+			continue
+		}
+		if f.Required && !f.Repeated {
+			e.Changes = append(e.Changes, Change{Kind: RequiredAdded, Path: prefix + f.Name, New: f})
+			continue
+		}
+		e.Changes = append(e.Changes, Change{Kind: ColumnAdded, Path: prefix + f.Name, New: f})
+		out = append(out, f)
+	}
+	return out
+}
+
+// normaliseType replaces the Standard SQL names of types by their legacy names,
+// as used by the client library.
+func normaliseType(t bigquery.FieldType) bigquery.FieldType {
+	switch strings.ToUpper(string(t)) {
+	case "INT64":
+		return bigquery.IntegerFieldType
+	case "FLOAT64":
+		return bigquery.FloatFieldType
+	case "BOOL":
+		return bigquery.BooleanFieldType
+	case "STRUCT":
+		return bigquery.RecordFieldType
+	}
+	return bigquery.FieldType(strings.ToUpper(string(t)))
+}
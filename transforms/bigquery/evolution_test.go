@@ -0,0 +1,150 @@
+package bigquery
+
+import (
+	"cloud.google.com/go/bigquery"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/types/known/structpb"
+	"reflect"
+	"testing"
+)
+
+func TestCompareSchemas(t *testing.T) {
+	id := &bigquery.FieldSchema{Name: "id", Type: bigquery.IntegerFieldType}
+	requiredID := &bigquery.FieldSchema{Name: "id", Type: bigquery.IntegerFieldType, Required: true}
+	name := &bigquery.FieldSchema{Name: "name", Type: bigquery.StringFieldType}
+	tags := &bigquery.FieldSchema{Name: "tags", Type: bigquery.StringFieldType, Repeated: true}
+	place := func(fs ...*bigquery.FieldSchema) *bigquery.FieldSchema {
+		return &bigquery.FieldSchema{Name: "place", Type: bigquery.RecordFieldType, Schema: fs}
+	}
+	lat := &bigquery.FieldSchema{Name: "lat", Type: bigquery.FloatFieldType}
+
+	cases := []struct {
+		existing       []*bigquery.FieldSchema
+		next           []*bigquery.FieldSchema
+		expected       []Change
+		expectedSchema bigquery.Schema
+		breaking       bool
+		message        string
+	}{
+		{
+			existing:       []*bigquery.FieldSchema{id, name},
+			next:           []*bigquery.FieldSchema{id, name},
+			expectedSchema: bigquery.Schema{id, name},
+			message:        "equal",
+		},
+		{
+			existing: []*bigquery.FieldSchema{id},
+			next:     []*bigquery.FieldSchema{id, name, tags},
+			expected: []Change{
+				{Kind: ColumnAdded, Path: "name", New: name},
+				{Kind: ColumnAdded, Path: "tags", New: tags},
+			},
+			expectedSchema: bigquery.Schema{id, name, tags},
+			message:        "added columns",
+		},
+		{
+			existing:       []*bigquery.FieldSchema{requiredID},
+			next:           []*bigquery.FieldSchema{id},
+			expected:       []Change{{Kind: ModeRelaxed, Path: "id", Old: requiredID, New: id}},
+			expectedSchema: bigquery.Schema{id},
+			message:        "relaxed",
+		},
+		{
+			existing:       []*bigquery.FieldSchema{id, name},
+			next:           []*bigquery.FieldSchema{id},
+			expected:       []Change{{Kind: ColumnRemoved, Path: "name", Old: name}},
+			expectedSchema: bigquery.Schema{id, name},
+			breaking:       true,
+			message:        "removed",
+		},
+		{
+			existing:       []*bigquery.FieldSchema{{Name: "name", Type: bigquery.IntegerFieldType}},
+			next:           []*bigquery.FieldSchema{name},
+			expected:       []Change{{Kind: TypeChanged, Path: "name", Old: &bigquery.FieldSchema{Name: "name", Type: bigquery.IntegerFieldType}, New: name}},
+			expectedSchema: bigquery.Schema{{Name: "name", Type: bigquery.IntegerFieldType}},
+			breaking:       true,
+			message:        "type changed",
+		},
+		{
+			existing:       []*bigquery.FieldSchema{{Name: "tags", Type: bigquery.StringFieldType}},
+			next:           []*bigquery.FieldSchema{tags},
+			expected:       []Change{{Kind: ModeChanged, Path: "tags", Old: &bigquery.FieldSchema{Name: "tags", Type: bigquery.StringFieldType}, New: tags}},
+			expectedSchema: bigquery.Schema{{Name: "tags", Type: bigquery.StringFieldType}},
+			breaking:       true,
+			message:        "to repeated",
+		},
+		{
+			existing:       []*bigquery.FieldSchema{id},
+			next:           []*bigquery.FieldSchema{requiredID},
+			expected:       []Change{{Kind: ModeChanged, Path: "id", Old: id, New: requiredID}},
+			expectedSchema: bigquery.Schema{id},
+			breaking:       true,
+			message:        "to required",
+		},
+		{
+			existing:       []*bigquery.FieldSchema{id},
+			next:           []*bigquery.FieldSchema{id, {Name: "name", Type: bigquery.StringFieldType, Required: true}},
+			expected:       []Change{{Kind: RequiredAdded, Path: "name", New: &bigquery.FieldSchema{Name: "name", Type: bigquery.StringFieldType, Required: true}}},
+			expectedSchema: bigquery.Schema{id},
+			breaking:       true,
+			message:        "required added",
+		},
+		{
+			existing: []*bigquery.FieldSchema{{Name: "ID", Type: "INT64"}, place()},
+			next:     []*bigquery.FieldSchema{id, place(lat)},
+			expected: []Change{
+				{Kind: ColumnAdded, Path: "place.lat", New: lat},
+			},
+			expectedSchema: bigquery.Schema{{Name: "ID", Type: "INT64"}, place(lat)},
+			message:        "nested and aliases",
+		},
+	}
+
+	for _, c := range cases {
+		actual := CompareSchemas(c.existing, c.next)
+		if !reflect.DeepEqual(actual.Changes, c.expected) {
+			t.Errorf("%s, \nexpected %v, \ngot      %v", c.message, c.expected, actual.Changes)
+		}
+		if !reflect.DeepEqual(actual.Schema, c.expectedSchema) {
+			t.Errorf("%s, \nexpected %s, \ngot      %v", c.message, pretty(c.expectedSchema), pretty(actual.Schema))
+		}
+		if actual.Breaking() != c.breaking {
+			t.Errorf("%s, \nexpected %v, \ngot      %v", c.message, c.breaking, actual.Breaking())
+		}
+		if u := actual.Update(); !reflect.DeepEqual(u.Schema, actual.Schema) {
+			t.Errorf("%s, \nexpected %s, \ngot      %v", c.message, pretty(actual.Schema), pretty(u.Schema))
+		}
+	}
+}
+
+func TestCompareSchemas_FromJSON(t *testing.T) {
+	existing, err := bigquery.SchemaFromJSON([]byte(`[
+  {"name": "null_value", "type": "INT64", "mode": "REQUIRED"},
+  {"name": "number_value", "type": "FLOAT64"},
+  {"name": "string_value", "type": "STRING"},
+  {"name": "legacy", "type": "STRING"}
+]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	next := NewSchemaConverter(transforms.OptionMaxDepth(1)).Apply((&structpb.Value{}).ProtoReflect().Descriptor())
+
+	actual := CompareSchemas(existing, next)
+	var kinds []string
+	for _, c := range actual.Changes {
+		kinds = append(kinds, c.String())
+	}
+	expected := []string{
+		"null_value: mode relaxed from REQUIRED to NULLABLE",
+		"legacy: column removed",
+		"bool_value: column added (NULLABLE)",
+		"struct_value: column added (NULLABLE)",
+		"list_value: column added (NULLABLE)",
+	}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("expected %v, \ngot      %v", expected, kinds)
+	}
+	if bs := actual.BreakingChanges(); len(bs) != 1 || bs[0].Path != "legacy" {
+		t.Errorf("expected breaking change for legacy, \ngot      %v", bs)
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package compat detects changes between two versions of message types that
+// break compatibility of the wire format or the JSON format.
+//
+// Fields are matched on their numbers. The types of message and enum fields
+// are compared as well, so comparing a root message covers all types it uses.
+// Oneofs are compared by their members rather than their names, as renaming a
+// oneof affects neither format.
+package compat
+
+import (
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CompareMessages compares two versions of a message type.
+func CompareMessages(from, to protoreflect.MessageDescriptor) *Report {
+	c := newComparer()
+	c.message(from, to)
+	return &Report{Changes: c.changes}
+}
+
+// CompareFiles compares the message types of two versions of a set of files.
+// If names are given, only those message types are compared; otherwise all
+// message types that are in both versions are.
+func CompareFiles(from, to *descriptorpb.FileDescriptorSet, names ...protoreflect.FullName) (*Report, error) {
+	fromFiles, err := protodesc.NewFiles(from)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load old files: %w", err)
+	}
+	toFiles, err := protodesc.NewFiles(to)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load new files: %w", err)
+	}
+	c := newComparer()
+	if len(names) > 0 {
+		for _, name := range names {
+			fromMD, err := findMessage(fromFiles, name)
+			if err != nil {
+				return nil, fmt.Errorf("old files: %w", err)
+			}
+			toMD, err := findMessage(toFiles, name)
+			if err != nil {
+				return nil, fmt.Errorf("new files: %w", err)
+			}
+			c.message(fromMD, toMD)
+		}
+		return &Report{Changes: c.changes}, nil
+	}
+	var mds []protoreflect.MessageDescriptor
+	fromFiles.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		mds = appendMessages(mds, fd.Messages())
+		return true
+	})
+	for _, md := range mds {
+		if toMD, err := findMessage(toFiles, md.FullName()); err == nil {
+			c.message(md, toMD)
+		}
+	}
+	return &Report{Changes: c.changes}, nil
+}
+
+func findMessage(files *protoregistry.Files, name protoreflect.FullName) (protoreflect.MessageDescriptor, error) {
+	d, err := files.FindDescriptorByName(name)
+	if err != nil {
+		return nil, err
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+	return md, nil
+}
+
+// appendMessages appends message types and their nested message types, in
+// order of declaration. Map entries are compared through their fields.
+func appendMessages(out []protoreflect.MessageDescriptor, mds protoreflect.MessageDescriptors) []protoreflect.MessageDescriptor {
+	for i := 0; i < mds.Len(); i += 1 {
+		md := mds.Get(i)
+		if md.IsMapEntry() {
+			continue
+		}
+		out = append(out, md)
+		out = appendMessages(out, md.Messages())
+	}
+	return out
+}
+
+// A comparer compares message and enum types, each at most once.
+type comparer struct {
+	seen    map[protoreflect.FullName]bool
+	changes []Change
+}
+
+func newComparer() *comparer {
+	return &comparer{
+		seen: map[protoreflect.FullName]bool{},
+	}
+}
+
+func (c *comparer) add(k Kind, s Severity, d protoreflect.Descriptor, format string, args ...interface{}) {
+	c.changes = append(c.changes, Change{
+		Kind:     k,
+		Severity: s,
+		Path:     string(d.FullName()),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *comparer) message(from, to protoreflect.MessageDescriptor) {
+	if c.seen[from.FullName()] {
+		return
+	}
+	c.seen[from.FullName()] = true
+
+	toFields := transforms.DescriptorFields(to)
+	byNumber := make(map[protoreflect.FieldNumber]protoreflect.FieldDescriptor, len(toFields))
+	byName := make(map[protoreflect.Name]protoreflect.FieldDescriptor, len(toFields))
+	for _, fd := range toFields {
+		byNumber[fd.Number()] = fd
+		byName[fd.Name()] = fd
+	}
+	for _, fd := range transforms.DescriptorFields(from) {
+		if next, ok := byNumber[fd.Number()]; ok {
+			c.field(fd, next)
+			continue
+		}
+		if next, ok := byName[fd.Name()]; ok {
+			c.add(FieldNumberChanged, SeverityWire, fd, "field number changed from %d to %d", fd.Number(), next.Number())
+			continue
+		}
+		numberReserved := to.ReservedRanges().Has(fd.Number())
+		nameReserved := to.ReservedNames().Has(fd.Name())
+		switch {
+		case !numberReserved:
+			c.add(FieldRemoved, SeverityWire, fd, "field %d removed without reserving its number", fd.Number())
+		case !nameReserved:
+			c.add(FieldRemoved, SeverityJSON, fd, "field %d removed without reserving its name", fd.Number())
+		}
+	}
+}
+
+func (c *comparer) field(from, to protoreflect.FieldDescriptor) {
+	if from.Name() != to.Name() {
+		c.add(FieldRenamed, SeverityJSON, from, "field %d renamed to %s", from.Number(), to.Name())
+	}
+	if from.JSONName() != to.JSONName() {
+		c.add(JSONNameChanged, SeverityJSON, from, "JSON name changed from %s to %s", from.JSONName(), to.JSONName())
+	}
+	if from.Cardinality() != to.Cardinality() {
+		c.add(CardinalityChanged, SeverityWire, from, "cardinality changed from %s to %s", from.Cardinality(), to.Cardinality())
+	}
+	// renaming a oneof changes neither format; only its members matter
+	if fromOneof, toOneof := oneofMembers(from, to.ContainingMessage()), oneofMembers(to, from.ContainingMessage()); !equalNumbers(fromOneof, toOneof) {
+		c.add(OneofChanged, SeverityWire, from, "oneof changed from %s to %s", describeOneof(from, fromOneof), describeOneof(to, toOneof))
+	}
+	if from.Kind() != to.Kind() {
+		s := SeverityWire
+		if wireGroup(from.Kind()) != 0 && wireGroup(from.Kind()) == wireGroup(to.Kind()) {
+			s = SeverityJSON
+		}
+		c.add(KindChanged, s, from, "kind changed from %s to %s", from.Kind(), to.Kind())
+		return
+	}
+	switch {
+	case from.Message() != nil:
+		c.message(from.Message(), to.Message())
+	case from.Enum() != nil:
+		c.enum(from.Enum(), to.Enum())
+	}
+}
+
+// oneofMembers returns the numbers of the fields in the oneof of a field that
+// exist in the other version of the message, in ascending order, or nil if
+// the field is not in a oneof. Synthetic oneofs of optional fields are
+// ignored.
+func oneofMembers(fd protoreflect.FieldDescriptor, other protoreflect.MessageDescriptor) []protoreflect.FieldNumber {
+	od := fd.ContainingOneof()
+	if od == nil || od.IsSynthetic() {
+		return nil
+	}
+	var out []protoreflect.FieldNumber
+	for i := 0; i < od.Fields().Len(); i += 1 {
+		if n := od.Fields().Get(i).Number(); other.Fields().ByNumber(n) != nil {
+			out = append(out, n)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func equalNumbers(xs, ys []protoreflect.FieldNumber) bool {
+	if len(xs) != len(ys) {
+		return false
+	}
+	for i := range xs {
+		if xs[i] != ys[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// describeOneof describes the oneof of a field by its name and members.
+func describeOneof(fd protoreflect.FieldDescriptor, members []protoreflect.FieldNumber) string {
+	if members == nil {
+		return "(none)"
+	}
+	ns := make([]string, len(members))
+	for i, n := range members {
+		ns[i] = strconv.Itoa(int(n))
+	}
+	return fmt.Sprintf("%s (%s)", fd.ContainingOneof().Name(), strings.Join(ns, ", "))
+}
+
+// wireGroup returns the group of kinds that a kind can be changed to without
+// breaking the wire format, or 0 if there is none.
+func wireGroup(k protoreflect.Kind) int {
+	switch k {
+	case protoreflect.Int32Kind, protoreflect.Uint32Kind, protoreflect.Int64Kind,
+		protoreflect.Uint64Kind, protoreflect.BoolKind, protoreflect.EnumKind:
+		return 1
+	case protoreflect.Sint32Kind, protoreflect.Sint64Kind:
+		return 2
+	case protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind:
+		return 3
+	case protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind:
+		return 4
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return 5
+	}
+	return 0
+}
+
+func (c *comparer) enum(from, to protoreflect.EnumDescriptor) {
+	if c.seen[from.FullName()] {
+		return
+	}
+	c.seen[from.FullName()] = true
+
+	// values of closed enums that are unknown to the receiver are not
+	// retained in the field
+	removed := SeverityJSON
+	if from.Syntax() == protoreflect.Proto2 {
+		removed = SeverityWire
+	}
+	for i := 0; i < from.Values().Len(); i += 1 {
+		v := from.Values().Get(i)
+		next := to.Values().ByNumber(v.Number())
+		switch {
+		case next == nil && to.ReservedRanges().Has(v.Number()) && to.ReservedNames().Has(v.Name()):
+		case next == nil:
+			c.add(EnumValueRemoved, removed, v, "enum value %d removed", v.Number())
+		case next.Name() != v.Name():
+			c.add(EnumValueRenamed, SeverityJSON, v, "enum value %d renamed to %s", v.Number(), next.Name())
+		}
+	}
+}
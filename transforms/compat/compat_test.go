@@ -0,0 +1,278 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package compat
+
+import (
+	"bytes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"reflect"
+	"testing"
+)
+
+const (
+	optional = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	repeated = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+)
+
+func field(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, type_ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+	f := &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Label:  label.Enum(),
+		Type:   type_.Enum(),
+	}
+	if typeName != "" {
+		f.TypeName = proto.String(typeName)
+	}
+	return f
+}
+
+func inOneof(f *descriptorpb.FieldDescriptorProto, i int32) *descriptorpb.FieldDescriptorProto {
+	f.OneofIndex = proto.Int32(i)
+	return f
+}
+
+func enumValues(names ...string) []*descriptorpb.EnumValueDescriptorProto {
+	var out []*descriptorpb.EnumValueDescriptorProto
+	for i, n := range names {
+		if n != "" {
+			out = append(out, &descriptorpb.EnumValueDescriptorProto{Name: proto.String(n), Number: proto.Int32(int32(i))})
+		}
+	}
+	return out
+}
+
+func fileSet(event, place []*descriptorpb.FieldDescriptorProto, reserved []string, ranges []int32, status []string) *descriptorpb.FileDescriptorSet {
+	msg := &descriptorpb.DescriptorProto{
+		Name:         proto.String("Event"),
+		Field:        event,
+		ReservedName: reserved,
+	}
+	for _, f := range event {
+		if f.OneofIndex != nil {
+			msg.OneofDecl = []*descriptorpb.OneofDescriptorProto{{Name: proto.String("choice")}}
+		}
+	}
+	for _, r := range ranges {
+		msg.ReservedRange = append(msg.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{
+			Start: proto.Int32(r),
+			End:   proto.Int32(r + 1),
+		})
+	}
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("event.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			msg,
+			{Name: proto.String("Place"), Field: place},
+		},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name:  proto.String("Status"),
+			Value: enumValues(status...),
+		}},
+	}}}
+}
+
+func TestCompareFiles(t *testing.T) {
+	from := fileSet(
+		[]*descriptorpb.FieldDescriptorProto{
+			field("id", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+			field("name", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			field("count", 3, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+			field("ratio", 4, optional, descriptorpb.FieldDescriptorProto_TYPE_FLOAT, ""),
+			field("tags", 5, repeated, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			field("old", 6, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			field("older", 7, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			field("oldest", 8, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			field("place", 9, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Place"),
+			inOneof(field("alias", 10, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""), 0),
+			field("status", 11, optional, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".test.Status"),
+			field("moved", 12, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+		},
+		[]*descriptorpb.FieldDescriptorProto{
+			field("lat", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+		},
+		nil,
+		nil,
+		[]string{"UNKNOWN", "ACTIVE", "DONE", "GONE"},
+	)
+	jsonName := field("name", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	jsonName.JsonName = proto.String("title")
+	to := fileSet(
+		[]*descriptorpb.FieldDescriptorProto{
+			field("id", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+			jsonName,
+			field("count", 3, optional, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+			field("ratio", 4, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			field("tags", 5, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			field("place", 9, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Place"),
+			field("alias", 10, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			field("status", 11, optional, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".test.Status"),
+			field("moved", 13, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+		},
+		[]*descriptorpb.FieldDescriptorProto{
+			field("latitude", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+		},
+		[]string{"oldest"},
+		[]int32{7, 8},
+		[]string{"UNKNOWN", "ACTIVE", "", "GONER"},
+	)
+
+	expected := []Change{
+		{JSONNameChanged, SeverityJSON, "test.Event.name", "JSON name changed from name to title"},
+		{KindChanged, SeverityJSON, "test.Event.count", "kind changed from int32 to int64"},
+		{KindChanged, SeverityWire, "test.Event.ratio", "kind changed from float to string"},
+		{CardinalityChanged, SeverityWire, "test.Event.tags", "cardinality changed from repeated to optional"},
+		{FieldRemoved, SeverityWire, "test.Event.old", "field 6 removed without reserving its number"},
+		{FieldRemoved, SeverityJSON, "test.Event.older", "field 7 removed without reserving its name"},
+		{FieldRenamed, SeverityJSON, "test.Place.lat", "field 1 renamed to latitude"},
+		{JSONNameChanged, SeverityJSON, "test.Place.lat", "JSON name changed from lat to latitude"},
+		{OneofChanged, SeverityWire, "test.Event.alias", "oneof changed from choice (10) to (none)"},
+		{EnumValueRemoved, SeverityJSON, "test.DONE", "enum value 2 removed"},
+		{EnumValueRenamed, SeverityJSON, "test.GONE", "enum value 3 renamed to GONER"},
+		{FieldNumberChanged, SeverityWire, "test.Event.moved", "field number changed from 12 to 13"},
+	}
+
+	cases := []struct {
+		names    []protoreflect.FullName
+		expected []Change
+		name     string
+	}{
+		{nil, expected, "all"},
+		{[]protoreflect.FullName{"test.Event"}, expected, "root"},
+		{[]protoreflect.FullName{"test.Place"}, expected[6:8], "nested"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := CompareFiles(from, to, c.names...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(actual.Changes, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual.Changes)
+			}
+		})
+	}
+
+	if _, err := CompareFiles(from, to, "test.Nope"); err == nil {
+		t.Errorf("expected error for unknown message")
+	}
+}
+
+func TestCompareFiles_Oneofs(t *testing.T) {
+	oneofFields := func() []*descriptorpb.FieldDescriptorProto {
+		return []*descriptorpb.FieldDescriptorProto{
+			field("id", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+			inOneof(field("alias", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""), 0),
+			inOneof(field("nick", 3, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""), 0),
+		}
+	}
+	newFileSet := func(fields []*descriptorpb.FieldDescriptorProto, oneofs ...string) *descriptorpb.FileDescriptorSet {
+		fs := fileSet(fields, nil, nil, nil, []string{"UNKNOWN"})
+		msg := fs.File[0].MessageType[0]
+		msg.OneofDecl = nil
+		for _, n := range oneofs {
+			msg.OneofDecl = append(msg.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String(n)})
+		}
+		return fs
+	}
+	from := newFileSet(oneofFields(), "choice")
+
+	split := oneofFields()
+	split[2].OneofIndex = proto.Int32(1)
+	added := append(oneofFields(), inOneof(field("handle", 4, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""), 0))
+
+	cases := []struct {
+		to       *descriptorpb.FileDescriptorSet
+		expected []Change
+		name     string
+	}{
+		{newFileSet(oneofFields(), "variant"), nil, "renamed"},
+		{newFileSet(added, "choice"), nil, "member added"},
+		{
+			newFileSet(split, "choice", "other"),
+			[]Change{
+				{OneofChanged, SeverityWire, "test.Event.alias", "oneof changed from choice (2, 3) to choice (2)"},
+				{OneofChanged, SeverityWire, "test.Event.nick", "oneof changed from choice (2, 3) to other (3)"},
+			},
+			"split",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := CompareFiles(from, c.to)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(actual.Changes, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual.Changes)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	r := &Report{Changes: []Change{
+		{FieldRenamed, SeverityJSON, "test.Event.a", "field 1 renamed to b"},
+		{FieldRemoved, SeverityWire, "test.Event.c", "field 3 removed without reserving its number"},
+	}}
+
+	cases := []struct {
+		input        *Report
+		expected     Severity
+		expectedText string
+		expectedJSON string
+		name         string
+	}{
+		{
+			&Report{},
+			SeverityNone,
+			"",
+			`{"severity":"NONE","changes":[]}` + "\n",
+			"empty",
+		},
+		{
+			r,
+			SeverityWire,
+			"JSON test.Event.a: field 1 renamed to b\n" +
+				"WIRE test.Event.c: field 3 removed without reserving its number\n",
+			`{"severity":"WIRE","changes":[` +
+				`{"kind":"FIELD_RENAMED","severity":"JSON","path":"test.Event.a","message":"field 1 renamed to b"},` +
+				`{"kind":"FIELD_REMOVED","severity":"WIRE","path":"test.Event.c","message":"field 3 removed without reserving its number"}]}` + "\n",
+			"changes",
+		},
+		{
+			r.Filter(SeverityWire),
+			SeverityWire,
+			"WIRE test.Event.c: field 3 removed without reserving its number\n",
+			`{"severity":"WIRE","changes":[` +
+				`{"kind":"FIELD_REMOVED","severity":"WIRE","path":"test.Event.c","message":"field 3 removed without reserving its number"}]}` + "\n",
+			"filtered",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := c.input.Severity(); actual != c.expected {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+			buf := &bytes.Buffer{}
+			if err := c.input.WriteText(buf); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual := buf.String(); actual != c.expectedText {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expectedText, actual)
+			}
+			buf.Reset()
+			if err := c.input.WriteJSON(buf); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual := buf.String(); actual != c.expectedJSON {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expectedJSON, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package compat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A Severity is the level of compatibility a change breaks.
+type Severity int
+
+const (
+	// SeverityNone is the severity of a report without changes.
+	SeverityNone = Severity(iota)
+	// SeverityJSON changes break the JSON and text formats, but not the wire
+	// format.
+	SeverityJSON
+	// SeverityWire changes break the wire format.
+	SeverityWire
+)
+
+var severityNames = map[Severity]string{
+	SeverityNone: "NONE",
+	SeverityJSON: "JSON",
+	SeverityWire: "WIRE",
+}
+
+func (s Severity) String() string {
+	if n, ok := severityNames[s]; ok {
+		return n
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(bs []byte) error {
+	for k, v := range severityNames {
+		if v == string(bs) {
+			*s = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", bs)
+}
+
+// A Kind classifies a change.
+type Kind int
+
+const (
+	FieldNumberChanged = Kind(iota)
+	KindChanged
+	CardinalityChanged
+	FieldRemoved
+	FieldRenamed
+	JSONNameChanged
+	OneofChanged
+	EnumValueRemoved
+	EnumValueRenamed
+)
+
+var kindNames = map[Kind]string{
+	FieldNumberChanged: "FIELD_NUMBER_CHANGED",
+	KindChanged:        "KIND_CHANGED",
+	CardinalityChanged: "CARDINALITY_CHANGED",
+	FieldRemoved:       "FIELD_REMOVED",
+	FieldRenamed:       "FIELD_RENAMED",
+	JSONNameChanged:    "JSON_NAME_CHANGED",
+	OneofChanged:       "ONEOF_CHANGED",
+	EnumValueRemoved:   "ENUM_VALUE_REMOVED",
+	EnumValueRenamed:   "ENUM_VALUE_RENAMED",
+}
+
+func (k Kind) String() string {
+	if n, ok := kindNames[k]; ok {
+		return n
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *Kind) UnmarshalText(bs []byte) error {
+	for n, v := range kindNames {
+		if v == string(bs) {
+			*k = n
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown kind %q", bs)
+}
+
+// A Change is a difference between two versions of a message or enum type.
+type Change struct {
+	Kind     Kind     `json:"kind"`
+	Severity Severity `json:"severity"`
+	// Path is the full name of the field or enum value in the old version.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s: %s", c.Severity, c.Path, c.Message)
+}
+
+// A Report holds the changes between two versions, in order of traversal.
+type Report struct {
+	Changes []Change `json:"changes"`
+}
+
+// Severity returns the highest severity of the changes.
+func (r *Report) Severity() Severity {
+	s := SeverityNone
+	for _, c := range r.Changes {
+		if c.Severity > s {
+			s = c.Severity
+		}
+	}
+	return s
+}
+
+// Filter returns a report with the changes of at least the given severity.
+func (r *Report) Filter(min Severity) *Report {
+	out := &Report{}
+	for _, c := range r.Changes {
+		if c.Severity >= min {
+			out.Changes = append(out.Changes, c)
+		}
+	}
+	return out
+}
+
+// String returns the changes as text, one per line.
+func (r *Report) String() string {
+	sb := &strings.Builder{}
+	for _, c := range r.Changes {
+		sb.WriteString(c.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// WriteText writes the changes as text, one per line.
+func (r *Report) WriteText(w io.Writer) error {
+	_, err := io.WriteString(w, r.String())
+	return err
+}
+
+// WriteJSON writes the report as a JSON object, with its overall severity.
+func (r *Report) WriteJSON(w io.Writer) error {
+	changes := r.Changes
+	if changes == nil {
+		changes = []Change{}
+	}
+	return json.NewEncoder(w).Encode(struct {
+		Severity Severity `json:"severity"`
+		Changes  []Change `json:"changes"`
+	}{r.Severity(), changes})
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package transforms
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strconv"
+	"strings"
+)
+
+// A WalkContext describes where in a message the Walker is. It is passed to
+// context-aware override functions and is only valid during such a call.
+type WalkContext struct {
+	// Field is the field being converted. For map values, this is the value
+	// field of the map entry.
+	Field protoreflect.FieldDescriptor
+
+	// Name is the dotted name of the field, as used by OptionAddNameOverride.
+	Name string
+
+	// Path holds the fields leading to the value, starting at the root. List
+	// items and map values are identified by their index or key. A map value
+	// is followed by the value field of the map entry.
+	Path []PathElement
+
+	// Parent is the message containing the field. It is nil when walking a
+	// descriptor.
+	Parent protoreflect.Message
+
+	// Root is the message being walked. It is nil when walking a descriptor.
+	Root protoreflect.Message
+
+	// Depth is the remaining message recursion depth.
+	Depth int
+}
+
+// A PathElement is a field on the path to a value. For list items and map
+// values, it also holds their position within the field.
+type PathElement struct {
+	Field protoreflect.FieldDescriptor
+	// Index is the index of a list item, or -1.
+	Index int
+	// Key is the key of a map value. It is invalid for other values.
+	Key protoreflect.MapKey
+}
+
+// String renders the path with indices and keys, i.e. 'items[0].price' or
+// 'attributes["color"]'.
+func (c *WalkContext) String() string {
+	sb := strings.Builder{}
+	for i, e := range c.Path {
+		if i > 0 && c.Path[i-1].Key.IsValid() && isMapValue(e.Field) {
+			// the value field is implied by the key
+			continue
+		}
+		if i > 0 {
+			sb.WriteString(".")
+		}
+		sb.WriteString(string(e.Field.Name()))
+		if e.Index >= 0 {
+			sb.WriteString("[")
+			sb.WriteString(strconv.Itoa(e.Index))
+			sb.WriteString("]")
+		} else if e.Key.IsValid() {
+			sb.WriteString("[")
+			sb.WriteString(formatMapKey(e.Key))
+			sb.WriteString("]")
+		}
+	}
+	return sb.String()
+}
+
+func formatMapKey(k protoreflect.MapKey) string {
+	switch x := k.Interface().(type) {
+	case string:
+		return strconv.Quote(x)
+	default:
+		return k.String()
+	}
+}
+
+type ContextOverrideFunc func(*WalkContext, interface{}) interface{}
+
+type ContextScalarFunc func(*WalkContext, *protoreflect.Value) interface{}
+type ContextMessageFunc func(*WalkContext, []KeyValue) interface{}
+type ContextMapFunc func(*WalkContext, map[interface{}]interface{}) interface{}
+type ContextRepeatedFunc func(*WalkContext, []interface{}) interface{}
+
+// WithContext creates a ContextOverrideFunc from an OverrideFunc.
+func WithContext(f OverrideFunc) ContextOverrideFunc {
+	return func(c *WalkContext, v interface{}) interface{} {
+		return f(c.Field, v)
+	}
+}
+
+// FromContextScalarFunc creates a ContextOverrideFunc from a
+// ContextScalarFunc.
+func FromContextScalarFunc(f ContextScalarFunc) ContextOverrideFunc {
+	return func(c *WalkContext, v interface{}) interface{} {
+		return f(c, v.(*protoreflect.Value))
+	}
+}
+
+func FromContextMessageFunc(f ContextMessageFunc) ContextOverrideFunc {
+	return func(c *WalkContext, v interface{}) interface{} {
+		return f(c, v.([]KeyValue))
+	}
+}
+
+func FromContextMapFunc(f ContextMapFunc) ContextOverrideFunc {
+	return func(c *WalkContext, v interface{}) interface{} {
+		return f(c, v.(map[interface{}]interface{}))
+	}
+}
+
+func FromContextRepeatedFunc(f ContextRepeatedFunc) ContextOverrideFunc {
+	return func(c *WalkContext, v interface{}) interface{} {
+		return f(c, v.([]interface{}))
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package transforms
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/apipb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"reflect"
+	"testing"
+)
+
+func TestOptionAddNameOverride_Context(t *testing.T) {
+	apiInput := &apipb.Api{
+		Name: "foo",
+		Methods: []*apipb.Method{
+			{Name: "foo_method", RequestTypeUrl: "Foo"},
+			{Name: "bar_method", RequestTypeUrl: "Bar"},
+		},
+	}
+
+	cases := []struct {
+		walker   Walker
+		input    proto.Message
+		expected interface{}
+		name     string
+	}{
+		{
+			NewWalker(OptionAddNameOverride(
+				"methods.request_type_url",
+				func(c *WalkContext, v *protoreflect.Value) interface{} {
+					// use sibling field
+					name := c.Parent.Get(c.Parent.Descriptor().Fields().ByName("name"))
+					return name.String() + ":" + v.String()
+				},
+			)),
+			apiInput,
+			map[string]interface{}{
+				"name": "foo",
+				"methods": []interface{}{
+					map[string]interface{}{"name": "foo_method", "request_type_url": "foo_method:Foo"},
+					map[string]interface{}{"name": "bar_method", "request_type_url": "bar_method:Bar"},
+				},
+			},
+			"scalar with sibling",
+		},
+		{
+			NewWalker(OptionAddNameOverride(
+				"methods",
+				ContextMessageFunc(func(c *WalkContext, kvs []KeyValue) interface{} {
+					return fmt.Sprintf("%s %s %d", c, c.Name, c.Depth)
+				}),
+			)),
+			apiInput,
+			map[string]interface{}{
+				"name":    "foo",
+				"methods": []interface{}{"methods[0] methods 98", "methods[1] methods 98"},
+			},
+			"message with index",
+		},
+		{
+			NewWalker(OptionAddNameOverride(
+				"name",
+				func(c *WalkContext, v *protoreflect.Value) interface{} {
+					return c.Root.Interface() == c.Parent.Interface()
+				},
+			)),
+			apiInput,
+			map[string]interface{}{
+				"name": true,
+				"methods": []interface{}{
+					map[string]interface{}{"name": "foo_method", "request_type_url": "Foo"},
+					map[string]interface{}{"name": "bar_method", "request_type_url": "Bar"},
+				},
+			},
+			"root",
+		},
+		{
+			NewWalker(OptionAddNameOverride(
+				"fields.value.string_value",
+				func(c *WalkContext, v *protoreflect.Value) interface{} {
+					return c.String()
+				},
+			)),
+			&structpb.Struct{
+				Fields: map[string]*structpb.Value{
+					"foo": structpb.NewStringValue("bla"),
+				},
+			},
+			map[string]interface{}{
+				"fields": map[interface{}]interface{}{
+					"foo": map[string]interface{}{"string_value": `fields["foo"].string_value`},
+				},
+			},
+			"map value",
+		},
+		{
+			NewWalker(OptionAddNameOverride(
+				"fields",
+				func(c *WalkContext, m map[interface{}]interface{}) interface{} {
+					return c.String()
+				},
+			)),
+			&structpb.Struct{
+				Fields: map[string]*structpb.Value{
+					"foo": structpb.NewStringValue("bla"),
+				},
+			},
+			map[string]interface{}{"fields": "fields"},
+			"map",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := c.walker.Apply(c.input); !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestOptionAddNameOverride_ContextDescriptor(t *testing.T) {
+	var actual []string
+	walker := NewWalker(
+		OptionMaxDepth(1),
+		OptionAddNameOverride(
+			"source_context",
+			func(c *WalkContext, kvs []KeyValue) interface{} {
+				actual = append(actual, fmt.Sprintf("%s %v %v %d", c, c.Parent, c.Root, c.Depth))
+				return nil
+			},
+		),
+	)
+	walker.ApplyDesc((&apipb.Api{}).ProtoReflect().Descriptor())
+	expected := []string{"source_context <nil> <nil> 0"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, \ngot      %v", expected, actual)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package csv
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type nodeKind int
+
+const (
+	// valueNode is a scalar or timestamp in a single cell
+	valueNode = nodeKind(iota)
+	// cellNode is a repeated field or map in a single cell
+	cellNode
+	// messageNode is a message flattened into the columns of its fields
+	messageNode
+	// listNode is an exploded repeated field; its child is the item
+	listNode
+	// mapNode is an exploded map; its children are the key and value
+	mapNode
+)
+
+// A node is a field, list item or map key or value, spanning one or more
+// columns.
+type node struct {
+	// name is the column name, or the prefix of the column names of a message
+	name string
+	// key is the key of the value in its message, as produced by the Walker
+	key      string
+	kind     nodeKind
+	fd       protoreflect.FieldDescriptor
+	children []*node
+}
+
+// columns appends the names of the columns of the node.
+func (n *node) columns(out []string) []string {
+	if n.kind == valueNode || n.kind == cellNode {
+		return append(out, n.name)
+	}
+	for _, c := range n.children {
+		out = c.columns(out)
+	}
+	return out
+}
+
+// width returns the number of columns of the node.
+func (n *node) width() int {
+	return len(n.columns(nil))
+}
+
+// A resolver resolves the nodes for the fields of a message type.
+type resolver struct {
+	repeated RepeatedPolicy
+}
+
+func newResolver(c *config) *resolver {
+	return &resolver{
+		repeated: c.repeated,
+	}
+}
+
+// fields returns the nodes for the fields of a message. The allowed depth
+// mirrors that of the Walker: message values are only included if it is not
+// negative.
+func (r *resolver) fields(md protoreflect.MessageDescriptor, prefix string, allowedDepth int) []*node {
+	var out []*node
+	for _, fd := range transforms.DescriptorFields(md) {
+		if n := r.field(fd, prefix+string(fd.Name()), allowedDepth); n != nil {
+			n.key = string(fd.Name())
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func (r *resolver) field(fd protoreflect.FieldDescriptor, name string, allowedDepth int) *node {
+	switch {
+	case fd.IsMap():
+		value := r.value(fd.MapValue(), name+".value", allowedDepth)
+		if value == nil {
+			return nil
+		}
+		if r.repeated != RepeatedExploded {
+			return &node{name: name, kind: cellNode, fd: fd}
+		}
+		key := &node{name: name + ".key", kind: valueNode, fd: fd.MapKey()}
+		return &node{name: name, kind: mapNode, fd: fd, children: []*node{key, value}}
+	case fd.IsList():
+		item := r.value(fd, name, allowedDepth)
+		if item == nil {
+			return nil
+		}
+		if r.repeated != RepeatedExploded {
+			return &node{name: name, kind: cellNode, fd: fd}
+		}
+		return &node{name: name, kind: listNode, fd: fd, children: []*node{item}}
+	}
+	return r.value(fd, name, allowedDepth)
+}
+
+// value returns the node for a single value of a field, or nil if it is a
+// message beyond the maximum depth.
+func (r *resolver) value(fd protoreflect.FieldDescriptor, name string, allowedDepth int) *node {
+	switch {
+	case fd.Message() == nil:
+		return &node{name: name, kind: valueNode, fd: fd}
+	case allowedDepth < 0:
+		return nil
+	case fd.Message().FullName() == timestampName:
+		return &node{name: name, kind: valueNode, fd: fd}
+	}
+	return &node{
+		name:     name,
+		kind:     messageNode,
+		fd:       fd,
+		children: r.fields(fd.Message(), name+".", allowedDepth-1),
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package csv writes messages as CSV or TSV, one line per message.
+//
+// The columns follow from the message descriptor: nested messages are
+// flattened into columns named by their dotted paths (i.e. 'place.lat'), in
+// field number order. Repeated fields and maps are written as JSON, joined in
+// a single cell or exploded into multiple lines (see OptionRepeatedPolicy).
+//
+// Cells hold the values as by strconv; enums are written by name, bytes as
+// standard base64 and google.protobuf.Timestamp as RFC 3339. Unset fields
+// that track presence (message fields, oneof members and optional fields) are
+// written as the null representation (see OptionNull), as are the fields of
+// unset messages. Other unset fields hold their default values. Message fields
+// beyond the maximum depth (see OptionMaxDepth) are left out.
+package csv
+
+import (
+	"fmt"
+)
+
+const (
+	timestampName = "google.protobuf.Timestamp"
+
+	defaultMaxDepth  = 10
+	defaultSeparator = "|"
+)
+
+// A RepeatedPolicy determines how repeated fields and maps are written.
+type RepeatedPolicy int
+
+const (
+	// RepeatedAsJSON writes the field as a JSON array or object in a single
+	// cell. This is the default.
+	RepeatedAsJSON = RepeatedPolicy(iota)
+	// RepeatedJoined writes the items in a single cell, joined by the
+	// separator (see OptionSeparator). Map entries are written as
+	// 'key=value', ordered by key; messages are written as JSON.
+	RepeatedJoined
+	// RepeatedExploded writes a line per item. Map entries get a 'key' and a
+	// 'value' column; repeated messages are flattened into columns. Multiple
+	// exploded fields yield a line per combination of their items. An empty
+	// field yields a single line of nulls for its columns.
+	RepeatedExploded
+)
+
+type config struct {
+	repeated  RepeatedPolicy
+	separator string
+	null      string
+	comma     rune
+	header    bool
+	maxDepth  int
+}
+
+type Option interface {
+	// Apply applies the Option to the Writer.
+	Apply(c *config)
+}
+
+type optionRepeatedPolicy struct {
+	value RepeatedPolicy
+}
+
+func (o *optionRepeatedPolicy) Apply(c *config) {
+	c.repeated = o.value
+}
+
+// OptionRepeatedPolicy sets how repeated fields and maps are written. Defaults
+// to RepeatedAsJSON.
+func OptionRepeatedPolicy(v RepeatedPolicy) Option {
+	if v < RepeatedAsJSON || v > RepeatedExploded {
+		panic(fmt.Sprintf("unknown repeated policy %d", v))
+	}
+	return &optionRepeatedPolicy{value: v}
+}
+
+type optionSeparator struct {
+	value string
+}
+
+func (o *optionSeparator) Apply(c *config) {
+	c.separator = o.value
+}
+
+// OptionSeparator sets the separator of joined items (see RepeatedJoined).
+// Defaults to "|".
+func OptionSeparator(v string) Option {
+	return &optionSeparator{value: v}
+}
+
+type optionNull struct {
+	value string
+}
+
+func (o *optionNull) Apply(c *config) {
+	c.null = o.value
+}
+
+// OptionNull sets the representation of null values, i.e. "NULL" or `\N`.
+// Defaults to an empty string.
+func OptionNull(v string) Option {
+	return &optionNull{value: v}
+}
+
+type optionComma struct {
+	value rune
+}
+
+func (o *optionComma) Apply(c *config) {
+	c.comma = o.value
+}
+
+// OptionComma sets the field delimiter, i.e. '\t' for TSV. Defaults to ','.
+// See csv.Writer.
+func OptionComma(v rune) Option {
+	return &optionComma{value: v}
+}
+
+type optionHeader struct {
+	value bool
+}
+
+func (o *optionHeader) Apply(c *config) {
+	c.header = o.value
+}
+
+// OptionHeader sets whether a header line with the column names is written.
+// Defaults to true.
+func OptionHeader(v bool) Option {
+	return &optionHeader{value: v}
+}
+
+type optionMaxDepth struct {
+	value int
+}
+
+func (o *optionMaxDepth) Apply(c *config) {
+	c.maxDepth = o.value
+}
+
+// OptionMaxDepth sets a maximum message recursion depth. Message fields beyond
+// it are left out. Defaults to 10. See transforms.OptionMaxDepth.
+func OptionMaxDepth(v int) Option {
+	return &optionMaxDepth{value: v}
+}
+
+func newConfig(options []Option) *config {
+	c := &config{
+		separator: defaultSeparator,
+		comma:     ',',
+		header:    true,
+		maxDepth:  defaultMaxDepth,
+	}
+	for _, o := range options {
+		o.Apply(c)
+	}
+	return c
+}
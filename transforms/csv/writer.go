@@ -0,0 +1,299 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package csv
+
+import (
+	"encoding/base64"
+	stdcsv "encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Writer writes messages of a single type as CSV. It is not safe for
+// concurrent use.
+//
+// Lines are buffered by an encoding/csv Writer; call Flush to write them.
+type Writer struct {
+	w           *stdcsv.Writer
+	md          protoreflect.MessageDescriptor
+	config      *config
+	walker      transforms.Walker
+	nodes       []*node
+	header      []string
+	wroteHeader bool
+}
+
+// NewWriter creates a new Writer for messages of the given type.
+func NewWriter(w io.Writer, md protoreflect.MessageDescriptor, options ...Option) *Writer {
+	c := newConfig(options)
+	cw := stdcsv.NewWriter(w)
+	cw.Comma = c.comma
+	nodes := newResolver(c).fields(md, "", c.maxDepth-1)
+	var header []string
+	for _, n := range nodes {
+		header = n.columns(header)
+	}
+	return &Writer{
+		w:      cw,
+		md:     md,
+		config: c,
+		walker: transforms.NewWalker(
+			transforms.OptionKeepSet(true),
+			transforms.OptionMaxDepth(c.maxDepth),
+			transforms.OptionDefaultScalarFunc(convertScalar),
+			transforms.OptionMapStrategy(transforms.MapStringKeys),
+			transforms.OptionAddTypeOverride(timestampName, convertTimestamp),
+		),
+		nodes:  nodes,
+		header: header,
+	}
+}
+
+func convertScalar(fd protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	if fd.Kind() == protoreflect.EnumKind {
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return int32(v.Enum())
+	}
+	return v.Interface()
+}
+
+func convertTimestamp(_ protoreflect.FieldDescriptor, kvs []transforms.KeyValue) interface{} {
+	seconds, nanos := int64(0), int64(0)
+	for _, kv := range kvs {
+		switch kv.Key {
+		case "seconds":
+			seconds = kv.Value.(int64)
+		case "nanos":
+			nanos = int64(kv.Value.(int32))
+		}
+	}
+	return time.Unix(seconds, nanos).UTC()
+}
+
+// Header returns the column names.
+func (cw *Writer) Header() []string {
+	return cw.header
+}
+
+// Write writes the lines for a message, preceded by the header if it has not
+// been written yet.
+func (cw *Writer) Write(m proto.Message) error {
+	if m == nil {
+		return fmt.Errorf("cannot write nil message")
+	}
+	if d := m.ProtoReflect().Descriptor(); d.FullName() != cw.md.FullName() {
+		return fmt.Errorf("expected message of type %s, got %s", cw.md.FullName(), d.FullName())
+	}
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	row, _ := cw.walker.Apply(m).(map[string]interface{})
+	lines, err := cw.fields(cw.nodes, row, false)
+	if err != nil {
+		return err
+	}
+	return cw.w.WriteAll(lines)
+}
+
+// Flush writes any buffered lines, including the header if no message has
+// been written.
+func (cw *Writer) Flush() error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *Writer) writeHeader() error {
+	if cw.wroteHeader || !cw.config.header {
+		return nil
+	}
+	cw.wroteHeader = true
+	return cw.w.Write(cw.header)
+}
+
+// fields returns the lines for the fields of a message: the combinations of
+// the lines of each field.
+func (cw *Writer) fields(ns []*node, m map[string]interface{}, null bool) ([][]string, error) {
+	out := [][]string{{}}
+	for _, n := range ns {
+		lines, err := cw.lines(n, m[n.key], null)
+		if err != nil {
+			return nil, err
+		}
+		next := make([][]string, 0, len(out)*len(lines))
+		for _, prefix := range out {
+			for _, l := range lines {
+				next = append(next, append(prefix[:len(prefix):len(prefix)], l...))
+			}
+		}
+		out = next
+	}
+	return out, nil
+}
+
+// lines returns the cells of a node, per line. Only exploded fields yield
+// more than one line. If null is set, the node is part of an unset message.
+func (cw *Writer) lines(n *node, v interface{}, null bool) ([][]string, error) {
+	switch n.kind {
+	case messageNode:
+		m, _ := v.(map[string]interface{})
+		return cw.fields(n.children, m, null || m == nil)
+	case listNode:
+		xs, _ := v.([]interface{})
+		if len(xs) == 0 {
+			return [][]string{cw.nulls(n)}, nil
+		}
+		var out [][]string
+		for _, x := range xs {
+			lines, err := cw.lines(n.children[0], x, false)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, lines...)
+		}
+		return out, nil
+	case mapNode:
+		m, _ := v.(map[string]interface{})
+		if len(m) == 0 {
+			return [][]string{cw.nulls(n)}, nil
+		}
+		var out [][]string
+		for _, k := range sortedKeys(m) {
+			lines, err := cw.lines(n.children[1], m[k], false)
+			if err != nil {
+				return nil, err
+			}
+			for _, l := range lines {
+				out = append(out, append([]string{k}, l...))
+			}
+		}
+		return out, nil
+	}
+	cell, err := cw.cell(n, v, null)
+	if err != nil {
+		return nil, err
+	}
+	return [][]string{{cell}}, nil
+}
+
+func (cw *Writer) nulls(n *node) []string {
+	out := make([]string, n.width())
+	for i := range out {
+		out[i] = cw.config.null
+	}
+	return out
+}
+
+// cell returns the cell of a value or cell node.
+func (cw *Writer) cell(n *node, v interface{}, null bool) (string, error) {
+	fd := n.fd
+	switch {
+	case null:
+		return cw.config.null, nil
+	case v == nil && n.kind == cellNode:
+		if fd.IsMap() {
+			v = map[string]interface{}{}
+		} else {
+			v = []interface{}{}
+		}
+	case v == nil && (fd.HasPresence() || fd.Message() != nil):
+		return cw.config.null, nil
+	case v == nil:
+		d := fd.Default()
+		v = convertScalar(fd, &d)
+	}
+	if n.kind == valueNode {
+		return formatValue(v), nil
+	}
+	if cw.config.repeated == RepeatedAsJSON {
+		return marshal(v)
+	}
+	var items []string
+	switch x := v.(type) {
+	case []interface{}:
+		for _, item := range x {
+			s, err := formatItem(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+	case map[string]interface{}:
+		for _, k := range sortedKeys(x) {
+			s, err := formatItem(x[k])
+			if err != nil {
+				return "", err
+			}
+			items = append(items, k+"="+s)
+		}
+	}
+	return strings.Join(items, cw.config.separator), nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+// formatItem formats an item of a joined field; messages are written as JSON.
+func formatItem(v interface{}) (string, error) {
+	if _, ok := v.(map[string]interface{}); ok {
+		return marshal(v)
+	}
+	return formatValue(v), nil
+}
+
+func marshal(v interface{}) (string, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+func formatValue(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case bool:
+		return strconv.FormatBool(x)
+	case int32:
+		return strconv.FormatInt(int64(x), 10)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case uint32:
+		return strconv.FormatUint(uint64(x), 10)
+	case uint64:
+		return strconv.FormatUint(x, 10)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(x)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
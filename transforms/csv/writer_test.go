@@ -0,0 +1,117 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package csv
+
+import (
+	"bytes"
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"reflect"
+	"testing"
+)
+
+const fullEvent = `{
+  "id": "1",
+  "name": "a, b",
+  "ratio": 0.5,
+  "count": 4294967295,
+  "status": "ACTIVE",
+  "tags": ["x", "y"],
+  "attrs": {"b": "2", "a": "1"},
+  "created": "1970-01-01T00:00:01.000002Z",
+  "alias": "q",
+  "place": {"lat": 1.5, "seen": ["1970-01-01T00:00:02Z"]},
+  "stops": [{"status": "ACTIVE"}, {"lat": 2}],
+  "states": ["ACTIVE", "UNKNOWN"]
+}`
+
+func TestWriter_Header(t *testing.T) {
+	event := (&testpb.FlatEvent{}).ProtoReflect().Descriptor()
+
+	cases := []struct {
+		options  []Option
+		expected []string
+		name     string
+	}{
+		{
+			nil,
+			[]string{"id", "name", "ratio", "count", "status", "tags", "attrs", "created", "alias", "place.lat", "place.status", "place.seen", "stops", "states"},
+			"default",
+		},
+		{
+			[]Option{OptionRepeatedPolicy(RepeatedExploded)},
+			[]string{"id", "name", "ratio", "count", "status", "tags", "attrs.key", "attrs.value", "created", "alias", "place.lat", "place.status", "place.seen", "stops.lat", "stops.status", "stops.seen", "states"},
+			"exploded",
+		},
+		{
+			[]Option{OptionMaxDepth(1)},
+			[]string{"id", "name", "ratio", "count", "status", "tags", "attrs", "created", "alias", "place.lat", "place.status", "stops", "states"},
+			"max depth",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := NewWriter(&bytes.Buffer{}, event, c.options...).Header()
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %#v, \ngot      %#v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	event := (&testpb.FlatEvent{}).ProtoReflect().Descriptor()
+
+	cases := []struct {
+		options  []Option
+		inputs   []string
+		expected string
+		name     string
+	}{
+		{
+			nil,
+			[]string{fullEvent, `{"id": "2"}`},
+			`id,name,ratio,count,status,tags,attrs,created,alias,place.lat,place.status,place.seen,stops,states
+1,"a, b",0.5,4294967295,ACTIVE,"[""x"",""y""]","{""a"":1,""b"":2}",1970-01-01T00:00:01.000002Z,q,1.5,UNKNOWN,"[""1970-01-01T00:00:02Z""]","[{""status"":""ACTIVE""},{""lat"":2}]","[""ACTIVE"",""UNKNOWN""]"
+2,,0,0,UNKNOWN,[],{},,,,,,[],[]
+`,
+			"default",
+		},
+		{
+			[]Option{OptionRepeatedPolicy(RepeatedJoined), OptionNull("NULL"), OptionComma('\t'), OptionHeader(false)},
+			[]string{fullEvent, `{"id": "2"}`},
+			"1\ta, b\t0.5\t4294967295\tACTIVE\tx|y\ta=1|b=2\t1970-01-01T00:00:01.000002Z\tq\t1.5\tUNKNOWN\t1970-01-01T00:00:02Z\t\"{\"\"status\"\":\"\"ACTIVE\"\"}|{\"\"lat\"\":2}\"\tACTIVE|UNKNOWN\n" +
+				"2\t\t0\t0\tUNKNOWN\t\t\tNULL\tNULL\tNULL\tNULL\tNULL\t\t\n",
+			"joined",
+		},
+		{
+			[]Option{OptionRepeatedPolicy(RepeatedExploded), OptionMaxDepth(1)},
+			[]string{`{"id": "1", "tags": ["x", "y"], "stops": [{"status": "ACTIVE"}, {"lat": 2}]}`, `{"id": "2"}`},
+			`id,name,ratio,count,status,tags,attrs.key,attrs.value,created,alias,place.lat,place.status,stops.lat,stops.status,states
+1,,0,0,UNKNOWN,x,,,,,,,0,ACTIVE,
+1,,0,0,UNKNOWN,x,,,,,,,2,UNKNOWN,
+1,,0,0,UNKNOWN,y,,,,,,,0,ACTIVE,
+1,,0,0,UNKNOWN,y,,,,,,,2,UNKNOWN,
+2,,0,0,UNKNOWN,,,,,,,,,,
+`,
+			"exploded",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w := NewWriter(buf, event, c.options...)
+			for _, in := range c.inputs {
+				if err := w.Write(testpb.NewFlatEvent(t, in)); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual := buf.String(); actual != c.expected {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
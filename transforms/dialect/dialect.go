@@ -0,0 +1,263 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package dialect converts message descriptors into CREATE TABLE statements
+// and messages into insert parameters for SQL databases with nested types.
+//
+// A Dialect describes a database as a table of type names and formats. The
+// ClickHouse and DuckDB dialects are predefined; others can be added without
+// code. Messages map to structs, repeated fields to arrays and maps to maps.
+// Enums map to strings, holding the value's name, or its number for unknown
+// values. Columns and struct fields are in field number order. Message fields
+// beyond the maximum depth (see OptionMaxDepth) are left out, as are those of
+// messages without fields, since structs need at least one field.
+//
+// Databases that deviate from this can set the hooks of a Dialect: fields can
+// be stored as JSON, as named types or as Protocol Buffers types (see Mapping),
+// and values can be converted as their drivers expect.
+package dialect
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+)
+
+// A StructValues determines how struct values are passed as parameters.
+type StructValues int
+
+const (
+	// StructsAsSlices passes structs as an []interface{} of their field
+	// values, in field order.
+	StructsAsSlices = StructValues(iota)
+	// StructsAsMaps passes structs as a map[string]interface{}.
+	StructsAsMaps
+)
+
+// An ArrayValues determines how array values are passed as parameters.
+type ArrayValues int
+
+const (
+	// ArraysAsInterfaces passes arrays as an []interface{}.
+	ArraysAsInterfaces = ArrayValues(iota)
+	// ArraysAsTyped passes arrays as slices of the type of their items, like
+	// []int64. Arrays of structs are passed as an []interface{}.
+	ArraysAsTyped
+)
+
+// A Mapping determines how the values of a field are stored.
+type Mapping int
+
+const (
+	// Native stores values in the types of the dialect: scalars, structs,
+	// arrays and maps. This is the default.
+	Native = Mapping(iota)
+	// AsJSON stores values as JSON, in the dialect's JSON type. Lists and
+	// maps are stored as a whole.
+	AsJSON
+	// AsType stores messages and enums as named types, which are created
+	// along with the table (see Table.Types). Values are passed as for Native.
+	AsType
+	// AsProto stores messages and enums as Protocol Buffers types, named by
+	// their full name (see Table.ProtoTypes). Messages are passed in their
+	// wire format, enums as their number.
+	AsProto
+)
+
+// A Dialect describes the types and statements of an SQL database. Formats
+// are used with fmt.Sprintf.
+type Dialect struct {
+	Name string
+	// Types holds the type per scalar kind.
+	Types map[protoreflect.Kind]string
+	// Timestamp is the type for google.protobuf.Timestamp.
+	Timestamp string
+	// Array is the format for arrays, given the item type.
+	Array string
+	// Map is the format for maps, given the key and value types.
+	Map string
+	// Struct is the format for structs, given their field definitions.
+	Struct string
+	// StructArray is the format for arrays of structs, given their field
+	// definitions. If empty, Array is applied to Struct.
+	StructArray string
+	// Field is the format for column and struct field definitions, given the
+	// quoted name and the type.
+	Field string
+	// Nullable is the format for nullable types. If empty, types are nullable
+	// by default.
+	Nullable string
+	// NullableStructs is set if structs can be null. If not, unset message
+	// fields hold structs of default values.
+	NullableStructs bool
+	// NotNull is appended to the definitions of non-nullable columns.
+	NotNull string
+	// Quote is the character used to quote identifiers. It is escaped by
+	// doubling it.
+	Quote string
+	// CreateTable is the format for CREATE TABLE statements, given the quoted
+	// table name and the column definitions.
+	CreateTable string
+	// StructValues determines how struct values are passed.
+	StructValues StructValues
+	// ArrayValues determines how array values are passed.
+	ArrayValues ArrayValues
+
+	// JSON is the type for values stored as JSON.
+	JSON string
+	// CreateEnum is the format for statements creating enum types, given the
+	// quoted type name and the quoted labels.
+	CreateEnum string
+	// CreateStruct is the format for statements creating struct types, given
+	// the quoted type name and the field definitions.
+	CreateStruct string
+	// TypeName returns the name of the named type for a message or enum. If
+	// nil, types are named after their full name.
+	TypeName func(d protoreflect.Descriptor) string
+	// Mapping returns how the values of a field are stored. It is called for
+	// fields and for the value fields of maps, but not for timestamps. For
+	// lists, AsJSON applies to the list as a whole and other mappings to its
+	// items. AsType and AsProto only apply to messages and enums. If nil, all
+	// values are stored as Native.
+	Mapping func(fd protoreflect.FieldDescriptor) Mapping
+	// Check returns the expression of a CHECK constraint for the column of a
+	// field, if any. It may be nil.
+	Check func(fd protoreflect.FieldDescriptor) string
+	// Scalar converts scalar values into parameters. It may return a
+	// protoreflect.EnumNumber for unknown enum values, which results in an
+	// error unless they are stored as JSON. If nil, values are passed as
+	// their Go types and enums by the name of their value, or its number for
+	// unknown values.
+	Scalar transforms.ScalarFunc
+	// JSONValue converts values stored as JSON into parameters; v is nil for
+	// null values. If nil, values are passed as a json.RawMessage, or nil.
+	JSONValue func(v interface{}) interface{}
+}
+
+func (d *Dialect) quote(s string) string {
+	if d.Quote == "" {
+		return s
+	}
+	return d.Quote + strings.ReplaceAll(s, d.Quote, d.Quote+d.Quote) + d.Quote
+}
+
+func quoteLiteral(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `''`) + `'`
+}
+
+// mapping returns the mapping for a field. Timestamps are always Native, and
+// AsType and AsProto fall back to Native for fields other than messages and
+// enums.
+func (d *Dialect) mapping(fd protoreflect.FieldDescriptor) Mapping {
+	if d.Mapping == nil || fd.Message() != nil && fd.Message().FullName() == timestampName {
+		return Native
+	}
+	m := d.Mapping(fd)
+	if (m == AsType || m == AsProto) && (fd.IsMap() || fd.Enum() == nil && fd.Message() == nil) {
+		return Native
+	}
+	return m
+}
+
+func (d *Dialect) typeName(desc protoreflect.Descriptor) string {
+	if d.TypeName == nil {
+		return string(desc.FullName())
+	}
+	return d.TypeName(desc)
+}
+
+// IsRecursive reports whether a message type can contain itself. Dialects
+// that store messages as named types, which cannot refer to themselves, can
+// use it to store such types as JSON instead.
+func IsRecursive(md protoreflect.MessageDescriptor) bool {
+	return reaches(md, md.FullName(), map[protoreflect.FullName]bool{})
+}
+
+func reaches(md protoreflect.MessageDescriptor, target protoreflect.FullName, seen map[protoreflect.FullName]bool) bool {
+	if seen[md.FullName()] {
+		return false
+	}
+	seen[md.FullName()] = true
+	for i := 0; i < md.Fields().Len(); i += 1 {
+		fd := md.Fields().Get(i)
+		if fd.IsMap() {
+			fd = fd.MapValue()
+		}
+		if fd.Message() == nil {
+			continue
+		}
+		if fd.Message().FullName() == target || reaches(fd.Message(), target, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClickHouse is the dialect for ClickHouse. Lists of messages map to Nested
+// columns, which are inserted as arrays of tuples and require the
+// flatten_nested setting to be disabled. Tables use the MergeTree engine,
+// without ordering.
+var ClickHouse = &Dialect{
+	Name: "ClickHouse",
+	Types: map[protoreflect.Kind]string{
+		protoreflect.BoolKind:     "Bool",
+		protoreflect.EnumKind:     "String",
+		protoreflect.Int32Kind:    "Int32",
+		protoreflect.Sint32Kind:   "Int32",
+		protoreflect.Sfixed32Kind: "Int32",
+		protoreflect.Int64Kind:    "Int64",
+		protoreflect.Sint64Kind:   "Int64",
+		protoreflect.Sfixed64Kind: "Int64",
+		protoreflect.Uint32Kind:   "UInt32",
+		protoreflect.Fixed32Kind:  "UInt32",
+		protoreflect.Uint64Kind:   "UInt64",
+		protoreflect.Fixed64Kind:  "UInt64",
+		protoreflect.FloatKind:    "Float32",
+		protoreflect.DoubleKind:   "Float64",
+		protoreflect.StringKind:   "String",
+		protoreflect.BytesKind:    "String",
+	},
+	Timestamp:   "DateTime64(6, 'UTC')",
+	Array:       "Array(%s)",
+	Map:         "Map(%s, %s)",
+	Struct:      "Tuple(%s)",
+	StructArray: "Nested(%s)",
+	Field:       "%s %s",
+	Nullable:    "Nullable(%s)",
+	Quote:       "`",
+	CreateTable: "CREATE TABLE %s (\n%s\n) ENGINE = MergeTree ORDER BY tuple()",
+}
+
+// DuckDB is the dialect for DuckDB.
+var DuckDB = &Dialect{
+	Name: "DuckDB",
+	Types: map[protoreflect.Kind]string{
+		protoreflect.BoolKind:     "BOOLEAN",
+		protoreflect.EnumKind:     "VARCHAR",
+		protoreflect.Int32Kind:    "INTEGER",
+		protoreflect.Sint32Kind:   "INTEGER",
+		protoreflect.Sfixed32Kind: "INTEGER",
+		protoreflect.Int64Kind:    "BIGINT",
+		protoreflect.Sint64Kind:   "BIGINT",
+		protoreflect.Sfixed64Kind: "BIGINT",
+		protoreflect.Uint32Kind:   "UINTEGER",
+		protoreflect.Fixed32Kind:  "UINTEGER",
+		protoreflect.Uint64Kind:   "UBIGINT",
+		protoreflect.Fixed64Kind:  "UBIGINT",
+		protoreflect.FloatKind:    "FLOAT",
+		protoreflect.DoubleKind:   "DOUBLE",
+		protoreflect.StringKind:   "VARCHAR",
+		protoreflect.BytesKind:    "BLOB",
+	},
+	Timestamp:       "TIMESTAMPTZ",
+	Array:           "%s[]",
+	Map:             "MAP(%s, %s)",
+	Struct:          "STRUCT(%s)",
+	Field:           "%s %s",
+	NullableStructs: true,
+	NotNull:         " NOT NULL",
+	Quote:           `"`,
+	CreateTable:     "CREATE TABLE %s (\n%s\n)",
+	StructValues:    StructsAsMaps,
+}
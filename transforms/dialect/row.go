@@ -0,0 +1,327 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package dialect
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A RowConverter converts messages into insert parameters for the tables
+// created by a SchemaConverter with the same dialect and options. It is safe
+// for concurrent use by multiple goroutines.
+//
+// Parameters are in column order. Scalars are passed as converted by the
+// dialect's Scalar function, timestamps as time.Time, arrays and structs as
+// set by the dialect, maps as map[interface{}]interface{}, values stored as
+// JSON as set by the dialect's JSONValue function and Protocol Buffers types
+// as their wire format or enum number. Unknown enum values result in an error
+// if the Scalar function returns their protoreflect.EnumNumber.
+type RowConverter interface {
+	Apply(m proto.Message) ([]interface{}, error)
+}
+
+type rowConverter struct {
+	sc      SchemaConverter
+	dialect *Dialect
+	scalar  transforms.ScalarFunc
+	walker  transforms.Walker
+	tables  sync.Map
+}
+
+// NewRowConverter creates a new RowConverter for a dialect. OptionTableName
+// does not apply.
+func NewRowConverter(d *Dialect, options ...Option) RowConverter {
+	c := newConfig(options)
+	scalar := d.Scalar
+	if scalar == nil {
+		scalar = convertScalar
+	}
+	return &rowConverter{
+		sc:      NewSchemaConverter(d, options...),
+		dialect: d,
+		scalar:  scalar,
+		walker: transforms.NewWalker(
+			transforms.OptionKeepSet(true),
+			transforms.OptionMaxDepth(c.maxDepth),
+			transforms.OptionDefaultScalarFunc(scalar),
+			// the timestamp override expects the fields' Go types
+			transforms.OptionAddScalarTypeFunc(timestampName, rawScalar),
+			transforms.OptionAddTypeOverride(timestampName, convertTimestamp),
+		),
+	}
+}
+
+// ApplyBatch converts a batch of messages into insert parameters, using the
+// given number of goroutines. The Value of each Result is an []interface{}.
+// See transforms.ApplyBatch.
+func ApplyBatch(rc RowConverter, ms []proto.Message, workers int) []transforms.Result {
+	return transforms.ApplyBatchFunc(func(m proto.Message) (interface{}, error) {
+		return rc.Apply(m)
+	}, ms, workers)
+}
+
+func convertScalar(fd protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	if fd.Kind() == protoreflect.EnumKind {
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return strconv.Itoa(int(v.Enum()))
+	}
+	return v.Interface()
+}
+
+func rawScalar(_ protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	return v.Interface()
+}
+
+func convertTimestamp(_ protoreflect.FieldDescriptor, kvs []transforms.KeyValue) interface{} {
+	seconds, nanos := int64(0), int64(0)
+	for _, kv := range kvs {
+		switch kv.Key {
+		case "seconds":
+			seconds = kv.Value.(int64)
+		case "nanos":
+			nanos = int64(kv.Value.(int32))
+		}
+	}
+	return time.Unix(seconds, nanos).UTC()
+}
+
+func (rc *rowConverter) table(md protoreflect.MessageDescriptor) *Table {
+	if t, ok := rc.tables.Load(md.FullName()); ok {
+		return t.(*Table)
+	}
+	t, _ := rc.tables.LoadOrStore(md.FullName(), rc.sc.Apply(md))
+	return t.(*Table)
+}
+
+func (rc *rowConverter) Apply(m proto.Message) ([]interface{}, error) {
+	pm := m.ProtoReflect()
+	t := rc.table(pm.Descriptor())
+	row := rc.walker.Apply(m).(map[string]interface{})
+	out := make([]interface{}, len(t.nodes))
+	for i, n := range t.nodes {
+		v, err := rc.value(n, row[n.name], pm.Get(n.fd))
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// value converts a value of the walker into a parameter for a node. The
+// protoreflect.Value is that of the message, list or scalar the value was
+// converted from; it provides Protocol Buffers values. Unset values of
+// non-nullable nodes are replaced by defaults.
+func (rc *rowConverter) value(n *node, v interface{}, pv protoreflect.Value) (interface{}, error) {
+	if n.kind == jsonNode {
+		return rc.json(n, v)
+	}
+	if v == nil && n.nullable {
+		return nil, nil
+	}
+	switch n.kind {
+	case structNode:
+		m, _ := v.(map[string]interface{})
+		pm := pv.Message()
+		if rc.dialect.StructValues == StructsAsMaps {
+			out := make(map[string]interface{}, len(n.children))
+			for _, c := range n.children {
+				x, err := rc.value(c, m[c.name], pm.Get(c.fd))
+				if err != nil {
+					return nil, err
+				}
+				out[c.name] = x
+			}
+			return out, nil
+		}
+		out := make([]interface{}, len(n.children))
+		for i, c := range n.children {
+			x, err := rc.value(c, m[c.name], pm.Get(c.fd))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = x
+		}
+		return out, nil
+	case listNode:
+		return rc.list(n, v, pv)
+	case mapNode:
+		xs, _ := v.(map[interface{}]interface{})
+		pm := pv.Map()
+		out := make(map[interface{}]interface{}, len(xs))
+		for k, x := range xs {
+			y, err := rc.value(n.children[1], x, pm.Get(protoreflect.ValueOf(k).MapKey()))
+			if err != nil {
+				return nil, err
+			}
+			out[k] = y
+		}
+		return out, nil
+	case timestampNode:
+		if v == nil {
+			return time.Unix(0, 0).UTC(), nil
+		}
+		if _, ok := v.(time.Time); !ok {
+			return nil, fmt.Errorf("%s: unexpected value of type %T", n.name, v)
+		}
+		return v, nil
+	case protoNode:
+		if n.fd.Enum() != nil {
+			return int64(pv.Enum()), nil
+		}
+		bs, err := proto.MarshalOptions{Deterministic: true}.Marshal(pv.Message().Interface())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", n.name, err)
+		}
+		return bs, nil
+	}
+	if v == nil {
+		d := n.fd.Default()
+		v = rc.scalar(n.fd, &d)
+	}
+	if x, ok := v.(protoreflect.EnumNumber); ok {
+		return nil, fmt.Errorf("%s: unknown value %d for enum %s", n.name, x, n.fd.Enum().FullName())
+	}
+	return v, nil
+}
+
+func (rc *rowConverter) list(n *node, v interface{}, pv protoreflect.Value) (interface{}, error) {
+	xs, _ := v.([]interface{})
+	pl := pv.List()
+	item := n.children[0]
+	var typ reflect.Type
+	if rc.dialect.ArrayValues == ArraysAsTyped {
+		typ = rc.itemType(item)
+	}
+	if typ == nil {
+		out := make([]interface{}, len(xs))
+		for i, x := range xs {
+			y, err := rc.value(item, x, pl.Get(i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = y
+		}
+		return out, nil
+	}
+	out := reflect.MakeSlice(reflect.SliceOf(typ), 0, len(xs))
+	for i, x := range xs {
+		y, err := rc.value(item, x, pl.Get(i))
+		if err != nil {
+			return nil, err
+		}
+		yv := reflect.ValueOf(y)
+		if !yv.IsValid() || yv.Type() != typ {
+			return nil, fmt.Errorf("%s: unexpected item of type %T", n.name, y)
+		}
+		out = reflect.Append(out, yv)
+	}
+	return out.Interface(), nil
+}
+
+// itemType returns the type of typed array items for a node, or nil if items
+// are passed as an interface{}.
+func (rc *rowConverter) itemType(n *node) reflect.Type {
+	switch n.kind {
+	case scalarNode:
+		z := zeroValue(n.fd)
+		return reflect.TypeOf(rc.scalar(n.fd, &z))
+	case timestampNode:
+		return reflect.TypeOf(time.Time{})
+	case protoNode:
+		if n.fd.Enum() != nil {
+			return reflect.TypeOf(int64(0))
+		}
+		return reflect.TypeOf([]byte(nil))
+	}
+	return nil
+}
+
+// zeroValue returns the zero value of the items of a list field.
+func zeroValue(fd protoreflect.FieldDescriptor) protoreflect.Value {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(false)
+	case protoreflect.EnumKind:
+		return protoreflect.ValueOfEnum(fd.Enum().Values().Get(0).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(0)
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(0)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(0)
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(0)
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(0)
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(0)
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString("")
+	}
+	return protoreflect.ValueOfBytes(nil)
+}
+
+// json converts a value of the walker into a parameter for a node stored as
+// JSON. Unset lists and maps are stored as empty ones.
+func (rc *rowConverter) json(n *node, v interface{}) (interface{}, error) {
+	switch {
+	case v != nil:
+		v = jsonValue(v)
+	case n.fd.IsMap():
+		v = map[string]interface{}{}
+	case n.fd.IsList():
+		v = []interface{}{}
+	}
+	if rc.dialect.JSONValue != nil {
+		return rc.dialect.JSONValue(v), nil
+	}
+	if v == nil {
+		return nil, nil
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return json.RawMessage(bs), nil
+}
+
+// jsonValue converts the maps in a value of the walker into maps with string
+// keys, as in the JSON mapping of Protocol Buffers.
+func jsonValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, y := range x {
+			out[transforms.FormatMapKey(k)] = jsonValue(y)
+		}
+		return out
+	case map[string]interface{}:
+		for k, y := range x {
+			x[k] = jsonValue(y)
+		}
+	case []interface{}:
+		for i, y := range x {
+			x[i] = jsonValue(y)
+		}
+	}
+	return v
+}
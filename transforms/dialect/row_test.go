@@ -0,0 +1,139 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package dialect
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const fullEvent = `{
+  "id": "1",
+  "name": "a",
+  "ratio": 0.5,
+  "count": 4294967295,
+  "status": "ACTIVE",
+  "tags": ["x", "y"],
+  "attrs": {"b": "2", "a": "1"},
+  "created": "1970-01-01T00:00:01.000002Z",
+  "alias": "q",
+  "place": {"lat": 1.5, "seen": ["1970-01-01T00:00:02Z"]},
+  "stops": [{"status": "ACTIVE"}],
+  "states": ["ACTIVE", "UNKNOWN"]
+}`
+
+func TestRowConverter(t *testing.T) {
+	created := time.Unix(1, 2000).UTC()
+	seen := time.Unix(2, 0).UTC()
+
+	cases := []struct {
+		dialect  *Dialect
+		input    string
+		expected []interface{}
+		name     string
+	}{
+		{
+			ClickHouse,
+			fullEvent,
+			[]interface{}{
+				int64(1), "a", float32(0.5), uint32(4294967295), "ACTIVE",
+				[]interface{}{"x", "y"},
+				map[interface{}]interface{}{"a": int64(1), "b": int64(2)},
+				created,
+				"q",
+				[]interface{}{1.5, "UNKNOWN", []interface{}{seen}},
+				[]interface{}{[]interface{}{float64(0), "ACTIVE", []interface{}{}}},
+				[]interface{}{"ACTIVE", "UNKNOWN"},
+			},
+			"clickhouse",
+		},
+		{
+			ClickHouse,
+			`{}`,
+			[]interface{}{
+				int64(0), "", float32(0), uint32(0), "UNKNOWN",
+				[]interface{}{},
+				map[interface{}]interface{}{},
+				nil,
+				nil,
+				[]interface{}{float64(0), "UNKNOWN", []interface{}{}},
+				[]interface{}{},
+				[]interface{}{},
+			},
+			"clickhouse empty",
+		},
+		{
+			ClickHouse,
+			`{"status": 99, "states": ["ACTIVE", 99]}`,
+			[]interface{}{
+				int64(0), "", float32(0), uint32(0), "99",
+				[]interface{}{},
+				map[interface{}]interface{}{},
+				nil,
+				nil,
+				[]interface{}{float64(0), "UNKNOWN", []interface{}{}},
+				[]interface{}{},
+				[]interface{}{"ACTIVE", "99"},
+			},
+			"unknown enum values",
+		},
+		{
+			DuckDB,
+			fullEvent,
+			[]interface{}{
+				int64(1), "a", float32(0.5), uint32(4294967295), "ACTIVE",
+				[]interface{}{"x", "y"},
+				map[interface{}]interface{}{"a": int64(1), "b": int64(2)},
+				created,
+				"q",
+				map[string]interface{}{"lat": 1.5, "status": "UNKNOWN", "seen": []interface{}{seen}},
+				[]interface{}{map[string]interface{}{"lat": float64(0), "status": "ACTIVE", "seen": []interface{}{}}},
+				[]interface{}{"ACTIVE", "UNKNOWN"},
+			},
+			"duckdb",
+		},
+		{
+			DuckDB,
+			`{"place": {}}`,
+			[]interface{}{
+				int64(0), "", float32(0), uint32(0), "UNKNOWN",
+				[]interface{}{},
+				map[interface{}]interface{}{},
+				nil,
+				nil,
+				map[string]interface{}{"lat": float64(0), "status": "UNKNOWN", "seen": []interface{}{}},
+				[]interface{}{},
+				[]interface{}{},
+			},
+			"duckdb empty",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := NewRowConverter(c.dialect).Apply(testpb.NewFlatEvent(t, c.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestApplyBatch(t *testing.T) {
+	rc := NewRowConverter(DuckDB)
+	ms := []proto.Message{testpb.NewFlatEvent(t, fullEvent), testpb.NewFlatEvent(t, `{"id": "2"}`)}
+
+	results := ApplyBatch(rc, ms, 2)
+	for i, m := range ms {
+		expected, _ := rc.Apply(m)
+		if results[i].Err != nil || !reflect.DeepEqual(results[i].Value, expected) {
+			t.Errorf("%d: \nexpected %v, \ngot      %v", i, expected, results[i])
+		}
+	}
+}
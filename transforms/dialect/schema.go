@@ -0,0 +1,488 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package dialect
+
+import (
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+)
+
+const (
+	timestampName = "google.protobuf.Timestamp"
+
+	defaultMaxDepth = 10
+)
+
+type config struct {
+	maxDepth  int
+	tableName string
+}
+
+type Option interface {
+	// Apply applies the Option to the converter.
+	Apply(c *config)
+}
+
+type optionMaxDepth struct {
+	value int
+}
+
+func (o *optionMaxDepth) Apply(c *config) {
+	c.maxDepth = o.value
+}
+
+// OptionMaxDepth sets a maximum message recursion depth. Message fields beyond
+// it are left out of the table. Defaults to 10. See transforms.OptionMaxDepth.
+func OptionMaxDepth(v int) Option {
+	return &optionMaxDepth{value: v}
+}
+
+type optionTableName struct {
+	value string
+}
+
+func (o *optionTableName) Apply(c *config) {
+	c.tableName = o.value
+}
+
+// OptionTableName sets the name of the table. Defaults to the name of the
+// message.
+func OptionTableName(v string) Option {
+	if v == "" {
+		panic("table name cannot be empty")
+	}
+	return &optionTableName{value: v}
+}
+
+func newConfig(options []Option) *config {
+	c := &config{maxDepth: defaultMaxDepth}
+	for _, o := range options {
+		o.Apply(c)
+	}
+	return c
+}
+
+type nodeKind int
+
+const (
+	scalarNode = nodeKind(iota)
+	timestampNode
+	structNode
+	listNode
+	mapNode
+	// jsonNode holds a value stored as JSON
+	jsonNode
+	// protoNode holds a message or enum stored as a Protocol Buffers type
+	protoNode
+)
+
+// A node is a column, struct field, list item or map key or value.
+type node struct {
+	name     string
+	kind     nodeKind
+	type_    string
+	nullable bool
+	mapping  Mapping
+	fd       protoreflect.FieldDescriptor
+	// children holds the fields of a struct, the item of a list or the key
+	// and value of a map
+	children []*node
+}
+
+// column returns the column, or struct field, for a node.
+func (n *node) column() Column {
+	c := Column{Name: n.name, Type: n.type_, NotNull: !n.nullable, Field: n.fd, Mapping: n.mapping}
+	s := n
+	if n.kind == listNode {
+		s = n.children[0]
+	}
+	if s.kind == structNode {
+		c.Fields = columns(s.children)
+	}
+	return c
+}
+
+func columns(ns []*node) []Column {
+	out := make([]Column, len(ns))
+	for i, n := range ns {
+		out[i] = n.column()
+	}
+	return out
+}
+
+// A Column is a column of a table, or a field of a struct.
+type Column struct {
+	Name    string
+	Type    string
+	NotNull bool
+	// Check is the expression of the column's CHECK constraint, if any.
+	Check string
+	// Field is the field holding the values of the column.
+	Field protoreflect.FieldDescriptor
+	// Mapping is how the values of the column are stored. For arrays, it is
+	// that of their items.
+	Mapping Mapping
+	// Fields holds the fields of a struct, or of the structs in an array.
+	Fields []Column
+}
+
+// A Type is a named enum or struct type.
+type Type struct {
+	Name string
+	// Values holds the labels of an enum type.
+	Values []string
+	// Fields holds the fields of a struct type.
+	Fields []Column
+}
+
+// A Table is the table for a message type.
+type Table struct {
+	Name    string
+	Columns []Column
+	// Types holds the named types used by the table. A type comes after the
+	// types it uses.
+	Types []*Type
+	// ProtoTypes holds the full names of the Protocol Buffers types used by
+	// the table, in order of appearance.
+	ProtoTypes []string
+
+	dialect *Dialect
+	nodes   []*node
+}
+
+// ColumnNames returns the names of the columns, in column order.
+func (t *Table) ColumnNames() []string {
+	out := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		out[i] = c.Name
+	}
+	return out
+}
+
+// Statements returns the statements creating the named types of the table,
+// followed by its CREATE TABLE statement.
+func (t *Table) Statements() []string {
+	d := t.dialect
+	var out []string
+	for _, typ := range t.Types {
+		if typ.Values == nil {
+			out = append(out, fmt.Sprintf(d.CreateStruct, d.quote(typ.Name), d.definitions(typ.Fields, false)))
+			continue
+		}
+		labels := make([]string, len(typ.Values))
+		for i, v := range typ.Values {
+			labels[i] = quoteLiteral(v)
+		}
+		out = append(out, fmt.Sprintf(d.CreateEnum, d.quote(typ.Name), strings.Join(labels, ", ")))
+	}
+	return append(out, fmt.Sprintf(d.CreateTable, d.quote(t.Name), d.definitions(t.Columns, true)))
+}
+
+// DDL returns the statements of the table, separated by semicolons.
+func (t *Table) DDL() string {
+	return strings.Join(t.Statements(), ";\n")
+}
+
+// definitions returns the definitions of columns, or of the fields of a struct
+// type, one per line.
+func (d *Dialect) definitions(cs []Column, constraints bool) string {
+	defs := make([]string, len(cs))
+	for i, c := range cs {
+		defs[i] = "  " + fmt.Sprintf(d.Field, d.quote(c.Name), c.Type)
+		if !constraints {
+			continue
+		}
+		if c.NotNull {
+			defs[i] += d.NotNull
+		}
+		if c.Check != "" {
+			defs[i] += " CHECK (" + c.Check + ")"
+		}
+	}
+	return strings.Join(defs, ",\n")
+}
+
+// Insert returns an INSERT statement for the table, with a ? placeholder per
+// column.
+func (t *Table) Insert() string {
+	names := make([]string, len(t.Columns))
+	params := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		names[i] = t.dialect.quote(c.Name)
+		params[i] = "?"
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", t.dialect.quote(t.Name), strings.Join(names, ", "), strings.Join(params, ", "))
+}
+
+// A SchemaConverter converts message descriptors into tables. It is safe for
+// concurrent use by multiple goroutines.
+type SchemaConverter interface {
+	Apply(md protoreflect.MessageDescriptor) *Table
+}
+
+type schemaConverter struct {
+	dialect *Dialect
+	config  *config
+	walker  transforms.Walker
+}
+
+// NewSchemaConverter creates a new SchemaConverter for a dialect.
+func NewSchemaConverter(d *Dialect, options ...Option) SchemaConverter {
+	c := newConfig(options)
+	return &schemaConverter{
+		dialect: d,
+		config:  c,
+		walker:  transforms.NewWalker(transforms.OptionMaxDepth(c.maxDepth)),
+	}
+}
+
+func (sc *schemaConverter) Apply(md protoreflect.MessageDescriptor) *Table {
+	t := &Table{Name: sc.config.tableName, dialect: sc.dialect}
+	if t.Name == "" {
+		t.Name = string(md.Name())
+	}
+	v := &schemaVisitor{d: sc.dialect, t: t, types: map[string]bool{}, protoTypes: map[string]bool{}}
+	sc.walker.WalkDesc(md, v)
+	t.nodes = v.nodes
+	for _, n := range t.nodes {
+		c := n.column()
+		if sc.dialect.Check != nil {
+			c.Check = sc.dialect.Check(n.fd)
+		}
+		t.Columns = append(t.Columns, c)
+	}
+	return t
+}
+
+// A frame holds the nodes collected for a message, list or map.
+type frame struct {
+	kind  nodeKind
+	nodes []*node
+}
+
+// A schemaVisitor creates the nodes for the fields of a message type from the
+// events of a descriptor walk. Messages beyond the maximum depth produce no
+// events; lists and maps of them are left out.
+type schemaVisitor struct {
+	d          *Dialect
+	t          *Table
+	types      map[string]bool
+	protoTypes map[string]bool
+	frames     []*frame
+	// skip counts the messages, lists and maps entered within a value that
+	// is stored as a whole
+	skip  int
+	nodes []*node
+}
+
+func (v *schemaVisitor) push(k nodeKind) {
+	v.frames = append(v.frames, &frame{kind: k})
+}
+
+func (v *schemaVisitor) pop() []*node {
+	f := v.frames[len(v.frames)-1]
+	v.frames = v.frames[:len(v.frames)-1]
+	return f.nodes
+}
+
+// emit adds a node to the message, list or map being visited. Nodes for
+// singular fields are nullable if the field tracks presence.
+func (v *schemaVisitor) emit(fd protoreflect.FieldDescriptor, n *node) {
+	f := v.frames[len(v.frames)-1]
+	n.name = string(fd.Name())
+	if f.kind == structNode && !fd.IsList() && !fd.IsMap() && fd.HasPresence() &&
+		(n.kind != structNode || v.d.NullableStructs) {
+		n.nullable = true
+		if v.d.Nullable != "" {
+			n.type_ = fmt.Sprintf(v.d.Nullable, n.type_)
+		}
+	}
+	f.nodes = append(f.nodes, n)
+}
+
+// enter reports whether a message, list or map is stored as a whole, or is
+// part of such a value. If so, it is skipped until its exit.
+func (v *schemaVisitor) enter(stored bool) bool {
+	if v.skip > 0 || stored {
+		v.skip += 1
+		return true
+	}
+	return false
+}
+
+// exit reports whether a skipped message, list or map is exited. If it is
+// the outermost one, its node is emitted.
+func (v *schemaVisitor) exit(fd protoreflect.FieldDescriptor) bool {
+	if v.skip == 0 {
+		return false
+	}
+	v.skip -= 1
+	if v.skip == 0 {
+		v.emit(fd, v.storedNode(fd))
+	}
+	return true
+}
+
+func (v *schemaVisitor) EnterMessage(fd protoreflect.FieldDescriptor, md protoreflect.MessageDescriptor) {
+	m := Native
+	if fd != nil {
+		m = v.d.mapping(fd)
+	}
+	// timestamps are stored as a whole, too
+	if !v.enter(m == AsJSON || m == AsProto || md.FullName() == timestampName) {
+		v.push(structNode)
+	}
+}
+
+// SkipMessage skips the fields of messages that are stored as a whole, so
+// that recursive message types stored as JSON are not walked to the maximum
+// depth.
+func (v *schemaVisitor) SkipMessage(protoreflect.FieldDescriptor, protoreflect.MessageDescriptor) bool {
+	return v.skip > 0
+}
+
+func (v *schemaVisitor) ExitMessage(fd protoreflect.FieldDescriptor, md protoreflect.MessageDescriptor) {
+	if v.exit(fd) {
+		return
+	}
+	// structs need at least one field, so leave out empty ones
+	if ns := v.pop(); fd == nil {
+		v.nodes = ns
+	} else if len(ns) > 0 {
+		v.emit(fd, v.structNode(fd, md, ns))
+	}
+}
+
+func (v *schemaVisitor) structNode(fd protoreflect.FieldDescriptor, md protoreflect.MessageDescriptor, ns []*node) *node {
+	n := &node{kind: structNode, fd: fd, children: ns}
+	if v.d.mapping(fd) != AsType {
+		n.type_ = fmt.Sprintf(v.d.Struct, structFields(v.d, ns))
+		return n
+	}
+	name := v.d.typeName(md)
+	if !v.types[name] {
+		v.types[name] = true
+		v.t.Types = append(v.t.Types, &Type{Name: name, Fields: columns(ns)})
+	}
+	n.type_, n.mapping = v.d.quote(name), AsType
+	return n
+}
+
+func (v *schemaVisitor) Field(fd protoreflect.FieldDescriptor, _ *protoreflect.Value) {
+	if v.skip > 0 {
+		return
+	}
+	f := v.frames[len(v.frames)-1]
+	if f.kind == mapNode && len(f.nodes) == 0 {
+		// map keys are always stored natively
+		v.emit(fd, v.scalarNode(fd))
+		return
+	}
+	switch v.d.mapping(fd) {
+	case AsJSON, AsProto:
+		v.emit(fd, v.storedNode(fd))
+	case AsType:
+		v.emit(fd, v.enumNode(fd))
+	default:
+		v.emit(fd, v.scalarNode(fd))
+	}
+}
+
+func (v *schemaVisitor) scalarNode(fd protoreflect.FieldDescriptor) *node {
+	t, ok := v.d.Types[fd.Kind()]
+	if !ok {
+		panic(fmt.Sprintf("unsupported type %v for dialect %s", fd.Kind(), v.d.Name))
+	}
+	return &node{type_: t, fd: fd}
+}
+
+func (v *schemaVisitor) enumNode(fd protoreflect.FieldDescriptor) *node {
+	ed := fd.Enum()
+	name := v.d.typeName(ed)
+	if !v.types[name] {
+		v.types[name] = true
+		labels := make([]string, ed.Values().Len())
+		for i := range labels {
+			labels[i] = string(ed.Values().Get(i).Name())
+		}
+		v.t.Types = append(v.t.Types, &Type{Name: name, Values: labels})
+	}
+	return &node{type_: v.d.quote(name), mapping: AsType, fd: fd}
+}
+
+// storedNode returns the node for a timestamp or for a value stored as JSON or
+// as a Protocol Buffers type.
+func (v *schemaVisitor) storedNode(fd protoreflect.FieldDescriptor) *node {
+	switch {
+	case fd.Message() != nil && fd.Message().FullName() == timestampName:
+		return &node{kind: timestampNode, type_: v.d.Timestamp, fd: fd}
+	case v.d.mapping(fd) == AsJSON:
+		return &node{kind: jsonNode, type_: v.d.JSON, mapping: AsJSON, fd: fd}
+	}
+	var desc protoreflect.Descriptor = fd.Message()
+	if fd.Enum() != nil {
+		desc = fd.Enum()
+	}
+	name := string(desc.FullName())
+	if !v.protoTypes[name] {
+		v.protoTypes[name] = true
+		v.t.ProtoTypes = append(v.t.ProtoTypes, name)
+	}
+	return &node{kind: protoNode, type_: v.d.quote(name), mapping: AsProto, fd: fd}
+}
+
+func (v *schemaVisitor) EnterList(fd protoreflect.FieldDescriptor, _ int) {
+	if !v.enter(v.d.mapping(fd) == AsJSON) {
+		v.push(listNode)
+	}
+}
+
+func (v *schemaVisitor) ListItem(protoreflect.FieldDescriptor, int) {}
+
+func (v *schemaVisitor) ExitList(fd protoreflect.FieldDescriptor) {
+	if v.exit(fd) {
+		return
+	}
+	ns := v.pop()
+	if len(ns) == 0 {
+		return
+	}
+	item := ns[0]
+	type_ := fmt.Sprintf(v.d.Array, item.type_)
+	if item.kind == structNode && item.mapping == Native && v.d.StructArray != "" {
+		type_ = fmt.Sprintf(v.d.StructArray, structFields(v.d, item.children))
+	}
+	v.emit(fd, &node{kind: listNode, type_: type_, mapping: item.mapping, fd: fd, children: ns})
+}
+
+func (v *schemaVisitor) EnterMap(fd protoreflect.FieldDescriptor, _ int) {
+	if !v.enter(v.d.mapping(fd) == AsJSON) {
+		v.push(mapNode)
+	}
+}
+
+func (v *schemaVisitor) MapEntry(protoreflect.FieldDescriptor, protoreflect.MapKey) {}
+
+func (v *schemaVisitor) ExitMap(fd protoreflect.FieldDescriptor) {
+	if v.exit(fd) {
+		return
+	}
+	ns := v.pop()
+	if len(ns) < 2 {
+		return
+	}
+	type_ := fmt.Sprintf(v.d.Map, ns[0].type_, ns[1].type_)
+	v.emit(fd, &node{kind: mapNode, type_: type_, fd: fd, children: ns})
+}
+
+func structFields(d *Dialect, ns []*node) string {
+	fs := make([]string, len(ns))
+	for i, c := range ns {
+		fs[i] = fmt.Sprintf(d.Field, d.quote(c.name), c.type_)
+	}
+	return strings.Join(fs, ", ")
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package dialect
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+	"testing"
+)
+
+// trino is a dialect for Trino, to test custom dialects.
+var trino = &Dialect{
+	Name: "Trino",
+	Types: map[protoreflect.Kind]string{
+		protoreflect.BoolKind:   "boolean",
+		protoreflect.EnumKind:   "varchar",
+		protoreflect.Int64Kind:  "bigint",
+		protoreflect.Uint32Kind: "bigint",
+		protoreflect.FloatKind:  "real",
+		protoreflect.DoubleKind: "double",
+		protoreflect.StringKind: "varchar",
+	},
+	Timestamp:       "timestamp(6) with time zone",
+	Array:           "array(%s)",
+	Map:             "map(%s, %s)",
+	Struct:          "row(%s)",
+	Field:           "%s %s",
+	NullableStructs: true,
+	NotNull:         " NOT NULL",
+	Quote:           `"`,
+	CreateTable:     "CREATE TABLE IF NOT EXISTS %s (\n%s\n)",
+	StructValues:    StructsAsSlices,
+}
+
+func TestSchemaConverter(t *testing.T) {
+	event := (&testpb.FlatEvent{}).ProtoReflect().Descriptor()
+
+	cases := []struct {
+		dialect  *Dialect
+		options  []Option
+		expected string
+		name     string
+	}{
+		{
+			ClickHouse,
+			nil,
+			"CREATE TABLE `FlatEvent` (\n" +
+				"  `id` Int64,\n" +
+				"  `name` String,\n" +
+				"  `ratio` Float32,\n" +
+				"  `count` UInt32,\n" +
+				"  `status` String,\n" +
+				"  `tags` Array(String),\n" +
+				"  `attrs` Map(String, Int64),\n" +
+				"  `created` Nullable(DateTime64(6, 'UTC')),\n" +
+				"  `alias` Nullable(String),\n" +
+				"  `place` Tuple(`lat` Float64, `status` String, `seen` Array(DateTime64(6, 'UTC'))),\n" +
+				"  `stops` Nested(`lat` Float64, `status` String, `seen` Array(DateTime64(6, 'UTC'))),\n" +
+				"  `states` Array(String)\n" +
+				") ENGINE = MergeTree ORDER BY tuple()",
+			"clickhouse",
+		},
+		{DuckDB, nil, `CREATE TABLE "FlatEvent" (
+  "id" BIGINT NOT NULL,
+  "name" VARCHAR NOT NULL,
+  "ratio" FLOAT NOT NULL,
+  "count" UINTEGER NOT NULL,
+  "status" VARCHAR NOT NULL,
+  "tags" VARCHAR[] NOT NULL,
+  "attrs" MAP(VARCHAR, BIGINT) NOT NULL,
+  "created" TIMESTAMPTZ,
+  "alias" VARCHAR,
+  "place" STRUCT("lat" DOUBLE, "status" VARCHAR, "seen" TIMESTAMPTZ[]),
+  "stops" STRUCT("lat" DOUBLE, "status" VARCHAR, "seen" TIMESTAMPTZ[])[] NOT NULL,
+  "states" VARCHAR[] NOT NULL
+)`, "duckdb"},
+		{DuckDB, []Option{OptionMaxDepth(1), OptionTableName("events")}, `CREATE TABLE "events" (
+  "id" BIGINT NOT NULL,
+  "name" VARCHAR NOT NULL,
+  "ratio" FLOAT NOT NULL,
+  "count" UINTEGER NOT NULL,
+  "status" VARCHAR NOT NULL,
+  "tags" VARCHAR[] NOT NULL,
+  "attrs" MAP(VARCHAR, BIGINT) NOT NULL,
+  "created" TIMESTAMPTZ,
+  "alias" VARCHAR,
+  "place" STRUCT("lat" DOUBLE, "status" VARCHAR),
+  "stops" STRUCT("lat" DOUBLE, "status" VARCHAR)[] NOT NULL,
+  "states" VARCHAR[] NOT NULL
+)`, "max depth"},
+		{trino, nil, `CREATE TABLE IF NOT EXISTS "FlatEvent" (
+  "id" bigint NOT NULL,
+  "name" varchar NOT NULL,
+  "ratio" real NOT NULL,
+  "count" bigint NOT NULL,
+  "status" varchar NOT NULL,
+  "tags" array(varchar) NOT NULL,
+  "attrs" map(varchar, bigint) NOT NULL,
+  "created" timestamp(6) with time zone,
+  "alias" varchar,
+  "place" row("lat" double, "status" varchar, "seen" array(timestamp(6) with time zone)),
+  "stops" array(row("lat" double, "status" varchar, "seen" array(timestamp(6) with time zone))) NOT NULL,
+  "states" array(varchar) NOT NULL
+)`, "custom"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := NewSchemaConverter(c.dialect, c.options...).Apply(event).DDL()
+			if actual != c.expected {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSchemaConverter_EmptyStructs(t *testing.T) {
+	// beyond depth 1, the struct and list values have no fields left
+	value := (&structpb.Value{}).ProtoReflect().Descriptor()
+
+	cases := []struct {
+		dialect  *Dialect
+		expected string
+		name     string
+	}{
+		{ClickHouse, "CREATE TABLE `Value` (\n" +
+			"  `null_value` Nullable(String),\n" +
+			"  `number_value` Nullable(Float64),\n" +
+			"  `string_value` Nullable(String),\n" +
+			"  `bool_value` Nullable(Bool)\n" +
+			") ENGINE = MergeTree ORDER BY tuple()", "clickhouse"},
+		{DuckDB, `CREATE TABLE "Value" (
+  "null_value" VARCHAR,
+  "number_value" DOUBLE,
+  "string_value" VARCHAR,
+  "bool_value" BOOLEAN
+)`, "duckdb"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := NewSchemaConverter(c.dialect, OptionMaxDepth(1)).Apply(value).DDL()
+			if actual != c.expected {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package diff compares two messages of the same type.
+//
+// Fields are compared in the order of their numbers, as the Walker visits
+// them. Paths are those of transforms.WalkContext: list items and map values
+// are identified by their index or key. Fields are compared by presence:
+// fields without presence are unset when they hold their default value.
+// Timestamps and durations are compared as a whole.
+package diff
+
+import (
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"strings"
+)
+
+// A Kind classifies a change.
+type Kind int
+
+const (
+	// Added is a value that is only set in the new message.
+	Added = Kind(iota)
+	// Removed is a value that is only set in the old message.
+	Removed
+	// Modified is a scalar value that differs.
+	Modified
+	// Reordered is a list that holds the same items in a different order.
+	Reordered
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	case Reordered:
+		return "reordered"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// A Change is a difference between two messages.
+//
+// Old and New hold the values, or nil if unset. Scalars hold their native
+// types, messages are proto.Message values and reordered lists are
+// []interface{} values of their items.
+type Change struct {
+	Kind Kind
+	// Path holds the fields leading to the value, starting at the root.
+	Path []transforms.PathElement
+	Old  interface{}
+	New  interface{}
+}
+
+// PathString renders the path with indices and keys, i.e. 'items[0].price'.
+func (c Change) PathString() string {
+	return (&transforms.WalkContext{Path: c.Path}).String()
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("%s %s: %v", c.Kind, c.PathString(), c.New)
+	case Removed:
+		return fmt.Sprintf("%s %s: %v", c.Kind, c.PathString(), c.Old)
+	}
+	return fmt.Sprintf("%s %s: %v -> %v", c.Kind, c.PathString(), c.Old, c.New)
+}
+
+// FieldMask returns a normalised field mask with the paths of the changed
+// fields. Since field masks cannot address list items or map values, changes
+// within lists and maps are covered by the path of the list or map field.
+func FieldMask(cs []Change) *fieldmaskpb.FieldMask {
+	fm := &fieldmaskpb.FieldMask{}
+	for _, c := range cs {
+		var names []string
+		for _, e := range c.Path {
+			names = append(names, string(e.Field.Name()))
+			if e.Index >= 0 || e.Key.IsValid() {
+				break
+			}
+		}
+		fm.Paths = append(fm.Paths, strings.Join(names, "."))
+	}
+	fm.Normalize()
+	return fm
+}
+
+type config struct {
+	ignore []*transforms.PathPattern
+	keys   []setKey
+}
+
+// A setKey is a pattern for repeated fields compared as sets, with the name of
+// the field of their items to match them by.
+type setKey struct {
+	pattern *transforms.PathPattern
+	field   string
+}
+
+type Option interface {
+	// Apply applies the Option to the Differ.
+	Apply(c *config)
+}
+
+type optionIgnore struct {
+	value *transforms.PathPattern
+}
+
+func (o *optionIgnore) Apply(c *config) {
+	c.ignore = append(c.ignore, o.value)
+}
+
+// OptionIgnore ignores the values matching a path pattern. See
+// transforms.PathPattern; indices and keys match list items and map values.
+func OptionIgnore(pattern string) Option {
+	return &optionIgnore{value: transforms.MustParsePathPattern(pattern)}
+}
+
+type optionSetKey struct {
+	value setKey
+}
+
+func (o *optionSetKey) Apply(c *config) {
+	c.keys = append(c.keys, o.value)
+}
+
+// OptionSetKey compares the repeated message fields matching a pattern as
+// sets, matching their items by the value of a field. The pattern is matched
+// against the dotted name of the field (see transforms.PathPattern.MatchName).
+// Changes are reported at the index of the item in the new list, or in the
+// old list for removed items. Later options take precedence. A list holding
+// several items with the same key cannot be compared as a set; Apply returns
+// an error for it.
+func OptionSetKey(pattern, field string) Option {
+	if field == "" {
+		panic("key field cannot be empty")
+	}
+	return &optionSetKey{value: setKey{pattern: transforms.MustParsePathPattern(pattern), field: field}}
+}
+
+func newConfig(options []Option) *config {
+	c := &config{}
+	for _, o := range options {
+		o.Apply(c)
+	}
+	return c
+}
@@ -0,0 +1,257 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package diff
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"reflect"
+	"testing"
+)
+
+func field(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, type_ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+	f := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    label.Enum(),
+		Type:     type_.Enum(),
+	}
+	if typeName != "" {
+		f.TypeName = proto.String(typeName)
+	}
+	return f
+}
+
+// newMessage parses a message of the given type, or returns nil for an empty
+// string.
+func newMessage(t *testing.T, md protoreflect.MessageDescriptor, s string) proto.Message {
+	if s == "" {
+		return nil
+	}
+	m := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal([]byte(s), m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return m
+}
+
+const prevEvent = `{
+  "id": "1",
+  "name": "a",
+  "count": 2,
+  "tags": ["x", "y"],
+  "attrs": {"a": "1", "b": "2"},
+  "created": "1970-01-01T00:00:01Z",
+  "place": {"lat": 1.5, "status": "ACTIVE"},
+  "stops": [{"lat": 1, "status": "ACTIVE"}, {"lat": 2}],
+  "states": ["ACTIVE", "UNKNOWN"]
+}`
+
+const nextEvent = `{
+  "id": "1",
+  "name": "b",
+  "ratio": 0.5,
+  "tags": ["x", "z", "w"],
+  "attrs": {"b": "3", "c": "4"},
+  "created": "1970-01-01T00:00:02Z",
+  "alias": "q",
+  "place": {"lat": 1.5},
+  "stops": [{"lat": 2}, {"lat": 1}],
+  "states": ["UNKNOWN", "ACTIVE"]
+}`
+
+// changeStrings renders changes; message values are elided, since their text
+// format is deliberately unstable.
+func changeStrings(cs []Change) []string {
+	var out []string
+	for _, c := range cs {
+		if _, ok := c.Old.(proto.Message); ok {
+			c.Old = "msg"
+		}
+		if _, ok := c.New.(proto.Message); ok {
+			c.New = "msg"
+		}
+		out = append(out, c.String())
+	}
+	return out
+}
+
+func TestDiffer(t *testing.T) {
+	event := (&testpb.FlatEvent{}).ProtoReflect().Descriptor()
+
+	cases := []struct {
+		options      []Option
+		prev         string
+		next         string
+		expected     []string
+		expectedMask []string
+		name         string
+	}{
+		{
+			nil,
+			prevEvent,
+			prevEvent,
+			nil,
+			nil,
+			"equal",
+		},
+		{
+			nil,
+			prevEvent,
+			nextEvent,
+			[]string{
+				"modified name: a -> b",
+				"added ratio: 0.5",
+				"removed count: 2",
+				"modified tags[1]: y -> z",
+				"added tags[2]: w",
+				`removed attrs["a"]: 1`,
+				`modified attrs["b"]: 2 -> 3`,
+				`added attrs["c"]: 4`,
+				"modified created: msg -> msg",
+				"added alias: q",
+				"removed place.status: 1",
+				"modified stops[0].lat: 1 -> 2",
+				"removed stops[0].status: 1",
+				"modified stops[1].lat: 2 -> 1",
+				"reordered states: [1 0] -> [0 1]",
+			},
+			[]string{"alias", "attrs", "count", "created", "name", "place.status", "ratio", "states", "stops", "tags"},
+			"changes",
+		},
+		{
+			[]Option{
+				OptionIgnore("name"),
+				OptionIgnore("tags[2]"),
+				OptionIgnore(`attrs["b"]`),
+				OptionIgnore("**.status"),
+				OptionSetKey("stops", "lat"),
+			},
+			prevEvent,
+			nextEvent,
+			[]string{
+				"added ratio: 0.5",
+				"removed count: 2",
+				"modified tags[1]: y -> z",
+				`removed attrs["a"]: 1`,
+				`added attrs["c"]: 4`,
+				"modified created: msg -> msg",
+				"added alias: q",
+				"reordered states: [1 0] -> [0 1]",
+			},
+			[]string{"alias", "attrs", "count", "created", "ratio", "states", "tags"},
+			"options",
+		},
+		{
+			nil,
+			"",
+			`{"id": "1", "stops": [{"lat": 1}]}`,
+			[]string{"added id: 1", "added stops[0]: msg"},
+			[]string{"id", "stops"},
+			"nil",
+		},
+		{
+			nil,
+			`{"ratio": "NaN", "place": {"lat": "NaN"}, "stops": [{"lat": "NaN"}]}`,
+			`{"ratio": "NaN", "place": {"lat": "NaN"}, "stops": [{"lat": "NaN"}]}`,
+			nil,
+			nil,
+			"NaN",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := NewDiffer(c.options...).Apply(newMessage(t, event, c.prev), newMessage(t, event, c.next))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ss := changeStrings(actual); !reflect.DeepEqual(ss, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, ss)
+			}
+			if fm := FieldMask(actual); !reflect.DeepEqual(fm.GetPaths(), c.expectedMask) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expectedMask, fm.GetPaths())
+			}
+		})
+	}
+}
+
+func TestDiffer_Errors(t *testing.T) {
+	m := testpb.NewFlatEvent(t, `{"stops": [{"lat": 1}]}`)
+
+	cases := []struct {
+		options []Option
+		prev    proto.Message
+		next    proto.Message
+		name    string
+	}{
+		{nil, nil, nil, "nil"},
+		{nil, m, &structpb.Struct{}, "type mismatch"},
+		{nil, m, newMessage(t, testpb.CopyDescriptor(t, (&testpb.FlatEvent{}).ProtoReflect().Descriptor()), `{}`), "other descriptor"},
+		{[]Option{OptionSetKey("stops", "nope")}, m, m, "unknown key"},
+		{[]Option{OptionSetKey("stops", "lat")}, testpb.NewFlatEvent(t, `{"stops": [{"lat": 1}, {"lat": 1}]}`), m, "duplicate old key"},
+		{[]Option{OptionSetKey("stops", "lat")}, m, testpb.NewFlatEvent(t, `{"stops": [{"lat": 1}, {"lat": 1}]}`), "duplicate new key"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := NewDiffer(c.options...).Apply(c.prev, c.next); err == nil {
+				t.Errorf("%s: expected error", c.name)
+			}
+		})
+	}
+}
+
+func TestDiffer_SameNameOtherDescriptor(t *testing.T) {
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("other.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("FlatEvent"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("other", 3, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other := fd.Messages().ByName("FlatEvent")
+
+	d := NewDiffer()
+	if _, err := d.Apply(testpb.NewFlatEvent(t, `{}`), testpb.NewFlatEvent(t, `{"id": "1"}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	actual, err := d.Apply(newMessage(t, other, `{}`), newMessage(t, other, `{"other": "x"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"added other: x"}
+	if ss := changeStrings(actual); !reflect.DeepEqual(ss, expected) {
+		t.Errorf("\nexpected %v, \ngot      %v", expected, ss)
+	}
+}
+
+func TestFieldMask_Replay(t *testing.T) {
+	prev, next := testpb.NewFlatEvent(t, prevEvent), testpb.NewFlatEvent(t, nextEvent)
+
+	cs, err := NewDiffer().Apply(prev, next)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	actual := proto.Clone(prev)
+	if err := transforms.NewMerger().Apply(actual, next, FieldMask(cs)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !proto.Equal(actual, next) {
+		t.Errorf("expected %v, \ngot      %v", next, actual)
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"math"
+	"sync"
+)
+
+// A Differ compares two messages of the same type. It is safe for concurrent
+// use by multiple goroutines.
+type Differ interface {
+	// Apply returns the changes from prev to next. A nil message is treated
+	// as an empty message of the type of the other. Both messages must share
+	// their descriptor; copies of the same type, such as a generated message
+	// and a dynamic message of a separately loaded file, are rejected.
+	Apply(prev, next proto.Message) ([]Change, error)
+}
+
+type differ struct {
+	config *config
+	fields sync.Map
+}
+
+// NewDiffer creates a new Differ.
+func NewDiffer(options ...Option) Differ {
+	return &differ{
+		config: newConfig(options),
+	}
+}
+
+// messageFields holds the fields of a message type, in field number order.
+type messageFields struct {
+	md  protoreflect.MessageDescriptor
+	fds []protoreflect.FieldDescriptor
+}
+
+// messageFields returns the fields of a message type. They are cached by the
+// descriptor's full name. Should a different descriptor with the same name be
+// passed (as can happen with dynamic messages), its fields are collected anew.
+func (d *differ) messageFields(md protoreflect.MessageDescriptor) []protoreflect.FieldDescriptor {
+	x, ok := d.fields.Load(md.FullName())
+	if !ok {
+		x, _ = d.fields.LoadOrStore(md.FullName(), d.collectFields(md))
+	}
+	if mf := x.(*messageFields); mf.md == md {
+		return mf.fds
+	}
+	return d.collectFields(md).fds
+}
+
+func (d *differ) collectFields(md protoreflect.MessageDescriptor) *messageFields {
+	return &messageFields{md: md, fds: transforms.DescriptorFields(md)}
+}
+
+func (d *differ) Apply(prev, next proto.Message) ([]Change, error) {
+	switch {
+	case prev == nil && next == nil:
+		return nil, fmt.Errorf("cannot compare two nil messages")
+	case prev == nil:
+		prev = next.ProtoReflect().Type().Zero().Interface()
+	case next == nil:
+		next = prev.ProtoReflect().Type().Zero().Interface()
+	}
+	a, b := prev.ProtoReflect(), next.ProtoReflect()
+	if a.Descriptor().FullName() != b.Descriptor().FullName() {
+		return nil, fmt.Errorf("cannot compare %s to %s", a.Descriptor().FullName(), b.Descriptor().FullName())
+	}
+	if a.Descriptor() != b.Descriptor() {
+		// fields are looked up by descriptor, which does not work across copies
+		return nil, fmt.Errorf("cannot compare %s to %s: their descriptors are distinct", a.Descriptor().FullName(), b.Descriptor().FullName())
+	}
+	s := &state{d: d}
+	s.message(nil, "", a, b)
+	return s.changes, s.err
+}
+
+// A state holds the changes of a single comparison.
+type state struct {
+	d       *differ
+	changes []Change
+	// err is the first error encountered
+	err error
+}
+
+func (s *state) add(k Kind, path []transforms.PathElement, prev, next interface{}) {
+	p := make([]transforms.PathElement, len(path))
+	copy(p, path)
+	s.changes = append(s.changes, Change{Kind: k, Path: p, Old: prev, New: next})
+}
+
+func (s *state) ignored(path []transforms.PathElement) bool {
+	for _, p := range s.d.config.ignore {
+		if p.MatchPath(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// setKey returns the name of the key field for a repeated field compared as
+// a set, or an empty string.
+func (s *state) setKey(name string) string {
+	ks := s.d.config.keys
+	for i := len(ks) - 1; i >= 0; i -= 1 {
+		if ks[i].pattern.MatchName(name) {
+			return ks[i].field
+		}
+	}
+	return ""
+}
+
+// createName creates the dotted name of a field, like the Walker does.
+func createName(parent string, name protoreflect.Name) string {
+	if parent == "" {
+		return string(name)
+	}
+	return parent + "." + string(name)
+}
+
+// withElement returns a copy of the path with an element appended.
+func withElement(path []transforms.PathElement, e transforms.PathElement) []transforms.PathElement {
+	return append(path[:len(path):len(path)], e)
+}
+
+func (s *state) message(path []transforms.PathElement, name string, a, b protoreflect.Message) {
+	for _, fd := range s.d.messageFields(a.Descriptor()) {
+		p := withElement(path, transforms.PathElement{Field: fd, Index: -1})
+		if s.ignored(p) {
+			continue
+		}
+		n := createName(name, fd.Name())
+		switch {
+		case fd.IsMap():
+			s.mapField(p, n, fd, a.Get(fd).Map(), b.Get(fd).Map())
+		case fd.IsList():
+			s.list(p, n, fd, a.Get(fd).List(), b.Get(fd).List())
+		default:
+			hasA, hasB := a.Has(fd), b.Has(fd)
+			switch {
+			case hasA && hasB:
+				s.value(p, n, fd, a.Get(fd), b.Get(fd))
+			case hasA:
+				s.add(Removed, p, value(fd, a.Get(fd)), nil)
+			case hasB:
+				s.add(Added, p, nil, value(fd, b.Get(fd)))
+			}
+		}
+	}
+}
+
+// value compares two set values of a field, list item or map value.
+func (s *state) value(path []transforms.PathElement, name string, fd protoreflect.FieldDescriptor, a, b protoreflect.Value) {
+	switch {
+	case fd.Message() != nil && !atomicMessages[fd.Message().FullName()]:
+		s.message(path, name, a.Message(), b.Message())
+	case !equal(fd, a, b):
+		s.add(Modified, path, value(fd, a), value(fd, b))
+	}
+}
+
+func (s *state) list(path []transforms.PathElement, name string, fd protoreflect.FieldDescriptor, a, b protoreflect.List) {
+	if key := s.setKey(name); key != "" {
+		s.set(path, name, fd, key, a, b)
+		return
+	}
+	if a.Len() == b.Len() && !sameOrder(fd, a, b) && sameItems(fd, a, b) {
+		s.add(Reordered, path, items(fd, a), items(fd, b))
+		return
+	}
+	for i := 0; i < a.Len() || i < b.Len(); i += 1 {
+		p := itemPath(path, i)
+		if s.ignored(p) {
+			continue
+		}
+		switch {
+		case i >= b.Len():
+			s.add(Removed, p, value(fd, a.Get(i)), nil)
+		case i >= a.Len():
+			s.add(Added, p, nil, value(fd, b.Get(i)))
+		default:
+			s.value(p, name, fd, a.Get(i), b.Get(i))
+		}
+	}
+}
+
+// set compares two lists of messages as sets, matching items by a key field.
+func (s *state) set(path []transforms.PathElement, name string, fd protoreflect.FieldDescriptor, key string, a, b protoreflect.List) {
+	var kfd protoreflect.FieldDescriptor
+	if md := fd.Message(); md != nil {
+		kfd = md.Fields().ByName(protoreflect.Name(key))
+	}
+	if kfd == nil || kfd.Message() != nil || kfd.IsList() {
+		if s.err == nil {
+			s.err = fmt.Errorf("%s: %s is not a scalar field of the items", name, key)
+		}
+		return
+	}
+	keyOf := func(v protoreflect.Value) interface{} {
+		k := v.Message().Get(kfd).Interface()
+		if bs, ok := k.([]byte); ok {
+			return string(bs)
+		}
+		return k
+	}
+	// items would get lost if a key were to match several of them
+	for _, l := range []protoreflect.List{a, b} {
+		seen := make(map[interface{}]bool, l.Len())
+		for i := 0; i < l.Len(); i += 1 {
+			k := keyOf(l.Get(i))
+			if seen[k] {
+				if s.err == nil {
+					s.err = fmt.Errorf("%s: duplicate key %s = %v", name, key, k)
+				}
+				return
+			}
+			seen[k] = true
+		}
+	}
+	indices := make(map[interface{}]int, b.Len())
+	for i := 0; i < b.Len(); i += 1 {
+		indices[keyOf(b.Get(i))] = i
+	}
+	matched := make(map[interface{}]bool, a.Len())
+	for i := 0; i < a.Len(); i += 1 {
+		k := keyOf(a.Get(i))
+		matched[k] = true
+		j, ok := indices[k]
+		if !ok {
+			if p := itemPath(path, i); !s.ignored(p) {
+				s.add(Removed, p, value(fd, a.Get(i)), nil)
+			}
+			continue
+		}
+		if p := itemPath(path, j); !s.ignored(p) {
+			s.value(p, name, fd, a.Get(i), b.Get(j))
+		}
+	}
+	for j := 0; j < b.Len(); j += 1 {
+		if matched[keyOf(b.Get(j))] {
+			continue
+		}
+		if p := itemPath(path, j); !s.ignored(p) {
+			s.add(Added, p, nil, value(fd, b.Get(j)))
+		}
+	}
+}
+
+// itemPath returns a copy of the path to a list field, with the index of an
+// item set on its last element.
+func itemPath(path []transforms.PathElement, i int) []transforms.PathElement {
+	p := withElement(path[:len(path)-1], path[len(path)-1])
+	p[len(p)-1].Index = i
+	return p
+}
+
+func (s *state) mapField(path []transforms.PathElement, name string, fd protoreflect.FieldDescriptor, a, b protoreflect.Map) {
+	var keys []interface{}
+	collect := func(m, other protoreflect.Map, skipShared bool) {
+		m.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+			if !skipShared || !other.Has(k) {
+				keys = append(keys, k.Interface())
+			}
+			return true
+		})
+	}
+	collect(a, b, false)
+	collect(b, a, true)
+	transforms.SortMapKeys(fd, keys)
+
+	vfd := fd.MapValue()
+	n := createName(name, vfd.Name())
+	for _, k := range keys {
+		mk := protoreflect.ValueOf(k).MapKey()
+		e := path[len(path)-1]
+		e.Key = mk
+		p := withElement(withElement(path[:len(path)-1], e), transforms.PathElement{Field: vfd, Index: -1})
+		if s.ignored(p) {
+			continue
+		}
+		hasA, hasB := a.Has(mk), b.Has(mk)
+		switch {
+		case hasA && hasB:
+			s.value(p, n, vfd, a.Get(mk), b.Get(mk))
+		case hasA:
+			s.add(Removed, p, value(vfd, a.Get(mk)), nil)
+		default:
+			s.add(Added, p, nil, value(vfd, b.Get(mk)))
+		}
+	}
+}
+
+// atomicMessages holds the message types that are compared as a whole.
+var atomicMessages = map[protoreflect.FullName]bool{
+	"google.protobuf.Timestamp": true,
+	"google.protobuf.Duration":  true,
+}
+
+// value returns the value for a change: the native value of a scalar or the
+// proto.Message of a message.
+func value(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	if fd.Message() != nil {
+		return v.Message().Interface()
+	}
+	return v.Interface()
+}
+
+func items(fd protoreflect.FieldDescriptor, l protoreflect.List) []interface{} {
+	out := make([]interface{}, l.Len())
+	for i := range out {
+		out[i] = value(fd, l.Get(i))
+	}
+	return out
+}
+
+func equal(fd protoreflect.FieldDescriptor, a, b protoreflect.Value) bool {
+	switch {
+	case fd.Message() != nil:
+		return proto.Equal(a.Message().Interface(), b.Message().Interface())
+	case fd.Kind() == protoreflect.BytesKind:
+		return bytes.Equal(a.Bytes(), b.Bytes())
+	case fd.Kind() == protoreflect.FloatKind || fd.Kind() == protoreflect.DoubleKind:
+		// NaN is not equal to itself, but is not a change either
+		x, y := a.Float(), b.Float()
+		return x == y || math.IsNaN(x) && math.IsNaN(y)
+	}
+	return a.Interface() == b.Interface()
+}
+
+func sameOrder(fd protoreflect.FieldDescriptor, a, b protoreflect.List) bool {
+	for i := 0; i < a.Len(); i += 1 {
+		if !equal(fd, a.Get(i), b.Get(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameItems reports whether two lists of equal length hold the same items,
+// in any order.
+func sameItems(fd protoreflect.FieldDescriptor, a, b protoreflect.List) bool {
+	used := make([]bool, b.Len())
+	for i := 0; i < a.Len(); i += 1 {
+		found := false
+		for j := 0; j < b.Len(); j += 1 {
+			if !used[j] && equal(fd, a.Get(i), b.Get(j)) {
+				used[j] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
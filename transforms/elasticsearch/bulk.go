@@ -0,0 +1,157 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package elasticsearch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"io"
+	"strings"
+	"time"
+)
+
+// A BulkEncoder writes messages as the NDJSON body of a bulk request: an
+// action line followed by the document, per message. It is safe for
+// concurrent use by multiple goroutines.
+//
+// Documents match the mappings created by a MappingConverter. Unset fields
+// without presence are omitted; Elasticsearch treats them as missing.
+type BulkEncoder interface {
+	Encode(w io.Writer, ms []proto.Message) error
+}
+
+type bulkEncoder struct {
+	config *config
+	walker transforms.Walker
+}
+
+// NewBulkEncoder creates a new BulkEncoder. OptionStringMapping,
+// OptionRepeatedMapping and OptionAddNameOverride do not apply.
+func NewBulkEncoder(options ...Option) BulkEncoder {
+	c := newConfig(options)
+	return &bulkEncoder{
+		config: c,
+		walker: transforms.NewWalker(
+			transforms.OptionKeepSet(true),
+			transforms.OptionMaxDepth(c.maxDepth),
+			transforms.OptionDefaultScalarFunc(convertScalar),
+			transforms.OptionMapStrategy(transforms.MapStringKeys),
+			transforms.OptionAddTypeOverride(timestampName, convertTimestamp),
+		),
+	}
+}
+
+// MarshalBulk returns the bulk request body for a slice of messages.
+func MarshalBulk(ms []proto.Message, options ...Option) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := NewBulkEncoder(options...).Encode(buf, ms); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func convertScalar(fd protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	if fd.Kind() == protoreflect.EnumKind {
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return int32(v.Enum())
+	}
+	return v.Interface()
+}
+
+func convertTimestamp(_ protoreflect.FieldDescriptor, kvs []transforms.KeyValue) interface{} {
+	seconds, nanos := int64(0), int64(0)
+	for _, kv := range kvs {
+		switch kv.Key {
+		case "seconds":
+			seconds = kv.Value.(int64)
+		case "nanos":
+			nanos = int64(kv.Value.(int32))
+		}
+	}
+	return time.Unix(seconds, nanos).UTC()
+}
+
+func (e *bulkEncoder) Encode(w io.Writer, ms []proto.Message) error {
+	// a bufio.Writer retains the first error, so writes need not be checked
+	bw := bufio.NewWriter(w)
+	for i, m := range ms {
+		if m == nil {
+			return fmt.Errorf("message %d: cannot encode nil message", i)
+		}
+		action, err := e.action(m.ProtoReflect())
+		if err != nil {
+			return fmt.Errorf("message %d: %w", i, err)
+		}
+		doc, err := json.Marshal(e.walker.Apply(m))
+		if err != nil {
+			return fmt.Errorf("message %d: %w", i, err)
+		}
+		bw.Write(action)
+		bw.WriteByte('\n')
+		bw.Write(doc)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// action returns the action line for a message.
+func (e *bulkEncoder) action(m protoreflect.Message) ([]byte, error) {
+	meta := map[string]string{}
+	if e.config.index != "" {
+		meta["_index"] = e.config.index
+	}
+	if e.config.idField != "" {
+		id, err := lookupID(m, e.config.idField)
+		if err != nil {
+			return nil, err
+		}
+		meta["_id"] = id
+	}
+	name := "index"
+	if e.config.action == ActionCreate {
+		name = "create"
+	}
+	return json.Marshal(map[string]interface{}{name: meta})
+}
+
+// lookupID returns the value of the ID field of a message as a string. Unset
+// fields yield their default values.
+func lookupID(m protoreflect.Message, path string) (string, error) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+		switch {
+		case fd == nil:
+			return "", fmt.Errorf("unknown ID field %q", path)
+		case fd.IsList() || fd.IsMap():
+			return "", fmt.Errorf("invalid ID field %q", path)
+		case i < len(names)-1:
+			if fd.Message() == nil {
+				return "", fmt.Errorf("invalid ID field %q", path)
+			}
+			m = m.Get(fd).Message()
+			continue
+		}
+		if fd.Message() != nil || fd.Kind() == protoreflect.BytesKind {
+			return "", fmt.Errorf("invalid ID field %q", path)
+		}
+		v := m.Get(fd)
+		if fd.Kind() == protoreflect.EnumKind {
+			return fmt.Sprint(convertScalar(fd, &v)), nil
+		}
+		return fmt.Sprint(v.Interface()), nil
+	}
+	return "", fmt.Errorf("invalid ID field %q", path)
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package elasticsearch
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"google.golang.org/protobuf/proto"
+	"strings"
+	"testing"
+)
+
+const fullEvent = `{
+  "id": "1",
+  "name": "a",
+  "ratio": 0.5,
+  "count": 4294967295,
+  "status": "ACTIVE",
+  "tags": ["x", "y"],
+  "attrs": {"b": "2", "a": "1"},
+  "created": "1970-01-01T00:00:01.000002Z",
+  "alias": "q",
+  "place": {"lat": 1.5, "seen": ["1970-01-01T00:00:02Z"]},
+  "stops": [{"status": "ACTIVE"}],
+  "states": ["ACTIVE", "UNKNOWN"]
+}`
+
+func TestMarshalBulk(t *testing.T) {
+	ms := []proto.Message{testpb.NewFlatEvent(t, fullEvent), testpb.NewFlatEvent(t, `{"id": "2"}`)}
+
+	cases := []struct {
+		options  []Option
+		expected string
+		name     string
+	}{
+		{nil, `{"index":{}}
+{"alias":"q","attrs":{"a":1,"b":2},"count":4294967295,"created":"1970-01-01T00:00:01.000002Z","id":1,"name":"a","place":{"lat":1.5,"seen":["1970-01-01T00:00:02Z"]},"ratio":0.5,"states":["ACTIVE","UNKNOWN"],"status":"ACTIVE","stops":[{"status":"ACTIVE"}],"tags":["x","y"]}
+{"index":{}}
+{"id":2}
+`, "default"},
+		{
+			[]Option{OptionIndex("events"), OptionIDField("id"), OptionAction(ActionCreate), OptionMaxDepth(1)},
+			`{"create":{"_id":"1","_index":"events"}}
+{"alias":"q","attrs":{"a":1,"b":2},"count":4294967295,"created":"1970-01-01T00:00:01.000002Z","id":1,"name":"a","place":{"lat":1.5},"ratio":0.5,"states":["ACTIVE","UNKNOWN"],"status":"ACTIVE","stops":[{"status":"ACTIVE"}],"tags":["x","y"]}
+{"create":{"_id":"2","_index":"events"}}
+{"id":2}
+`,
+			"options",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := MarshalBulk(ms, c.options...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(actual) != c.expected {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, string(actual))
+			}
+		})
+	}
+}
+
+func TestMarshalBulk_IDField(t *testing.T) {
+	ms := []proto.Message{testpb.NewFlatEvent(t, fullEvent)}
+
+	cases := []struct {
+		idField  string
+		expected string
+		name     string
+	}{
+		{"status", `{"index":{"_id":"ACTIVE"}}`, "enum"},
+		{"place.lat", `{"index":{"_id":"1.5"}}`, "nested"},
+		{"place.status", `{"index":{"_id":"UNKNOWN"}}`, "default"},
+		{"tags", "", "repeated"},
+		{"place", "", "message"},
+		{"place.foo", "", "unknown"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			bs, err := MarshalBulk(ms, OptionIDField(c.idField))
+			actual := ""
+			if err == nil {
+				actual = strings.SplitN(string(bs), "\n", 2)[0]
+			}
+			if actual != c.expected {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package elasticsearch converts message descriptors into Elasticsearch (and
+// OpenSearch) index mappings and messages into bulk request bodies.
+//
+// Scalars map to boolean, integer, long, unsigned_long, float, double, binary
+// and, for strings, keyword or text (see OptionStringMapping). Enums map to
+// keyword, holding the value's name. Messages map to objects, repeated
+// messages to nested or object fields (see OptionRepeatedMapping), maps to
+// flattened fields and google.protobuf.Timestamp to date. Properties are named
+// by the fields' proto names.
+//
+// The generated properties can be adjusted per field with OptionAddNameOverride,
+// which accepts the paths of transforms.OptionAddNameOverride.
+package elasticsearch
+
+import (
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms"
+)
+
+const (
+	timestampName = "google.protobuf.Timestamp"
+
+	defaultMaxDepth = 10
+)
+
+// A Property is the mapping of a field. It marshals to JSON via
+// encoding/json.
+type Property = map[string]interface{}
+
+// Keyword returns a keyword property.
+func Keyword() Property {
+	return Property{"type": "keyword"}
+}
+
+// Text returns a text property with the given analyzer. If the analyzer is
+// empty, the index's default analyzer is used.
+func Text(analyzer string) Property {
+	p := Property{"type": "text"}
+	if analyzer != "" {
+		p["analyzer"] = analyzer
+	}
+	return p
+}
+
+// A StringMapping determines how strings are mapped.
+type StringMapping int
+
+const (
+	// StringsAsKeyword maps strings to keyword. This is the default.
+	StringsAsKeyword = StringMapping(iota)
+	// StringsAsText maps strings to text.
+	StringsAsText
+	// StringsAsMultiField maps strings to text with a keyword subfield named
+	// 'keyword', as Elasticsearch's dynamic mapping does.
+	StringsAsMultiField
+)
+
+// A RepeatedMapping determines how repeated messages are mapped.
+type RepeatedMapping int
+
+const (
+	// RepeatedAsNested maps repeated messages to nested fields, which keeps
+	// the fields of each message together in queries. This is the default.
+	RepeatedAsNested = RepeatedMapping(iota)
+	// RepeatedAsObject maps repeated messages to object fields, which
+	// flattens them into arrays per field.
+	RepeatedAsObject
+)
+
+// An Action is the bulk action for a document.
+type Action int
+
+const (
+	// ActionIndex adds or replaces documents. This is the default.
+	ActionIndex = Action(iota)
+	// ActionCreate adds documents, failing for existing ones.
+	ActionCreate
+)
+
+type override struct {
+	pattern  *transforms.PathPattern
+	property Property
+}
+
+type config struct {
+	strings   StringMapping
+	repeated  RepeatedMapping
+	overrides []override
+	maxDepth  int
+	index     string
+	idField   string
+	action    Action
+}
+
+type Option interface {
+	// Apply applies the Option to the converter.
+	Apply(c *config)
+}
+
+type optionStringMapping struct {
+	value StringMapping
+}
+
+func (o *optionStringMapping) Apply(c *config) {
+	c.strings = o.value
+}
+
+// OptionStringMapping sets how strings are mapped. Defaults to
+// StringsAsKeyword.
+func OptionStringMapping(v StringMapping) Option {
+	if v < StringsAsKeyword || v > StringsAsMultiField {
+		panic(fmt.Sprintf("unknown string mapping %d", v))
+	}
+	return &optionStringMapping{value: v}
+}
+
+type optionRepeatedMapping struct {
+	value RepeatedMapping
+}
+
+func (o *optionRepeatedMapping) Apply(c *config) {
+	c.repeated = o.value
+}
+
+// OptionRepeatedMapping sets how repeated messages are mapped. Defaults to
+// RepeatedAsNested.
+func OptionRepeatedMapping(v RepeatedMapping) Option {
+	if v != RepeatedAsNested && v != RepeatedAsObject {
+		panic(fmt.Sprintf("unknown repeated mapping %d", v))
+	}
+	return &optionRepeatedMapping{value: v}
+}
+
+type optionAddNameOverride struct {
+	value override
+}
+
+func (o *optionAddNameOverride) Apply(c *config) {
+	c.overrides = append(c.overrides, o.value)
+}
+
+// OptionAddNameOverride adjusts the property of the fields matching a path,
+// i.e. OptionAddNameOverride("title", Text("english")). The entries of the
+// given property are added to the generated one. If it sets a different type,
+// the other entries of the generated property are dropped, except for the
+// properties of a message. A nil value removes an entry.
+//
+// The name is a path, as for transforms.OptionAddNameOverride, and the same
+// precedence rules apply. Paths with indices or keys do not match any field.
+// It panics if the path is invalid.
+func OptionAddNameOverride(name string, p Property) Option {
+	return &optionAddNameOverride{value: override{pattern: transforms.MustParsePathPattern(name), property: p}}
+}
+
+type optionMaxDepth struct {
+	value int
+}
+
+func (o *optionMaxDepth) Apply(c *config) {
+	c.maxDepth = o.value
+}
+
+// OptionMaxDepth sets a maximum message recursion depth. Message fields beyond
+// it are left out of the mapping and the documents. Defaults to 10. See
+// transforms.OptionMaxDepth.
+func OptionMaxDepth(v int) Option {
+	return &optionMaxDepth{value: v}
+}
+
+type optionIndex struct {
+	value string
+}
+
+func (o *optionIndex) Apply(c *config) {
+	c.index = o.value
+}
+
+// OptionIndex sets the index in the bulk actions. If not set, the index of
+// the request URL applies.
+func OptionIndex(v string) Option {
+	if v == "" {
+		panic("index cannot be empty")
+	}
+	return &optionIndex{value: v}
+}
+
+type optionIDField struct {
+	value string
+}
+
+func (o *optionIDField) Apply(c *config) {
+	c.idField = o.value
+}
+
+// OptionIDField sets the field holding the document ID by its dotted name,
+// like "id" or "meta.id". The field must be a non-repeated scalar other than
+// bytes. If not set, Elasticsearch generates IDs.
+func OptionIDField(v string) Option {
+	if v == "" {
+		panic("ID field cannot be empty")
+	}
+	return &optionIDField{value: v}
+}
+
+type optionAction struct {
+	value Action
+}
+
+func (o *optionAction) Apply(c *config) {
+	c.action = o.value
+}
+
+// OptionAction sets the bulk action for the documents. Defaults to
+// ActionIndex.
+func OptionAction(v Action) Option {
+	if v != ActionIndex && v != ActionCreate {
+		panic(fmt.Sprintf("unknown action %d", v))
+	}
+	return &optionAction{value: v}
+}
+
+func newConfig(options []Option) *config {
+	c := &config{maxDepth: defaultMaxDepth}
+	for _, o := range options {
+		o.Apply(c)
+	}
+	return c
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package elasticsearch
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// A Mapping is an index mapping, as sent in the 'mappings' of a create index
+// request. It marshals to JSON via encoding/json.
+type Mapping = map[string]interface{}
+
+// A MappingConverter converts message descriptors into index mappings. It is
+// safe for concurrent use by multiple goroutines.
+type MappingConverter interface {
+	Apply(md protoreflect.MessageDescriptor) Mapping
+}
+
+type mappingConverter struct {
+	config *config
+}
+
+// NewMappingConverter creates a new MappingConverter. OptionIndex,
+// OptionIDField and OptionAction do not apply.
+func NewMappingConverter(options ...Option) MappingConverter {
+	return &mappingConverter{config: newConfig(options)}
+}
+
+func (mc *mappingConverter) Apply(md protoreflect.MessageDescriptor) Mapping {
+	return Mapping{"properties": mc.properties(md, "", mc.config.maxDepth-1)}
+}
+
+// properties returns the properties for the fields of a message. The allowed
+// depth mirrors that of the Walker: message fields are only included if it is
+// not negative.
+func (mc *mappingConverter) properties(md protoreflect.MessageDescriptor, prefix string, allowedDepth int) Property {
+	out := Property{}
+	for i := 0; i < md.Fields().Len(); i += 1 {
+		fd := md.Fields().Get(i)
+		name := prefix + string(fd.Name())
+		if p := mc.property(fd, name, allowedDepth); p != nil {
+			out[string(fd.Name())] = mc.override(name, p)
+		}
+	}
+	return out
+}
+
+func (mc *mappingConverter) property(fd protoreflect.FieldDescriptor, name string, allowedDepth int) Property {
+	switch {
+	case fd.IsMap():
+		return Property{"type": "flattened"}
+	case fd.Message() == nil:
+		return mc.scalar(fd)
+	case allowedDepth < 0:
+		return nil
+	case fd.Message().FullName() == timestampName:
+		return Property{"type": "date"}
+	}
+	type_ := "object"
+	if fd.IsList() && mc.config.repeated == RepeatedAsNested {
+		type_ = "nested"
+	}
+	return Property{
+		"type":       type_,
+		"properties": mc.properties(fd.Message(), name+".", allowedDepth-1),
+	}
+}
+
+func (mc *mappingConverter) scalar(fd protoreflect.FieldDescriptor) Property {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return Property{"type": "boolean"}
+	case protoreflect.EnumKind:
+		return Keyword()
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return Property{"type": "integer"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return Property{"type": "long"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return Property{"type": "unsigned_long"}
+	case protoreflect.FloatKind:
+		return Property{"type": "float"}
+	case protoreflect.DoubleKind:
+		return Property{"type": "double"}
+	case protoreflect.StringKind:
+		switch mc.config.strings {
+		case StringsAsText:
+			return Text("")
+		case StringsAsMultiField:
+			return Property{
+				"type":   "text",
+				"fields": Property{"keyword": Property{"type": "keyword", "ignore_above": 256}},
+			}
+		}
+		return Keyword()
+	case protoreflect.BytesKind:
+		return Property{"type": "binary"}
+	default:
+		panic(fmt.Sprintf("unsupported type %v", fd.Kind()))
+	}
+}
+
+// override applies the override for a field, if any, to its property.
+func (mc *mappingConverter) override(name string, p Property) Property {
+	var o *override
+	for i, x := range mc.config.overrides {
+		// later overrides take precedence over earlier ones of equal precedence
+		if x.pattern.MatchName(name) && (o == nil || !o.pattern.Precedes(x.pattern)) {
+			o = &mc.config.overrides[i]
+		}
+	}
+	if o == nil {
+		return p
+	}
+	out := Property{}
+	if t, ok := o.property["type"]; !ok || t == p["type"] {
+		for k, v := range p {
+			out[k] = v
+		}
+	} else if ps, ok := p["properties"]; ok {
+		out["properties"] = ps
+	}
+	for k, v := range o.property {
+		if v == nil {
+			delete(out, k)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package elasticsearch
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"reflect"
+	"testing"
+)
+
+func TestMappingConverter(t *testing.T) {
+	event := (&testpb.FlatEvent{}).ProtoReflect().Descriptor()
+
+	cases := []struct {
+		options  []Option
+		expected Mapping
+		name     string
+	}{
+		{
+			nil,
+			Mapping{"properties": Property{
+				"id":      Property{"type": "long"},
+				"name":    Property{"type": "keyword"},
+				"ratio":   Property{"type": "float"},
+				"count":   Property{"type": "long"},
+				"status":  Property{"type": "keyword"},
+				"tags":    Property{"type": "keyword"},
+				"attrs":   Property{"type": "flattened"},
+				"created": Property{"type": "date"},
+				"alias":   Property{"type": "keyword"},
+				"place": Property{"type": "object", "properties": Property{
+					"lat":    Property{"type": "double"},
+					"status": Property{"type": "keyword"},
+					"seen":   Property{"type": "date"},
+				}},
+				"stops": Property{"type": "nested", "properties": Property{
+					"lat":    Property{"type": "double"},
+					"status": Property{"type": "keyword"},
+					"seen":   Property{"type": "date"},
+				}},
+				"states": Property{"type": "keyword"},
+			}},
+			"default",
+		},
+		{
+			[]Option{
+				OptionMaxDepth(1),
+				OptionStringMapping(StringsAsMultiField),
+				OptionRepeatedMapping(RepeatedAsObject),
+				OptionAddNameOverride("name", Text("english")),
+				OptionAddNameOverride("alias", Property{"fields": nil}),
+				OptionAddNameOverride("**.status", Property{"null_value": "NONE"}),
+				OptionAddNameOverride("*.status", Property{"null_value": "UNKNOWN"}),
+				OptionAddNameOverride("stops", Property{"type": "nested"}),
+				OptionAddNameOverride("stops.lat", Property{"type": "float"}),
+			},
+			Mapping{"properties": Property{
+				"id": Property{"type": "long"},
+				"name": Property{
+					"type":     "text",
+					"analyzer": "english",
+					"fields":   Property{"keyword": Property{"type": "keyword", "ignore_above": 256}},
+				},
+				"ratio":   Property{"type": "float"},
+				"count":   Property{"type": "long"},
+				"status":  Property{"type": "keyword", "null_value": "NONE"},
+				"tags":    Property{"type": "text", "fields": Property{"keyword": Property{"type": "keyword", "ignore_above": 256}}},
+				"attrs":   Property{"type": "flattened"},
+				"created": Property{"type": "date"},
+				"alias":   Property{"type": "text"},
+				"place": Property{"type": "object", "properties": Property{
+					"lat":    Property{"type": "double"},
+					"status": Property{"type": "keyword", "null_value": "UNKNOWN"},
+				}},
+				"stops": Property{"type": "nested", "properties": Property{
+					"lat":    Property{"type": "float"},
+					"status": Property{"type": "keyword", "null_value": "UNKNOWN"},
+				}},
+				"states": Property{"type": "keyword"},
+			}},
+			"options",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := NewMappingConverter(c.options...).Apply(event)
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package testpb holds the message types shared by the tests of the
+// transforms packages.
+package testpb
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative internal/testpb/event.proto
+
+import (
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"testing"
+)
+
+// NewEvent parses an Event from its JSON mapping.
+func NewEvent(t testing.TB, s string) *Event {
+	m := &Event{}
+	if err := protojson.Unmarshal([]byte(s), m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return m
+}
+
+// NewFlatEvent parses a FlatEvent from its JSON mapping.
+func NewFlatEvent(t testing.TB, s string) *FlatEvent {
+	m := &FlatEvent{}
+	if err := protojson.Unmarshal([]byte(s), m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return m
+}
+
+// CopyDescriptor returns a message type from a separately built copy of its
+// file: a distinct descriptor with the same name.
+func CopyDescriptor(t testing.TB, md protoreflect.MessageDescriptor) protoreflect.MessageDescriptor {
+	fd, err := protodesc.NewFile(protodesc.ToFileDescriptorProto(md.ParentFile()), protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return fd.Messages().ByName(md.Name())
+}
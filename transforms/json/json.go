@@ -0,0 +1,367 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package json encodes messages as canonical JSON. Unlike protojson, its
+// output is byte-stable: the same message always yields the same bytes, which
+// makes it suitable for hashing and deduplication keys.
+//
+// The output is defined as follows:
+//
+//   - fields are ordered by their numbers and named by their proto names
+//   - unset fields are omitted; set fields with presence are written, even
+//     if they hold a default value
+//   - map entries are ordered by their keys' natural ordering
+//   - 64-bit integers are written as strings (configurable)
+//   - enums are written by name (configurable); unknown values by number
+//   - floats are formatted as by encoding/json; NaN and infinities are
+//     written as "NaN", "Infinity" and "-Infinity"
+//   - bytes are written as standard base64
+//   - no insignificant whitespace is written
+//
+// Well-known types are not treated specially; they are written as any other
+// message.
+package json
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"io"
+	"math"
+	"strconv"
+)
+
+// An EnumMode determines how enum values are written.
+type EnumMode int
+
+const (
+	// EnumAsName writes enum values by their names. Values without a name
+	// are written as numbers. This is the default.
+	EnumAsName = EnumMode(iota)
+	// EnumAsNumber writes enum values by their numbers.
+	EnumAsNumber
+)
+
+// An Encoder writes messages as canonical JSON. It is safe for concurrent use
+// by multiple goroutines.
+type Encoder interface {
+	// Encode writes the JSON encoding of a message to w, followed by a
+	// newline.
+	Encode(w io.Writer, m proto.Message) error
+}
+
+type encoder struct {
+	walker        transforms.Walker
+	walkerOpts    []transforms.Option
+	int64AsString bool
+	enumMode      EnumMode
+	jsonNames     bool
+}
+
+type Option interface {
+	// Apply applies the Option to the Encoder.
+	Apply(e *encoder)
+}
+
+type optionInt64AsString struct {
+	value bool
+}
+
+func (o *optionInt64AsString) Apply(e *encoder) {
+	e.int64AsString = o.value
+}
+
+// OptionInt64AsString sets whether 64-bit integers are written as strings, as
+// protojson does. JSON numbers cannot represent all 64-bit integers in most
+// decoders. Defaults to true.
+func OptionInt64AsString(v bool) Option {
+	return &optionInt64AsString{value: v}
+}
+
+type optionEnumMode struct {
+	value EnumMode
+}
+
+func (o *optionEnumMode) Apply(e *encoder) {
+	e.enumMode = o.value
+}
+
+// OptionEnumMode sets how enum values are written. Defaults to EnumAsName.
+func OptionEnumMode(v EnumMode) Option {
+	return &optionEnumMode{value: v}
+}
+
+type optionJSONNames struct {
+	value bool
+}
+
+func (o *optionJSONNames) Apply(e *encoder) {
+	e.jsonNames = o.value
+}
+
+// OptionJSONNames sets whether fields are named by their JSON names (i.e.
+// 'requestTypeUrl') rather than their proto names (i.e. 'request_type_url').
+func OptionJSONNames(v bool) Option {
+	return &optionJSONNames{value: v}
+}
+
+type optionMaxDepth struct {
+	value int
+}
+
+func (o *optionMaxDepth) Apply(e *encoder) {
+	e.walkerOpts = append(e.walkerOpts, transforms.OptionMaxDepth(o.value))
+}
+
+// OptionMaxDepth sets a maximum message recursion depth. Messages beyond it
+// are omitted. See transforms.OptionMaxDepth.
+func OptionMaxDepth(v int) Option {
+	return &optionMaxDepth{value: v}
+}
+
+// NewEncoder creates a new Encoder.
+func NewEncoder(options ...Option) Encoder {
+	e := &encoder{int64AsString: true}
+	for _, o := range options {
+		o.Apply(e)
+	}
+	e.walker = transforms.NewWalker(e.walkerOpts...)
+	return e
+}
+
+// Marshal returns the canonical JSON encoding of a message, without a
+// trailing newline.
+func Marshal(m proto.Message, options ...Option) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := NewEncoder(options...).Encode(buf, m); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func (e *encoder) Encode(w io.Writer, m proto.Message) error {
+	if m == nil {
+		return fmt.Errorf("cannot encode nil message")
+	}
+	// a bufio.Writer retains the first error, so writes need not be checked
+	v := &visitor{e: e, w: bufio.NewWriter(w), stack: make([]frame, 0, 8)}
+	e.walker.Walk(m, v)
+	v.w.WriteByte('\n')
+	return v.w.Flush()
+}
+
+type frameKind int
+
+const (
+	messageFrame = frameKind(iota)
+	listFrame
+	mapFrame
+)
+
+type frame struct {
+	kind frameKind
+	// n is the number of values written
+	n   int
+	key string
+}
+
+// A visitor writes the events of a walk as JSON.
+type visitor struct {
+	e     *encoder
+	w     *bufio.Writer
+	stack []frame
+}
+
+// begin writes what precedes a value: a separator and its name or key.
+func (v *visitor) begin(fd protoreflect.FieldDescriptor) {
+	if len(v.stack) == 0 {
+		return
+	}
+	f := &v.stack[len(v.stack)-1]
+	if f.n > 0 {
+		v.w.WriteByte(',')
+	}
+	f.n += 1
+	switch f.kind {
+	case messageFrame:
+		if v.e.jsonNames {
+			writeString(v.w, fd.JSONName())
+		} else {
+			writeString(v.w, string(fd.Name()))
+		}
+		v.w.WriteByte(':')
+	case mapFrame:
+		writeString(v.w, f.key)
+		v.w.WriteByte(':')
+	}
+}
+
+func (v *visitor) push(k frameKind) {
+	v.stack = append(v.stack, frame{kind: k})
+}
+
+func (v *visitor) pop() {
+	v.stack = v.stack[:len(v.stack)-1]
+}
+
+func (v *visitor) EnterMessage(fd protoreflect.FieldDescriptor, _ protoreflect.MessageDescriptor) {
+	v.begin(fd)
+	v.w.WriteByte('{')
+	v.push(messageFrame)
+}
+
+func (v *visitor) ExitMessage(protoreflect.FieldDescriptor, protoreflect.MessageDescriptor) {
+	v.pop()
+	v.w.WriteByte('}')
+}
+
+func (v *visitor) Field(fd protoreflect.FieldDescriptor, x *protoreflect.Value) {
+	v.begin(fd)
+	v.scalar(fd, x)
+}
+
+func (v *visitor) EnterList(fd protoreflect.FieldDescriptor, _ int) {
+	v.begin(fd)
+	v.w.WriteByte('[')
+	v.push(listFrame)
+}
+
+func (v *visitor) ListItem(protoreflect.FieldDescriptor, int) {
+}
+
+func (v *visitor) ExitList(protoreflect.FieldDescriptor) {
+	v.pop()
+	v.w.WriteByte(']')
+}
+
+func (v *visitor) EnterMap(fd protoreflect.FieldDescriptor, _ int) {
+	v.begin(fd)
+	v.w.WriteByte('{')
+	v.push(mapFrame)
+}
+
+func (v *visitor) MapEntry(_ protoreflect.FieldDescriptor, k protoreflect.MapKey) {
+	v.stack[len(v.stack)-1].key = transforms.FormatMapKey(k.Interface())
+}
+
+func (v *visitor) ExitMap(protoreflect.FieldDescriptor) {
+	v.pop()
+	v.w.WriteByte('}')
+}
+
+func (v *visitor) scalar(fd protoreflect.FieldDescriptor, x *protoreflect.Value) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		v.w.WriteString(strconv.FormatBool(x.Bool()))
+	case protoreflect.EnumKind:
+		v.enum(fd, x.Enum())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v.w.WriteString(strconv.FormatInt(x.Int(), 10))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v.w.WriteString(strconv.FormatUint(x.Uint(), 10))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v.int64(strconv.FormatInt(x.Int(), 10))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v.int64(strconv.FormatUint(x.Uint(), 10))
+	case protoreflect.FloatKind:
+		writeFloat(v.w, x.Float(), 32)
+	case protoreflect.DoubleKind:
+		writeFloat(v.w, x.Float(), 64)
+	case protoreflect.StringKind:
+		writeString(v.w, x.String())
+	case protoreflect.BytesKind:
+		writeString(v.w, base64.StdEncoding.EncodeToString(x.Bytes()))
+	default:
+		panic(fmt.Sprintf("unsupported type %v", fd.Kind()))
+	}
+}
+
+func (v *visitor) int64(s string) {
+	if v.e.int64AsString {
+		writeString(v.w, s)
+	} else {
+		v.w.WriteString(s)
+	}
+}
+
+func (v *visitor) enum(fd protoreflect.FieldDescriptor, n protoreflect.EnumNumber) {
+	if v.e.enumMode == EnumAsName {
+		if fd.Enum().FullName() == "google.protobuf.NullValue" {
+			v.w.WriteString("null")
+			return
+		}
+		if ev := fd.Enum().Values().ByNumber(n); ev != nil {
+			writeString(v.w, string(ev.Name()))
+			return
+		}
+	}
+	v.w.WriteString(strconv.FormatInt(int64(n), 10))
+}
+
+// writeFloat writes a float like encoding/json does, which is the shortest
+// representation that round-trips, using exponents only for very small or
+// large numbers.
+func writeFloat(w *bufio.Writer, f float64, bits int) {
+	switch {
+	case math.IsNaN(f):
+		w.WriteString(`"NaN"`)
+		return
+	case math.IsInf(f, 1):
+		w.WriteString(`"Infinity"`)
+		return
+	case math.IsInf(f, -1):
+		w.WriteString(`"-Infinity"`)
+		return
+	}
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	b := strconv.AppendFloat(nil, f, format, -1, bits)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	w.Write(b)
+}
+
+const hex = "0123456789abcdef"
+
+// writeString writes a quoted string. Only quotes, backslashes and control
+// characters are escaped; invalid UTF-8 is replaced by U+FFFD.
+func writeString(w *bufio.Writer, s string) {
+	w.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			w.WriteString(`\"`)
+		case r == '\\':
+			w.WriteString(`\\`)
+		case r == '\n':
+			w.WriteString(`\n`)
+		case r == '\r':
+			w.WriteString(`\r`)
+		case r == '\t':
+			w.WriteString(`\t`)
+		case r < 0x20:
+			w.WriteString(`\u00`)
+			w.WriteByte(hex[r>>4])
+			w.WriteByte(hex[r&0xf])
+		default:
+			w.WriteRune(r)
+		}
+	}
+	w.WriteByte('"')
+}
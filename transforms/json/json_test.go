@@ -0,0 +1,122 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/apipb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/typepb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func createStruct() *structpb.Struct {
+	s, err := structpb.NewStruct(map[string]interface{}{
+		"zulu":    "last",
+		"alpha":   1.5,
+		"mike":    []interface{}{0.0, "", false, nil, map[string]interface{}{}},
+		"quote\"": "line\nbreak\ttab\u0001 ünïcödé",
+		"nested":  map[string]interface{}{"b": 1e21, "a": 1e-7},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func TestEncoder_Golden(t *testing.T) {
+	api := &apipb.Api{
+		Name: "foo",
+		Methods: []*apipb.Method{
+			{Name: "foo_method", RequestTypeUrl: "Foo", ResponseStreaming: true},
+			{Name: "bar_method", Options: []*typepb.Option{{Name: "bar_opt"}}},
+		},
+		Version: "v1",
+		Syntax:  typepb.Syntax_SYNTAX_PROTO3,
+	}
+	field := &typepb.Field{
+		Kind:        typepb.Field_TYPE_INT64,
+		Cardinality: typepb.Field_Cardinality(42),
+		Number:      3,
+		Name:        "foo",
+		Packed:      true,
+	}
+
+	cases := []struct {
+		encoder Encoder
+		input   proto.Message
+		name    string
+	}{
+		{NewEncoder(), api, "api"},
+		{NewEncoder(OptionJSONNames(true)), api, "api_json_names"},
+		{NewEncoder(), createStruct(), "struct"},
+		{NewEncoder(), field, "enum_name"},
+		{NewEncoder(OptionEnumMode(EnumAsNumber)), field, "enum_number"},
+		{NewEncoder(), &durationpb.Duration{Seconds: -9007199254740993, Nanos: -1}, "int64_string"},
+		{NewEncoder(OptionInt64AsString(false)), &durationpb.Duration{Seconds: -9007199254740993, Nanos: -1}, "int64_number"},
+		{NewEncoder(), wrapperspb.UInt64(math.MaxUint64), "uint64"},
+		{NewEncoder(), wrapperspb.Float(0.1), "float"},
+		{NewEncoder(), wrapperspb.Bytes([]byte{0, 1, 254, 255}), "bytes"},
+		{NewEncoder(), &structpb.ListValue{Values: []*structpb.Value{structpb.NewNumberValue(math.Inf(-1)), structpb.NewNumberValue(math.NaN())}}, "special_floats"},
+		{NewEncoder(), &apipb.Api{}, "empty"},
+		{NewEncoder(OptionMaxDepth(1)), createStruct(), "max_depth"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			golden := filepath.Join("testdata", c.name+".golden")
+			buf := &bytes.Buffer{}
+			// output must be stable across runs
+			for i := 0; i < 10; i += 1 {
+				if err := c.encoder.Encode(buf, c.input); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			lines := bytes.SplitAfter(buf.Bytes(), []byte("\n"))
+			for _, l := range lines[1 : len(lines)-1] {
+				if !bytes.Equal(l, lines[0]) {
+					t.Fatalf("%s: unstable output: \nexpected %s, \ngot      %s", c.name, lines[0], l)
+				}
+			}
+			actual := lines[0]
+			if !json.Valid(actual) {
+				t.Errorf("%s: invalid JSON: %s", c.name, actual)
+			}
+			if *update {
+				if err := os.WriteFile(golden, actual, 0644); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(actual, expected) {
+				t.Errorf("%s: \nexpected %s, \ngot      %s", c.name, expected, actual)
+			}
+		})
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	actual, err := Marshal(&durationpb.Duration{Seconds: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := `{"seconds":"1"}`; string(actual) != expected {
+		t.Errorf("expected %s, \ngot      %s", expected, actual)
+	}
+	if _, err := Marshal(nil); err == nil {
+		t.Errorf("expected error")
+	}
+}
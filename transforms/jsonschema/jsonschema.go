@@ -0,0 +1,370 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package jsonschema converts message descriptors into JSON Schemas (draft
+// 2020-12) that validate the protojson representation of their messages.
+//
+// Message and enum types are defined once under '$defs', keyed by their full
+// names, and referenced from there; recursive types are therefore described
+// completely. References to the root message point to the document root.
+//
+// Enum values are expected by name or by number, as protojson accepts both.
+package jsonschema
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+)
+
+const (
+	Draft = "https://json-schema.org/draft/2020-12/schema"
+
+	defsPrefix = "#/$defs/"
+)
+
+// A Schema is a JSON Schema document or subschema. It marshals to JSON via
+// encoding/json.
+type Schema = map[string]interface{}
+
+// A SchemaConverter converts message descriptors into JSON Schemas. It is safe
+// for concurrent use by multiple goroutines.
+type SchemaConverter interface {
+	// Apply returns a schema document for a message.
+	Apply(md protoreflect.MessageDescriptor) Schema
+
+	// Defs returns the definitions of the given messages and the types they
+	// refer to, keyed by their full names. References between them are of the
+	// form '#/$defs/<full name>'.
+	Defs(mds ...protoreflect.MessageDescriptor) Schema
+}
+
+type schemaConverter struct {
+	int64AsString bool
+	protoNames    bool
+}
+
+type Option interface {
+	// Apply applies the Option to the SchemaConverter.
+	Apply(sc *schemaConverter)
+}
+
+type optionInt64AsString struct {
+	value bool
+}
+
+func (o *optionInt64AsString) Apply(sc *schemaConverter) {
+	sc.int64AsString = o.value
+}
+
+// OptionInt64AsString sets whether 64-bit integers are expected as strings, as
+// protojson writes them. Otherwise, they are expected as integers. Defaults to
+// true.
+func OptionInt64AsString(v bool) Option {
+	return &optionInt64AsString{value: v}
+}
+
+type optionProtoNames struct {
+	value bool
+}
+
+func (o *optionProtoNames) Apply(sc *schemaConverter) {
+	sc.protoNames = o.value
+}
+
+// OptionProtoNames sets whether properties are named by the fields' proto
+// names (i.e. 'request_type_url') rather than their JSON names (i.e.
+// 'requestTypeUrl').
+func OptionProtoNames(v bool) Option {
+	return &optionProtoNames{value: v}
+}
+
+// NewSchemaConverter creates a new SchemaConverter.
+func NewSchemaConverter(options ...Option) SchemaConverter {
+	sc := &schemaConverter{int64AsString: true}
+	for _, o := range options {
+		o.Apply(sc)
+	}
+	return sc
+}
+
+// fieldSchema returns the schema of a field.
+func (sc *schemaConverter) fieldSchema(fd protoreflect.FieldDescriptor) Schema {
+	switch {
+	case fd.IsMap():
+		s := Schema{
+			"type":                 "object",
+			"additionalProperties": sc.valueSchema(fd.MapValue()),
+		}
+		// keys are always strings in JSON
+		if p, ok := keyPatterns[fd.MapKey().Kind()]; ok {
+			s["propertyNames"] = Schema{"pattern": p}
+		}
+		return s
+	case fd.IsList():
+		return Schema{
+			"type":  "array",
+			"items": sc.valueSchema(fd),
+		}
+	}
+	return sc.valueSchema(fd)
+}
+
+var keyPatterns = map[protoreflect.Kind]string{
+	protoreflect.BoolKind:     "^(true|false)$",
+	protoreflect.Int32Kind:    "^-?[0-9]+$",
+	protoreflect.Sint32Kind:   "^-?[0-9]+$",
+	protoreflect.Sfixed32Kind: "^-?[0-9]+$",
+	protoreflect.Int64Kind:    "^-?[0-9]+$",
+	protoreflect.Sint64Kind:   "^-?[0-9]+$",
+	protoreflect.Sfixed64Kind: "^-?[0-9]+$",
+	protoreflect.Uint32Kind:   "^[0-9]+$",
+	protoreflect.Fixed32Kind:  "^[0-9]+$",
+	protoreflect.Uint64Kind:   "^[0-9]+$",
+	protoreflect.Fixed64Kind:  "^[0-9]+$",
+}
+
+// valueSchema returns the schema for a single value of a field, disregarding
+// whether it is repeated.
+func (sc *schemaConverter) valueSchema(fd protoreflect.FieldDescriptor) Schema {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return Schema{"type": "boolean"}
+	case protoreflect.EnumKind:
+		if fd.Enum().FullName() == "google.protobuf.NullValue" {
+			return Schema{"type": "null"}
+		}
+		return Schema{"$ref": defsPrefix + string(fd.Enum().FullName())}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return Schema{"type": "integer", "format": "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return Schema{"type": "integer", "format": "uint32", "minimum": 0}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if sc.int64AsString {
+			return Schema{"type": "string", "format": "int64", "pattern": "^-?[0-9]+$"}
+		}
+		return Schema{"type": "integer", "format": "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if sc.int64AsString {
+			return Schema{"type": "string", "format": "uint64", "pattern": "^[0-9]+$"}
+		}
+		return Schema{"type": "integer", "format": "uint64", "minimum": 0}
+	case protoreflect.FloatKind:
+		return Schema{"type": "number", "format": "float"}
+	case protoreflect.DoubleKind:
+		return Schema{"type": "number", "format": "double"}
+	case protoreflect.StringKind:
+		return Schema{"type": "string"}
+	case protoreflect.BytesKind:
+		return Schema{"type": "string", "contentEncoding": "base64"}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if wkt, ok := wellKnownTypes[string(fd.Message().FullName())]; ok {
+			return wkt(sc)
+		}
+		return Schema{"$ref": defsPrefix + string(fd.Message().FullName())}
+	default:
+		panic("unsupported type " + fd.Kind().String())
+	}
+}
+
+// wellKnownTypes holds the schemas of types with a special protojson
+// representation.
+var wellKnownTypes = map[string]func(sc *schemaConverter) Schema{
+	"google.protobuf.Any": func(*schemaConverter) Schema {
+		return Schema{
+			"type":       "object",
+			"properties": Schema{"@type": Schema{"type": "string"}},
+			"required":   []string{"@type"},
+		}
+	},
+	"google.protobuf.Duration": func(*schemaConverter) Schema {
+		return Schema{"type": "string", "pattern": `^-?[0-9]+(\.[0-9]{1,9})?s$`}
+	},
+	"google.protobuf.FieldMask": func(*schemaConverter) Schema {
+		return Schema{"type": "string"}
+	},
+	"google.protobuf.ListValue": func(*schemaConverter) Schema {
+		return Schema{"type": "array"}
+	},
+	"google.protobuf.Struct": func(*schemaConverter) Schema {
+		return Schema{"type": "object"}
+	},
+	"google.protobuf.Timestamp": func(*schemaConverter) Schema {
+		return Schema{"type": "string", "format": "date-time"}
+	},
+	"google.protobuf.Value": func(*schemaConverter) Schema {
+		return Schema{}
+	},
+	"google.protobuf.BoolValue": func(*schemaConverter) Schema {
+		return Schema{"type": "boolean"}
+	},
+	"google.protobuf.BytesValue": func(*schemaConverter) Schema {
+		return Schema{"type": "string", "contentEncoding": "base64"}
+	},
+	"google.protobuf.DoubleValue": func(*schemaConverter) Schema {
+		return Schema{"type": "number", "format": "double"}
+	},
+	"google.protobuf.FloatValue": func(*schemaConverter) Schema {
+		return Schema{"type": "number", "format": "float"}
+	},
+	"google.protobuf.Int32Value": func(*schemaConverter) Schema {
+		return Schema{"type": "integer", "format": "int32"}
+	},
+	"google.protobuf.Int64Value": func(sc *schemaConverter) Schema {
+		if sc.int64AsString {
+			return Schema{"type": "string", "format": "int64", "pattern": "^-?[0-9]+$"}
+		}
+		return Schema{"type": "integer", "format": "int64"}
+	},
+	"google.protobuf.StringValue": func(*schemaConverter) Schema {
+		return Schema{"type": "string"}
+	},
+	"google.protobuf.UInt32Value": func(*schemaConverter) Schema {
+		return Schema{"type": "integer", "format": "uint32", "minimum": 0}
+	},
+	"google.protobuf.UInt64Value": func(sc *schemaConverter) Schema {
+		if sc.int64AsString {
+			return Schema{"type": "string", "format": "uint64", "pattern": "^[0-9]+$"}
+		}
+		return Schema{"type": "integer", "format": "uint64", "minimum": 0}
+	},
+}
+
+func (sc *schemaConverter) Apply(md protoreflect.MessageDescriptor) Schema {
+	if wkt, ok := wellKnownTypes[string(md.FullName())]; ok {
+		root := wkt(sc)
+		root["$schema"] = Draft
+		return root
+	}
+	defs := Schema{}
+	root := sc.collect(md, defs)
+	delete(defs, string(md.FullName()))
+	// refer to the root message via the document root
+	replaceRef(root, defsPrefix+string(md.FullName()), "#")
+	for _, def := range defs {
+		replaceRef(def.(Schema), defsPrefix+string(md.FullName()), "#")
+	}
+	root["$schema"] = Draft
+	if len(defs) > 0 {
+		root["$defs"] = defs
+	}
+	return root
+}
+
+func (sc *schemaConverter) Defs(mds ...protoreflect.MessageDescriptor) Schema {
+	defs := Schema{}
+	for _, md := range mds {
+		name := string(md.FullName())
+		if wkt, ok := wellKnownTypes[name]; ok {
+			defs[name] = wkt(sc)
+		} else if _, ok := defs[name]; !ok {
+			sc.collect(md, defs)
+		}
+	}
+	return defs
+}
+
+// collect adds the definition of a message type and those of the types it
+// refers to. It returns the message's definition.
+func (sc *schemaConverter) collect(md protoreflect.MessageDescriptor, defs Schema) Schema {
+	s := sc.messageSchema(md)
+	defs[string(md.FullName())] = s
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i += 1 {
+		fd := fields.Get(i)
+		if fd.IsMap() {
+			fd = fd.MapValue()
+		}
+		switch fd.Kind() {
+		case protoreflect.EnumKind:
+			name := string(fd.Enum().FullName())
+			if _, ok := defs[name]; !ok && name != "google.protobuf.NullValue" {
+				defs[name] = enumSchema(fd.Enum())
+			}
+		case protoreflect.MessageKind, protoreflect.GroupKind:
+			name := string(fd.Message().FullName())
+			if _, ok := wellKnownTypes[name]; ok {
+				continue
+			}
+			if _, ok := defs[name]; !ok {
+				sc.collect(fd.Message(), defs)
+			}
+		}
+	}
+	return s
+}
+
+func (sc *schemaConverter) messageSchema(md protoreflect.MessageDescriptor) Schema {
+	props := Schema{}
+	var required []string
+	for _, fd := range transforms.DescriptorFields(md) {
+		name := fd.JSONName()
+		if sc.protoNames {
+			name = string(fd.Name())
+		}
+		prop := sc.fieldSchema(fd)
+		if d := description(fd); d != "" {
+			prop["description"] = d
+		}
+		if transforms.HasFieldBehavior(fd, transforms.FieldBehaviorOutputOnly) {
+			prop["readOnly"] = true
+		}
+		if transforms.HasFieldBehavior(fd, transforms.FieldBehaviorInputOnly) {
+			prop["writeOnly"] = true
+		}
+		props[name] = prop
+		if transforms.IsRequired(fd) {
+			required = append(required, name)
+		}
+	}
+	s := Schema{"type": "object", "properties": props}
+	if d := description(md); d != "" {
+		s["description"] = d
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func enumSchema(ed protoreflect.EnumDescriptor) Schema {
+	var names []string
+	for i := 0; i < ed.Values().Len(); i += 1 {
+		names = append(names, string(ed.Values().Get(i).Name()))
+	}
+	s := Schema{"anyOf": []Schema{
+		{"type": "string", "enum": names},
+		// protojson also accepts numbers, including unknown ones
+		{"type": "integer", "format": "int32"},
+	}}
+	if d := description(ed); d != "" {
+		s["description"] = d
+	}
+	return s
+}
+
+// description returns the leading comments of a descriptor, if its file
+// holds source information. Leading spaces are removed from each line.
+func description(d protoreflect.Descriptor) string {
+	loc := d.ParentFile().SourceLocations().ByDescriptor(d)
+	lines := strings.Split(strings.TrimSpace(loc.LeadingComments), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimPrefix(l, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// replaceRef replaces a reference throughout a schema.
+func replaceRef(s Schema, from, to string) {
+	for k, v := range s {
+		switch x := v.(type) {
+		case string:
+			if k == "$ref" && x == from {
+				s[k] = to
+			}
+		case Schema:
+			replaceRef(x, from, to)
+		}
+	}
+}
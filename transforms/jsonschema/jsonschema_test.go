@@ -0,0 +1,207 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package jsonschema
+
+import (
+	"encoding/json"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"reflect"
+	"testing"
+)
+
+func requiredBehavior() *descriptorpb.FieldOptions {
+	// google.api.field_behavior = REQUIRED
+	b := protowire.AppendTag(nil, 1052, protowire.VarintType)
+	b = protowire.AppendVarint(b, 2)
+	opts := &descriptorpb.FieldOptions{}
+	opts.ProtoReflect().SetUnknown(b)
+	return opts
+}
+
+func field(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, type_ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+	f := &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Label:  label.Enum(),
+		Type:   type_.Enum(),
+	}
+	if typeName != "" {
+		f.TypeName = proto.String(typeName)
+	}
+	return f
+}
+
+// createNodeDescriptor creates a recursive message type, with maps, enums,
+// required fields and a well-known type.
+func createNodeDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	const (
+		optional = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		required = descriptorpb.FieldDescriptorProto_LABEL_REQUIRED
+		repeated = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	)
+	name := field("display_name", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	name.Options = requiredBehavior()
+	entry := func(name string, key descriptorpb.FieldDescriptorProto_Type, value descriptorpb.FieldDescriptorProto_Type, valueType string) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{
+			Name: proto.String(name),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("key", 1, optional, key, ""),
+				field("value", 2, optional, value, valueType),
+			},
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+		}
+	}
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("node.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto2"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Node"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, required, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+					name,
+					field("children", 3, repeated, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Node"),
+					field("leaves", 4, repeated, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Node.LeavesEntry"),
+					field("labels", 5, repeated, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Node.LabelsEntry"),
+					field("status", 6, optional, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".test.Status"),
+					field("created", 7, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{
+					entry("LeavesEntry", descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Leaf"),
+					entry("LabelsEntry", descriptorpb.FieldDescriptorProto_TYPE_UINT32, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				},
+			},
+			{
+				Name: proto.String("Leaf"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("parent", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Node"),
+					field("weight", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+				},
+			},
+		},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("ACTIVE"), Number: proto.Int32(1)},
+			},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return fd.Messages().ByName("Node")
+}
+
+func TestSchemaConverter(t *testing.T) {
+	node := createNodeDescriptor(t)
+	defs := Schema{
+		"test.Leaf": Schema{
+			"type": "object",
+			"properties": Schema{
+				"parent": Schema{"$ref": "#"},
+				"weight": Schema{"type": "number", "format": "double"},
+			},
+		},
+		"test.Status": Schema{"anyOf": []Schema{
+			{"type": "string", "enum": []string{"UNKNOWN", "ACTIVE"}},
+			{"type": "integer", "format": "int32"},
+		}},
+	}
+
+	cases := []struct {
+		converter SchemaConverter
+		input     protoreflect.MessageDescriptor
+		expected  Schema
+		name      string
+	}{
+		{
+			NewSchemaConverter(),
+			node,
+			Schema{
+				"$schema": Draft,
+				"type":    "object",
+				"properties": Schema{
+					"id":          Schema{"type": "string", "format": "int64", "pattern": "^-?[0-9]+$"},
+					"displayName": Schema{"type": "string"},
+					"children":    Schema{"type": "array", "items": Schema{"$ref": "#"}},
+					"leaves": Schema{
+						"type":                 "object",
+						"additionalProperties": Schema{"$ref": "#/$defs/test.Leaf"},
+					},
+					"labels": Schema{
+						"type":                 "object",
+						"additionalProperties": Schema{"type": "string"},
+						"propertyNames":        Schema{"pattern": "^[0-9]+$"},
+					},
+					"status":  Schema{"$ref": "#/$defs/test.Status"},
+					"created": Schema{"type": "string", "format": "date-time"},
+				},
+				"required": []string{"id", "displayName"},
+				"$defs":    defs,
+			},
+			"recursive message",
+		},
+		{
+			NewSchemaConverter(OptionInt64AsString(false), OptionProtoNames(true)),
+			node.Fields().ByName("leaves").MapValue().Message(),
+			Schema{
+				"$schema": Draft,
+				"type":    "object",
+				"properties": Schema{
+					"parent": Schema{"$ref": "#/$defs/test.Node"},
+					"weight": Schema{"type": "number", "format": "double"},
+				},
+				"$defs": Schema{
+					"test.Node": Schema{
+						"type": "object",
+						"properties": Schema{
+							"id":           Schema{"type": "integer", "format": "int64"},
+							"display_name": Schema{"type": "string"},
+							"children":     Schema{"type": "array", "items": Schema{"$ref": "#/$defs/test.Node"}},
+							"leaves": Schema{
+								"type":                 "object",
+								"additionalProperties": Schema{"$ref": "#"},
+							},
+							"labels": Schema{
+								"type":                 "object",
+								"additionalProperties": Schema{"type": "string"},
+								"propertyNames":        Schema{"pattern": "^[0-9]+$"},
+							},
+							"status":  Schema{"$ref": "#/$defs/test.Status"},
+							"created": Schema{"type": "string", "format": "date-time"},
+						},
+						"required": []string{"id", "display_name"},
+					},
+					"test.Status": defs["test.Status"],
+				},
+			},
+			"options",
+		},
+		{
+			NewSchemaConverter(),
+			(&timestamppb.Timestamp{}).ProtoReflect().Descriptor(),
+			Schema{"$schema": Draft, "type": "string", "format": "date-time"},
+			"well-known type",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := c.converter.Apply(c.input)
+			if !reflect.DeepEqual(actual, c.expected) {
+				a, _ := json.MarshalIndent(actual, "", "  ")
+				e, _ := json.MarshalIndent(c.expected, "", "  ")
+				t.Errorf("%s: \nexpected %s, \ngot      %s", c.name, e, a)
+			}
+		})
+	}
+}
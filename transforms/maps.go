@@ -0,0 +1,299 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package transforms
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// A MapStrategy determines how the Walker renders map fields.
+type MapStrategy int
+
+const (
+	// MapNative renders a map as a map[interface{}]interface{}. This is the
+	// default.
+	MapNative = MapStrategy(iota)
+	// MapStringKeys renders a map as a map[string]interface{}. Keys are
+	// formatted as in the JSON mapping of Protocol Buffers.
+	MapStringKeys
+	// MapSortedKeyValues renders a map as a list of KeyValue structs, sorted by
+	// key. Keys are formatted as with MapStringKeys.
+	MapSortedKeyValues
+	// MapEntries renders a map as a list of records with a "key" and a "value"
+	// field, sorted by key. This mirrors the wire format of maps.
+	MapEntries
+	// MapJSONObject renders a map as a json.RawMessage, holding a JSON object
+	// with sorted keys. Values must be marshallable by encoding/json, except
+	// for NaN and infinite floats, which are written as in the JSON mapping of
+	// Protocol Buffers: "NaN", "Infinity" and "-Infinity".
+	MapJSONObject
+)
+
+// MapFunc returns the map conversion function for the strategy.
+func (s MapStrategy) MapFunc() MapFunc {
+	switch s {
+	case MapNative:
+		return mapNative
+	case MapStringKeys:
+		return mapStringKeys
+	case MapSortedKeyValues:
+		return mapSortedKeyValues
+	case MapEntries:
+		return mapEntries
+	case MapJSONObject:
+		return mapJSONObject
+	}
+	panic(fmt.Sprintf("unknown map strategy %d", s))
+}
+
+type optionMapStrategy struct {
+	value MapStrategy
+}
+
+func (o *optionMapStrategy) Type() OptionType {
+	return OptionTypeMapStrategy
+}
+
+func (o *optionMapStrategy) Apply(w *walker) {
+	w.mapFn = o.value.MapFunc()
+}
+
+// OptionMapStrategy sets the map type conversion function to that of one of
+// the predefined strategies. It replaces any function set via OptionMapFunc
+// and vice versa; the last option wins.
+func OptionMapStrategy(s MapStrategy) Option {
+	// fail early on unknown strategies
+	_ = s.MapFunc()
+	return &optionMapStrategy{value: s}
+}
+
+func mapNative(_ protoreflect.FieldDescriptor, m map[interface{}]interface{}) interface{} {
+	return m
+}
+
+func mapStringKeys(_ protoreflect.FieldDescriptor, m map[interface{}]interface{}) interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[FormatMapKey(k)] = v
+	}
+	return out
+}
+
+func mapSortedKeyValues(fd protoreflect.FieldDescriptor, m map[interface{}]interface{}) interface{} {
+	keys := SortedMapKeys(fd, m)
+	kvs := make([]KeyValue, len(keys))
+	for i, k := range keys {
+		kvs[i] = KeyValue{Key: FormatMapKey(k), Value: m[k]}
+	}
+	return kvs
+}
+
+func mapEntries(fd protoreflect.FieldDescriptor, m map[interface{}]interface{}) interface{} {
+	keys := SortedMapKeys(fd, m)
+	entries := make([]map[string]interface{}, len(keys))
+	for i, k := range keys {
+		entries[i] = map[string]interface{}{
+			"key":   k,
+			"value": m[k],
+		}
+	}
+	return entries
+}
+
+func mapJSONObject(_ protoreflect.FieldDescriptor, m map[interface{}]interface{}) interface{} {
+	// encoding/json sorts the keys of string-keyed maps
+	bs, err := json.Marshal(jsonSafe(mapStringKeys(nil, m)))
+	if err != nil {
+		panic(fmt.Sprintf("cannot marshal map: %v", err))
+	}
+	return json.RawMessage(bs)
+}
+
+// jsonSafe replaces the floating point values that encoding/json rejects by
+// their strings in the JSON mapping of Protocol Buffers.
+func jsonSafe(v interface{}) interface{} {
+	switch x := v.(type) {
+	case float32:
+		return jsonSafeFloat(float64(x), v)
+	case float64:
+		return jsonSafeFloat(x, v)
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, y := range x {
+			out[i] = jsonSafe(y)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, y := range x {
+			out[k] = jsonSafe(y)
+		}
+		return out
+	}
+	return v
+}
+
+func jsonSafeFloat(x float64, v interface{}) interface{} {
+	switch {
+	case math.IsNaN(x):
+		return "NaN"
+	case math.IsInf(x, 1):
+		return "Infinity"
+	case math.IsInf(x, -1):
+		return "-Infinity"
+	}
+	return v
+}
+
+// FormatMapKey formats a map key as a string, as in the JSON mapping of
+// Protocol Buffers.
+func FormatMapKey(k interface{}) string {
+	switch x := k.(type) {
+	case string:
+		return x
+	case bool:
+		return strconv.FormatBool(x)
+	case int32:
+		return strconv.FormatInt(int64(x), 10)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case uint32:
+		return strconv.FormatUint(uint64(x), 10)
+	case uint64:
+		return strconv.FormatUint(x, 10)
+	}
+	panic(fmt.Sprintf("unsupported map key type %T", k))
+}
+
+// SortedMapKeys returns the keys of a converted map, sorted by their natural
+// ordering.
+func SortedMapKeys(fd protoreflect.FieldDescriptor, m map[interface{}]interface{}) []interface{} {
+	keys := make([]interface{}, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	SortMapKeys(fd, keys)
+	return keys
+}
+
+// SortMapKeys sorts the keys of a map field by their natural ordering: false
+// before true, numbers ascending and strings by their bytes. Keys that do not
+// match the field's key type, such as the names of the key and value fields
+// that stand in for keys when walking a descriptor, are sorted as strings.
+func SortMapKeys(fd protoreflect.FieldDescriptor, keys []interface{}) {
+	var less func(x, y interface{}) bool
+	switch fd.MapKey().Kind() {
+	case protoreflect.BoolKind:
+		less = func(x, y interface{}) bool {
+			return !x.(bool) && y.(bool)
+		}
+	case protoreflect.Int32Kind, protoreflect.Int64Kind,
+		protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+		protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind:
+		less = func(x, y interface{}) bool {
+			a, _ := toInt64(x)
+			b, _ := toInt64(y)
+			return a < b
+		}
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind,
+		protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		less = func(x, y interface{}) bool {
+			a, _ := toUint64(x)
+			b, _ := toUint64(y)
+			return a < b
+		}
+	case protoreflect.StringKind:
+		less = func(x, y interface{}) bool {
+			a, _ := toString(x)
+			b, _ := toString(y)
+			return a < b
+		}
+	default:
+		panic(fmt.Sprintf("unsupported map key kind %v", fd.MapKey().Kind()))
+	}
+	for _, k := range keys {
+		if !isMapKey(fd.MapKey().Kind(), k) {
+			less = func(x, y interface{}) bool {
+				return fmt.Sprint(x) < fmt.Sprint(y)
+			}
+			break
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return less(keys[i], keys[j])
+	})
+}
+
+// isMapKey reports whether a key is of the given key kind.
+func isMapKey(kind protoreflect.Kind, k interface{}) bool {
+	var err error
+	switch kind {
+	case protoreflect.BoolKind:
+		_, ok := k.(bool)
+		return ok
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind,
+		protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		_, err = toUint64(k)
+	case protoreflect.StringKind:
+		_, err = toString(k)
+	default:
+		_, err = toInt64(k)
+	}
+	return err == nil
+}
+
+// sortedMapKeys returns the keys of a map in their natural ordering.
+func sortedMapKeys(fd protoreflect.FieldDescriptor, m protoreflect.Map) []protoreflect.MapKey {
+	xs := make([]interface{}, 0, m.Len())
+	m.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+		xs = append(xs, k.Interface())
+		return true
+	})
+	SortMapKeys(fd, xs)
+	keys := make([]protoreflect.MapKey, len(xs))
+	for i, x := range xs {
+		keys[i] = protoreflect.ValueOf(x).MapKey()
+	}
+	return keys
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), nil
+	case int32:
+		return int64(x), nil
+	case int64:
+		return x, nil
+	}
+	return 0, fmt.Errorf("not an int: %T", v)
+}
+
+func toUint64(v interface{}) (uint64, error) {
+	switch x := v.(type) {
+	case uint:
+		return uint64(x), nil
+	case uint32:
+		return uint64(x), nil
+	case uint64:
+		return x, nil
+	}
+	return 0, fmt.Errorf("not a uint: %T", v)
+}
+
+func toString(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case []byte:
+		return string(x), nil
+	}
+	return "", fmt.Errorf("not a string: %T", v)
+}
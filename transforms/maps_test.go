@@ -0,0 +1,219 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package transforms
+
+import (
+	"encoding/json"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// createMapsDescriptor creates a message descriptor with a map field per key
+// type.
+func createMapsDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	keyTypes := []struct {
+		name  string
+		type_ descriptorpb.FieldDescriptorProto_Type
+	}{
+		{"bools", descriptorpb.FieldDescriptorProto_TYPE_BOOL},
+		{"ints", descriptorpb.FieldDescriptorProto_TYPE_SINT32},
+		{"uints", descriptorpb.FieldDescriptorProto_TYPE_UINT64},
+		{"strings", descriptorpb.FieldDescriptorProto_TYPE_STRING},
+	}
+	msg := &descriptorpb.DescriptorProto{Name: proto.String("Maps")}
+	for i, kt := range keyTypes {
+		entry := strings.ToUpper(kt.name[:1]) + kt.name[1:] + "Entry"
+		msg.NestedType = append(msg.NestedType, &descriptorpb.DescriptorProto{
+			Name: proto.String(entry),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:   proto.String("key"),
+					Number: proto.Int32(1),
+					Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:   kt.type_.Enum(),
+				},
+				{
+					Name:   proto.String("value"),
+					Number: proto.Int32(2),
+					Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				},
+			},
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+		})
+		msg.Field = append(msg.Field, &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(kt.name),
+			Number:   proto.Int32(int32(i) + 1),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+			TypeName: proto.String(".test.Maps." + entry),
+		})
+	}
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("maps.proto"),
+		Package:     proto.String("test"),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{msg},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return fd.Messages().Get(0)
+}
+
+func TestSortMapKeys(t *testing.T) {
+	md := createMapsDescriptor(t)
+
+	cases := []struct {
+		field    string
+		input    []interface{}
+		expected []interface{}
+	}{
+		{"bools", []interface{}{true, false}, []interface{}{false, true}},
+		{"bools", []interface{}{false, true}, []interface{}{false, true}},
+		{"ints", []interface{}{int32(3), int32(-1), int32(2)}, []interface{}{int32(-1), int32(2), int32(3)}},
+		{"uints", []interface{}{uint64(18446744073709551615), uint64(0), uint64(7)}, []interface{}{uint64(0), uint64(7), uint64(18446744073709551615)}},
+		{"strings", []interface{}{"b", "B", "a"}, []interface{}{"B", "a", "b"}},
+	}
+	for _, c := range cases {
+		t.Run(c.field, func(t *testing.T) {
+			actual := append([]interface{}{}, c.input...)
+			SortMapKeys(md.Fields().ByName(protoreflect.Name(c.field)), actual)
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.field, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestOptionMapStrategy(t *testing.T) {
+	md := createMapsDescriptor(t)
+	input := dynamicpb.NewMessage(md)
+	ints := input.Mutable(md.Fields().ByName("ints")).Map()
+	for _, k := range []int32{3, -1, 2} {
+		ints.Set(protoreflect.ValueOfInt32(k).MapKey(), protoreflect.ValueOfString(string(rune('a'+k+1))))
+	}
+
+	cases := []struct {
+		strategy MapStrategy
+		expected interface{}
+		name     string
+	}{
+		{
+			MapNative,
+			map[interface{}]interface{}{int32(3): "e", int32(-1): "a", int32(2): "d"},
+			"native",
+		},
+		{
+			MapStringKeys,
+			map[string]interface{}{"3": "e", "-1": "a", "2": "d"},
+			"string keys",
+		},
+		{
+			MapSortedKeyValues,
+			[]KeyValue{{"-1", "a"}, {"2", "d"}, {"3", "e"}},
+			"sorted key values",
+		},
+		{
+			MapEntries,
+			[]map[string]interface{}{
+				{"key": int32(-1), "value": "a"},
+				{"key": int32(2), "value": "d"},
+				{"key": int32(3), "value": "e"},
+			},
+			"entries",
+		},
+		{
+			MapJSONObject,
+			json.RawMessage(`{"-1":"a","2":"d","3":"e"}`),
+			"json object",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			walker := NewWalker(OptionMapStrategy(c.strategy))
+			expected := map[string]interface{}{"ints": c.expected}
+			if actual := walker.Apply(input); !reflect.DeepEqual(actual, expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, expected, actual)
+			}
+		})
+	}
+}
+
+func TestWalker_Walk_MapOrder(t *testing.T) {
+	md := createMapsDescriptor(t)
+	input := dynamicpb.NewMessage(md)
+	uints := input.Mutable(md.Fields().ByName("uints")).Map()
+	for _, k := range []uint64{9, 1, 18446744073709551615, 4} {
+		uints.Set(protoreflect.ValueOfUint64(k).MapKey(), protoreflect.ValueOfString("x"))
+	}
+
+	var actual []string
+	walker := NewWalker(OptionAddNameOverride(
+		"uints.value",
+		func(c *WalkContext, _ *protoreflect.Value) interface{} {
+			actual = append(actual, c.String())
+			return nil
+		},
+	))
+	walker.Apply(input)
+	expected := []string{"uints[1]", "uints[4]", "uints[9]", "uints[18446744073709551615]"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, \ngot      %v", expected, actual)
+	}
+}
+
+func TestOptionMapStrategy_ApplyDesc(t *testing.T) {
+	md := createMapsDescriptor(t)
+
+	cases := []struct {
+		strategy MapStrategy
+		expected interface{}
+		name     string
+	}{
+		{
+			MapSortedKeyValues,
+			[]KeyValue{{"key", nil}, {"value", nil}},
+			"sorted key values",
+		},
+		{
+			MapEntries,
+			[]map[string]interface{}{
+				{"key": "key", "value": nil},
+				{"key": "value", "value": nil},
+			},
+			"entries",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := NewWalker(OptionMapStrategy(c.strategy)).ApplyDesc(md).(map[string]interface{})
+			for _, field := range []string{"bools", "ints", "uints", "strings"} {
+				if !reflect.DeepEqual(actual[field], c.expected) {
+					t.Errorf("%s: %s: \nexpected %v, \ngot      %v", c.name, field, c.expected, actual[field])
+				}
+			}
+		})
+	}
+}
+
+func TestMapJSONObject_SpecialFloats(t *testing.T) {
+	m := map[interface{}]interface{}{
+		"a": math.NaN(),
+		"b": math.Inf(1),
+		"c": float32(math.Inf(-1)),
+		"d": map[string]interface{}{"x": []interface{}{math.NaN(), 1.5}},
+	}
+	expected := json.RawMessage(`{"a":"NaN","b":"Infinity","c":"-Infinity","d":{"x":["NaN",1.5]}}`)
+	if actual := mapJSONObject(nil, m); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
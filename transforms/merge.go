@@ -0,0 +1,323 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package transforms
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"math"
+)
+
+// A Merger applies patches to messages, following the update semantics of
+// AIP-134. It is safe for concurrent use by multiple goroutines.
+//
+// Mask paths are path patterns (see PathPattern) without wildcards or list
+// indices; a map key may end a path to update a single map value, i.e.
+// 'labels["env"]'. The mask '*' replaces the message as a whole. An empty or
+// nil mask selects the fields that are populated in the patch.
+//
+// A selected field is replaced by its value in the patch. If it is unset in
+// the patch, it is cleared. Repeated fields and maps are replaced as a whole,
+// unless they match OptionMergeRepeated. The output of package diff can be
+// replayed with diff.FieldMask.
+type Merger interface {
+	// Apply updates base with the fields of patch that are selected by the
+	// mask. Both messages must be of the same type. The mask is validated as
+	// a whole before base is updated, so that base is left untouched on error.
+	// Messages of distinct descriptors for the same type, such as a generated
+	// message and a dynamic message of a separately loaded file, are rejected.
+	Apply(base, patch proto.Message, mask *fieldmaskpb.FieldMask) error
+}
+
+type mergeConfig struct {
+	mergeRepeated []*PathPattern
+}
+
+type MergeOption interface {
+	// Apply applies the MergeOption to the Merger.
+	Apply(c *mergeConfig)
+}
+
+type optionMergeRepeated struct {
+	value *PathPattern
+}
+
+func (o *optionMergeRepeated) Apply(c *mergeConfig) {
+	c.mergeRepeated = append(c.mergeRepeated, o.value)
+}
+
+// OptionMergeRepeated merges the repeated fields and maps whose dotted names
+// match a pattern, instead of replacing them: list items of the patch are
+// appended and map values of the patch are set. Use '**' to merge all.
+func OptionMergeRepeated(pattern string) MergeOption {
+	return &optionMergeRepeated{value: MustParsePathPattern(pattern)}
+}
+
+type merger struct {
+	config *mergeConfig
+}
+
+// NewMerger creates a new Merger.
+func NewMerger(options ...MergeOption) Merger {
+	c := &mergeConfig{}
+	for _, o := range options {
+		o.Apply(c)
+	}
+	return &merger{config: c}
+}
+
+// A maskNode holds the selected fields of a message.
+type maskNode struct {
+	// all is set if the field is selected as a whole
+	all bool
+	// keys holds the selected keys of a map field
+	keys []interface{}
+	// children holds the selected fields of a message field
+	children map[protoreflect.Name]*maskNode
+	// names holds the names of the children, in order of appearance
+	names []protoreflect.Name
+}
+
+func (n *maskNode) child(name protoreflect.Name) *maskNode {
+	if n.children == nil {
+		n.children = map[protoreflect.Name]*maskNode{}
+	}
+	c, ok := n.children[name]
+	if !ok {
+		c = &maskNode{}
+		n.children[name] = c
+		n.names = append(n.names, name)
+	}
+	return c
+}
+
+// parseMask parses the paths of a field mask into a tree.
+func parseMask(paths []string) (*maskNode, error) {
+	root := &maskNode{}
+	for _, path := range paths {
+		p, err := ParsePathPattern(path)
+		if err != nil {
+			return nil, err
+		}
+		n := root
+		for i, s := range p.segs {
+			if s.name == wildcard || s.name == doubleWildcard {
+				return nil, fmt.Errorf("invalid mask path %q: wildcards are not supported", path)
+			}
+			n = n.child(protoreflect.Name(s.name))
+			if s.hasIndex {
+				if i < len(p.segs)-1 {
+					return nil, fmt.Errorf("invalid mask path %q: a key must end the path", path)
+				}
+				n.keys = append(n.keys, s.index)
+			} else if i == len(p.segs)-1 {
+				n.all = true
+			}
+		}
+	}
+	return root, nil
+}
+
+func (mg *merger) Apply(base, patch proto.Message, mask *fieldmaskpb.FieldMask) error {
+	b, p := base.ProtoReflect(), patch.ProtoReflect()
+	if b.Descriptor().FullName() != p.Descriptor().FullName() {
+		return fmt.Errorf("cannot merge %s into %s", p.Descriptor().FullName(), b.Descriptor().FullName())
+	}
+	if b.Descriptor() != p.Descriptor() {
+		// fields are looked up by descriptor, which does not work across copies
+		return fmt.Errorf("cannot merge %s into %s: their descriptors are distinct", p.Descriptor().FullName(), b.Descriptor().FullName())
+	}
+	paths := mask.GetPaths()
+	if len(paths) == 1 && paths[0] == wildcard {
+		proto.Reset(base)
+		proto.Merge(base, patch)
+		return nil
+	}
+	var root *maskNode
+	if len(paths) == 0 {
+		root = &maskNode{}
+		p.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			root.child(fd.Name()).all = true
+			return true
+		})
+	} else {
+		var err error
+		if root, err = parseMask(paths); err != nil {
+			return err
+		}
+		// validate all paths first, so that base is left untouched on error
+		if err = checkMask(root, "", b.Descriptor()); err != nil {
+			return err
+		}
+	}
+	mg.message(root, "", b, p)
+	return nil
+}
+
+func dottedName(parent string, name protoreflect.Name) string {
+	if parent == "" {
+		return string(name)
+	}
+	return parent + "." + string(name)
+}
+
+// checkMask validates a mask tree against a message descriptor.
+func checkMask(n *maskNode, parent string, md protoreflect.MessageDescriptor) error {
+	fields := md.Fields()
+	for _, name := range n.names {
+		c := n.children[name]
+		fd := fields.ByName(name)
+		if fd == nil {
+			return fmt.Errorf("unknown field %s in %s", name, md.FullName())
+		}
+		dotted := dottedName(parent, name)
+		if !c.all && len(c.keys) > 0 {
+			if !fd.IsMap() {
+				return fmt.Errorf("%s: keys can only select map values", dotted)
+			}
+			for _, k := range c.keys {
+				if _, err := mapKey(fd.MapKey(), k); err != nil {
+					return fmt.Errorf("%s: %w", dotted, err)
+				}
+			}
+		}
+		if c.all || len(c.children) == 0 {
+			continue
+		}
+		if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+			return fmt.Errorf("%s: only singular message fields have subfields", dotted)
+		}
+		if err := checkMask(c, dotted, fd.Message()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// message merges the fields selected by a validated mask tree.
+func (mg *merger) message(n *maskNode, parent string, b, p protoreflect.Message) {
+	fields := b.Descriptor().Fields()
+	for _, name := range n.names {
+		c := n.children[name]
+		fd := fields.ByName(name)
+		dotted := dottedName(parent, name)
+		switch {
+		case c.all:
+			mg.field(fd, dotted, b, p)
+		case len(c.keys) > 0:
+			mergeKeys(fd, c.keys, b, p)
+		}
+		if c.all || len(c.children) == 0 {
+			continue
+		}
+		if !b.Has(fd) && !p.Has(fd) {
+			continue
+		}
+		mg.message(c, dotted, b.Mutable(fd).Message(), p.Get(fd).Message())
+	}
+}
+
+func (mg *merger) mergeRepeated(name string) bool {
+	for _, pp := range mg.config.mergeRepeated {
+		if pp.MatchName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// field replaces a field with its value in the patch, or merges it if it is a
+// repeated field or map that is to be merged.
+func (mg *merger) field(fd protoreflect.FieldDescriptor, name string, b, p protoreflect.Message) {
+	merge := (fd.IsList() || fd.IsMap()) && mg.mergeRepeated(name)
+	if !merge {
+		b.Clear(fd)
+	}
+	if !p.Has(fd) {
+		return
+	}
+	switch {
+	case fd.IsList():
+		l, pl := b.Mutable(fd).List(), p.Get(fd).List()
+		for i := 0; i < pl.Len(); i += 1 {
+			l.Append(cloneValue(fd, pl.Get(i)))
+		}
+	case fd.IsMap():
+		m := b.Mutable(fd).Map()
+		p.Get(fd).Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			m.Set(k, cloneValue(fd.MapValue(), v))
+			return true
+		})
+	default:
+		b.Set(fd, cloneValue(fd, p.Get(fd)))
+	}
+}
+
+// mergeKeys replaces map values with their values in the patch, or deletes
+// them if they are not in the patch. The keys must have been validated.
+func mergeKeys(fd protoreflect.FieldDescriptor, keys []interface{}, b, p protoreflect.Message) {
+	for _, k := range keys {
+		mk, _ := mapKey(fd.MapKey(), k)
+		pm := p.Get(fd).Map()
+		if !pm.Has(mk) {
+			if b.Has(fd) {
+				b.Mutable(fd).Map().Clear(mk)
+			}
+			continue
+		}
+		b.Mutable(fd).Map().Set(mk, cloneValue(fd.MapValue(), pm.Get(mk)))
+	}
+}
+
+// mapKey converts a parsed key into a map key of the field's type.
+func mapKey(fd protoreflect.FieldDescriptor, k interface{}) (protoreflect.MapKey, error) {
+	invalid := fmt.Errorf("invalid key %v for %s key", k, fd.Kind())
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		if s, ok := k.(string); ok {
+			return protoreflect.ValueOfString(s).MapKey(), nil
+		}
+	case protoreflect.BoolKind:
+		if x, ok := k.(bool); ok {
+			return protoreflect.ValueOfBool(x).MapKey(), nil
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if x, ok := k.(int64); ok && x >= math.MinInt32 && x <= math.MaxInt32 {
+			return protoreflect.ValueOfInt32(int32(x)).MapKey(), nil
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if x, ok := k.(int64); ok {
+			return protoreflect.ValueOfInt64(x).MapKey(), nil
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if x, ok := k.(int64); ok && x >= 0 && x <= math.MaxUint32 {
+			return protoreflect.ValueOfUint32(uint32(x)).MapKey(), nil
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		switch x := k.(type) {
+		case int64:
+			if x >= 0 {
+				return protoreflect.ValueOfUint64(uint64(x)).MapKey(), nil
+			}
+		case uint64:
+			return protoreflect.ValueOfUint64(x).MapKey(), nil
+		}
+	}
+	return protoreflect.MapKey{}, invalid
+}
+
+// cloneValue returns a deep copy of a single value of a field, so that the
+// patch and the merged message do not share memory.
+func cloneValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) protoreflect.Value {
+	switch {
+	case fd.Message() != nil:
+		return protoreflect.ValueOfMessage(proto.Clone(v.Message().Interface()).ProtoReflect())
+	case fd.Kind() == protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes(append([]byte(nil), v.Bytes()...))
+	}
+	return v
+}
@@ -0,0 +1,212 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package transforms
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/apipb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/sourcecontextpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/typepb"
+	"testing"
+)
+
+func TestMerger(t *testing.T) {
+	base := func() *apipb.Api {
+		return &apipb.Api{
+			Name:          "base",
+			Version:       "v1",
+			Methods:       []*apipb.Method{{Name: "get"}},
+			SourceContext: &sourcecontextpb.SourceContext{FileName: "a.proto"},
+			Syntax:        typepb.Syntax_SYNTAX_PROTO3,
+		}
+	}
+	patch := &apipb.Api{
+		Name:    "patch",
+		Methods: []*apipb.Method{{Name: "list"}},
+		Mixins:  []*apipb.Mixin{{Name: "mixin"}},
+	}
+	mask := func(paths ...string) *fieldmaskpb.FieldMask {
+		return &fieldmaskpb.FieldMask{Paths: paths}
+	}
+
+	cases := []struct {
+		options  []MergeOption
+		mask     *fieldmaskpb.FieldMask
+		expected proto.Message
+		name     string
+	}{
+		{
+			nil,
+			nil,
+			&apipb.Api{
+				Name:          "patch",
+				Version:       "v1",
+				Methods:       []*apipb.Method{{Name: "list"}},
+				SourceContext: &sourcecontextpb.SourceContext{FileName: "a.proto"},
+				Mixins:        []*apipb.Mixin{{Name: "mixin"}},
+				Syntax:        typepb.Syntax_SYNTAX_PROTO3,
+			},
+			"populated fields",
+		},
+		{
+			nil,
+			mask("*"),
+			patch,
+			"full replacement",
+		},
+		{
+			nil,
+			mask("name", "version", "source_context"),
+			&apipb.Api{
+				Name:    "patch",
+				Methods: []*apipb.Method{{Name: "get"}},
+				Syntax:  typepb.Syntax_SYNTAX_PROTO3,
+			},
+			"clear unset",
+		},
+		{
+			nil,
+			mask("source_context.file_name"),
+			&apipb.Api{
+				Name:          "base",
+				Version:       "v1",
+				Methods:       []*apipb.Method{{Name: "get"}},
+				SourceContext: &sourcecontextpb.SourceContext{},
+				Syntax:        typepb.Syntax_SYNTAX_PROTO3,
+			},
+			"subfield",
+		},
+		{
+			nil,
+			mask("methods"),
+			&apipb.Api{
+				Name:          "base",
+				Version:       "v1",
+				Methods:       []*apipb.Method{{Name: "list"}},
+				SourceContext: &sourcecontextpb.SourceContext{FileName: "a.proto"},
+				Syntax:        typepb.Syntax_SYNTAX_PROTO3,
+			},
+			"replace repeated",
+		},
+		{
+			[]MergeOption{OptionMergeRepeated("methods")},
+			mask("methods"),
+			&apipb.Api{
+				Name:          "base",
+				Version:       "v1",
+				Methods:       []*apipb.Method{{Name: "get"}, {Name: "list"}},
+				SourceContext: &sourcecontextpb.SourceContext{FileName: "a.proto"},
+				Syntax:        typepb.Syntax_SYNTAX_PROTO3,
+			},
+			"merge repeated",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := base()
+			if err := NewMerger(c.options...).Apply(actual, patch, c.mask); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !proto.Equal(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+
+	actual := base()
+	_ = NewMerger().Apply(actual, patch, mask("methods"))
+	actual.Methods[0].Name = "changed"
+	if patch.Methods[0].Name != "list" {
+		t.Errorf("expected patch to be unchanged, got %v", patch)
+	}
+}
+
+func TestMerger_Maps(t *testing.T) {
+	base := func() *structpb.Struct {
+		return &structpb.Struct{Fields: map[string]*structpb.Value{
+			"a": structpb.NewNumberValue(1),
+			"b": structpb.NewNumberValue(2),
+		}}
+	}
+	patch := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"b": structpb.NewNumberValue(3),
+		"c": structpb.NewNumberValue(4),
+	}}
+
+	cases := []struct {
+		options  []MergeOption
+		paths    []string
+		expected map[string]interface{}
+		name     string
+	}{
+		{nil, []string{"fields"}, map[string]interface{}{"b": 3.0, "c": 4.0}, "replace"},
+		{
+			[]MergeOption{OptionMergeRepeated("**")},
+			[]string{"fields"},
+			map[string]interface{}{"a": 1.0, "b": 3.0, "c": 4.0},
+			"merge",
+		},
+		{nil, []string{`fields["c"]`}, map[string]interface{}{"a": 1.0, "b": 2.0, "c": 4.0}, "key"},
+		{nil, []string{`fields["a"]`, `fields["b"]`}, map[string]interface{}{"b": 3.0}, "key deleted"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := base()
+			if err := NewMerger(c.options...).Apply(actual, patch, &fieldmaskpb.FieldMask{Paths: c.paths}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expected, _ := structpb.NewStruct(c.expected)
+			if !proto.Equal(actual, expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, expected, actual)
+			}
+		})
+	}
+}
+
+func TestMerger_Errors(t *testing.T) {
+	api := &apipb.Api{Name: "patch", Methods: []*apipb.Method{{Name: "list"}}}
+	fields := &structpb.Struct{Fields: map[string]*structpb.Value{"a": structpb.NewNumberValue(1)}}
+	// a copy of the Api descriptor, as when loading its file a second time
+	file, err := protodesc.NewFile(protodesc.ToFileDescriptorProto(apipb.File_google_protobuf_api_proto), protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	otherAPI := dynamicpb.NewMessage(file.Messages().ByName("Api"))
+
+	cases := []struct {
+		base  proto.Message
+		patch proto.Message
+		paths []string
+		name  string
+	}{
+		{&apipb.Api{}, &structpb.Struct{}, nil, "type mismatch"},
+		{&apipb.Api{}, otherAPI, nil, "other descriptor"},
+		{&apipb.Api{}, api, []string{"nope"}, "unknown field"},
+		{&apipb.Api{}, api, []string{"methods.name"}, "repeated subfield"},
+		{&apipb.Api{}, api, []string{"methods[0]"}, "list index"},
+		{&apipb.Api{}, api, []string{"*.name"}, "wildcard"},
+		{&apipb.Api{}, api, []string{"name["}, "invalid path"},
+		{&structpb.Struct{}, fields, []string{`fields["a"].string_value`}, "key before end"},
+		{&structpb.Struct{}, fields, []string{"fields[1]"}, "key type"},
+		{&apipb.Api{Name: "base"}, api, []string{"name", "bogus"}, "valid path before unknown field"},
+		{&apipb.Api{Name: "base"}, api, []string{"name", "methods.name"}, "valid path before repeated subfield"},
+		{&structpb.Struct{}, fields, []string{`fields["a"]`, "fields[1]"}, "valid key before key type"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			before := proto.Clone(c.base)
+			if err := NewMerger().Apply(c.base, c.patch, &fieldmaskpb.FieldMask{Paths: c.paths}); err == nil {
+				t.Errorf("%s: expected error", c.name)
+			}
+			if !proto.Equal(c.base, before) {
+				t.Errorf("%s: expected base to be unchanged, got %v", c.name, c.base)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package openapi converts message descriptors into OpenAPI 3.1 components.
+//
+// OpenAPI 3.1 schemas are JSON Schemas (draft 2020-12), so the schemas are
+// those of package jsonschema, with references pointing to
+// '#/components/schemas/<full name>'. Descriptions are taken from the
+// comments in the descriptors' source information, when available. Fields
+// annotated with google.api.field_behavior are required (REQUIRED), read-only
+// (OUTPUT_ONLY) or write-only (INPUT_ONLY).
+package openapi
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms/jsonschema"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+)
+
+const (
+	Version = "3.1.0"
+
+	schemasPrefix = "#/components/schemas/"
+	defsPrefix    = "#/$defs/"
+)
+
+// A ComponentsConverter converts message descriptors into an OpenAPI
+// components object. It is safe for concurrent use by multiple goroutines.
+type ComponentsConverter interface {
+	// Apply returns a components object holding the schemas of the given
+	// messages and of all types they refer to.
+	Apply(mds ...protoreflect.MessageDescriptor) map[string]interface{}
+}
+
+type componentsConverter struct {
+	sc jsonschema.SchemaConverter
+}
+
+// NewComponentsConverter creates a new ComponentsConverter. The options are
+// those of the underlying jsonschema.SchemaConverter.
+func NewComponentsConverter(options ...jsonschema.Option) ComponentsConverter {
+	return &componentsConverter{sc: jsonschema.NewSchemaConverter(options...)}
+}
+
+func (cc *componentsConverter) Apply(mds ...protoreflect.MessageDescriptor) map[string]interface{} {
+	defs := cc.sc.Defs(mds...)
+	for _, def := range defs {
+		rewriteRefs(def)
+	}
+	return map[string]interface{}{"schemas": defs}
+}
+
+// rewriteRefs points references to definitions to the components' schemas.
+func rewriteRefs(v interface{}) {
+	switch x := v.(type) {
+	case jsonschema.Schema:
+		for k, w := range x {
+			if s, ok := w.(string); ok && k == "$ref" && strings.HasPrefix(s, defsPrefix) {
+				x[k] = schemasPrefix + strings.TrimPrefix(s, defsPrefix)
+			} else {
+				rewriteRefs(w)
+			}
+		}
+	case []interface{}:
+		for _, w := range x {
+			rewriteRefs(w)
+		}
+	}
+}
+
+// NewDocument creates a minimal OpenAPI document holding the given
+// components. Paths can be added to it by hand.
+func NewDocument(title, version string, components map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"openapi":    Version,
+		"info":       map[string]interface{}{"title": title, "version": version},
+		"components": components,
+	}
+}
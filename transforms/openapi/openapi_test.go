@@ -0,0 +1,182 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/HayoVanLoon/go-proto/transforms/jsonschema"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"reflect"
+	"testing"
+)
+
+func withBehavior(fb uint64) *descriptorpb.FieldOptions {
+	// google.api.field_behavior
+	b := protowire.AppendTag(nil, 1052, protowire.VarintType)
+	b = protowire.AppendVarint(b, fb)
+	opts := &descriptorpb.FieldOptions{}
+	opts.ProtoReflect().SetUnknown(b)
+	return opts
+}
+
+func field(name string, number int32, type_ descriptorpb.FieldDescriptorProto_Type, typeName string, opts *descriptorpb.FieldOptions) *descriptorpb.FieldDescriptorProto {
+	f := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:     type_.Enum(),
+		Options:  opts,
+	}
+	if typeName != "" {
+		f.TypeName = proto.String(typeName)
+	}
+	return f
+}
+
+func comment(text string, path ...int32) *descriptorpb.SourceCodeInfo_Location {
+	return &descriptorpb.SourceCodeInfo_Location{
+		Path:            path,
+		Span:            []int32{0, 0, 0},
+		LeadingComments: proto.String(text),
+	}
+}
+
+func createLibraryFile(t *testing.T) protoreflect.FileDescriptor {
+	authors := field("authors", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".library.Author", nil)
+	authors.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("library.proto"),
+		Package: proto.String("library"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Book"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", withBehavior(3)),
+					field("title", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", withBehavior(2)),
+					authors,
+					field("token", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", withBehavior(4)),
+					field("genre", 5, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".library.Genre", nil),
+				},
+			},
+			{
+				Name: proto.String("Author"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", nil),
+					field("favourite", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".library.Book", nil),
+				},
+			},
+		},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Genre"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("GENRE_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("FICTION"), Number: proto.Int32(1)},
+			},
+		}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{
+			Location: []*descriptorpb.SourceCodeInfo_Location{
+				comment(" A book.\n Books have authors.\n", 4, 0),
+				comment(" The resource name.\n", 4, 0, 2, 0),
+				comment(" The favourite book.\n", 4, 1, 2, 1),
+				comment(" A literary genre.\n", 5, 0),
+			},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return fd
+}
+
+func TestComponentsConverter(t *testing.T) {
+	file := createLibraryFile(t)
+	book := file.Messages().ByName("Book")
+	author := file.Messages().ByName("Author")
+
+	cases := []struct {
+		converter ComponentsConverter
+		input     []protoreflect.MessageDescriptor
+		expected  map[string]interface{}
+		name      string
+	}{
+		{
+			NewComponentsConverter(),
+			[]protoreflect.MessageDescriptor{book, author},
+			map[string]interface{}{
+				"schemas": jsonschema.Schema{
+					"library.Book": jsonschema.Schema{
+						"type":        "object",
+						"description": "A book.\nBooks have authors.",
+						"properties": jsonschema.Schema{
+							"name":  jsonschema.Schema{"type": "string", "description": "The resource name.", "readOnly": true},
+							"title": jsonschema.Schema{"type": "string"},
+							"authors": jsonschema.Schema{
+								"type":  "array",
+								"items": jsonschema.Schema{"$ref": "#/components/schemas/library.Author"},
+							},
+							"token": jsonschema.Schema{"type": "string", "writeOnly": true},
+							"genre": jsonschema.Schema{"$ref": "#/components/schemas/library.Genre"},
+						},
+						"required": []string{"title"},
+					},
+					"library.Author": jsonschema.Schema{
+						"type": "object",
+						"properties": jsonschema.Schema{
+							"name": jsonschema.Schema{"type": "string"},
+							"favourite": jsonschema.Schema{
+								"$ref":        "#/components/schemas/library.Book",
+								"description": "The favourite book.",
+							},
+						},
+					},
+					"library.Genre": jsonschema.Schema{
+						"anyOf": []jsonschema.Schema{
+							{"type": "string", "enum": []string{"GENRE_UNSPECIFIED", "FICTION"}},
+							{"type": "integer", "format": "int32"},
+						},
+						"description": "A literary genre.",
+					},
+				},
+			},
+			"library",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := c.converter.Apply(c.input...)
+			if !reflect.DeepEqual(actual, c.expected) {
+				a, _ := json.MarshalIndent(actual, "", "  ")
+				e, _ := json.MarshalIndent(c.expected, "", "  ")
+				t.Errorf("%s: \nexpected %s, \ngot      %s", c.name, e, a)
+			}
+		})
+	}
+}
+
+func TestNewDocument(t *testing.T) {
+	file := createLibraryFile(t)
+	components := NewComponentsConverter().Apply(file.Messages().ByName("Author"))
+	doc := NewDocument("Library", "v1", components)
+	bs, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var actual map[string]interface{}
+	if err := json.Unmarshal(bs, &actual); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual["openapi"] != "3.1.0" {
+		t.Errorf("expected version %s, got %v", Version, actual["openapi"])
+	}
+	schemas := actual["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	if len(schemas) != 3 {
+		t.Errorf("expected 3 schemas, got %v", schemas)
+	}
+}
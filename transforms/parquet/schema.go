@@ -0,0 +1,352 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package parquet converts message descriptors into Parquet schemas and
+// writes messages into Parquet files.
+//
+// Messages map to groups. Repeated fields map to three-level LIST groups and
+// map fields to MAP groups with a repeated key_value group. Fields that track
+// presence (message fields, oneof members and optional fields) are optional;
+// other fields are required, holding their default value when unset. Messages
+// without fields are left out.
+//
+// Integers map to INT32 or INT64, unsigned integers being annotated as such.
+// Strings map to BYTE_ARRAY (STRING) and enums to BYTE_ARRAY (ENUM), holding
+// the value's name, or its number for unknown values.
+// google.protobuf.Timestamp maps to INT64 (TIMESTAMP(MICROS,true)).
+//
+// Parquet schemas cannot be recursive. Message fields beyond the maximum
+// depth (see OptionMaxDepth) are left out.
+//
+// Data pages are written uncompressed or compressed with gzip. Snappy, the
+// default of most Parquet writers, would add a dependency to this module and
+// is not supported.
+package parquet
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"strings"
+)
+
+const timestampName = "google.protobuf.Timestamp"
+
+// A PhysicalType is a Parquet primitive type.
+type PhysicalType int32
+
+const (
+	Boolean           = PhysicalType(0)
+	Int32             = PhysicalType(1)
+	Int64             = PhysicalType(2)
+	Float             = PhysicalType(4)
+	Double            = PhysicalType(5)
+	ByteArray         = PhysicalType(6)
+	FixedLenByteArray = PhysicalType(7)
+)
+
+var physicalNames = map[PhysicalType]string{
+	Boolean:           "boolean",
+	Int32:             "int32",
+	Int64:             "int64",
+	Float:             "float",
+	Double:            "double",
+	ByteArray:         "binary",
+	FixedLenByteArray: "fixed_len_byte_array",
+}
+
+func (t PhysicalType) String() string {
+	return physicalNames[t]
+}
+
+type repetition int32
+
+const (
+	required = repetition(0)
+	optional = repetition(1)
+	repeated = repetition(2)
+)
+
+func (r repetition) String() string {
+	return [...]string{"required", "optional", "repeated"}[r]
+}
+
+// annotation combines a Parquet converted type and its logical type.
+type annotation int
+
+const (
+	noAnnotation = annotation(iota)
+	stringAnnotation
+	enumAnnotation
+	listAnnotation
+	mapAnnotation
+	uint32Annotation
+	uint64Annotation
+	timestampAnnotation
+)
+
+func (a annotation) String() string {
+	return [...]string{"", "STRING", "ENUM", "LIST", "MAP", "INTEGER(32,false)", "INTEGER(64,false)", "TIMESTAMP(MICROS,true)"}[a]
+}
+
+// convertedType returns the legacy converted type of an annotation.
+func (a annotation) convertedType() int32 {
+	return [...]int32{-1, 0, 4, 3, 1, 13, 14, 10}[a]
+}
+
+type nodeKind int
+
+const (
+	leafNode = nodeKind(iota)
+	groupNode
+	listNode
+	mapNode
+	// repeatedNode is the repeated group inside of a list or map
+	repeatedNode
+)
+
+// A node is a field in a Parquet schema.
+type node struct {
+	name       string
+	kind       nodeKind
+	repetition repetition
+	physical   PhysicalType
+	annotation annotation
+	children   []*node
+	// maxDef and maxRep are the maximum definition and repetition levels
+	maxDef int
+	maxRep int
+	// column is the index of a leaf's column
+	column int
+	// zero is the value of a required leaf when its field is unset
+	zero interface{}
+}
+
+// leaves appends the leaves of the node, in schema order.
+func (n *node) leaves(out []*node) []*node {
+	if n.kind == leafNode {
+		return append(out, n)
+	}
+	for _, c := range n.children {
+		out = c.leaves(out)
+	}
+	return out
+}
+
+// A Schema is the Parquet schema for a message type.
+type Schema struct {
+	root   *node
+	leaves []*node
+}
+
+// Columns returns the paths of the schema's columns, in column order.
+func (s *Schema) Columns() [][]string {
+	var out [][]string
+	var walk func(n *node, path []string)
+	walk = func(n *node, path []string) {
+		path = append(path[:len(path):len(path)], n.name)
+		if n.kind == leafNode {
+			out = append(out, path)
+			return
+		}
+		for _, c := range n.children {
+			walk(c, path)
+		}
+	}
+	for _, c := range s.root.children {
+		walk(c, nil)
+	}
+	return out
+}
+
+// String returns the schema in the textual message format used by Parquet
+// tooling.
+func (s *Schema) String() string {
+	sb := &strings.Builder{}
+	sb.WriteString("message ")
+	sb.WriteString(s.root.name)
+	sb.WriteString(" {\n")
+	for _, c := range s.root.children {
+		c.write(sb, "  ")
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func (n *node) write(sb *strings.Builder, indent string) {
+	sb.WriteString(indent)
+	sb.WriteString(n.repetition.String())
+	sb.WriteString(" ")
+	if n.kind == leafNode {
+		sb.WriteString(n.physical.String())
+	} else {
+		sb.WriteString("group")
+	}
+	sb.WriteString(" ")
+	sb.WriteString(n.name)
+	if n.annotation != noAnnotation {
+		sb.WriteString(" (")
+		sb.WriteString(n.annotation.String())
+		sb.WriteString(")")
+	}
+	if n.kind == leafNode {
+		sb.WriteString(";\n")
+		return
+	}
+	sb.WriteString(" {\n")
+	for _, c := range n.children {
+		c.write(sb, indent+"  ")
+	}
+	sb.WriteString(indent)
+	sb.WriteString("}\n")
+}
+
+// NewSchema creates the Parquet schema for a message type. Of the options,
+// only OptionMaxDepth applies.
+func NewSchema(md protoreflect.MessageDescriptor, options ...Option) *Schema {
+	c := newConfig(options)
+	root := &node{name: string(md.FullName()), kind: groupNode}
+	root.children = fieldNodes(md, c.maxDepth-1)
+	s := &Schema{root: root}
+	for _, c := range root.children {
+		c.setLevels(0, 0)
+	}
+	s.leaves = root.leaves(nil)
+	for i, l := range s.leaves {
+		l.column = i
+	}
+	return s
+}
+
+func (n *node) setLevels(def, rep int) {
+	switch n.repetition {
+	case optional:
+		def += 1
+	case repeated:
+		def += 1
+		rep += 1
+	}
+	n.maxDef, n.maxRep = def, rep
+	for _, c := range n.children {
+		c.setLevels(def, rep)
+	}
+}
+
+// fieldNodes creates the nodes for the fields of a message. The allowed depth
+// mirrors that of the Walker: message values are only included if it is not
+// negative.
+func fieldNodes(md protoreflect.MessageDescriptor, allowedDepth int) []*node {
+	var out []*node
+	for i := 0; i < md.Fields().Len(); i += 1 {
+		if n := fieldNode(md.Fields().Get(i), allowedDepth); n != nil {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func fieldNode(fd protoreflect.FieldDescriptor, allowedDepth int) *node {
+	name := string(fd.Name())
+	switch {
+	case fd.IsMap():
+		value := valueNode("value", fd.MapValue(), allowedDepth)
+		if value == nil {
+			return nil
+		}
+		key := valueNode("key", fd.MapKey(), allowedDepth)
+		return &node{
+			name:       name,
+			kind:       mapNode,
+			annotation: mapAnnotation,
+			children: []*node{{
+				name:       "key_value",
+				kind:       repeatedNode,
+				repetition: repeated,
+				children:   []*node{key, value},
+			}},
+		}
+	case fd.IsList():
+		element := valueNode("element", fd, allowedDepth)
+		if element == nil {
+			return nil
+		}
+		return &node{
+			name:       name,
+			kind:       listNode,
+			annotation: listAnnotation,
+			children: []*node{{
+				name:       "list",
+				kind:       repeatedNode,
+				repetition: repeated,
+				children:   []*node{element},
+			}},
+		}
+	}
+	n := valueNode(name, fd, allowedDepth)
+	if n != nil && fd.HasPresence() {
+		n.repetition = optional
+	}
+	return n
+}
+
+// valueNode creates a required node for a single value of a field, or nil if
+// it is a message beyond the maximum depth or without fields.
+func valueNode(name string, fd protoreflect.FieldDescriptor, allowedDepth int) *node {
+	n := &node{name: name}
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		n.physical = Boolean
+	case protoreflect.EnumKind:
+		n.physical, n.annotation = ByteArray, enumAnnotation
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n.physical = Int32
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n.physical, n.annotation = Int32, uint32Annotation
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n.physical = Int64
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n.physical, n.annotation = Int64, uint64Annotation
+	case protoreflect.FloatKind:
+		n.physical = Float
+	case protoreflect.DoubleKind:
+		n.physical = Double
+	case protoreflect.StringKind:
+		n.physical, n.annotation = ByteArray, stringAnnotation
+	case protoreflect.BytesKind:
+		n.physical = ByteArray
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if allowedDepth < 0 {
+			return nil
+		}
+		if fd.Message().FullName() == timestampName {
+			n.physical, n.annotation = Int64, timestampAnnotation
+			break
+		}
+		n.kind = groupNode
+		n.children = fieldNodes(fd.Message(), allowedDepth-1)
+		// Parquet does not allow empty groups
+		if len(n.children) == 0 {
+			return nil
+		}
+	default:
+		panic(fmt.Sprintf("unsupported type %v", fd.Kind()))
+	}
+	if n.kind == leafNode {
+		n.zero = zeroValue(fd)
+	}
+	return n
+}
+
+func zeroValue(fd protoreflect.FieldDescriptor) interface{} {
+	if fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+		// timestamps
+		return int64(0)
+	}
+	v := fd.Default()
+	if fd.IsList() {
+		// lists have no default, so use that of a new element
+		v = dynamicpb.NewMessage(fd.ContainingMessage()).NewField(fd).List().NewElement()
+	}
+	return convertScalar(fd, &v)
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package parquet
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"strings"
+	"testing"
+)
+
+func field(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, type_ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+	f := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    label.Enum(),
+		Type:     type_.Enum(),
+	}
+	if typeName != "" {
+		f.TypeName = proto.String(typeName)
+	}
+	return f
+}
+
+// scalarEventSchema holds the fields of test.Event that are not messages.
+const scalarEventSchema = `required int64 id;
+required binary name (STRING);
+required boolean flag;
+required float ratio;
+required int32 count (INTEGER(32,false));
+required binary status (ENUM);
+required group tags (LIST) {
+  repeated group list {
+    required binary element (STRING);
+  }
+}
+required group attrs (MAP) {
+  repeated group key_value {
+    required binary key (STRING);
+    required int64 value;
+  }
+}
+`
+
+const statesSchema = `required group states (LIST) {
+  repeated group list {
+    required binary element (ENUM);
+  }
+}
+`
+
+// leafEventSchema holds test.Event at the maximum depth, where its message
+// fields are left out.
+const leafEventSchema = scalarEventSchema + "optional binary alias (STRING);\n" + statesSchema
+
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(strings.TrimSuffix(s, "\n"), "\n", "\n"+prefix) + "\n"
+}
+
+func TestNewSchema(t *testing.T) {
+	event := (&testpb.Event{}).ProtoReflect().Descriptor()
+
+	cases := []struct {
+		options  []Option
+		expected string
+		name     string
+	}{
+		{
+			[]Option{OptionMaxDepth(0)},
+			"message test.Event {\n" +
+				indent(leafEventSchema, "  ") +
+				"}\n",
+			"depth zero",
+		},
+		{
+			[]Option{OptionMaxDepth(1)},
+			"message test.Event {\n" +
+				indent(scalarEventSchema, "  ") +
+				"  required group children (LIST) {\n" +
+				"    repeated group list {\n" +
+				"      required group element {\n" +
+				indent(leafEventSchema, "        ") +
+				"      }\n" +
+				"    }\n" +
+				"  }\n" +
+				"  optional group parent {\n" +
+				indent(leafEventSchema, "    ") +
+				"  }\n" +
+				"  optional int64 created (TIMESTAMP(MICROS,true));\n" +
+				"  optional binary alias (STRING);\n" +
+				"  optional group place {\n" +
+				"    required double lat;\n" +
+				"    required binary status (ENUM);\n" +
+				"  }\n" +
+				"  required group stops (LIST) {\n" +
+				"    repeated group list {\n" +
+				"      required group element {\n" +
+				"        required double lat;\n" +
+				"        required binary status (ENUM);\n" +
+				"      }\n" +
+				"    }\n" +
+				"  }\n" +
+				indent(statesSchema, "  ") +
+				"}\n",
+			"depth one",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := NewSchema(event, c.options...).String()
+			if actual != c.expected {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestNewSchema_RepeatedScalars(t *testing.T) {
+	const repeated = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("lists.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Lists"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("ratios", 1, repeated, descriptorpb.FieldDescriptorProto_TYPE_FLOAT, ""),
+				field("states", 2, repeated, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".test.State"),
+			},
+		}},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name:  proto.String("State"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{{Name: proto.String("NONE"), Number: proto.Int32(0)}},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `message test.Lists {
+  required group ratios (LIST) {
+    repeated group list {
+      required float element;
+    }
+  }
+  required group states (LIST) {
+    repeated group list {
+      required binary element (ENUM);
+    }
+  }
+}
+`
+	if actual := NewSchema(fd.Messages().ByName("Lists")).String(); actual != expected {
+		t.Errorf("\nexpected %v, \ngot      %v", expected, actual)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package parquet
+
+import (
+	"encoding/binary"
+)
+
+// Types of the Thrift compact protocol.
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// A thriftWriter writes structs in the Thrift compact protocol, which is what
+// Parquet uses for its metadata. Top-level structs are started with
+// structBegin(-1) as well.
+type thriftWriter struct {
+	buf []byte
+	// last holds the last field id per nesting level
+	last []int16
+}
+
+func (t *thriftWriter) fieldHeader(id int16, type_ byte) {
+	delta := id - t.last[len(t.last)-1]
+	if delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|type_)
+	} else {
+		t.buf = append(t.buf, type_)
+		t.varint(int64(id))
+	}
+	t.last[len(t.last)-1] = id
+}
+
+func (t *thriftWriter) varint(x int64) {
+	var bs [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(bs[:], x)
+	t.buf = append(t.buf, bs[:n]...)
+}
+
+func (t *thriftWriter) uvarint(x uint64) {
+	var bs [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(bs[:], x)
+	t.buf = append(t.buf, bs[:n]...)
+}
+
+func (t *thriftWriter) bool(id int16, v bool) {
+	if v {
+		t.fieldHeader(id, thriftTrue)
+	} else {
+		t.fieldHeader(id, thriftFalse)
+	}
+}
+
+func (t *thriftWriter) i8(id int16, v int8) {
+	t.fieldHeader(id, thriftByte)
+	t.buf = append(t.buf, byte(v))
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) string(id int16, v string) {
+	t.fieldHeader(id, thriftBinary)
+	t.uvarint(uint64(len(v)))
+	t.buf = append(t.buf, v...)
+}
+
+// listHeader starts a list field of n elements. The elements are to be
+// written with the element functions.
+func (t *thriftWriter) listHeader(id int16, type_ byte, n int) {
+	t.fieldHeader(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|type_)
+	} else {
+		t.buf = append(t.buf, 0xf0|type_)
+		t.uvarint(uint64(n))
+	}
+}
+
+func (t *thriftWriter) i32Element(v int32) {
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) stringElement(v string) {
+	t.uvarint(uint64(len(v)))
+	t.buf = append(t.buf, v...)
+}
+
+// structBegin starts a struct field. A negative id starts a struct without a
+// field header, as used for list elements and top-level structs.
+func (t *thriftWriter) structBegin(id int16) {
+	if id >= 0 {
+		t.fieldHeader(id, thriftStruct)
+	}
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftWriter) structEnd() {
+	t.buf = append(t.buf, 0)
+	t.last = t.last[:len(t.last)-1]
+}
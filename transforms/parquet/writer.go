@@ -0,0 +1,621 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"io"
+	"math"
+	"math/bits"
+	"strconv"
+)
+
+const (
+	createdBy = "github.com/HayoVanLoon/go-proto/transforms/parquet"
+
+	defaultMaxDepth     = 10
+	defaultRowGroupSize = 128 << 20
+
+	// encodings
+	plainEncoding = 0
+	rleEncoding   = 3
+)
+
+var magic = []byte("PAR1")
+
+// A Compression is a Parquet compression codec. Only Uncompressed and Gzip
+// are supported.
+type Compression int32
+
+const (
+	Uncompressed = Compression(0)
+	Gzip         = Compression(2)
+)
+
+type config struct {
+	maxDepth     int
+	compression  Compression
+	rowGroupSize int
+}
+
+type Option interface {
+	// Apply applies the Option to the configuration.
+	Apply(c *config)
+}
+
+type optionMaxDepth struct {
+	value int
+}
+
+func (o *optionMaxDepth) Apply(c *config) {
+	c.maxDepth = o.value
+}
+
+// OptionMaxDepth sets a maximum message recursion depth. Message fields beyond
+// it are left out of the schema. Defaults to 10. See transforms.OptionMaxDepth.
+func OptionMaxDepth(v int) Option {
+	return &optionMaxDepth{value: v}
+}
+
+type optionCompression struct {
+	value Compression
+}
+
+func (o *optionCompression) Apply(c *config) {
+	c.compression = o.value
+}
+
+// OptionCompression sets the compression codec of data pages. Defaults to
+// Uncompressed.
+func OptionCompression(v Compression) Option {
+	if v != Uncompressed && v != Gzip {
+		panic(fmt.Sprintf("unsupported compression %d", v))
+	}
+	return &optionCompression{value: v}
+}
+
+type optionRowGroupSize struct {
+	value int
+}
+
+func (o *optionRowGroupSize) Apply(c *config) {
+	c.rowGroupSize = o.value
+}
+
+// OptionRowGroupSize sets the size in bytes of uncompressed data at which a
+// row group is completed. Defaults to 128 MiB.
+func OptionRowGroupSize(v int) Option {
+	if v <= 0 {
+		panic(fmt.Sprintf("invalid row group size %d", v))
+	}
+	return &optionRowGroupSize{value: v}
+}
+
+func newConfig(options []Option) *config {
+	c := &config{maxDepth: defaultMaxDepth, rowGroupSize: defaultRowGroupSize}
+	for _, o := range options {
+		o.Apply(c)
+	}
+	return c
+}
+
+// A column buffers the values and levels of a column in the current row
+// group.
+type column struct {
+	leaf   *node
+	path   []string
+	values []byte
+	bools  []bool
+	defs   []int
+	reps   []int
+}
+
+func (c *column) null(rep, def int) {
+	c.reps = append(c.reps, rep)
+	c.defs = append(c.defs, def)
+}
+
+func (c *column) add(v interface{}, rep int) error {
+	if v == nil {
+		v = c.leaf.zero
+	}
+	c.reps = append(c.reps, rep)
+	c.defs = append(c.defs, c.leaf.maxDef)
+	switch c.leaf.physical {
+	case Boolean:
+		if x, ok := v.(bool); ok {
+			c.bools = append(c.bools, x)
+			return nil
+		}
+	case Int32:
+		switch x := v.(type) {
+		case int32:
+			c.values = appendUint32(c.values, uint32(x))
+			return nil
+		case uint32:
+			c.values = appendUint32(c.values, x)
+			return nil
+		}
+	case Int64:
+		switch x := v.(type) {
+		case int64:
+			c.values = appendUint64(c.values, uint64(x))
+			return nil
+		case uint64:
+			c.values = appendUint64(c.values, x)
+			return nil
+		}
+	case Float:
+		if x, ok := v.(float32); ok {
+			c.values = appendUint32(c.values, math.Float32bits(x))
+			return nil
+		}
+	case Double:
+		if x, ok := v.(float64); ok {
+			c.values = appendUint64(c.values, math.Float64bits(x))
+			return nil
+		}
+	case ByteArray:
+		switch x := v.(type) {
+		case string:
+			c.values = append(appendUint32(c.values, uint32(len(x))), x...)
+			return nil
+		case []byte:
+			c.values = append(appendUint32(c.values, uint32(len(x))), x...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%v: unexpected value of type %T for %s column", c.path, v, c.leaf.physical)
+}
+
+func (c *column) size() int {
+	// levels take at most a byte per value
+	return len(c.values) + len(c.bools)/8 + 2*len(c.defs)
+}
+
+func (c *column) reset() {
+	c.values = c.values[:0]
+	c.bools = c.bools[:0]
+	c.defs = c.defs[:0]
+	c.reps = c.reps[:0]
+}
+
+type columnChunk struct {
+	offset           int64
+	numValues        int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+type rowGroup struct {
+	columns []columnChunk
+	numRows int64
+	size    int64
+}
+
+// A Writer writes messages of a single type to a Parquet file. It is not safe
+// for concurrent use.
+//
+// Rows are buffered until the row group size is reached. Each column chunk
+// is written as a single, PLAIN encoded data page.
+type Writer struct {
+	w         io.Writer
+	schema    *Schema
+	config    *config
+	walker    transforms.Walker
+	columns   []*column
+	offset    int64
+	rows      int64
+	rowGroups []rowGroup
+	err       error
+}
+
+// NewWriter creates a new Writer for messages of the given type and writes
+// the file header.
+func NewWriter(w io.Writer, md protoreflect.MessageDescriptor, options ...Option) (*Writer, error) {
+	c := newConfig(options)
+	s := NewSchema(md, options...)
+	pw := &Writer{
+		w:      w,
+		schema: s,
+		config: c,
+		walker: transforms.NewWalker(
+			transforms.OptionKeepSet(true),
+			transforms.OptionMaxDepth(c.maxDepth),
+			transforms.OptionDefaultScalarFunc(convertScalar),
+			transforms.OptionMapStrategy(transforms.MapEntries),
+			transforms.OptionAddTypeOverride(timestampName, convertTimestamp),
+		),
+	}
+	for i, path := range s.Columns() {
+		pw.columns = append(pw.columns, &column{leaf: s.leaves[i], path: path})
+	}
+	if err := pw.write(magic); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// Schema returns the schema of the file.
+func (pw *Writer) Schema() *Schema {
+	return pw.schema
+}
+
+func convertScalar(fd protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return strconv.Itoa(int(v.Enum()))
+	case protoreflect.FloatKind:
+		return float32(v.Float())
+	}
+	return v.Interface()
+}
+
+func convertTimestamp(_ protoreflect.FieldDescriptor, kvs []transforms.KeyValue) interface{} {
+	micros := int64(0)
+	for _, kv := range kvs {
+		switch kv.Key {
+		case "seconds":
+			micros += kv.Value.(int64) * 1e6
+		case "nanos":
+			micros += int64(kv.Value.(int32)) / 1e3
+		}
+	}
+	return micros
+}
+
+// Write adds messages to the current row group, completing it when it reaches
+// the row group size.
+func (pw *Writer) Write(ms ...proto.Message) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	for _, m := range ms {
+		if name := string(m.ProtoReflect().Descriptor().FullName()); name != pw.schema.root.name {
+			return fmt.Errorf("expected message of type %s, got %s", pw.schema.root.name, name)
+		}
+		row := pw.walker.Apply(m).(map[string]interface{})
+		for _, n := range pw.schema.root.children {
+			if pw.err = pw.shred(n, row[n.name], 0); pw.err != nil {
+				return pw.err
+			}
+		}
+		pw.rows += 1
+		size := 0
+		for _, c := range pw.columns {
+			size += c.size()
+		}
+		if size >= pw.config.rowGroupSize {
+			if err := pw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// shred adds a value to the columns under a node, starting at the given
+// repetition level.
+func (pw *Writer) shred(n *node, v interface{}, rep int) error {
+	switch n.kind {
+	case leafNode:
+		if v == nil && n.repetition == optional {
+			pw.columns[n.column].null(rep, n.maxDef-1)
+			return nil
+		}
+		return pw.columns[n.column].add(v, rep)
+	case groupNode:
+		if v == nil && n.repetition == optional {
+			pw.nulls(n, rep, n.maxDef-1)
+			return nil
+		}
+		m, _ := v.(map[string]interface{})
+		for _, c := range n.children {
+			if err := pw.shred(c, m[c.name], rep); err != nil {
+				return err
+			}
+		}
+	case listNode:
+		r := n.children[0]
+		xs, _ := v.([]interface{})
+		if len(xs) == 0 {
+			pw.nulls(r, rep, r.maxDef-1)
+		}
+		for i, x := range xs {
+			if i > 0 {
+				rep = r.maxRep
+			}
+			if err := pw.shred(r.children[0], x, rep); err != nil {
+				return err
+			}
+		}
+	case mapNode:
+		r := n.children[0]
+		es, _ := v.([]map[string]interface{})
+		if len(es) == 0 {
+			pw.nulls(r, rep, r.maxDef-1)
+		}
+		for i, e := range es {
+			if i > 0 {
+				rep = r.maxRep
+			}
+			for _, c := range r.children {
+				if err := pw.shred(c, e[c.name], rep); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// nulls adds an undefined value to all columns under a node.
+func (pw *Writer) nulls(n *node, rep, def int) {
+	for _, l := range n.leaves(nil) {
+		pw.columns[l.column].null(rep, def)
+	}
+}
+
+// Flush completes the current row group, if it holds any rows.
+func (pw *Writer) Flush() error {
+	if pw.err != nil || pw.rows == 0 {
+		return pw.err
+	}
+	rg := rowGroup{numRows: pw.rows}
+	for _, c := range pw.columns {
+		cc, err := pw.writeColumn(c)
+		if err != nil {
+			pw.err = err
+			return err
+		}
+		rg.columns = append(rg.columns, cc)
+		rg.size += cc.uncompressedSize
+		c.reset()
+	}
+	pw.rowGroups = append(pw.rowGroups, rg)
+	pw.rows = 0
+	return nil
+}
+
+func (pw *Writer) writeColumn(c *column) (columnChunk, error) {
+	var page []byte
+	if c.leaf.maxRep > 0 {
+		page = appendLevels(page, c.reps, bits.Len(uint(c.leaf.maxRep)))
+	}
+	if c.leaf.maxDef > 0 {
+		page = appendLevels(page, c.defs, bits.Len(uint(c.leaf.maxDef)))
+	}
+	if c.leaf.physical == Boolean {
+		page = appendBools(page, c.bools)
+	} else {
+		page = append(page, c.values...)
+	}
+	data := page
+	if pw.config.compression == Gzip {
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		if _, err := gw.Write(page); err != nil {
+			return columnChunk{}, err
+		}
+		if err := gw.Close(); err != nil {
+			return columnChunk{}, err
+		}
+		data = buf.Bytes()
+	}
+
+	t := &thriftWriter{}
+	t.structBegin(-1)
+	t.i32(1, 0) // DATA_PAGE
+	t.i32(2, int32(len(page)))
+	t.i32(3, int32(len(data)))
+	t.structBegin(5)
+	t.i32(1, int32(len(c.defs)))
+	t.i32(2, plainEncoding)
+	t.i32(3, rleEncoding)
+	t.i32(4, rleEncoding)
+	t.structEnd()
+	t.structEnd()
+
+	cc := columnChunk{
+		offset:           pw.offset,
+		numValues:        int64(len(c.defs)),
+		uncompressedSize: int64(len(t.buf) + len(page)),
+		compressedSize:   int64(len(t.buf) + len(data)),
+	}
+	if err := pw.write(t.buf); err != nil {
+		return cc, err
+	}
+	return cc, pw.write(data)
+}
+
+// appendLevels appends levels in the RLE/bit-packing hybrid encoding, using
+// only RLE runs, preceded by their length.
+func appendLevels(buf []byte, levels []int, bitWidth int) []byte {
+	var runs []byte
+	width := (bitWidth + 7) / 8
+	for i := 0; i < len(levels); {
+		j := i + 1
+		for j < len(levels) && levels[j] == levels[i] {
+			j += 1
+		}
+		runs = appendUvarint(runs, uint64(j-i)<<1)
+		for k := 0; k < width; k += 1 {
+			runs = append(runs, byte(levels[i]>>(8*k)))
+		}
+		i = j
+	}
+	return append(appendUint32(buf, uint32(len(runs))), runs...)
+}
+
+// appendBools appends booleans bit-packed, least significant bit first.
+func appendBools(buf []byte, xs []bool) []byte {
+	for i := 0; i < len(xs); i += 8 {
+		b := byte(0)
+		for j := 0; j < 8 && i+j < len(xs); j += 1 {
+			if xs[i+j] {
+				b |= 1 << j
+			}
+		}
+		buf = append(buf, b)
+	}
+	return buf
+}
+
+// Close completes the current row group and writes the file footer. It does
+// not close the underlying writer.
+func (pw *Writer) Close() error {
+	if err := pw.Flush(); err != nil {
+		return err
+	}
+	t := &thriftWriter{}
+	pw.writeFileMetaData(t)
+	footer := appendUint32(t.buf, uint32(len(t.buf)))
+	footer = append(footer, magic...)
+	if err := pw.write(footer); err != nil {
+		return err
+	}
+	pw.err = fmt.Errorf("writer is closed")
+	return nil
+}
+
+func (pw *Writer) writeFileMetaData(t *thriftWriter) {
+	var elements []*node
+	var collect func(n *node)
+	collect = func(n *node) {
+		elements = append(elements, n)
+		for _, c := range n.children {
+			collect(c)
+		}
+	}
+	collect(pw.schema.root)
+	numRows := int64(0)
+	for _, rg := range pw.rowGroups {
+		numRows += rg.numRows
+	}
+
+	t.structBegin(-1)
+	t.i32(1, 1)
+	t.listHeader(2, thriftStruct, len(elements))
+	for _, n := range elements {
+		writeSchemaElement(t, n, n == pw.schema.root)
+	}
+	t.i64(3, numRows)
+	t.listHeader(4, thriftStruct, len(pw.rowGroups))
+	for _, rg := range pw.rowGroups {
+		t.structBegin(-1)
+		t.listHeader(1, thriftStruct, len(rg.columns))
+		for i, cc := range rg.columns {
+			c := pw.columns[i]
+			t.structBegin(-1)
+			t.i64(2, cc.offset)
+			t.structBegin(3)
+			t.i32(1, int32(c.leaf.physical))
+			t.listHeader(2, thriftI32, 2)
+			t.i32Element(plainEncoding)
+			t.i32Element(rleEncoding)
+			t.listHeader(3, thriftBinary, len(c.path))
+			for _, p := range c.path {
+				t.stringElement(p)
+			}
+			t.i32(4, int32(pw.config.compression))
+			t.i64(5, cc.numValues)
+			t.i64(6, cc.uncompressedSize)
+			t.i64(7, cc.compressedSize)
+			t.i64(9, cc.offset)
+			t.structEnd()
+			t.structEnd()
+		}
+		t.i64(2, rg.size)
+		t.i64(3, rg.numRows)
+		t.structEnd()
+	}
+	t.string(6, createdBy)
+	t.structEnd()
+}
+
+func writeSchemaElement(t *thriftWriter, n *node, root bool) {
+	t.structBegin(-1)
+	if n.kind == leafNode {
+		t.i32(1, int32(n.physical))
+	}
+	if !root {
+		t.i32(3, int32(n.repetition))
+	}
+	t.string(4, n.name)
+	if n.kind != leafNode {
+		t.i32(5, int32(len(n.children)))
+	}
+	if n.annotation != noAnnotation {
+		t.i32(6, n.annotation.convertedType())
+		t.structBegin(10)
+		switch n.annotation {
+		case stringAnnotation:
+			t.structBegin(1)
+		case mapAnnotation:
+			t.structBegin(2)
+		case listAnnotation:
+			t.structBegin(3)
+		case enumAnnotation:
+			t.structBegin(4)
+		case timestampAnnotation:
+			t.structBegin(8)
+			t.bool(1, true)
+			t.structBegin(2)
+			t.structBegin(2) // MICROS
+			t.structEnd()
+			t.structEnd()
+		case uint32Annotation, uint64Annotation:
+			t.structBegin(10)
+			if n.annotation == uint32Annotation {
+				t.i8(1, 32)
+			} else {
+				t.i8(1, 64)
+			}
+			t.bool(2, false)
+		}
+		t.structEnd()
+		t.structEnd()
+	}
+	t.structEnd()
+}
+
+func (pw *Writer) write(bs []byte) error {
+	n, err := pw.w.Write(bs)
+	pw.offset += int64(n)
+	if err != nil {
+		pw.err = err
+	}
+	return err
+}
+
+func appendUint32(buf []byte, x uint32) []byte {
+	var bs [4]byte
+	binary.LittleEndian.PutUint32(bs[:], x)
+	return append(buf, bs[:]...)
+}
+
+func appendUint64(buf []byte, x uint64) []byte {
+	var bs [8]byte
+	binary.LittleEndian.PutUint64(bs[:], x)
+	return append(buf, bs[:]...)
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var bs [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(bs[:], x)
+	return append(buf, bs[:n]...)
+}
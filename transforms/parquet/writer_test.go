@@ -0,0 +1,358 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// thriftFields is a decoded Thrift struct, keyed by field id.
+type thriftFields map[int16]interface{}
+
+func readThriftStruct(r *bytes.Reader) (thriftFields, error) {
+	s := thriftFields{}
+	last := int16(0)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == 0 {
+			return s, nil
+		}
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			x, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, err
+			}
+			id = int16(x)
+		}
+		if s[id], err = readThriftValue(r, b&0x0f); err != nil {
+			return nil, err
+		}
+		last = id
+	}
+}
+
+func readThriftValue(r *bytes.Reader, type_ byte) (interface{}, error) {
+	switch type_ {
+	case thriftTrue:
+		return true, nil
+	case thriftFalse:
+		return false, nil
+	case thriftByte:
+		b, err := r.ReadByte()
+		return int8(b), err
+	case thriftI32, thriftI64:
+		return binary.ReadVarint(r)
+	case thriftBinary:
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		bs := make([]byte, n)
+		_, err = io.ReadFull(r, bs)
+		return string(bs), err
+	case thriftList:
+		h, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		n := uint64(h >> 4)
+		if n == 15 {
+			if n, err = binary.ReadUvarint(r); err != nil {
+				return nil, err
+			}
+		}
+		xs := make([]interface{}, n)
+		for i := range xs {
+			if xs[i], err = readThriftValue(r, h&0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return xs, nil
+	case thriftStruct:
+		return readThriftStruct(r)
+	}
+	return nil, fmt.Errorf("unsupported thrift type %d", type_)
+}
+
+// columnData holds the contents of a column, across all row groups.
+type columnData struct {
+	values []interface{}
+	defs   []int
+	reps   []int
+}
+
+// readFile reads back a Parquet file as written by the Writer, returning its
+// metadata and the contents of its columns by path.
+func readFile(t *testing.T, bs []byte) (thriftFields, map[string]*columnData) {
+	if !bytes.HasPrefix(bs, magic) || !bytes.HasSuffix(bs, magic) {
+		t.Fatalf("missing magic bytes")
+	}
+	n := binary.LittleEndian.Uint32(bs[len(bs)-8:])
+	meta, err := readThriftStruct(bytes.NewReader(bs[len(bs)-8-int(n) : len(bs)-8]))
+	if err != nil {
+		t.Fatalf("could not read metadata: %v", err)
+	}
+
+	// derive the maximum levels from the schema
+	elements := meta[2].([]interface{})
+	levels := map[string][2]int{}
+	var walk func(i int, path string, def, rep int) int
+	walk = func(i int, path string, def, rep int) int {
+		e := elements[i].(thriftFields)
+		switch e[3] {
+		case int64(optional):
+			def += 1
+		case int64(repeated):
+			def, rep = def+1, rep+1
+		}
+		if path != "" {
+			path += "."
+		}
+		path += e[4].(string)
+		i += 1
+		if e[5] == nil {
+			levels[path] = [2]int{def, rep}
+			return i
+		}
+		for j := int64(0); j < e[5].(int64); j += 1 {
+			i = walk(i, path, def, rep)
+		}
+		return i
+	}
+	root := elements[0].(thriftFields)
+	for i, j := 1, int64(0); j < root[5].(int64); j += 1 {
+		i = walk(i, "", 0, 0)
+	}
+
+	columns := map[string]*columnData{}
+	for _, rg := range meta[4].([]interface{}) {
+		for _, cc := range rg.(thriftFields)[1].([]interface{}) {
+			cmd := cc.(thriftFields)[3].(thriftFields)
+			var path []string
+			for _, p := range cmd[3].([]interface{}) {
+				path = append(path, p.(string))
+			}
+			key := strings.Join(path, ".")
+			if columns[key] == nil {
+				columns[key] = &columnData{}
+			}
+			readPage(t, bs[cmd[9].(int64):], cmd, levels[key], columns[key])
+		}
+	}
+	return meta, columns
+}
+
+func readPage(t *testing.T, bs []byte, cmd thriftFields, levels [2]int, cd *columnData) {
+	r := bytes.NewReader(bs)
+	header, err := readThriftStruct(r)
+	if err != nil {
+		t.Fatalf("could not read page header: %v", err)
+	}
+	data := make([]byte, header[3].(int64))
+	if _, err := io.ReadFull(r, data); err != nil {
+		t.Fatalf("could not read page: %v", err)
+	}
+	if cmd[4].(int64) == int64(Gzip) {
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("could not decompress page: %v", err)
+		}
+		if data, err = io.ReadAll(gr); err != nil {
+			t.Fatalf("could not decompress page: %v", err)
+		}
+	}
+	if int64(len(data)) != header[2].(int64) {
+		t.Fatalf("expected uncompressed size %v, got %d", header[2], len(data))
+	}
+
+	n := int(header[5].(thriftFields)[1].(int64))
+	reps := make([]int, n)
+	if levels[1] > 0 {
+		reps, data = readLevels(t, data, n)
+	}
+	defs := make([]int, n)
+	for i := range defs {
+		defs[i] = levels[0]
+	}
+	if levels[0] > 0 {
+		defs, data = readLevels(t, data, n)
+	}
+	cd.defs = append(cd.defs, defs...)
+	cd.reps = append(cd.reps, reps...)
+
+	for i, d := range defs {
+		if d < levels[0] {
+			continue
+		}
+		switch PhysicalType(cmd[1].(int64)) {
+		case Boolean:
+			cd.values = append(cd.values, data[i/8]&(1<<(i%8)) != 0)
+		case Int32:
+			cd.values = append(cd.values, int32(binary.LittleEndian.Uint32(data)))
+			data = data[4:]
+		case Int64:
+			cd.values = append(cd.values, int64(binary.LittleEndian.Uint64(data)))
+			data = data[8:]
+		case Float:
+			cd.values = append(cd.values, math.Float32frombits(binary.LittleEndian.Uint32(data)))
+			data = data[4:]
+		case Double:
+			cd.values = append(cd.values, math.Float64frombits(binary.LittleEndian.Uint64(data)))
+			data = data[8:]
+		case ByteArray:
+			l := binary.LittleEndian.Uint32(data)
+			cd.values = append(cd.values, string(data[4:4+l]))
+			data = data[4+l:]
+		}
+	}
+}
+
+func readLevels(t *testing.T, data []byte, n int) ([]int, []byte) {
+	l := binary.LittleEndian.Uint32(data)
+	r := bytes.NewReader(data[4 : 4+l])
+	var out []int
+	for r.Len() > 0 {
+		h, err := binary.ReadUvarint(r)
+		if err != nil || h&1 == 1 {
+			t.Fatalf("expected RLE run")
+		}
+		// levels in these tests fit in a single byte
+		v, _ := r.ReadByte()
+		for i := uint64(0); i < h>>1; i += 1 {
+			out = append(out, int(v))
+		}
+	}
+	if len(out) != n {
+		t.Fatalf("expected %d levels, got %d", n, len(out))
+	}
+	return out, data[4+l:]
+}
+
+func TestWriter(t *testing.T) {
+	event := (&testpb.Event{}).ProtoReflect().Descriptor()
+	inputs := []string{
+		`{
+  "id": "1",
+  "name": "a",
+  "flag": true,
+  "ratio": 0.5,
+  "count": 4294967295,
+  "status": "ACTIVE",
+  "tags": ["x", "y"],
+  "attrs": {"b": "2", "a": "1"},
+  "children": [{"id": "2", "tags": ["z"]}, {"id": "3"}],
+  "parent": {"name": "p"},
+  "created": "1970-01-01T00:00:01.000002Z",
+  "alias": "q"
+}`,
+		`{}`,
+		`{"status": 99, "tags": [""], "children": [{}], "alias": ""}`,
+	}
+	expected := map[string]*columnData{
+		"id":     {[]interface{}{int64(1), int64(0), int64(0)}, []int{0, 0, 0}, []int{0, 0, 0}},
+		"flag":   {[]interface{}{true, false, false}, []int{0, 0, 0}, []int{0, 0, 0}},
+		"ratio":  {[]interface{}{float32(0.5), float32(0), float32(0)}, []int{0, 0, 0}, []int{0, 0, 0}},
+		"count":  {[]interface{}{int32(-1), int32(0), int32(0)}, []int{0, 0, 0}, []int{0, 0, 0}},
+		"status": {[]interface{}{"ACTIVE", "UNKNOWN", "99"}, []int{0, 0, 0}, []int{0, 0, 0}},
+		"tags.list.element": {
+			[]interface{}{"x", "y", ""},
+			[]int{1, 1, 0, 1},
+			[]int{0, 1, 0, 0},
+		},
+		"attrs.key_value.key": {
+			[]interface{}{"a", "b"},
+			[]int{1, 1, 0, 0},
+			[]int{0, 1, 0, 0},
+		},
+		"attrs.key_value.value": {
+			[]interface{}{int64(1), int64(2)},
+			[]int{1, 1, 0, 0},
+			[]int{0, 1, 0, 0},
+		},
+		"children.list.element.id": {
+			[]interface{}{int64(2), int64(3), int64(0)},
+			[]int{1, 1, 0, 1},
+			[]int{0, 1, 0, 0},
+		},
+		"children.list.element.tags.list.element": {
+			[]interface{}{"z"},
+			[]int{2, 1, 0, 1},
+			[]int{0, 1, 0, 0},
+		},
+		"parent.name":  {[]interface{}{"p"}, []int{1, 0, 0}, []int{0, 0, 0}},
+		"parent.alias": {nil, []int{1, 0, 0}, []int{0, 0, 0}},
+		"created":      {[]interface{}{int64(1000002)}, []int{1, 0, 0}, []int{0, 0, 0}},
+		"alias":        {[]interface{}{"q", ""}, []int{1, 0, 1}, []int{0, 0, 0}},
+	}
+
+	cases := []struct {
+		options   []Option
+		rowGroups int
+		name      string
+	}{
+		{[]Option{OptionMaxDepth(1)}, 1, "uncompressed"},
+		{[]Option{OptionMaxDepth(1), OptionCompression(Gzip)}, 1, "gzip"},
+		{[]Option{OptionMaxDepth(1), OptionRowGroupSize(1)}, 3, "row group per row"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w, err := NewWriter(buf, event, c.options...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var ms []proto.Message
+			for _, s := range inputs {
+				ms = append(ms, testpb.NewEvent(t, s))
+			}
+			if err := w.Write(ms...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			meta, columns := readFile(t, buf.Bytes())
+			if actual := meta[3]; actual != int64(len(inputs)) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, len(inputs), actual)
+			}
+			if actual := len(meta[4].([]interface{})); actual != c.rowGroups {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.rowGroups, actual)
+			}
+			if actual := len(columns); actual != len(w.Schema().Columns()) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, len(w.Schema().Columns()), actual)
+			}
+			for k, e := range expected {
+				if actual := columns[k]; !reflect.DeepEqual(actual, e) {
+					t.Errorf("%s: %s: \nexpected %v, \ngot      %v", c.name, k, e, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestWriter_Write_WrongType(t *testing.T) {
+	w, err := NewWriter(&bytes.Buffer{}, (&testpb.Event{}).ProtoReflect().Descriptor())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.Write(&timestamppb.Timestamp{}); err == nil {
+		t.Errorf("expected error")
+	}
+}
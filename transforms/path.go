@@ -0,0 +1,403 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package transforms
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A PathPattern is a parsed path expression, as accepted by
+// OptionAddNameOverride and OptionMaxDepthForName.
+//
+// A path is a chain of field names, separated by dots, i.e. 'address.street'.
+// Map values are referenced via the 'value' field of the map entry, i.e.
+// 'attributes.value'. Besides field names, the following can be used:
+//
+//	items[0].price       a list index
+//	attributes["color"]  a map key; strings are quoted, numbers and booleans
+//	                     are not
+//	*.created_at         '*' matches any single field name
+//	**.secret            '**' matches any number of field names, including none
+//
+// A map key may be followed directly by the fields of the map value:
+// 'attributes["color"].name' is the same as 'attributes["color"].value.name'.
+type PathPattern struct {
+	raw  string
+	segs []segment
+}
+
+type segment struct {
+	name     string
+	hasIndex bool
+	index    interface{}
+}
+
+const (
+	wildcard       = "*"
+	doubleWildcard = "**"
+)
+
+// MustParsePathPattern is like ParsePathPattern, but panics on an invalid
+// pattern.
+func MustParsePathPattern(s string) *PathPattern {
+	p, err := ParsePathPattern(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// ParsePathPattern parses a path pattern.
+func ParsePathPattern(s string) (*PathPattern, error) {
+	p := &PathPattern{raw: s}
+	rest := s
+	for {
+		seg, r, err := parseSegment(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %q: %w", s, err)
+		}
+		p.segs = append(p.segs, seg)
+		if r == "" {
+			return p, nil
+		}
+		if r[0] != '.' {
+			return nil, fmt.Errorf("invalid path %q: expected '.' at %q", s, r)
+		}
+		rest = r[1:]
+	}
+}
+
+func parseSegment(s string) (segment, string, error) {
+	i := 0
+	for i < len(s) && s[i] != '.' && s[i] != '[' {
+		i += 1
+	}
+	seg := segment{name: s[:i]}
+	if seg.name == "" {
+		return seg, "", fmt.Errorf("empty field name")
+	}
+	if strings.Contains(seg.name, wildcard) && seg.name != wildcard && seg.name != doubleWildcard {
+		return seg, "", fmt.Errorf("invalid wildcard %q", seg.name)
+	}
+	s = s[i:]
+	if s == "" || s[0] != '[' {
+		return seg, s, nil
+	}
+	if seg.name == doubleWildcard {
+		return seg, "", fmt.Errorf("'**' cannot be indexed")
+	}
+	end := strings.IndexByte(s, ']')
+	if len(s) > 1 && s[1] == '"' {
+		// a quoted key may contain a ']'
+		q, err := strconv.QuotedPrefix(s[1:])
+		if err != nil {
+			return seg, "", fmt.Errorf("invalid key at %q", s)
+		}
+		end = 1 + len(q)
+		if end >= len(s) || s[end] != ']' {
+			return seg, "", fmt.Errorf("expected ']' at %q", s)
+		}
+	}
+	if end < 0 {
+		return seg, "", fmt.Errorf("expected ']' at %q", s)
+	}
+	index, err := parseIndex(s[1:end])
+	if err != nil {
+		return seg, "", err
+	}
+	seg.hasIndex = true
+	seg.index = index
+	return seg, s[end+1:], nil
+}
+
+func parseIndex(s string) (interface{}, error) {
+	if strings.HasPrefix(s, `"`) {
+		return strconv.Unquote(s)
+	}
+	if s == "true" || s == "false" {
+		return s == "true", nil
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return u, nil
+	}
+	return nil, fmt.Errorf("invalid index %q", s)
+}
+
+// String returns the pattern as it was parsed.
+func (p *PathPattern) String() string {
+	return p.raw
+}
+
+// IsPlain reports whether the pattern is a plain chain of field names, without
+// wildcards or indices.
+func (p *PathPattern) IsPlain() bool {
+	return p.class() == classPlain
+}
+
+// MatchName reports whether the pattern matches a dotted name. Since names
+// contain no indices, patterns with indices never match.
+func (p *PathPattern) MatchName(name string) bool {
+	if p.class() == classIndexed {
+		return false
+	}
+	return matchSegments(p.segs, nameTarget(strings.Split(name, ".")), 0)
+}
+
+// Match reports whether the pattern matches the path of a WalkContext.
+func (p *PathPattern) Match(c *WalkContext) bool {
+	return p.MatchPath(c.Path)
+}
+
+// MatchPath reports whether the pattern matches a path.
+func (p *PathPattern) MatchPath(path []PathElement) bool {
+	return matchSegments(p.segs, pathTarget(path), 0)
+}
+
+// mayMatchName reports whether the pattern could match a value with the given
+// dotted name. Indices are ignored.
+func (p *PathPattern) mayMatchName(name string) bool {
+	return matchSegments(p.segs, lenientTarget(strings.Split(name, ".")), 0)
+}
+
+// A patternClass determines the precedence of patterns; lower classes take
+// precedence over higher ones.
+type patternClass int
+
+const (
+	classIndexed = patternClass(iota)
+	classPlain
+	classWildcard
+	classDoubleWildcard
+)
+
+func (p *PathPattern) class() patternClass {
+	c := classPlain
+	for _, s := range p.segs {
+		if s.hasIndex {
+			return classIndexed
+		}
+		if s.name == doubleWildcard {
+			c = classDoubleWildcard
+		} else if s.name == wildcard && c == classPlain {
+			c = classWildcard
+		}
+	}
+	return c
+}
+
+// literals returns the number of non-wildcard segments.
+func (p *PathPattern) literals() int {
+	n := 0
+	for _, s := range p.segs {
+		if s.name != wildcard && s.name != doubleWildcard {
+			n += 1
+		}
+	}
+	return n
+}
+
+// Precedes reports whether pattern p takes precedence over q when both match
+// a field, as described for OptionAddNameOverride. Patterns of equal
+// precedence do not precede each other.
+func (p *PathPattern) Precedes(q *PathPattern) bool {
+	if p.class() != q.class() {
+		return p.class() < q.class()
+	}
+	return p.literals() > q.literals()
+}
+
+type matchTarget interface {
+	len() int
+	name(i int) string
+	// position reports whether element i matches the index of segment s.
+	position(i int, s segment) bool
+	// mapValue reports whether element i is the value of a map entry.
+	mapValue(i int) bool
+}
+
+func matchSegments(segs []segment, t matchTarget, i int) bool {
+	if len(segs) == 0 {
+		return i == t.len()
+	}
+	s := segs[0]
+	if s.name == doubleWildcard {
+		for j := i; j <= t.len(); j += 1 {
+			if matchSegments(segs[1:], t, j) {
+				return true
+			}
+		}
+		return false
+	}
+	if i >= t.len() {
+		return false
+	}
+	if s.name != wildcard && s.name != t.name(i) {
+		return false
+	}
+	if s.hasIndex && !t.position(i, s) {
+		return false
+	}
+	if matchSegments(segs[1:], t, i+1) {
+		return true
+	}
+	// a map key may be followed directly by the fields of the map value
+	return s.hasIndex && i+1 < t.len() && t.mapValue(i+1) && matchSegments(segs[1:], t, i+2)
+}
+
+// A nameTarget matches the segments of a dotted name.
+type nameTarget []string
+
+func (t nameTarget) len() int {
+	return len(t)
+}
+
+func (t nameTarget) name(i int) string {
+	return t[i]
+}
+
+func (t nameTarget) position(int, segment) bool {
+	return false
+}
+
+func (t nameTarget) mapValue(int) bool {
+	return false
+}
+
+// A lenientTarget matches the segments of a dotted name, assuming that any
+// index would match.
+type lenientTarget []string
+
+func (t lenientTarget) len() int {
+	return len(t)
+}
+
+func (t lenientTarget) name(i int) string {
+	return t[i]
+}
+
+func (t lenientTarget) position(int, segment) bool {
+	return true
+}
+
+func (t lenientTarget) mapValue(i int) bool {
+	return t[i] == "value"
+}
+
+// A pathTarget matches the elements of a path.
+type pathTarget []PathElement
+
+func (t pathTarget) len() int {
+	return len(t)
+}
+
+func (t pathTarget) name(i int) string {
+	return string(t[i].Field.Name())
+}
+
+func (t pathTarget) position(i int, s segment) bool {
+	e := t[i]
+	if e.Index >= 0 {
+		x, ok := s.index.(int64)
+		return ok && x == int64(e.Index)
+	}
+	if !e.Key.IsValid() {
+		return false
+	}
+	switch k := e.Key.Interface().(type) {
+	case string:
+		x, ok := s.index.(string)
+		return ok && x == k
+	case bool:
+		x, ok := s.index.(bool)
+		return ok && x == k
+	case int32, int64:
+		x, ok := s.index.(int64)
+		return ok && x == e.Key.Int()
+	case uint32, uint64:
+		switch x := s.index.(type) {
+		case int64:
+			return x >= 0 && uint64(x) == e.Key.Uint()
+		case uint64:
+			return x == e.Key.Uint()
+		}
+	}
+	return false
+}
+
+func (t pathTarget) mapValue(i int) bool {
+	return isMapValue(t[i].Field)
+}
+
+func isMapValue(fd protoreflect.FieldDescriptor) bool {
+	md := fd.ContainingMessage()
+	return md != nil && md.IsMapEntry() && fd.Number() == 2
+}
+
+// A patternSet holds values registered by path pattern and resolves them by
+// precedence. Plain names are looked up directly; other patterns are checked
+// in order of precedence.
+type patternSet struct {
+	plain    map[string]interface{}
+	patterns []patternValue
+}
+
+type patternValue struct {
+	pattern *PathPattern
+	value   interface{}
+	seq     int
+}
+
+func newPatternSet() *patternSet {
+	return &patternSet{plain: map[string]interface{}{}}
+}
+
+// add registers a value for a pattern. Later values for the same pattern
+// replace earlier ones.
+func (ps *patternSet) add(p *PathPattern, v interface{}) {
+	if p.IsPlain() {
+		ps.plain[p.raw] = v
+		return
+	}
+	ps.patterns = append(ps.patterns, patternValue{pattern: p, value: v, seq: len(ps.patterns)})
+	sort.SliceStable(ps.patterns, func(i, j int) bool {
+		pi, pj := ps.patterns[i], ps.patterns[j]
+		if pi.pattern.Precedes(pj.pattern) {
+			return true
+		}
+		if pj.pattern.Precedes(pi.pattern) {
+			return false
+		}
+		// later registrations take precedence
+		return pi.seq > pj.seq
+	})
+}
+
+// resolve returns the value that applies to the given name, disregarding
+// indexed patterns, and the indexed patterns that might apply to it in order
+// of precedence.
+func (ps *patternSet) resolve(name string) (interface{}, []patternValue) {
+	var indexed []patternValue
+	for _, pv := range ps.patterns {
+		if pv.pattern.class() == classIndexed && pv.pattern.mayMatchName(name) {
+			indexed = append(indexed, pv)
+		}
+	}
+	if v, ok := ps.plain[name]; ok {
+		return v, indexed
+	}
+	for _, pv := range ps.patterns {
+		if pv.pattern.class() != classIndexed && pv.pattern.MatchName(name) {
+			return pv.value, indexed
+		}
+	}
+	return nil, indexed
+}
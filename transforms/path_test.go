@@ -0,0 +1,324 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package transforms
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/apipb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/typepb"
+	"reflect"
+	"testing"
+)
+
+func TestParsePathPattern(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected []segment
+		err      bool
+	}{
+		{"name", []segment{{name: "name"}}, false},
+		{"methods.name", []segment{{name: "methods"}, {name: "name"}}, false},
+		{"items[0].price", []segment{{name: "items", hasIndex: true, index: int64(0)}, {name: "price"}}, false},
+		{`attributes["co.l]or"]`, []segment{{name: "attributes", hasIndex: true, index: "co.l]or"}}, false},
+		{"flags[true]", []segment{{name: "flags", hasIndex: true, index: true}}, false},
+		{"big[18446744073709551615]", []segment{{name: "big", hasIndex: true, index: uint64(18446744073709551615)}}, false},
+		{"*.created_at", []segment{{name: "*"}, {name: "created_at"}}, false},
+		{"**.secret", []segment{{name: "**"}, {name: "secret"}}, false},
+		{"", nil, true},
+		{"foo..bar", nil, true},
+		{"foo.", nil, true},
+		{"foo[0", nil, true},
+		{"foo[", nil, true},
+		{"foo[bar]", nil, true},
+		{"foo[0]bar", nil, true},
+		{"**[0]", nil, true},
+		{"f*o", nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			actual, err := ParsePathPattern(c.input)
+			if c.err {
+				if err == nil {
+					t.Errorf("expected error, got %v", actual.segs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(actual.segs, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, actual.segs)
+			}
+		})
+	}
+}
+
+func TestPathPattern_MatchName(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"name", "name", true},
+		{"name", "methods.name", false},
+		{"methods.name", "methods.name", true},
+		{"*.name", "methods.name", true},
+		{"*.name", "name", false},
+		{"*.name", "methods.options.name", false},
+		{"**.name", "name", true},
+		{"**.name", "methods.options.name", true},
+		{"methods.**", "methods.options.name", true},
+		{"methods.**.value", "methods.options.value.type_url", false},
+		{"methods[0].name", "methods.name", false},
+	}
+	for _, c := range cases {
+		t.Run(c.pattern+" "+c.name, func(t *testing.T) {
+			if actual := MustParsePathPattern(c.pattern).MatchName(c.name); actual != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPathPattern_Precedes(t *testing.T) {
+	cases := []struct {
+		p        string
+		q        string
+		expected bool
+	}{
+		{"methods[0].name", "methods.name", true},
+		{"methods.name", "*.name", true},
+		{"*.name", "**.name", true},
+		{"**.name", "*.name", false},
+		{"methods.*.name", "*.name", true},
+		{"methods.name", "methods.name", false},
+	}
+	for _, c := range cases {
+		t.Run(c.p+" "+c.q, func(t *testing.T) {
+			if actual := MustParsePathPattern(c.p).Precedes(MustParsePathPattern(c.q)); actual != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPathPattern_MatchPath(t *testing.T) {
+	api := (&apipb.Api{}).ProtoReflect().Descriptor()
+	methods := api.Fields().ByName("methods")
+	methodName := methods.Message().Fields().ByName("name")
+	str := (&structpb.Struct{}).ProtoReflect().Descriptor()
+	fields := str.Fields().ByName("fields")
+	value := fields.MapValue()
+	stringValue := value.Message().Fields().ByName("string_value")
+
+	methodPath := []PathElement{{Field: methods, Index: 1}, {Field: methodName, Index: -1}}
+	structPath := []PathElement{
+		{Field: fields, Index: -1, Key: protoreflect.ValueOfString("foo").MapKey()},
+		{Field: value, Index: -1},
+		{Field: stringValue, Index: -1},
+	}
+
+	cases := []struct {
+		pattern  string
+		path     []PathElement
+		expected bool
+	}{
+		{"methods.name", methodPath, true},
+		{"methods[1].name", methodPath, true},
+		{"methods[0].name", methodPath, false},
+		{`methods["1"].name`, methodPath, false},
+		{"*[1].name", methodPath, true},
+		{"**.name", methodPath, true},
+		{"fields.value.string_value", structPath, true},
+		{`fields["foo"].value.string_value`, structPath, true},
+		{`fields["foo"].string_value`, structPath, true},
+		{`fields["bar"].string_value`, structPath, false},
+		{`fields[0].string_value`, structPath, false},
+		{`fields["foo"]`, structPath[:2], true},
+		{`fields["foo"]`, structPath[:1], true},
+		{`fields["foo"].string_value`, structPath[:2], false},
+	}
+	for _, c := range cases {
+		t.Run(c.pattern, func(t *testing.T) {
+			if actual := MustParsePathPattern(c.pattern).MatchPath(c.path); actual != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestOptionAddNameOverride_Paths(t *testing.T) {
+	constant := func(s string) ScalarFunc {
+		return func(_ protoreflect.FieldDescriptor, _ *protoreflect.Value) interface{} {
+			return s
+		}
+	}
+	apiInput := &apipb.Api{
+		Name: "foo",
+		Methods: []*apipb.Method{
+			{Name: "foo_method", Options: []*typepb.Option{{Name: "foo_opt"}}},
+			{Name: "bar_method"},
+		},
+	}
+	structInput := &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"foo": structpb.NewStringValue("bla"),
+			"bar": structpb.NewStringValue("bus"),
+		},
+	}
+
+	cases := []struct {
+		walker   Walker
+		input    proto.Message
+		expected interface{}
+		name     string
+	}{
+		{
+			NewWalker(OptionAddNameOverride("methods[1].name", constant("x"))),
+			apiInput,
+			map[string]interface{}{
+				"name": "foo",
+				"methods": []interface{}{
+					map[string]interface{}{
+						"name":    "foo_method",
+						"options": []interface{}{map[string]interface{}{"name": "foo_opt"}},
+					},
+					map[string]interface{}{"name": "x"},
+				},
+			},
+			"list index",
+		},
+		{
+			NewWalker(OptionAddNameOverride(`fields["foo"].string_value`, constant("x"))),
+			structInput,
+			map[string]interface{}{
+				"fields": map[interface{}]interface{}{
+					"foo": map[string]interface{}{"string_value": "x"},
+					"bar": map[string]interface{}{"string_value": "bus"},
+				},
+			},
+			"map key",
+		},
+		{
+			NewWalker(OptionAddNameOverride("*.name", constant("x"))),
+			apiInput,
+			map[string]interface{}{
+				"name": "foo",
+				"methods": []interface{}{
+					map[string]interface{}{
+						"name":    "x",
+						"options": []interface{}{map[string]interface{}{"name": "foo_opt"}},
+					},
+					map[string]interface{}{"name": "x"},
+				},
+			},
+			"single wildcard",
+		},
+		{
+			NewWalker(OptionAddNameOverride("**.name", constant("x"))),
+			apiInput,
+			map[string]interface{}{
+				"name": "x",
+				"methods": []interface{}{
+					map[string]interface{}{
+						"name":    "x",
+						"options": []interface{}{map[string]interface{}{"name": "x"}},
+					},
+					map[string]interface{}{"name": "x"},
+				},
+			},
+			"double wildcard",
+		},
+		{
+			NewWalker(
+				OptionAddNameOverride("methods[0].name", constant("indexed")),
+				OptionAddNameOverride("**.name", constant("double")),
+				OptionAddNameOverride("*.name", constant("single")),
+				OptionAddNameOverride("methods.*.name", constant("single2")),
+				OptionAddNameOverride("methods.name", constant("plain")),
+			),
+			apiInput,
+			map[string]interface{}{
+				"name": "double",
+				"methods": []interface{}{
+					map[string]interface{}{
+						"name":    "indexed",
+						"options": []interface{}{map[string]interface{}{"name": "single2"}},
+					},
+					map[string]interface{}{"name": "plain"},
+				},
+			},
+			"precedence",
+		},
+		{
+			NewWalker(
+				OptionAddNameOverride("*.name", constant("first")),
+				OptionAddNameOverride("*.name", constant("second")),
+			),
+			&apipb.Api{Methods: []*apipb.Method{{Name: "foo_method"}}},
+			map[string]interface{}{
+				"methods": []interface{}{map[string]interface{}{"name": "second"}},
+			},
+			"later wins",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := c.walker.Apply(c.input); !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestOptionMaxDepthForName_Paths(t *testing.T) {
+	apiInput := &apipb.Api{
+		Name: "foo",
+		Methods: []*apipb.Method{
+			{Name: "foo_method", Options: []*typepb.Option{{Name: "foo_opt"}}},
+			{Name: "bar_method", Options: []*typepb.Option{{Name: "bar_opt"}}},
+		},
+	}
+
+	cases := []struct {
+		walker   Walker
+		expected interface{}
+		name     string
+	}{
+		{
+			NewWalker(OptionMaxDepthForName("methods[1]", 0)),
+			map[string]interface{}{
+				"name": "foo",
+				"methods": []interface{}{
+					map[string]interface{}{
+						"name":    "foo_method",
+						"options": []interface{}{map[string]interface{}{"name": "foo_opt"}},
+					},
+					map[string]interface{}{"name": "bar_method"},
+				},
+			},
+			"list index",
+		},
+		{
+			NewWalker(OptionMaxDepthForName("**", 0)),
+			map[string]interface{}{
+				"name": "foo",
+				"methods": []interface{}{
+					map[string]interface{}{"name": "foo_method"},
+					map[string]interface{}{"name": "bar_method"},
+				},
+			},
+			"double wildcard",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := c.walker.Apply(apiInput); !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package transforms
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"sort"
+	"sync"
+)
+
+// A messagePlan holds the descriptor-derived data needed to convert a message
+// at a certain path: its fields, sorted by number.
+type messagePlan struct {
+	md     protoreflect.MessageDescriptor
+	fields []*fieldPlan
+}
+
+// A fieldPlan holds the descriptor-derived data needed to convert a field at a
+// certain path. Everything that depends only on the path and the Walker's
+// options is resolved once, when the plan is created.
+type fieldPlan struct {
+	fd   protoreflect.FieldDescriptor
+	key  string
+	name string
+
+	override     ContextOverrideFunc
+	typeOverride MessageFunc
+	scalarFn     ScalarFunc
+
+	hasMaxDepth bool
+	maxDepth    int
+
+	// indexed overrides and maximum depths can only be resolved during the
+	// walk; these are the candidates, in order of precedence
+	indexedOverrides []patternValue
+	indexedMaxDepths []patternValue
+
+	// overrides for repeated fields as a whole
+	repOverride         ContextOverrideFunc
+	indexedRepOverrides []patternValue
+	repTypeOverride     RepeatedFunc
+
+	// key and value plans for map fields
+	mapKey   *fieldPlan
+	mapValue *fieldPlan
+
+	// message plans are created lazily; recursive messages would otherwise
+	// result in infinite plans
+	once    sync.Once
+	message *messagePlan
+}
+
+// plan returns the plan for root message descriptor md. Plans are cached by
+// the descriptor's full name. Should a different descriptor with the same name
+// be passed (as can happen with dynamic messages), a fresh, uncached plan is
+// returned for it.
+func (w *walker) plan(md protoreflect.MessageDescriptor) *messagePlan {
+	x, ok := w.plans.Load(md.FullName())
+	if !ok {
+		x, _ = w.plans.LoadOrStore(md.FullName(), w.compileMessage(md, ""))
+	}
+	if mp := x.(*messagePlan); mp.md == md {
+		return mp
+	}
+	return w.compileMessage(md, "")
+}
+
+// DescriptorFields returns the fields of a message descriptor in the order of
+// their numbers, which is the order in which a Walker visits them.
+func DescriptorFields(md protoreflect.MessageDescriptor) []protoreflect.FieldDescriptor {
+	fds := md.Fields()
+	xs := make([]protoreflect.FieldDescriptor, fds.Len())
+	for i := 0; i < len(xs); i += 1 {
+		xs[i] = fds.Get(i)
+	}
+	sort.Slice(xs, func(i, j int) bool {
+		return xs[i].Number() < xs[j].Number()
+	})
+	return xs
+}
+
+// compileMessage creates the plan for message descriptor md at path parent.
+func (w *walker) compileMessage(md protoreflect.MessageDescriptor, parent string) *messagePlan {
+	xs := DescriptorFields(md)
+	mp := &messagePlan{md: md, fields: make([]*fieldPlan, len(xs))}
+	for i, fd := range xs {
+		mp.fields[i] = w.compileField(fd, parent)
+	}
+	return mp
+}
+
+// compileField creates the plan for field fd at path parent.
+func (w *walker) compileField(fd protoreflect.FieldDescriptor, parent string) *fieldPlan {
+	name := w.createName(parent, fd.Name())
+	fp := &fieldPlan{
+		fd:   fd,
+		key:  string(fd.Name()),
+		name: name,
+	}
+	override, indexed := w.nameOverrides.resolve(name)
+	if override != nil {
+		fp.override = override.(ContextOverrideFunc)
+	}
+	fp.indexedOverrides = indexed
+	maxDepth, indexed := w.maxDepthForName.resolve(name)
+	if maxDepth != nil {
+		fp.maxDepth, fp.hasMaxDepth = maxDepth.(int), true
+	}
+	fp.indexedMaxDepths = indexed
+	if fd.IsList() {
+		w.compileRepeated(fp)
+	}
+	if fd.IsMap() {
+		fp.mapKey = w.compileField(fd.MapKey(), name)
+		fp.mapValue = w.compileField(fd.MapValue(), name)
+		return fp
+	}
+	if fd.Kind() == protoreflect.MessageKind {
+		fp.typeOverride = w.typeOverrides[string(fd.Message().FullName())]
+		return fp
+	}
+	fp.scalarFn = w.scalarFn(fd)
+	return fp
+}
+
+// scalarFn returns the conversion function for a scalar field, in order of
+// precedence: by enum type, by containing message type, by kind.
+func (w *walker) scalarFn(fd protoreflect.FieldDescriptor) ScalarFunc {
+	if fd.Kind() == protoreflect.EnumKind {
+		if fn := w.scalarTypeFns[string(fd.Enum().FullName())]; fn != nil {
+			return fn
+		}
+	}
+	if md := fd.ContainingMessage(); md != nil {
+		if fn := w.scalarTypeFns[string(md.FullName())]; fn != nil {
+			return fn
+		}
+	}
+	if fn := w.scalarFns[fd.Kind()]; fn != nil {
+		return fn
+	}
+	return w.defltFn
+}
+
+// compileRepeated resolves the overrides for a repeated field as a whole.
+func (w *walker) compileRepeated(fp *fieldPlan) {
+	override, indexed := w.repOverrides.resolve(fp.name)
+	if override != nil {
+		fp.repOverride = override.(ContextOverrideFunc)
+	}
+	fp.indexedRepOverrides = indexed
+	switch fp.fd.Kind() {
+	case protoreflect.MessageKind:
+		fp.repTypeOverride = w.repTypeOverrides[string(fp.fd.Message().FullName())]
+	case protoreflect.EnumKind:
+		fp.repTypeOverride = w.repTypeOverrides[string(fp.fd.Enum().FullName())]
+	}
+}
+
+// messagePlan returns the plan for the message type of a message field,
+// creating it on first use.
+func (fp *fieldPlan) messagePlan(w *walker) *messagePlan {
+	fp.once.Do(func() {
+		fp.message = w.compileMessage(fp.fd.Message(), fp.name)
+	})
+	return fp.message
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms/dialect"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// A RowConverter converts messages into rows for the tables created by a
+// SchemaConverter with the same options. It is safe for concurrent use by
+// multiple goroutines.
+//
+// Values are in column order and of types that pgx encodes for their
+// columns: jsonb columns hold a json.RawMessage, arrays hold typed slices and
+// composite types hold an []interface{} of their attributes. Composite and
+// enum types must be registered with the connection. Unknown enum values
+// result in an error, unless they are held in a jsonb column.
+type RowConverter interface {
+	Apply(m proto.Message) ([]interface{}, error)
+}
+
+// NewRowConverter creates a new RowConverter. OptionTableName does not apply.
+func NewRowConverter(options ...Option) RowConverter {
+	c := newConfig(options)
+	return dialect.NewRowConverter(newDialect(c), newDialectOptions(c)...)
+}
+
+func convertRowScalar(fd protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		// enum columns cannot hold unknown values; jsonb holds their number
+		return v.Enum()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		// bigint
+		return int64(v.Uint())
+	}
+	return v.Interface()
+}
+
+// A CopySource provides the rows of messages to pgx.CopyFrom, implementing
+// pgx.CopyFromSource.
+type CopySource struct {
+	rc  RowConverter
+	ms  []proto.Message
+	i   int
+	row []interface{}
+	err error
+}
+
+// NewCopySource creates a new CopySource for the messages. They should all be
+// of the same type.
+func NewCopySource(rc RowConverter, ms []proto.Message) *CopySource {
+	return &CopySource{rc: rc, ms: ms}
+}
+
+// Next converts the next message, returning false when there are no more
+// messages or when conversion fails.
+func (s *CopySource) Next() bool {
+	if s.err != nil || s.i >= len(s.ms) {
+		return false
+	}
+	s.row, s.err = s.rc.Apply(s.ms[s.i])
+	s.i += 1
+	return s.err == nil
+}
+
+// Values returns the current row.
+func (s *CopySource) Values() ([]interface{}, error) {
+	return s.row, s.err
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (s *CopySource) Err() error {
+	return s.err
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package postgres
+
+import (
+	"encoding/json"
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const fullEvent = `{
+  "id": "1",
+  "name": "a",
+  "flag": true,
+  "ratio": 0.5,
+  "count": 4294967295,
+  "status": "ACTIVE",
+  "tags": ["x", "y"],
+  "attrs": {"b": "2", "a": "1"},
+  "children": [{"id": "2"}],
+  "parent": {"name": "p"},
+  "created": "1970-01-01T00:00:01.000002Z",
+  "alias": "q",
+  "place": {"lat": 1.5, "seen": ["1970-01-01T00:00:02Z"]},
+  "stops": [{"status": "ACTIVE"}],
+  "states": ["ACTIVE", "UNKNOWN"]
+}`
+
+func TestRowConverter(t *testing.T) {
+	created := time.Unix(1, 2000).UTC()
+	seen := time.Unix(2, 0).UTC()
+
+	cases := []struct {
+		options  []Option
+		input    string
+		expected []interface{}
+		name     string
+	}{
+		{
+			nil,
+			fullEvent,
+			[]interface{}{
+				int64(1), "a", true, float32(0.5), int64(4294967295), "ACTIVE",
+				[]string{"x", "y"},
+				json.RawMessage(`{"a":1,"b":2}`),
+				json.RawMessage(`[{"id":2}]`),
+				json.RawMessage(`{"name":"p"}`),
+				created,
+				"q",
+				json.RawMessage(`{"lat":1.5,"seen":["1970-01-01T00:00:02Z"]}`),
+				json.RawMessage(`[{"status":"ACTIVE"}]`),
+				[]string{"ACTIVE", "UNKNOWN"},
+			},
+			"default",
+		},
+		{
+			nil,
+			`{}`,
+			[]interface{}{
+				int64(0), "", false, float32(0), int64(0), "UNKNOWN",
+				[]string{},
+				json.RawMessage(`{}`),
+				json.RawMessage(`[]`),
+				nil,
+				nil,
+				nil,
+				nil,
+				json.RawMessage(`[]`),
+				[]string{},
+			},
+			"empty",
+		},
+		{
+			[]Option{OptionMessageMapping(MessagesAsComposite)},
+			fullEvent,
+			[]interface{}{
+				int64(1), "a", true, float32(0.5), int64(4294967295), "ACTIVE",
+				[]string{"x", "y"},
+				json.RawMessage(`{"a":1,"b":2}`),
+				json.RawMessage(`[{"id":2}]`),
+				json.RawMessage(`{"name":"p"}`),
+				created,
+				"q",
+				[]interface{}{1.5, "UNKNOWN", []time.Time{seen}},
+				[]interface{}{[]interface{}{float64(0), "ACTIVE", []time.Time{}}},
+				[]string{"ACTIVE", "UNKNOWN"},
+			},
+			"composite",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := NewRowConverter(c.options...).Apply(testpb.NewEvent(t, c.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRowConverter_UnknownEnum(t *testing.T) {
+	cases := []struct {
+		options []Option
+		input   string
+		name    string
+	}{
+		{nil, `{"status": 99}`, "field"},
+		{nil, `{"states": ["ACTIVE", 99]}`, "list item"},
+		{[]Option{OptionMessageMapping(MessagesAsComposite)}, `{"place": {"status": 99}}`, "composite"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := NewRowConverter(c.options...).Apply(testpb.NewEvent(t, c.input)); err == nil {
+				t.Errorf("%s: expected error", c.name)
+			}
+		})
+	}
+
+	actual, err := NewRowConverter().Apply(testpb.NewEvent(t, `{"stops": [{"status": 99}]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := json.RawMessage(`[{"status":99}]`); !reflect.DeepEqual(actual[13], expected) {
+		t.Errorf("\nexpected %s, \ngot      %s", expected, actual[13])
+	}
+}
+
+func TestCopySource(t *testing.T) {
+	ms := []proto.Message{testpb.NewEvent(t, `{"id": "1"}`), testpb.NewEvent(t, `{"id": "2"}`)}
+
+	s := NewCopySource(NewRowConverter(), ms)
+	var ids []interface{}
+	for s.Next() {
+		row, err := s.Values()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ids = append(ids, row[0])
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []interface{}{int64(1), int64(2)}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("\nexpected %v, \ngot      %v", expected, ids)
+	}
+}
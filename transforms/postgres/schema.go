@@ -0,0 +1,274 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package postgres converts message descriptors into PostgreSQL tables and
+// messages into rows for them.
+//
+// Scalars map to their native types. Unsigned 64-bit integers map to
+// numeric(20). Repeated scalars map to arrays, maps to jsonb and
+// google.protobuf.Timestamp to timestamptz. Nested messages map to jsonb or to
+// composite types (see OptionMessageMapping); recursive message types always
+// map to jsonb. Enums map to text with a CHECK constraint or to enum types (see
+// OptionEnumMapping), holding the value's name.
+//
+// Columns of fields that track presence (message fields, oneof members and
+// optional fields) are nullable; other columns are NOT NULL and hold their
+// default value when unset.
+//
+// Types are named after the full names of their messages or enums, in lower
+// case and with dots replaced by underscores.
+package postgres
+
+import (
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms/dialect"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	timestampName = "google.protobuf.Timestamp"
+
+	// maxDepth is the Walker's default, as message types that could exceed
+	// it are stored as jsonb
+	maxDepth = 99
+)
+
+// A MessageMapping determines how nested messages are stored.
+type MessageMapping int
+
+const (
+	// MessagesAsJSONB stores nested messages as jsonb. This is the default.
+	MessagesAsJSONB = MessageMapping(iota)
+	// MessagesAsComposite stores nested messages as composite types.
+	MessagesAsComposite
+)
+
+// An EnumMapping determines how enums are stored.
+type EnumMapping int
+
+const (
+	// EnumsAsCheck stores enums as text with a CHECK constraint on their
+	// names. This is the default. Attributes of composite types cannot have
+	// constraints and are stored as text.
+	EnumsAsCheck = EnumMapping(iota)
+	// EnumsAsType stores enums as enum types.
+	EnumsAsType
+)
+
+type config struct {
+	messages  MessageMapping
+	enums     EnumMapping
+	tableName string
+}
+
+type Option interface {
+	// Apply applies the Option to the converter.
+	Apply(c *config)
+}
+
+type optionMessageMapping struct {
+	value MessageMapping
+}
+
+func (o *optionMessageMapping) Apply(c *config) {
+	c.messages = o.value
+}
+
+// OptionMessageMapping sets how nested messages are stored. Defaults to
+// MessagesAsJSONB.
+func OptionMessageMapping(v MessageMapping) Option {
+	if v != MessagesAsJSONB && v != MessagesAsComposite {
+		panic(fmt.Sprintf("unknown message mapping %d", v))
+	}
+	return &optionMessageMapping{value: v}
+}
+
+type optionEnumMapping struct {
+	value EnumMapping
+}
+
+func (o *optionEnumMapping) Apply(c *config) {
+	c.enums = o.value
+}
+
+// OptionEnumMapping sets how enums are stored. Defaults to EnumsAsCheck.
+func OptionEnumMapping(v EnumMapping) Option {
+	if v != EnumsAsCheck && v != EnumsAsType {
+		panic(fmt.Sprintf("unknown enum mapping %d", v))
+	}
+	return &optionEnumMapping{value: v}
+}
+
+type optionTableName struct {
+	value string
+}
+
+func (o *optionTableName) Apply(c *config) {
+	c.tableName = o.value
+}
+
+// OptionTableName sets the name of the table. Defaults to the type name of
+// the message.
+func OptionTableName(v string) Option {
+	if v == "" {
+		panic("table name cannot be empty")
+	}
+	return &optionTableName{value: v}
+}
+
+func newConfig(options []Option) *config {
+	c := &config{}
+	for _, o := range options {
+		o.Apply(c)
+	}
+	return c
+}
+
+// newDialect returns the dialect for a configuration.
+func newDialect(c *config) *dialect.Dialect {
+	return &dialect.Dialect{
+		Name: "PostgreSQL",
+		Types: map[protoreflect.Kind]string{
+			protoreflect.BoolKind:     "boolean",
+			protoreflect.EnumKind:     "text",
+			protoreflect.Int32Kind:    "integer",
+			protoreflect.Sint32Kind:   "integer",
+			protoreflect.Sfixed32Kind: "integer",
+			protoreflect.Uint32Kind:   "bigint",
+			protoreflect.Fixed32Kind:  "bigint",
+			protoreflect.Int64Kind:    "bigint",
+			protoreflect.Sint64Kind:   "bigint",
+			protoreflect.Sfixed64Kind: "bigint",
+			protoreflect.Uint64Kind:   "numeric(20)",
+			protoreflect.Fixed64Kind:  "numeric(20)",
+			protoreflect.FloatKind:    "real",
+			protoreflect.DoubleKind:   "double precision",
+			protoreflect.StringKind:   "text",
+			protoreflect.BytesKind:    "bytea",
+		},
+		Timestamp:       "timestamptz",
+		Array:           "%s[]",
+		Field:           "%s %s",
+		NullableStructs: true,
+		NotNull:         " NOT NULL",
+		Quote:           `"`,
+		CreateTable:     "CREATE TABLE %s (\n%s\n)",
+		StructValues:    dialect.StructsAsSlices,
+		ArrayValues:     dialect.ArraysAsTyped,
+		JSON:            "jsonb",
+		CreateEnum:      "CREATE TYPE %s AS ENUM (%s)",
+		CreateStruct:    "CREATE TYPE %s AS (\n%s\n)",
+		TypeName:        TypeName,
+		Mapping: func(fd protoreflect.FieldDescriptor) dialect.Mapping {
+			switch {
+			case fd.IsMap():
+				return dialect.AsJSON
+			case fd.Message() != nil:
+				// a list of messages is stored as a single JSON array
+				if c.messages == MessagesAsComposite && !dialect.IsRecursive(fd.Message()) {
+					return dialect.AsType
+				}
+				return dialect.AsJSON
+			case fd.Enum() != nil && c.enums == EnumsAsType:
+				return dialect.AsType
+			}
+			return dialect.Native
+		},
+		Check: func(fd protoreflect.FieldDescriptor) string {
+			if fd.Enum() == nil || c.enums != EnumsAsCheck {
+				return ""
+			}
+			return enumCheck(fd)
+		},
+		Scalar: convertRowScalar,
+	}
+}
+
+func newDialectOptions(c *config) []dialect.Option {
+	options := []dialect.Option{dialect.OptionMaxDepth(maxDepth)}
+	if c.tableName != "" {
+		options = append(options, dialect.OptionTableName(c.tableName))
+	}
+	return options
+}
+
+// A Table is the PostgreSQL table for a message type. Its Types are the enum
+// and composite types it uses, in order of creation. Insert overrides that of
+// dialect.Table, whose ? placeholders PostgreSQL does not accept.
+type Table struct {
+	*dialect.Table
+}
+
+// DDL returns the CREATE TYPE statements for the types of the table, followed
+// by its CREATE TABLE statement.
+func (t *Table) DDL() string {
+	return strings.Join(t.Statements(), ";\n") + ";\n"
+}
+
+// Insert returns an INSERT statement for the table, with a numbered
+// placeholder ($1, $2, ...) per column, as expected by PostgreSQL.
+func (t *Table) Insert() string {
+	names := make([]string, len(t.Columns))
+	params := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		names[i] = quoteIdent(c.Name)
+		params[i] = "$" + strconv.Itoa(i+1)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdent(t.Name), strings.Join(names, ", "), strings.Join(params, ", "))
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func quoteLiteral(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `''`) + `'`
+}
+
+// TypeName returns the name of the type for a message or enum.
+func TypeName(d protoreflect.Descriptor) string {
+	return strings.ToLower(strings.ReplaceAll(string(d.FullName()), ".", "_"))
+}
+
+// A SchemaConverter converts message descriptors into PostgreSQL tables. It is
+// safe for concurrent use by multiple goroutines.
+type SchemaConverter interface {
+	Apply(md protoreflect.MessageDescriptor) *Table
+}
+
+type schemaConverter struct {
+	config *config
+	sc     dialect.SchemaConverter
+}
+
+// NewSchemaConverter creates a new SchemaConverter.
+func NewSchemaConverter(options ...Option) SchemaConverter {
+	c := newConfig(options)
+	return &schemaConverter{
+		config: c,
+		sc:     dialect.NewSchemaConverter(newDialect(c), newDialectOptions(c)...),
+	}
+}
+
+func (sc *schemaConverter) Apply(md protoreflect.MessageDescriptor) *Table {
+	t := &Table{Table: sc.sc.Apply(md)}
+	if sc.config.tableName == "" {
+		t.Name = TypeName(md)
+	}
+	return t
+}
+
+func enumCheck(fd protoreflect.FieldDescriptor) string {
+	values := fd.Enum().Values()
+	names := make([]string, values.Len())
+	for i := range names {
+		names[i] = quoteLiteral(string(values.Get(i).Name()))
+	}
+	if fd.IsList() {
+		return fmt.Sprintf("%s <@ ARRAY[%s]", quoteIdent(string(fd.Name())), strings.Join(names, ", "))
+	}
+	return fmt.Sprintf("%s IN (%s)", quoteIdent(string(fd.Name())), strings.Join(names, ", "))
+}
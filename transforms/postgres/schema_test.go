@@ -0,0 +1,87 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package postgres
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"testing"
+)
+
+func TestSchemaConverter(t *testing.T) {
+	event := (&testpb.Event{}).ProtoReflect().Descriptor()
+
+	cases := []struct {
+		options  []Option
+		expected string
+		name     string
+	}{
+		{
+			nil,
+			`CREATE TABLE "test_event" (
+  "id" bigint NOT NULL,
+  "name" text NOT NULL,
+  "flag" boolean NOT NULL,
+  "ratio" real NOT NULL,
+  "count" bigint NOT NULL,
+  "status" text NOT NULL CHECK ("status" IN ('UNKNOWN', 'ACTIVE')),
+  "tags" text[] NOT NULL,
+  "attrs" jsonb NOT NULL,
+  "children" jsonb NOT NULL,
+  "parent" jsonb,
+  "created" timestamptz,
+  "alias" text,
+  "place" jsonb,
+  "stops" jsonb NOT NULL,
+  "states" text[] NOT NULL CHECK ("states" <@ ARRAY['UNKNOWN', 'ACTIVE'])
+);
+`,
+			"default",
+		},
+		{
+			[]Option{OptionMessageMapping(MessagesAsComposite), OptionEnumMapping(EnumsAsType), OptionTableName("events")},
+			`CREATE TYPE "test_status" AS ENUM ('UNKNOWN', 'ACTIVE');
+CREATE TYPE "test_place" AS (
+  "lat" double precision,
+  "status" "test_status",
+  "seen" timestamptz[]
+);
+CREATE TABLE "events" (
+  "id" bigint NOT NULL,
+  "name" text NOT NULL,
+  "flag" boolean NOT NULL,
+  "ratio" real NOT NULL,
+  "count" bigint NOT NULL,
+  "status" "test_status" NOT NULL,
+  "tags" text[] NOT NULL,
+  "attrs" jsonb NOT NULL,
+  "children" jsonb NOT NULL,
+  "parent" jsonb,
+  "created" timestamptz,
+  "alias" text,
+  "place" "test_place",
+  "stops" "test_place"[] NOT NULL,
+  "states" "test_status"[] NOT NULL
+);
+`,
+			"composite and enum types",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := NewSchemaConverter(c.options...).Apply(event).DDL()
+			if actual != c.expected {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTable_Insert(t *testing.T) {
+	table := NewSchemaConverter(OptionTableName("events")).Apply((&testpb.Event{}).ProtoReflect().Descriptor())
+	expected := `INSERT INTO "events" ("id", "name", "flag", "ratio", "count", "status", "tags", "attrs", "children", "parent", "created", "alias", "place", "stops", "states") ` +
+		`VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+	if actual := table.Insert(); actual != expected {
+		t.Errorf("\nexpected %v, \ngot      %v", expected, actual)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package spanner
+
+import (
+	"cloud.google.com/go/spanner"
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"github.com/HayoVanLoon/go-proto/transforms/dialect"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"sync"
+)
+
+// A RowConverter converts messages into mutations for the tables created by a
+// SchemaConverter with the same options. It is safe for concurrent use by
+// multiple goroutines.
+//
+// A message yields a mutation for its row, followed by the mutations for the
+// rows of its child tables. Unless the Op is Insert, each child table's rows
+// are first deleted by a mutation for the row's key range, so that no stale
+// rows remain when a list has shrunk; the rows are then inserted anew.
+type RowConverter interface {
+	Apply(m proto.Message) ([]*spanner.Mutation, error)
+}
+
+type rowConverter struct {
+	sc     SchemaConverter
+	rc     dialect.RowConverter
+	op     Op
+	tables sync.Map
+}
+
+// NewRowConverter creates a new RowConverter. OptionPrimaryKey is required.
+func NewRowConverter(options ...Option) RowConverter {
+	c := newConfig(options)
+	return &rowConverter{
+		sc: NewSchemaConverter(options...),
+		rc: dialect.NewRowConverter(newDialect(c), dialect.OptionMaxDepth(maxDepth)),
+		op: c.op,
+	}
+}
+
+// ApplyBatch converts a batch of messages into mutations, using the given
+// number of goroutines. The Value of each Result is a []*spanner.Mutation.
+// See transforms.ApplyBatch.
+func ApplyBatch(rc RowConverter, ms []proto.Message, workers int) []transforms.Result {
+	return transforms.ApplyBatchFunc(applyFunc(rc), ms, workers)
+}
+
+func applyFunc(rc RowConverter) transforms.BatchFunc {
+	return func(m proto.Message) (interface{}, error) {
+		return rc.Apply(m)
+	}
+}
+
+func convertRowScalar(fd protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		return int64(v.Enum())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return v.Int()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return int64(v.Uint())
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return v.Float()
+	}
+	return v.Interface()
+}
+
+func (rc *rowConverter) table(md protoreflect.MessageDescriptor) (*Table, error) {
+	if t, ok := rc.tables.Load(md.FullName()); ok {
+		return t.(*Table), nil
+	}
+	t, err := rc.sc.Apply(md)
+	if err != nil {
+		return nil, err
+	}
+	x, _ := rc.tables.LoadOrStore(md.FullName(), t)
+	return x.(*Table), nil
+}
+
+func (rc *rowConverter) Apply(m proto.Message) ([]*spanner.Mutation, error) {
+	t, err := rc.table(m.ProtoReflect().Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	values, err := rc.rc.Apply(m)
+	if err != nil {
+		return nil, err
+	}
+	row := make(map[string]interface{}, len(values))
+	for i, name := range t.source.ColumnNames() {
+		row[name] = values[i]
+	}
+	return rc.mutations(nil, t, row, nil, rc.op)
+}
+
+// mutations appends the mutations for a row of a table and the rows of its
+// children. The row holds the values of the dialect, with structs as maps.
+// The keys hold the primary key of the parent row, followed by the row's
+// position.
+func (rc *rowConverter) mutations(out []*spanner.Mutation, t *Table, row map[string]interface{}, keys []interface{}, op Op) ([]*spanner.Mutation, error) {
+	values := make([]interface{}, len(t.Columns))
+	byName := map[string]interface{}{}
+	for i, c := range t.Columns {
+		var v interface{}
+		switch c.kind {
+		case parentKeyColumn, indexColumn:
+			v = keys[i]
+		default:
+			v = c.value(row)
+		}
+		values[i] = v
+		byName[c.Name] = v
+	}
+	out = append(out, mutation(op, t.Name, t.ColumnNames(), values))
+
+	// deleting the child rows of a root row deletes their descendants, too
+	deleteChildren := t.Parent == "" && op != Insert
+	childOp := op
+	if deleteChildren && op == Update {
+		childOp = Insert
+	}
+	for _, child := range t.Children {
+		var parentKeys []interface{}
+		for _, k := range t.PrimaryKey {
+			parentKeys = append(parentKeys, byName[k])
+		}
+		if deleteChildren {
+			out = append(out, spanner.Delete(child.Name, spanner.Key(parentKeys).AsPrefix()))
+		}
+		items, _ := lookup(row, child.path).([]interface{})
+		for i, item := range items {
+			x, _ := item.(map[string]interface{})
+			ks := append(parentKeys[:len(parentKeys):len(parentKeys)], int64(i))
+			var err error
+			if out, err = rc.mutations(out, child, x, ks, childOp); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+func mutation(op Op, table string, columns []string, values []interface{}) *spanner.Mutation {
+	switch op {
+	case Insert:
+		return spanner.Insert(table, columns, values)
+	case Update:
+		return spanner.Update(table, columns, values)
+	case Replace:
+		return spanner.Replace(table, columns, values)
+	}
+	return spanner.InsertOrUpdate(table, columns, values)
+}
+
+// lookup returns the value at a path, or nil if any message on it is unset.
+func lookup(row map[string]interface{}, path []string) interface{} {
+	var v interface{} = row
+	for _, p := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[p]
+	}
+	return v
+}
+
+// value returns the value of the column in a row.
+func (c *Column) value(row map[string]interface{}) interface{} {
+	// the column is null when a flattened message on its path is unset
+	parent, ok := lookup(row, c.path[:len(c.path)-1]).(map[string]interface{})
+	if !ok {
+		if c.kind == jsonColumn {
+			return spanner.NullJSON{}
+		}
+		return nil
+	}
+	return parent[c.path[len(c.path)-1]]
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package spanner
+
+import (
+	"cloud.google.com/go/spanner"
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const fullEvent = `{
+  "id": "1",
+  "name": "a",
+  "flag": true,
+  "ratio": 0.5,
+  "count": 4294967295,
+  "status": "ACTIVE",
+  "tags": ["x", "y"],
+  "attrs": {"b": "2", "a": "1"},
+  "children": [{"id": "2"}],
+  "parent": {"name": "p"},
+  "created": "1970-01-01T00:00:01.000002Z",
+  "alias": "q",
+  "place": {"lat": 1.5, "seen": ["1970-01-01T00:00:02Z"]},
+  "stops": [{"status": "ACTIVE"}, {"lat": 2.5}],
+  "states": ["ACTIVE", "UNKNOWN"]
+}`
+
+func TestRowConverter(t *testing.T) {
+	created := time.Unix(1, 2000).UTC()
+	seen := time.Unix(2, 0).UTC()
+	eventColumns := []string{"id", "name", "flag", "ratio", "count", "status", "tags", "attrs", "children",
+		"parent", "created", "alias", "place_lat", "place_status", "place_seen", "states"}
+	stopsColumns := []string{"id", "stops_index", "lat", "status", "seen"}
+	attrs := spanner.NullJSON{Value: map[string]interface{}{"a": int64(1), "b": int64(2)}, Valid: true}
+	children := spanner.NullJSON{Value: []interface{}{map[string]interface{}{"id": int64(2)}}, Valid: true}
+	parent := spanner.NullJSON{Value: map[string]interface{}{"name": "p"}, Valid: true}
+
+	full := testpb.NewEvent(t, fullEvent)
+	place := full.GetPlace()
+	placeBytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(place)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		options  []Option
+		input    proto.Message
+		expected []*spanner.Mutation
+		name     string
+	}{
+		{
+			[]Option{OptionPrimaryKey("id")},
+			full,
+			[]*spanner.Mutation{
+				spanner.InsertOrUpdate("Event", eventColumns, []interface{}{
+					int64(1), "a", true, 0.5, int64(4294967295), int64(1), []string{"x", "y"}, attrs, children,
+					parent, created, "q", 1.5, int64(0), []time.Time{seen}, []int64{1, 0},
+				}),
+				spanner.Delete("Event_stops", spanner.Key{int64(1)}.AsPrefix()),
+				spanner.InsertOrUpdate("Event_stops", stopsColumns, []interface{}{
+					int64(1), int64(0), float64(0), int64(1), []time.Time{},
+				}),
+				spanner.InsertOrUpdate("Event_stops", stopsColumns, []interface{}{
+					int64(1), int64(1), 2.5, int64(0), []time.Time{},
+				}),
+			},
+			"flattened",
+		},
+		{
+			[]Option{OptionPrimaryKey("id"), OptionOp(Replace)},
+			testpb.NewEvent(t, `{}`),
+			[]*spanner.Mutation{
+				spanner.Replace("Event", eventColumns, []interface{}{
+					int64(0), "", false, float64(0), int64(0), int64(0), []string{},
+					spanner.NullJSON{Value: map[string]interface{}{}, Valid: true},
+					spanner.NullJSON{Value: []interface{}{}, Valid: true},
+					spanner.NullJSON{}, nil, nil, nil, nil, nil, []int64{},
+				}),
+				spanner.Delete("Event_stops", spanner.Key{int64(0)}.AsPrefix()),
+			},
+			"empty",
+		},
+		{
+			[]Option{OptionPrimaryKey("id"), OptionOp(Update)},
+			testpb.NewEvent(t, `{"id": "1", "stops": [{"lat": 2.5}]}`),
+			[]*spanner.Mutation{
+				spanner.Update("Event", eventColumns, []interface{}{
+					int64(1), "", false, float64(0), int64(0), int64(0), []string{},
+					spanner.NullJSON{Value: map[string]interface{}{}, Valid: true},
+					spanner.NullJSON{Value: []interface{}{}, Valid: true},
+					spanner.NullJSON{}, nil, nil, nil, nil, nil, []int64{},
+				}),
+				spanner.Delete("Event_stops", spanner.Key{int64(1)}.AsPrefix()),
+				spanner.Insert("Event_stops", stopsColumns, []interface{}{
+					int64(1), int64(0), 2.5, int64(0), []time.Time{},
+				}),
+			},
+			"update",
+		},
+		{
+			[]Option{OptionPrimaryKey("id"), OptionOp(Insert)},
+			testpb.NewEvent(t, `{"id": "1", "stops": [{"lat": 2.5}]}`),
+			[]*spanner.Mutation{
+				spanner.Insert("Event", eventColumns, []interface{}{
+					int64(1), "", false, float64(0), int64(0), int64(0), []string{},
+					spanner.NullJSON{Value: map[string]interface{}{}, Valid: true},
+					spanner.NullJSON{Value: []interface{}{}, Valid: true},
+					spanner.NullJSON{}, nil, nil, nil, nil, nil, []int64{},
+				}),
+				spanner.Insert("Event_stops", stopsColumns, []interface{}{
+					int64(1), int64(0), 2.5, int64(0), []time.Time{},
+				}),
+			},
+			"insert",
+		},
+		{
+			[]Option{OptionPrimaryKey("id"), OptionMessageMapping(MessagesAsProto), OptionEnumMapping(EnumsAsProto)},
+			testpb.NewEvent(t, `{"id": "1", "place": {"lat": 1.5, "seen": ["1970-01-01T00:00:02Z"]}}`),
+			[]*spanner.Mutation{
+				spanner.InsertOrUpdate("Event", []string{"id", "name", "flag", "ratio", "count", "status", "tags", "attrs",
+					"children", "parent", "created", "alias", "place", "stops", "states"}, []interface{}{
+					int64(1), "", false, float64(0), int64(0), int64(0), []string{},
+					spanner.NullJSON{Value: map[string]interface{}{}, Valid: true},
+					[][]byte{}, nil, nil, nil, placeBytes, [][]byte{}, []int64{},
+				}),
+			},
+			"proto",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := NewRowConverter(c.options...).Apply(c.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestApplyBatch(t *testing.T) {
+	ms := []proto.Message{testpb.NewEvent(t, `{"id": "1"}`), testpb.NewEvent(t, `{"id": "2"}`)}
+	rc := NewRowConverter(OptionPrimaryKey("id"), OptionMessageMapping(MessagesAsJSON))
+
+	for i, r := range ApplyBatch(rc, ms, 2) {
+		if r.Err != nil {
+			t.Fatalf("unexpected error: %v", r.Err)
+		}
+		expected, _ := rc.Apply(ms[i])
+		if !reflect.DeepEqual(r.Value, expected) {
+			t.Errorf("\nexpected %v, \ngot      %v", expected, r.Value)
+		}
+	}
+}
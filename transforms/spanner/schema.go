@@ -0,0 +1,252 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package spanner
+
+import (
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms/dialect"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+)
+
+type columnKind int
+
+const (
+	scalarColumn = columnKind(iota)
+	arrayColumn
+	jsonColumn
+	protoColumn
+	// parentKeyColumn is a primary key column of the parent of a child table
+	parentKeyColumn
+	// indexColumn holds the position of a child table's row in its list
+	indexColumn
+)
+
+// A Column is a column of a table.
+type Column struct {
+	Name    string
+	Type    string
+	NotNull bool
+
+	kind columnKind
+	fd   protoreflect.FieldDescriptor
+	// path holds the names of the fields leading to the value, starting at
+	// the message of the table
+	path []string
+}
+
+// A Table is the Spanner table for a message type or for a repeated message
+// field.
+type Table struct {
+	Name       string
+	Columns    []*Column
+	PrimaryKey []string
+	// Parent is the name of the table this table is interleaved in, if any.
+	Parent   string
+	Children []*Table
+	// ProtoTypes holds the full names of the types in PROTO and ENUM columns
+	// of the table and its children, in order of appearance.
+	ProtoTypes []string
+
+	// path holds the names of the fields leading to the repeated field of a
+	// child table, starting at the message of its parent
+	path []string
+	// source is the table of the dialect, for root tables
+	source *dialect.Table
+}
+
+// ColumnNames returns the names of the columns, in column order.
+func (t *Table) ColumnNames() []string {
+	out := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		out[i] = c.Name
+	}
+	return out
+}
+
+// Statements returns the DDL statements that create the table and its child
+// tables, preceded by a CREATE PROTO BUNDLE statement if the tables use
+// PROTO or ENUM columns.
+func (t *Table) Statements() []string {
+	var out []string
+	if len(t.ProtoTypes) > 0 {
+		out = append(out, "CREATE PROTO BUNDLE (\n  "+strings.Join(t.ProtoTypes, ",\n  ")+"\n)")
+	}
+	return t.appendStatements(out)
+}
+
+func (t *Table) appendStatements(out []string) []string {
+	sb := &strings.Builder{}
+	sb.WriteString("CREATE TABLE ")
+	sb.WriteString(t.Name)
+	sb.WriteString(" (\n")
+	for i, c := range t.Columns {
+		if i > 0 {
+			sb.WriteString(",\n")
+		}
+		sb.WriteString("  ")
+		sb.WriteString(c.Name)
+		sb.WriteString(" ")
+		sb.WriteString(c.Type)
+		if c.NotNull {
+			sb.WriteString(" NOT NULL")
+		}
+	}
+	sb.WriteString("\n) PRIMARY KEY (")
+	sb.WriteString(strings.Join(t.PrimaryKey, ", "))
+	sb.WriteString(")")
+	if t.Parent != "" {
+		sb.WriteString(",\n  INTERLEAVE IN PARENT ")
+		sb.WriteString(t.Parent)
+		sb.WriteString(" ON DELETE CASCADE")
+	}
+	out = append(out, sb.String())
+	for _, c := range t.Children {
+		out = c.appendStatements(out)
+	}
+	return out
+}
+
+// A SchemaConverter converts message descriptors into Spanner tables. It is
+// safe for concurrent use by multiple goroutines.
+//
+// Apply returns an error when a primary key path does not name a scalar
+// column, or when flattening yields duplicate column names, as with a field
+// meta_id next to a message field meta holding an id.
+type SchemaConverter interface {
+	Apply(md protoreflect.MessageDescriptor) (*Table, error)
+}
+
+type schemaConverter struct {
+	config *config
+	sc     dialect.SchemaConverter
+}
+
+// NewSchemaConverter creates a new SchemaConverter. OptionPrimaryKey is
+// required; OptionOp does not apply.
+func NewSchemaConverter(options ...Option) SchemaConverter {
+	c := newConfig(options)
+	return &schemaConverter{
+		config: c,
+		sc:     dialect.NewSchemaConverter(newDialect(c), dialect.OptionMaxDepth(maxDepth)),
+	}
+}
+
+func (sc *schemaConverter) Apply(md protoreflect.MessageDescriptor) (*Table, error) {
+	source := sc.sc.Apply(md)
+	t := &Table{Name: sc.config.tableName, ProtoTypes: source.ProtoTypes, source: source}
+	if t.Name == "" {
+		t.Name = string(md.Name())
+	}
+	r := &resolver{}
+	if err := r.columns(t, source.Columns, "", nil, false); err != nil {
+		return nil, err
+	}
+	for _, p := range sc.config.primaryKey {
+		c, err := keyColumn(t, p)
+		if err != nil {
+			return nil, err
+		}
+		t.PrimaryKey = append(t.PrimaryKey, c.Name)
+	}
+	if err := r.resolveChildren(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// keyColumn returns the column for a primary key path.
+func keyColumn(t *Table, path string) (*Column, error) {
+	for _, c := range t.Columns {
+		if strings.Join(c.path, ".") != path {
+			continue
+		}
+		if c.kind == scalarColumn {
+			return c, nil
+		}
+		break
+	}
+	return nil, fmt.Errorf("invalid primary key field %q", path)
+}
+
+// A resolver flattens the columns of the dialect into those of a table and
+// its child tables.
+type resolver struct {
+	// pending holds the child tables that have yet to be resolved, with
+	// the fields of their items
+	pending []pendingTable
+}
+
+type pendingTable struct {
+	parent *Table
+	child  *Table
+	fields []dialect.Column
+}
+
+// columns adds the columns for the fields of a message, flattening nested
+// messages. The columns of messages are nullable.
+func (r *resolver) columns(t *Table, cs []dialect.Column, prefix string, path []string, nullable bool) error {
+	for _, dc := range cs {
+		fd := dc.Field
+		name := prefix + dc.Name
+		p := append(path[:len(path):len(path)], dc.Name)
+		// only flattened messages have fields
+		switch {
+		case dc.Fields != nil && fd.IsList():
+			child := &Table{Name: t.Name + "_" + name, Parent: t.Name, path: p}
+			r.pending = append(r.pending, pendingTable{parent: t, child: child, fields: dc.Fields})
+			continue
+		case dc.Fields != nil:
+			if err := r.columns(t, dc.Fields, name+"_", p, true); err != nil {
+				return err
+			}
+			continue
+		}
+		c := &Column{Name: name, Type: dc.Type, NotNull: !nullable && dc.NotNull, fd: fd, path: p}
+		switch {
+		case dc.Mapping == dialect.AsJSON:
+			c.kind = jsonColumn
+		case dc.Mapping == dialect.AsProto:
+			c.kind = protoColumn
+		case fd.IsList():
+			c.kind = arrayColumn
+		}
+		for _, x := range t.Columns {
+			if x.Name == c.Name {
+				return fmt.Errorf("duplicate column %s in table %s", c.Name, t.Name)
+			}
+		}
+		t.Columns = append(t.Columns, c)
+	}
+	return nil
+}
+
+// resolveChildren resolves the pending child tables, which start with the
+// primary key of their parent and the position in their list.
+func (r *resolver) resolveChildren(t *Table) error {
+	pending := r.pending
+	r.pending = nil
+	for _, p := range pending {
+		child := p.child
+		for _, k := range p.parent.PrimaryKey {
+			for _, c := range p.parent.Columns {
+				if c.Name == k {
+					child.Columns = append(child.Columns, &Column{Name: k, Type: c.Type, NotNull: c.NotNull, kind: parentKeyColumn})
+				}
+			}
+		}
+		index := &Column{Name: strings.Join(child.path, "_") + "_index", Type: "INT64", NotNull: true, kind: indexColumn}
+		child.Columns = append(child.Columns, index)
+		child.PrimaryKey = append(append([]string(nil), p.parent.PrimaryKey...), index.Name)
+		if err := r.columns(child, p.fields, "", nil, false); err != nil {
+			return err
+		}
+		p.parent.Children = append(p.parent.Children, child)
+		if err := r.resolveChildren(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
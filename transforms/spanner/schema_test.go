@@ -0,0 +1,182 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package spanner
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"reflect"
+	"testing"
+)
+
+func field(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, type_ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+	f := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    label.Enum(),
+		Type:     type_.Enum(),
+	}
+	if typeName != "" {
+		f.TypeName = proto.String(typeName)
+	}
+	return f
+}
+
+func TestSchemaConverter(t *testing.T) {
+	event := (&testpb.Event{}).ProtoReflect().Descriptor()
+
+	cases := []struct {
+		options  []Option
+		expected []string
+		name     string
+	}{
+		{
+			[]Option{OptionPrimaryKey("id")},
+			[]string{
+				`CREATE TABLE Event (
+  id INT64 NOT NULL,
+  name STRING(MAX) NOT NULL,
+  flag BOOL NOT NULL,
+  ratio FLOAT64 NOT NULL,
+  count INT64 NOT NULL,
+  status INT64 NOT NULL,
+  tags ARRAY<STRING(MAX)> NOT NULL,
+  attrs JSON NOT NULL,
+  children JSON NOT NULL,
+  parent JSON,
+  created TIMESTAMP,
+  alias STRING(MAX),
+  place_lat FLOAT64,
+  place_status INT64,
+  place_seen ARRAY<TIMESTAMP>,
+  states ARRAY<INT64> NOT NULL
+) PRIMARY KEY (id)`,
+				`CREATE TABLE Event_stops (
+  id INT64 NOT NULL,
+  stops_index INT64 NOT NULL,
+  lat FLOAT64 NOT NULL,
+  status INT64 NOT NULL,
+  seen ARRAY<TIMESTAMP> NOT NULL
+) PRIMARY KEY (id, stops_index),
+  INTERLEAVE IN PARENT Event ON DELETE CASCADE`,
+			},
+			"flattened",
+		},
+		{
+			[]Option{OptionPrimaryKey("id", "name"), OptionMessageMapping(MessagesAsJSON), OptionTableName("events")},
+			[]string{
+				`CREATE TABLE events (
+  id INT64 NOT NULL,
+  name STRING(MAX) NOT NULL,
+  flag BOOL NOT NULL,
+  ratio FLOAT64 NOT NULL,
+  count INT64 NOT NULL,
+  status INT64 NOT NULL,
+  tags ARRAY<STRING(MAX)> NOT NULL,
+  attrs JSON NOT NULL,
+  children JSON NOT NULL,
+  parent JSON,
+  created TIMESTAMP,
+  alias STRING(MAX),
+  place JSON,
+  stops JSON NOT NULL,
+  states ARRAY<INT64> NOT NULL
+) PRIMARY KEY (id, name)`,
+			},
+			"json",
+		},
+		{
+			[]Option{OptionPrimaryKey("id"), OptionMessageMapping(MessagesAsProto), OptionEnumMapping(EnumsAsProto)},
+			[]string{
+				`CREATE PROTO BUNDLE (
+  test.Status,
+  test.Event,
+  test.Place
+)`,
+				`CREATE TABLE Event (
+  id INT64 NOT NULL,
+  name STRING(MAX) NOT NULL,
+  flag BOOL NOT NULL,
+  ratio FLOAT64 NOT NULL,
+  count INT64 NOT NULL,
+  status test.Status NOT NULL,
+  tags ARRAY<STRING(MAX)> NOT NULL,
+  attrs JSON NOT NULL,
+  children ARRAY<test.Event> NOT NULL,
+  parent test.Event,
+  created TIMESTAMP,
+  alias STRING(MAX),
+  place test.Place,
+  stops ARRAY<test.Place> NOT NULL,
+  states ARRAY<test.Status> NOT NULL
+) PRIMARY KEY (id)`,
+			},
+			"proto",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			table, err := NewSchemaConverter(c.options...).Apply(event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual := table.Statements(); !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSchemaConverter_Errors(t *testing.T) {
+	const optional = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("collision.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Collision"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("meta", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Meta"),
+				field("meta_id", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+			},
+		}, {
+			Name: proto.String("Meta"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	collision := fd.Messages().ByName("Collision")
+	event := (&testpb.Event{}).ProtoReflect().Descriptor()
+
+	cases := []struct {
+		options []Option
+		input   protoreflect.MessageDescriptor
+		name    string
+	}{
+		{[]Option{OptionPrimaryKey("meta_id")}, collision, "duplicate column"},
+		{[]Option{OptionPrimaryKey("nope")}, event, "unknown key"},
+		{[]Option{OptionPrimaryKey("tags")}, event, "array key"},
+		{[]Option{OptionPrimaryKey("place")}, event, "message key"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := NewSchemaConverter(c.options...).Apply(c.input); err == nil {
+				t.Errorf("%s: expected error", c.name)
+			}
+			m := dynamicpb.NewMessage(c.input)
+			if _, err := NewRowConverter(c.options...).Apply(m); err == nil {
+				t.Errorf("%s: expected error", c.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package spanner converts message descriptors into Cloud Spanner tables and
+// messages into mutations for them.
+//
+// Scalars map to BOOL, INT64, FLOAT64, STRING(MAX) and BYTES(MAX). Unsigned
+// 64-bit integers are stored as INT64, so values beyond its range wrap around.
+// Repeated scalars map to arrays, maps to JSON and google.protobuf.Timestamp
+// to TIMESTAMP. Enums map to INT64 or ENUM columns (see OptionEnumMapping),
+// holding the value's number.
+//
+// Nested messages are flattened into columns by default, their names joined
+// by underscores, while repeated messages are stored in interleaved child
+// tables. Alternatively, they map to JSON or PROTO columns (see
+// OptionMessageMapping). Recursive message types cannot be flattened and map
+// to JSON.
+//
+// Columns of fields that track presence (message fields, oneof members and
+// optional fields) are nullable, as are the columns of flattened messages.
+// Other columns are NOT NULL and hold their default value when unset.
+package spanner
+
+import (
+	"cloud.google.com/go/spanner"
+	"fmt"
+	"github.com/HayoVanLoon/go-proto/transforms/dialect"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// maxDepth is the Walker's default, as message types that could exceed it are
+// stored as JSON
+const maxDepth = 99
+
+// GetSpannerType returns the Spanner type for the values of a scalar field.
+// Enums map to INT64.
+func GetSpannerType(fd protoreflect.FieldDescriptor) string {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return "BOOL"
+	case protoreflect.EnumKind, protoreflect.Int32Kind, protoreflect.Int64Kind,
+		protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+		protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Uint64Kind,
+		protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		return "INT64"
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return "FLOAT64"
+	case protoreflect.StringKind:
+		return "STRING(MAX)"
+	case protoreflect.BytesKind:
+		return "BYTES(MAX)"
+	default:
+		panic(fmt.Sprintf("unsupported type %v", fd.Kind()))
+	}
+}
+
+// A MessageMapping determines how nested messages are stored.
+type MessageMapping int
+
+const (
+	// MessagesFlattened stores nested messages as columns of their parent and
+	// repeated messages in interleaved child tables. This is the default.
+	MessagesFlattened = MessageMapping(iota)
+	// MessagesAsJSON stores nested messages as JSON.
+	MessagesAsJSON
+	// MessagesAsProto stores nested messages in PROTO columns. Their types
+	// need to be in the database's proto bundle.
+	MessagesAsProto
+)
+
+// An EnumMapping determines how enums are stored.
+type EnumMapping int
+
+const (
+	// EnumsAsInt64 stores enums as INT64. This is the default.
+	EnumsAsInt64 = EnumMapping(iota)
+	// EnumsAsProto stores enums in ENUM columns. Their types need to be in the
+	// database's proto bundle.
+	EnumsAsProto
+)
+
+// An Op is the kind of mutation created for a row.
+type Op int
+
+const (
+	// InsertOrUpdate creates spanner.InsertOrUpdate mutations. This is the
+	// default.
+	InsertOrUpdate = Op(iota)
+	Insert
+	Update
+	Replace
+)
+
+type config struct {
+	messages   MessageMapping
+	enums      EnumMapping
+	tableName  string
+	primaryKey []string
+	op         Op
+}
+
+type Option interface {
+	// Apply applies the Option to the converter.
+	Apply(c *config)
+}
+
+type optionMessageMapping struct {
+	value MessageMapping
+}
+
+func (o *optionMessageMapping) Apply(c *config) {
+	c.messages = o.value
+}
+
+// OptionMessageMapping sets how nested messages are stored. Defaults to
+// MessagesFlattened.
+func OptionMessageMapping(v MessageMapping) Option {
+	if v < MessagesFlattened || v > MessagesAsProto {
+		panic(fmt.Sprintf("unknown message mapping %d", v))
+	}
+	return &optionMessageMapping{value: v}
+}
+
+type optionEnumMapping struct {
+	value EnumMapping
+}
+
+func (o *optionEnumMapping) Apply(c *config) {
+	c.enums = o.value
+}
+
+// OptionEnumMapping sets how enums are stored. Defaults to EnumsAsInt64.
+func OptionEnumMapping(v EnumMapping) Option {
+	if v != EnumsAsInt64 && v != EnumsAsProto {
+		panic(fmt.Sprintf("unknown enum mapping %d", v))
+	}
+	return &optionEnumMapping{value: v}
+}
+
+type optionTableName struct {
+	value string
+}
+
+func (o *optionTableName) Apply(c *config) {
+	c.tableName = o.value
+}
+
+// OptionTableName sets the name of the table. Defaults to the name of the
+// message. Child tables are named after their parent table and their field.
+func OptionTableName(v string) Option {
+	if v == "" {
+		panic("table name cannot be empty")
+	}
+	return &optionTableName{value: v}
+}
+
+type optionPrimaryKey struct {
+	value []string
+}
+
+func (o *optionPrimaryKey) Apply(c *config) {
+	c.primaryKey = o.value
+}
+
+// OptionPrimaryKey sets the primary key of the table by the paths of its
+// fields, like "id" or "meta.id". The fields must be scalars or timestamps and
+// cannot be part of a list or map. This option is required.
+func OptionPrimaryKey(paths ...string) Option {
+	if len(paths) == 0 {
+		panic("primary key cannot be empty")
+	}
+	return &optionPrimaryKey{value: paths}
+}
+
+type optionOp struct {
+	value Op
+}
+
+func (o *optionOp) Apply(c *config) {
+	c.op = o.value
+}
+
+// OptionOp sets the kind of mutations created by a RowConverter. Defaults to
+// InsertOrUpdate. Unless it is Insert, the rows of child tables are deleted
+// and inserted anew (see RowConverter).
+func OptionOp(v Op) Option {
+	if v < InsertOrUpdate || v > Replace {
+		panic(fmt.Sprintf("unknown op %d", v))
+	}
+	return &optionOp{value: v}
+}
+
+func newConfig(options []Option) *config {
+	c := &config{}
+	for _, o := range options {
+		o.Apply(c)
+	}
+	if len(c.primaryKey) == 0 {
+		panic("no primary key set, see OptionPrimaryKey")
+	}
+	return c
+}
+
+// newDialect returns the dialect for a configuration. Its tables are flattened
+// into Spanner tables by the SchemaConverter.
+func newDialect(c *config) *dialect.Dialect {
+	return &dialect.Dialect{
+		Name: "Spanner",
+		Types: map[protoreflect.Kind]string{
+			protoreflect.BoolKind:     "BOOL",
+			protoreflect.EnumKind:     "INT64",
+			protoreflect.Int32Kind:    "INT64",
+			protoreflect.Sint32Kind:   "INT64",
+			protoreflect.Sfixed32Kind: "INT64",
+			protoreflect.Int64Kind:    "INT64",
+			protoreflect.Sint64Kind:   "INT64",
+			protoreflect.Sfixed64Kind: "INT64",
+			protoreflect.Uint32Kind:   "INT64",
+			protoreflect.Fixed32Kind:  "INT64",
+			protoreflect.Uint64Kind:   "INT64",
+			protoreflect.Fixed64Kind:  "INT64",
+			protoreflect.FloatKind:    "FLOAT64",
+			protoreflect.DoubleKind:   "FLOAT64",
+			protoreflect.StringKind:   "STRING(MAX)",
+			protoreflect.BytesKind:    "BYTES(MAX)",
+		},
+		Timestamp:       "TIMESTAMP",
+		Array:           "ARRAY<%s>",
+		Struct:          "STRUCT<%s>",
+		Field:           "%s %s",
+		NullableStructs: true,
+		NotNull:         " NOT NULL",
+		StructValues:    dialect.StructsAsMaps,
+		ArrayValues:     dialect.ArraysAsTyped,
+		JSON:            "JSON",
+		Mapping: func(fd protoreflect.FieldDescriptor) dialect.Mapping {
+			switch {
+			case fd.IsMap():
+				return dialect.AsJSON
+			case fd.Message() != nil:
+				switch {
+				case c.messages == MessagesAsProto:
+					return dialect.AsProto
+				case c.messages == MessagesFlattened && !dialect.IsRecursive(fd.Message()):
+					return dialect.Native
+				}
+				return dialect.AsJSON
+			case fd.Enum() != nil && c.enums == EnumsAsProto:
+				return dialect.AsProto
+			}
+			return dialect.Native
+		},
+		Scalar: convertRowScalar,
+		JSONValue: func(v interface{}) interface{} {
+			if v == nil {
+				return spanner.NullJSON{}
+			}
+			return spanner.NullJSON{Value: v, Valid: true}
+		},
+	}
+}
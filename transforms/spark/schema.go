@@ -0,0 +1,85 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package spark
+
+import (
+	"github.com/HayoVanLoon/go-proto/transforms"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// A SchemaConverter converts message descriptors into Spark schemas. It is
+// safe for concurrent use by multiple goroutines.
+type SchemaConverter interface {
+	Apply(md protoreflect.MessageDescriptor) *StructType
+}
+
+type schemaConverter struct {
+	maxDepth int
+}
+
+// NewSchemaConverter creates a new SchemaConverter.
+func NewSchemaConverter(options ...Option) SchemaConverter {
+	c := newConfig(options)
+	return &schemaConverter{
+		maxDepth: c.maxDepth,
+	}
+}
+
+func (sc *schemaConverter) Apply(md protoreflect.MessageDescriptor) *StructType {
+	return sc.structType(md, sc.maxDepth-1)
+}
+
+// structType returns the struct type for a message. The allowed depth mirrors
+// that of the Walker: message values are only included if it is not negative.
+func (sc *schemaConverter) structType(md protoreflect.MessageDescriptor, allowedDepth int) *StructType {
+	out := &StructType{}
+	for _, fd := range transforms.DescriptorFields(md) {
+		if f := sc.field(fd, allowedDepth); f != nil {
+			out.Fields = append(out.Fields, f)
+		}
+	}
+	return out
+}
+
+func (sc *schemaConverter) field(fd protoreflect.FieldDescriptor, allowedDepth int) *StructField {
+	name := string(fd.Name())
+	switch {
+	case fd.IsMap():
+		value := sc.dataType(fd.MapValue(), allowedDepth)
+		if value == nil {
+			return nil
+		}
+		entry := &StructType{Fields: []*StructField{
+			{Name: "key", Type: sc.dataType(fd.MapKey(), allowedDepth)},
+			{Name: "value", Type: value},
+		}}
+		return &StructField{Name: name, Type: &ArrayType{ElementType: entry}}
+	case fd.IsList():
+		item := sc.dataType(fd, allowedDepth)
+		if item == nil {
+			return nil
+		}
+		return &StructField{Name: name, Type: &ArrayType{ElementType: item}}
+	}
+	t := sc.dataType(fd, allowedDepth)
+	if t == nil {
+		return nil
+	}
+	return &StructField{Name: name, Type: t, Nullable: fd.HasPresence()}
+}
+
+// dataType returns the type of a single value of a field, or nil if it is a
+// message beyond the maximum depth.
+func (sc *schemaConverter) dataType(fd protoreflect.FieldDescriptor, allowedDepth int) DataType {
+	switch {
+	case fd.Message() == nil:
+		return GetSparkType(fd)
+	case allowedDepth < 0:
+		return nil
+	case fd.Message().FullName() == timestampName:
+		return Timestamp
+	}
+	return sc.structType(fd.Message(), allowedDepth-1)
+}
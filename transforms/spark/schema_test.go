@@ -0,0 +1,96 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package spark
+
+import (
+	"encoding/json"
+	"github.com/HayoVanLoon/go-proto/transforms/internal/testpb"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaConverter(t *testing.T) {
+	event := (&testpb.FlatEvent{}).ProtoReflect().Descriptor()
+	place := func(nullable bool, depth int) *StructField {
+		fs := []*StructField{
+			{Name: "lat", Type: Double},
+			{Name: "status", Type: Long},
+		}
+		if depth > 1 {
+			fs = append(fs, &StructField{Name: "seen", Type: &ArrayType{ElementType: Timestamp}})
+		}
+		return &StructField{Name: "place", Type: &StructType{Fields: fs}, Nullable: nullable}
+	}
+	expected := func(depth int) *StructType {
+		return &StructType{Fields: []*StructField{
+			{Name: "id", Type: Long},
+			{Name: "name", Type: String},
+			{Name: "ratio", Type: Double},
+			{Name: "count", Type: Long},
+			{Name: "status", Type: Long},
+			{Name: "tags", Type: &ArrayType{ElementType: String}},
+			{Name: "attrs", Type: &ArrayType{ElementType: &StructType{Fields: []*StructField{
+				{Name: "key", Type: String},
+				{Name: "value", Type: Long},
+			}}}},
+			{Name: "created", Type: Timestamp, Nullable: true},
+			{Name: "alias", Type: String, Nullable: true},
+			place(true, depth),
+			{Name: "stops", Type: &ArrayType{ElementType: place(false, depth).Type}},
+			{Name: "states", Type: &ArrayType{ElementType: Long}},
+		}}
+	}
+
+	cases := []struct {
+		options  []Option
+		expected *StructType
+		name     string
+	}{
+		{nil, expected(10), "default"},
+		{[]Option{OptionMaxDepth(1)}, expected(1), "max depth"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := NewSchemaConverter(c.options...).Apply(event)
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestStructType_MarshalJSON(t *testing.T) {
+	cases := []struct {
+		input    *StructType
+		expected string
+		name     string
+	}{
+		{&StructType{}, `{"type":"struct","fields":[]}`, "empty"},
+		{
+			&StructType{Fields: []*StructField{
+				{Name: "id", Type: Long},
+				{Name: "created", Type: Timestamp, Nullable: true},
+				{Name: "tags", Type: &ArrayType{ElementType: String}},
+				{Name: "place", Type: &StructType{Fields: []*StructField{{Name: "lat", Type: Double}}}},
+			}},
+			`{"type":"struct","fields":[` +
+				`{"name":"id","type":"long","nullable":false,"metadata":{}},` +
+				`{"name":"created","type":"timestamp","nullable":true,"metadata":{}},` +
+				`{"name":"tags","type":{"type":"array","elementType":"string","containsNull":false},"nullable":false,"metadata":{}},` +
+				`{"name":"place","type":{"type":"struct","fields":[{"name":"lat","type":"double","nullable":false,"metadata":{}}]},"nullable":false,"metadata":{}}]}`,
+			"nested",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			bs, err := json.Marshal(c.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual := string(bs); actual != c.expected {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+// Package spark converts message descriptors into Apache Spark SQL schemas,
+// as StructType values that marshal to the JSON format of Spark's
+// DataType.fromJson.
+//
+// The type mapping follows that of the bigquery package: integers and enums
+// map to long, floating point numbers to double, and maps to arrays of structs
+// with a 'key' and a 'value' field. Messages map to nested structs and
+// google.protobuf.Timestamp to timestamp.
+//
+// Fields that track presence (message fields, oneof members and optional
+// fields) are nullable. Message fields beyond the maximum depth (see
+// OptionMaxDepth) are left out.
+package spark
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	timestampName = "google.protobuf.Timestamp"
+
+	defaultMaxDepth = 10
+)
+
+// A DataType is a Spark SQL data type: an AtomicType, *ArrayType or
+// *StructType.
+type DataType interface {
+	// TypeName returns the name of the type, as used in its JSON form.
+	TypeName() string
+}
+
+// An AtomicType is a Spark SQL data type without parameters.
+type AtomicType string
+
+const (
+	Boolean   = AtomicType("boolean")
+	Long      = AtomicType("long")
+	Double    = AtomicType("double")
+	String    = AtomicType("string")
+	Binary    = AtomicType("binary")
+	Timestamp = AtomicType("timestamp")
+)
+
+func (t AtomicType) TypeName() string {
+	return string(t)
+}
+
+// An ArrayType is an array of elements of a single type.
+type ArrayType struct {
+	ElementType  DataType
+	ContainsNull bool
+}
+
+func (t *ArrayType) TypeName() string {
+	return "array"
+}
+
+func (t *ArrayType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type         string   `json:"type"`
+		ElementType  DataType `json:"elementType"`
+		ContainsNull bool     `json:"containsNull"`
+	}{t.TypeName(), t.ElementType, t.ContainsNull})
+}
+
+// A StructField is a field of a StructType.
+type StructField struct {
+	Name     string
+	Type     DataType
+	Nullable bool
+}
+
+func (f *StructField) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name     string                 `json:"name"`
+		Type     DataType               `json:"type"`
+		Nullable bool                   `json:"nullable"`
+		Metadata map[string]interface{} `json:"metadata"`
+	}{f.Name, f.Type, f.Nullable, map[string]interface{}{}})
+}
+
+// A StructType is a struct of named fields; the schema of a message type.
+type StructType struct {
+	Fields []*StructField
+}
+
+func (t *StructType) TypeName() string {
+	return "struct"
+}
+
+func (t *StructType) MarshalJSON() ([]byte, error) {
+	fs := t.Fields
+	if fs == nil {
+		fs = []*StructField{}
+	}
+	return json.Marshal(struct {
+		Type   string         `json:"type"`
+		Fields []*StructField `json:"fields"`
+	}{t.TypeName(), fs})
+}
+
+// GetSparkType returns the Spark type for the values of a scalar field.
+func GetSparkType(fd protoreflect.FieldDescriptor) AtomicType {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return Boolean
+	case protoreflect.EnumKind, protoreflect.Int32Kind, protoreflect.Int64Kind,
+		protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+		protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Uint64Kind,
+		protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		return Long
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return Double
+	case protoreflect.StringKind:
+		return String
+	case protoreflect.BytesKind:
+		return Binary
+	default:
+		panic(fmt.Sprintf("unsupported type %v", fd.Kind()))
+	}
+}
+
+type config struct {
+	maxDepth int
+}
+
+type Option interface {
+	// Apply applies the Option to the converter.
+	Apply(c *config)
+}
+
+type optionMaxDepth struct {
+	value int
+}
+
+func (o *optionMaxDepth) Apply(c *config) {
+	c.maxDepth = o.value
+}
+
+// OptionMaxDepth sets a maximum message recursion depth. Message fields beyond
+// it are left out. Defaults to 10. See transforms.OptionMaxDepth.
+func OptionMaxDepth(v int) Option {
+	return &optionMaxDepth{value: v}
+}
+
+func newConfig(options []Option) *config {
+	c := &config{maxDepth: defaultMaxDepth}
+	for _, o := range options {
+		o.Apply(c)
+	}
+	return c
+}
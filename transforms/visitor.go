@@ -0,0 +1,303 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+
+package transforms
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// A Visitor receives the events of a walk over a message or message
+// descriptor. Events are pushed as the walk progresses, so a Visitor can
+// process a message without it ever being converted as a whole.
+//
+// Fields are visited in the order of their numbers. The FieldDescriptor is nil
+// for the root message. List items are visited with the FieldDescriptor of the
+// list field, map values with the FieldDescriptor of the map's value field.
+//
+// When walking a descriptor, values are nil, ListItem and MapEntry are never
+// called, a list contains the events for its item type once and a map
+// contains the events for its key and value fields.
+type Visitor interface {
+	// EnterMessage is called before the fields of a message are visited.
+	EnterMessage(fd protoreflect.FieldDescriptor, md protoreflect.MessageDescriptor)
+
+	// ExitMessage is called after the fields of a message have been visited.
+	ExitMessage(fd protoreflect.FieldDescriptor, md protoreflect.MessageDescriptor)
+
+	// Field is called for scalar values: scalar fields, scalar list items and
+	// scalar map values.
+	Field(fd protoreflect.FieldDescriptor, v *protoreflect.Value)
+
+	// EnterList is called before the n items of a list are visited.
+	EnterList(fd protoreflect.FieldDescriptor, n int)
+
+	// ListItem is called before the item at index i is visited.
+	ListItem(fd protoreflect.FieldDescriptor, i int)
+
+	// ExitList is called after the items of a list have been visited.
+	ExitList(fd protoreflect.FieldDescriptor)
+
+	// EnterMap is called before the n entries of a map are visited.
+	EnterMap(fd protoreflect.FieldDescriptor, n int)
+
+	// MapEntry is called before the value for key k is visited.
+	MapEntry(fd protoreflect.FieldDescriptor, k protoreflect.MapKey)
+
+	// ExitMap is called after the entries of a map have been visited.
+	ExitMap(fd protoreflect.FieldDescriptor)
+}
+
+// A MessageSkipper is a Visitor that can skip the contents of messages, like
+// those it processes as a whole.
+type MessageSkipper interface {
+	Visitor
+
+	// SkipMessage is called after EnterMessage. If it returns true, the
+	// fields of the message are not visited and ExitMessage follows.
+	SkipMessage(fd protoreflect.FieldDescriptor, md protoreflect.MessageDescriptor) bool
+}
+
+// A visitor receives the events of a walk, with access to the plans. The
+// message and value walks of the Walker itself are implemented as visitors.
+type visitor interface {
+	enterMessage(fp *fieldPlan, mp *messagePlan)
+	exitMessage(fp *fieldPlan, mp *messagePlan)
+	scalar(fp *fieldPlan, v *protoreflect.Value)
+	// null is called for values that are to be omitted: empty values (unless
+	// they are kept) and messages beyond the maximum depth.
+	null(fp *fieldPlan)
+	enterList(fp *fieldPlan, n int)
+	listItem(fp *fieldPlan, i int)
+	exitList(fp *fieldPlan)
+	enterMap(fp *fieldPlan, n int)
+	mapEntry(fp *fieldPlan, k protoreflect.MapKey)
+	exitMap(fp *fieldPlan)
+}
+
+// A walk drives a visitor over a message, or over a message descriptor if
+// the message is nil. It keeps track of the WalkContext.
+type walk struct {
+	w *walker
+	v visitor
+	// public walks visit all of a descriptor: list items are visited and
+	// scalar fields are not considered empty
+	public bool
+	// skipper is set for public walks with a MessageSkipper
+	skipper MessageSkipper
+	ctx     WalkContext
+}
+
+func (s *walk) root(mp *messagePlan, m protoreflect.Message) {
+	s.ctx.Root = m
+	if s.ctx.Path == nil {
+		s.ctx.Path = make([]PathElement, 0, 8)
+	}
+	s.message(nil, mp, m, s.w.maxDepth)
+}
+
+func (s *walk) message(fp *fieldPlan, mp *messagePlan, m protoreflect.Message, allowedDepth int) {
+	s.v.enterMessage(fp, mp)
+	if s.skipper != nil && s.skipper.SkipMessage(fieldDescriptor(fp), mp.md) {
+		s.v.exitMessage(fp, mp)
+		return
+	}
+	ctx := s.ctx
+	s.ctx.Parent = m
+	for _, c := range mp.fields {
+		s.field(c, m, allowedDepth-1)
+	}
+	s.ctx = ctx
+	s.v.exitMessage(fp, mp)
+}
+
+// enter updates the context for entering field fp.
+func (s *walk) enter(fp *fieldPlan, allowedDepth int) {
+	s.ctx.Field = fp.fd
+	s.ctx.Name = fp.name
+	s.ctx.Path = append(s.ctx.Path, PathElement{Field: fp.fd, Index: -1})
+	s.ctx.Depth = allowedDepth
+}
+
+// exit updates the context for leaving the current field.
+func (s *walk) exit() {
+	s.ctx.Path = s.ctx.Path[:len(s.ctx.Path)-1]
+}
+
+// last returns the last element of the context's path.
+func (s *walk) last() *PathElement {
+	return &s.ctx.Path[len(s.ctx.Path)-1]
+}
+
+func (s *walk) field(fp *fieldPlan, m protoreflect.Message, allowedDepth int) {
+	s.enter(fp, allowedDepth)
+	s.fieldValue(fp, m, allowedDepth)
+	s.exit()
+}
+
+func (s *walk) fieldValue(fp *fieldPlan, m protoreflect.Message, allowedDepth int) {
+	if m == nil {
+		switch {
+		case fp.fd.IsMap():
+			s.v.enterMap(fp, 0)
+			s.mapEntryValue(fp, fp.mapKey, nil, allowedDepth)
+			s.mapEntryValue(fp, fp.mapValue, nil, allowedDepth)
+			s.v.exitMap(fp)
+		case fp.fd.IsList():
+			s.v.enterList(fp, 0)
+			if s.public {
+				s.value(fp, nil, allowedDepth)
+			}
+			s.v.exitList(fp)
+		default:
+			s.value(fp, nil, allowedDepth)
+		}
+		return
+	}
+
+	// unset fields are skipped early, rather than discarded after having been
+	// visited; by default, scalar fields are judged by their value instead
+	byPresence := s.public || s.w.keepSet || fp.fd.Kind() == protoreflect.MessageKind || fp.fd.IsList() || fp.fd.IsMap()
+	if !s.w.keepEmpty && byPresence && !m.Has(fp.fd) {
+		s.v.null(fp)
+		return
+	}
+	v := m.Get(fp.fd)
+	switch {
+	case fp.fd.IsMap():
+		s.mapValue(fp, v.Map(), allowedDepth)
+	case fp.fd.IsList():
+		s.list(fp, v.List(), allowedDepth)
+	default:
+		s.value(fp, &v, allowedDepth)
+	}
+}
+
+func (s *walk) list(fp *fieldPlan, l protoreflect.List, allowedDepth int) {
+	s.v.enterList(fp, l.Len())
+	for i := 0; i < l.Len(); i += 1 {
+		s.last().Index = i
+		s.v.listItem(fp, i)
+		x := l.Get(i)
+		s.value(fp, &x, allowedDepth)
+	}
+	s.last().Index = -1
+	s.v.exitList(fp)
+}
+
+func (s *walk) mapValue(fp *fieldPlan, m protoreflect.Map, allowedDepth int) {
+	s.v.enterMap(fp, m.Len())
+	// visit entries in key order, so that output is deterministic
+	for _, k := range sortedMapKeys(fp.fd, m) {
+		x := m.Get(k)
+		s.last().Key = k
+		s.v.mapEntry(fp, k)
+		s.mapEntryValue(fp, fp.mapValue, &x, allowedDepth)
+	}
+	s.last().Key = protoreflect.MapKey{}
+	s.v.exitMap(fp)
+}
+
+// mapEntryValue visits the key or value of a map entry.
+func (s *walk) mapEntryValue(fp, entry *fieldPlan, v *protoreflect.Value, allowedDepth int) {
+	s.enter(entry, allowedDepth)
+	s.value(entry, v, allowedDepth)
+	s.exit()
+	s.ctx.Field = fp.fd
+	s.ctx.Name = fp.name
+	s.ctx.Depth = allowedDepth
+}
+
+// value visits a single, non-repeated value. This is either a non-repeated
+// field, a list item or a map value.
+func (s *walk) value(fp *fieldPlan, v *protoreflect.Value, allowedDepth int) {
+	if fp.fd.Kind() != protoreflect.MessageKind {
+		switch {
+		case v == nil && s.public:
+			s.v.scalar(fp, v)
+		case v == nil && !s.w.keepEmpty:
+			s.v.null(fp)
+		case !s.public && !s.w.keepEmpty && !s.w.keepSet && IsDefaultScalar(v):
+			s.v.null(fp)
+		default:
+			s.v.scalar(fp, v)
+		}
+		return
+	}
+	// only messages induce a risk of infinite recursion
+	if allowedDepth < 0 || v != nil && !v.IsValid() {
+		s.v.null(fp)
+		return
+	}
+	if d, ok := s.maxDepth(fp); ok {
+		allowedDepth = d
+		s.ctx.Depth = allowedDepth
+	}
+	var m protoreflect.Message
+	if v != nil {
+		m = v.Message()
+	}
+	s.message(fp, fp.messagePlan(s.w), m, allowedDepth)
+}
+
+// maxDepth returns the maximum depth set for the current value, if any.
+func (s *walk) maxDepth(fp *fieldPlan) (int, bool) {
+	for _, pv := range fp.indexedMaxDepths {
+		if pv.pattern.Match(&s.ctx) {
+			return pv.value.(int), true
+		}
+	}
+	return fp.maxDepth, fp.hasMaxDepth
+}
+
+// A publicVisitor passes the events of a walk on to a Visitor.
+type publicVisitor struct {
+	v Visitor
+}
+
+func fieldDescriptor(fp *fieldPlan) protoreflect.FieldDescriptor {
+	if fp == nil {
+		return nil
+	}
+	return fp.fd
+}
+
+func (p publicVisitor) enterMessage(fp *fieldPlan, mp *messagePlan) {
+	p.v.EnterMessage(fieldDescriptor(fp), mp.md)
+}
+
+func (p publicVisitor) exitMessage(fp *fieldPlan, mp *messagePlan) {
+	p.v.ExitMessage(fieldDescriptor(fp), mp.md)
+}
+
+func (p publicVisitor) scalar(fp *fieldPlan, v *protoreflect.Value) {
+	p.v.Field(fp.fd, v)
+}
+
+func (p publicVisitor) null(*fieldPlan) {
+}
+
+func (p publicVisitor) enterList(fp *fieldPlan, n int) {
+	p.v.EnterList(fp.fd, n)
+}
+
+func (p publicVisitor) listItem(fp *fieldPlan, i int) {
+	p.v.ListItem(fp.fd, i)
+}
+
+func (p publicVisitor) exitList(fp *fieldPlan) {
+	p.v.ExitList(fp.fd)
+}
+
+func (p publicVisitor) enterMap(fp *fieldPlan, n int) {
+	p.v.EnterMap(fp.fd, n)
+}
+
+func (p publicVisitor) mapEntry(fp *fieldPlan, k protoreflect.MapKey) {
+	p.v.MapEntry(fp.fd, k)
+}
+
+func (p publicVisitor) exitMap(fp *fieldPlan) {
+	p.v.ExitMap(fp.fd)
+}
@@ -0,0 +1,286 @@
+// Copyright 2022 Hayo van Loon. All rights reserved.
+// Use of this source code is governed by a licence
+// that can be found in the LICENSE file.
+package transforms
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/apipb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/typepb"
+	"reflect"
+	"testing"
+)
+
+// recorder records the events it receives as strings.
+type recorder struct {
+	events []string
+}
+
+func fdName(fd protoreflect.FieldDescriptor) string {
+	if fd == nil {
+		return "<root>"
+	}
+	return string(fd.Name())
+}
+
+func (r *recorder) EnterMessage(fd protoreflect.FieldDescriptor, md protoreflect.MessageDescriptor) {
+	r.events = append(r.events, fmt.Sprintf("enter %s %s", fdName(fd), md.FullName()))
+}
+
+func (r *recorder) ExitMessage(fd protoreflect.FieldDescriptor, md protoreflect.MessageDescriptor) {
+	r.events = append(r.events, fmt.Sprintf("exit %s %s", fdName(fd), md.FullName()))
+}
+
+func (r *recorder) Field(fd protoreflect.FieldDescriptor, v *protoreflect.Value) {
+	if v == nil {
+		r.events = append(r.events, fmt.Sprintf("field %s", fdName(fd)))
+	} else {
+		r.events = append(r.events, fmt.Sprintf("field %s %v", fdName(fd), v.Interface()))
+	}
+}
+
+func (r *recorder) EnterList(fd protoreflect.FieldDescriptor, n int) {
+	r.events = append(r.events, fmt.Sprintf("enter list %s %d", fdName(fd), n))
+}
+
+func (r *recorder) ListItem(fd protoreflect.FieldDescriptor, i int) {
+	r.events = append(r.events, fmt.Sprintf("item %s %d", fdName(fd), i))
+}
+
+func (r *recorder) ExitList(fd protoreflect.FieldDescriptor) {
+	r.events = append(r.events, fmt.Sprintf("exit list %s", fdName(fd)))
+}
+
+func (r *recorder) EnterMap(fd protoreflect.FieldDescriptor, n int) {
+	r.events = append(r.events, fmt.Sprintf("enter map %s %d", fdName(fd), n))
+}
+
+func (r *recorder) MapEntry(fd protoreflect.FieldDescriptor, k protoreflect.MapKey) {
+	r.events = append(r.events, fmt.Sprintf("entry %s %v", fdName(fd), k.Interface()))
+}
+
+func (r *recorder) ExitMap(fd protoreflect.FieldDescriptor) {
+	r.events = append(r.events, fmt.Sprintf("exit map %s", fdName(fd)))
+}
+
+func TestWalker_Walk(t *testing.T) {
+	cases := []struct {
+		walker   Walker
+		input    proto.Message
+		expected []string
+		name     string
+	}{
+		{
+			NewWalker(),
+			&timestamppb.Timestamp{Seconds: 1, Nanos: 2},
+			[]string{
+				"enter <root> google.protobuf.Timestamp",
+				"field seconds 1",
+				"field nanos 2",
+				"exit <root> google.protobuf.Timestamp",
+			},
+			"happy timestamp",
+		},
+		{
+			NewWalker(),
+			&timestamppb.Timestamp{Nanos: 2},
+			[]string{
+				"enter <root> google.protobuf.Timestamp",
+				"field nanos 2",
+				"exit <root> google.protobuf.Timestamp",
+			},
+			"skip empty scalar",
+		},
+		{
+			NewWalker(OptionKeepEmpty(true)),
+			&timestamppb.Timestamp{Nanos: 2},
+			[]string{
+				"enter <root> google.protobuf.Timestamp",
+				"field seconds 0",
+				"field nanos 2",
+				"exit <root> google.protobuf.Timestamp",
+			},
+			"keep empty scalar",
+		},
+		{
+			NewWalker(),
+			&apipb.Api{
+				Name: "foo",
+				Methods: []*apipb.Method{
+					{Name: "foo_method", Options: []*typepb.Option{{Name: "foo_opt"}}},
+					{Name: "bar_method"},
+				},
+			},
+			[]string{
+				"enter <root> google.protobuf.Api",
+				"field name foo",
+				"enter list methods 2",
+				"item methods 0",
+				"enter methods google.protobuf.Method",
+				"field name foo_method",
+				"enter list options 1",
+				"item options 0",
+				"enter options google.protobuf.Option",
+				"field name foo_opt",
+				"exit options google.protobuf.Option",
+				"exit list options",
+				"exit methods google.protobuf.Method",
+				"item methods 1",
+				"enter methods google.protobuf.Method",
+				"field name bar_method",
+				"exit methods google.protobuf.Method",
+				"exit list methods",
+				"exit <root> google.protobuf.Api",
+			},
+			"nested repeated",
+		},
+		{
+			NewWalker(OptionMaxDepth(1)),
+			&apipb.Api{
+				Name: "foo",
+				Methods: []*apipb.Method{
+					{Name: "foo_method", Options: []*typepb.Option{{Name: "foo_opt"}}},
+				},
+			},
+			[]string{
+				"enter <root> google.protobuf.Api",
+				"field name foo",
+				"enter list methods 1",
+				"item methods 0",
+				"enter methods google.protobuf.Method",
+				"field name foo_method",
+				"enter list options 1",
+				"item options 0",
+				"exit list options",
+				"exit methods google.protobuf.Method",
+				"exit list methods",
+				"exit <root> google.protobuf.Api",
+			},
+			"max depth",
+		},
+		{
+			NewWalker(),
+			&structpb.Struct{
+				Fields: map[string]*structpb.Value{
+					"foo": structpb.NewNumberValue(1.2),
+				},
+			},
+			[]string{
+				"enter <root> google.protobuf.Struct",
+				"enter map fields 1",
+				"entry fields foo",
+				"enter value google.protobuf.Value",
+				"field number_value 1.2",
+				"exit value google.protobuf.Value",
+				"exit map fields",
+				"exit <root> google.protobuf.Struct",
+			},
+			"map field",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := &recorder{}
+			c.walker.Walk(c.input, r)
+			if !reflect.DeepEqual(r.events, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, r.events)
+			}
+		})
+	}
+}
+
+func TestWalker_WalkDesc(t *testing.T) {
+	cases := []struct {
+		walker   Walker
+		input    proto.Message
+		expected []string
+		name     string
+	}{
+		{
+			NewWalker(),
+			&timestamppb.Timestamp{},
+			[]string{
+				"enter <root> google.protobuf.Timestamp",
+				"field seconds",
+				"field nanos",
+				"exit <root> google.protobuf.Timestamp",
+			},
+			"happy timestamp",
+		},
+		{
+			NewWalker(OptionMaxDepth(1)),
+			&structpb.Struct{},
+			[]string{
+				"enter <root> google.protobuf.Struct",
+				"enter map fields 0",
+				"field key",
+				"enter value google.protobuf.Value",
+				"field null_value",
+				"field number_value",
+				"field string_value",
+				"field bool_value",
+				"exit value google.protobuf.Value",
+				"exit map fields",
+				"exit <root> google.protobuf.Struct",
+			},
+			"map field",
+		},
+		{
+			NewWalker(OptionMaxDepth(1)),
+			&structpb.ListValue{},
+			[]string{
+				"enter <root> google.protobuf.ListValue",
+				"enter list values 0",
+				"enter values google.protobuf.Value",
+				"field null_value",
+				"field number_value",
+				"field string_value",
+				"field bool_value",
+				"exit values google.protobuf.Value",
+				"exit list values",
+				"exit <root> google.protobuf.ListValue",
+			},
+			"list field",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := &recorder{}
+			c.walker.WalkDesc(c.input.ProtoReflect().Descriptor(), r)
+			if !reflect.DeepEqual(r.events, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, r.events)
+			}
+		})
+	}
+}
+
+// skipper is a recorder that skips messages of a type.
+type skipper struct {
+	recorder
+	skip protoreflect.FullName
+}
+
+func (s *skipper) SkipMessage(_ protoreflect.FieldDescriptor, md protoreflect.MessageDescriptor) bool {
+	return md.FullName() == s.skip
+}
+
+func TestWalker_WalkDesc_SkipMessage(t *testing.T) {
+	s := &skipper{skip: "google.protobuf.Value"}
+	NewWalker().WalkDesc((&structpb.Struct{}).ProtoReflect().Descriptor(), s)
+	expected := []string{
+		"enter <root> google.protobuf.Struct",
+		"enter map fields 0",
+		"field key",
+		"enter value google.protobuf.Value",
+		"exit value google.protobuf.Value",
+		"exit map fields",
+		"exit <root> google.protobuf.Struct",
+	}
+	if !reflect.DeepEqual(s.events, expected) {
+		t.Errorf("\nexpected %v, \ngot      %v", expected, s.events)
+	}
+}
@@ -8,7 +8,7 @@ import (
 	"fmt"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
-	"sort"
+	"sync"
 )
 
 type OverrideFunc func(protoreflect.FieldDescriptor, interface{}) interface{}
@@ -37,16 +37,47 @@ func FromMessageFunc(f MessageFunc) OverrideFunc {
 	}
 }
 
+func FromRepeatedFunc(f RepeatedFunc) OverrideFunc {
+	return func(fd protoreflect.FieldDescriptor, v interface{}) interface{} {
+		return f(fd, v.([]interface{}))
+	}
+}
+
 const defaultMaxRecurse = 99
 
 // A Walker walks over a Protocol Buffers message or message descriptor.
 // Without additional configuration, it will return it as a map.
+//
+// A Walker is safe for concurrent use by multiple goroutines, provided that
+// the conversion functions passed to it via options are as well. Plans derived
+// from message descriptors are cached within the Walker, so the cost of
+// deriving them is only paid once per message type.
 type Walker interface {
 	// Apply will apply this Walker to a Message.
 	Apply(m proto.Message) interface{}
 
 	// ApplyDesc will apply this Walker to a message Descriptor.
 	ApplyDesc(d protoreflect.MessageDescriptor) interface{}
+
+	// Walk walks over a Message, pushing its contents to a Visitor rather than
+	// converting it. Of the Walker's options, only those that determine what is
+	// visited apply: OptionKeepEmpty, OptionMaxDepth and
+	// OptionMaxDepthForName. Values are visited as with OptionKeepSet: only
+	// unset fields are skipped.
+	Walk(m proto.Message, v Visitor)
+
+	// WalkDesc walks over a message Descriptor, pushing its contents to a
+	// Visitor. The same options apply as for Walk.
+	WalkDesc(d protoreflect.MessageDescriptor, v Visitor)
+
+	// Compile precomputes everything that can be derived from the message
+	// descriptor and the Walker's options: field order, field names,
+	// overrides and maximum depths. The returned Walker produces the same
+	// output as this one, but skips the plan cache lookup for messages of the
+	// given type. Other message types are handled as before.
+	//
+	// The returned Walker shares its plan cache with this one.
+	Compile(md protoreflect.MessageDescriptor) Walker
 }
 
 type KeyValue struct {
@@ -55,17 +86,27 @@ type KeyValue struct {
 }
 
 type walker struct {
-	scalarFns       map[protoreflect.Kind]ScalarFunc
-	defltFn         ScalarFunc
-	messageFn       MessageFunc
-	mapFn           MapFunc
-	repFn           RepeatedFunc
-	keepEmpty       bool
-	keepOrder       bool
-	maxDepth        int
-	maxDepthForName map[string]int
-	typeOverrides   map[string]MessageFunc
-	nameOverrides   map[string]OverrideFunc
+	scalarFns        map[protoreflect.Kind]ScalarFunc
+	scalarTypeFns    map[string]ScalarFunc
+	defltFn          ScalarFunc
+	messageFn        MessageFunc
+	mapFn            MapFunc
+	repFn            RepeatedFunc
+	keepEmpty        bool
+	keepSet          bool
+	keepOrder        bool
+	maxDepth         int
+	maxDepthForName  *patternSet
+	typeOverrides    map[string]MessageFunc
+	nameOverrides    *patternSet
+	repOverrides     *patternSet
+	repTypeOverrides map[string]RepeatedFunc
+
+	// plans caches root message plans by their full name
+	plans sync.Map
+	// builds pools the state of conversions, so that their stacks and paths
+	// are reused
+	builds sync.Pool
 }
 
 type Option interface {
@@ -91,6 +132,11 @@ const (
 	OptionTypeAddOverride
 	OptionTypeAddNameOverride
 	OptionTypeAddScalarFunc
+	OptionTypeAddRepeatedOverride
+	OptionTypeAddRepeatedTypeOverride
+	OptionTypeAddScalarTypeFunc
+	OptionTypeMapStrategy
+	OptionTypeKeepSet
 )
 
 type optionMaxDepth struct {
@@ -116,7 +162,7 @@ func OptionMaxDepth(v int) Option {
 }
 
 type optionMaxDepthForName struct {
-	key   string
+	key   *PathPattern
 	value int
 }
 
@@ -125,7 +171,7 @@ func (o *optionMaxDepthForName) Type() OptionType {
 }
 
 func (o *optionMaxDepthForName) Apply(w *walker) {
-	w.maxDepthForName[o.key] = o.value
+	w.maxDepthForName.add(o.key, o.value)
 }
 
 // OptionMaxDepthForName sets a maximum message recursion depth starting from
@@ -135,8 +181,12 @@ func (o *optionMaxDepthForName) Apply(w *walker) {
 //
 // A depth of zero will return the field. If depth is set to less
 // than zero, the default recursion depth (99) will be used.
+//
+// The name is a path, as described for PathPattern. When multiple paths match
+// a field, the same precedence rules apply as for OptionAddNameOverride. It
+// panics if the path is invalid.
 func OptionMaxDepthForName(name string, v int) Option {
-	return &optionMaxDepthForName{key: name, value: v}
+	return &optionMaxDepthForName{key: MustParsePathPattern(name), value: v}
 }
 
 type optionKeepEmpty struct {
@@ -155,6 +205,29 @@ func OptionKeepEmpty(v bool) Option {
 	return &optionKeepEmpty{value: v}
 }
 
+type optionKeepSet struct {
+	value bool
+}
+
+func (o *optionKeepSet) Type() OptionType {
+	return OptionTypeKeepSet
+}
+
+func (o *optionKeepSet) Apply(w *walker) {
+	w.keepSet = o.value
+}
+
+// OptionKeepSet will cause the Walker to omit values by presence rather than
+// by value, if set to true. By default, scalars holding their default value
+// and messages without any such scalars are omitted. With this option, only
+// unset fields are: list items, map values and explicitly set fields (like
+// oneof members and optional fields) are kept, even if they hold their
+// default value or are empty messages. It has no effect on descriptors, nor
+// when OptionKeepEmpty is set.
+func OptionKeepSet(v bool) Option {
+	return &optionKeepSet{value: v}
+}
+
 type optionDefaultScalarFunc struct {
 	value ScalarFunc
 }
@@ -186,7 +259,7 @@ func (o *optionMapFunc) Apply(w *walker) {
 }
 
 // OptionMapFunc sets the map type conversion function. The default is an
-// identity function.
+// identity function. See OptionMapStrategy for predefined functions.
 func OptionMapFunc(fn MapFunc) Option {
 	return &optionMapFunc{value: fn}
 }
@@ -271,8 +344,8 @@ func OptionAddTypeOverride(type_ string, v MessageFunc) Option {
 }
 
 type optionAddNameOverride struct {
-	key   string
-	value OverrideFunc
+	key   *PathPattern
+	value ContextOverrideFunc
 }
 
 func (o *optionAddNameOverride) Type() OptionType {
@@ -280,43 +353,71 @@ func (o *optionAddNameOverride) Type() OptionType {
 }
 
 func (o *optionAddNameOverride) Apply(w *walker) {
-	w.nameOverrides[o.key] = o.value
+	w.nameOverrides.add(o.key, o.value)
 }
 
 // OptionAddNameOverride defines a special (post-)processing for the given
 // field. Except for scalar fields, processing occurs after the normal
 // conversion. For scalar fields, it is applied instead of normal conversion.
 //
-// The name is a chain of field names, separated by dots. Repeated fields and
-// their subfields can be referenced (i.e. 'addresses.street'), but there is no
-// support for indexing. The same goes for map fields.
+// The name is a path: a chain of field names, separated by dots. Repeated
+// fields and their subfields can be referenced (i.e. 'addresses.street'), as
+// can map values (i.e. 'attributes.value'). Paths can contain list indices
+// ('items[0].price'), map keys ('attributes["color"]') and wildcards
+// ('*.created_at', '**.secret'); see PathPattern. When multiple paths match a
+// field, the first of these applies:
 //
-// An override on a repeated field will be applied to each element. There is no
-// support for post-processing the converted list as a whole. Such behaviour can
-// be achieved by overriding the containing message.
+//   - a path with an index or key
+//   - a plain path
+//   - a path with '*' wildcards
+//   - a path with a '**' wildcard
 //
-// You can effectively use multiple instances of this option as long as their
-// name differs - otherwise, earlier ones will be overwritten by later ones.
+// Within each of these, a path with more field names (not counting wildcards)
+// takes precedence over one with fewer. After that, later options take
+// precedence over earlier ones.
+//
+// An override on a repeated field will be applied to each element. To
+// post-process the converted list as a whole, use OptionAddRepeatedOverride.
+//
+// Besides ScalarFunc, MessageFunc and MapFunc, their context-aware
+// counterparts ContextScalarFunc, ContextMessageFunc and ContextMapFunc are
+// accepted. These receive a WalkContext, which provides access to (among
+// others) the containing message and the indices on the path to the value.
 //
+// You can effectively use multiple instances of this option as long as their
+// name differs - otherwise, earlier ones will be overwritten by later ones. It
+// panics if the path is invalid.
 func OptionAddNameOverride(name string, v interface{}) Option {
-	var f OverrideFunc
+	var f ContextOverrideFunc
 	switch x := v.(type) {
 	case ScalarFunc:
-		f = FromScalarFunc(x)
+		f = WithContext(FromScalarFunc(x))
 	case func(protoreflect.FieldDescriptor, *protoreflect.Value) interface{}:
-		f = FromScalarFunc(x)
+		f = WithContext(FromScalarFunc(x))
 	case MessageFunc:
-		f = FromMessageFunc(x)
+		f = WithContext(FromMessageFunc(x))
 	case func(fd protoreflect.FieldDescriptor, kvs []KeyValue) interface{}:
-		f = FromMessageFunc(x)
+		f = WithContext(FromMessageFunc(x))
 	case MapFunc:
-		f = FromMapFunc(x)
+		f = WithContext(FromMapFunc(x))
 	case func(protoreflect.FieldDescriptor, map[interface{}]interface{}) interface{}:
-		f = FromMapFunc(x)
+		f = WithContext(FromMapFunc(x))
+	case ContextScalarFunc:
+		f = FromContextScalarFunc(x)
+	case func(*WalkContext, *protoreflect.Value) interface{}:
+		f = FromContextScalarFunc(x)
+	case ContextMessageFunc:
+		f = FromContextMessageFunc(x)
+	case func(*WalkContext, []KeyValue) interface{}:
+		f = FromContextMessageFunc(x)
+	case ContextMapFunc:
+		f = FromContextMapFunc(x)
+	case func(*WalkContext, map[interface{}]interface{}) interface{}:
+		f = FromContextMapFunc(x)
 	default:
-		panic(fmt.Sprintf("Valid options: ScalarFunc, MessageFunc, MapFunc, got %T", v))
+		panic(fmt.Sprintf("Valid options: ScalarFunc, MessageFunc, MapFunc, ContextScalarFunc, ContextMessageFunc, ContextMapFunc, got %T", v))
 	}
-	return &optionAddNameOverride{key: name, value: f}
+	return &optionAddNameOverride{key: MustParsePathPattern(name), value: f}
 }
 
 type optionAddScalarFunc struct {
@@ -334,7 +435,8 @@ func (o *optionAddScalarFunc) Apply(w *walker) {
 
 // OptionAddScalarFunc adds a conversion function for a scalar kind. If no
 // conversion function has been specified for a certain kind, the default
-// function specified via SetDefaultFunc will be applied.
+// function specified via SetDefaultFunc will be applied. Functions set via
+// OptionAddScalarTypeFunc take precedence.
 //
 // You can effectively use multiple instances of this option as long as their
 // protoreflect.Kind differs - otherwise, earlier ones will be overwritten by
@@ -343,6 +445,108 @@ func OptionAddScalarFunc(k protoreflect.Kind, v ScalarFunc) Option {
 	return &optionAddScalarFunc{key: k, value: v}
 }
 
+type optionAddScalarTypeFunc struct {
+	key   string
+	value ScalarFunc
+}
+
+func (o *optionAddScalarTypeFunc) Type() OptionType {
+	return OptionTypeAddScalarTypeFunc
+}
+
+func (o *optionAddScalarTypeFunc) Apply(w *walker) {
+	w.scalarTypeFns[o.key] = o.value
+}
+
+// OptionAddScalarTypeFunc adds a conversion function for scalar fields by
+// type. The type name is expected to be a full name, i.e. 'acme.Status'. It
+// can be the name of:
+//
+//   - an enum type; the function applies to all fields of that type
+//   - a message type; the function applies to all scalar fields of that
+//     message (but not to those of nested messages)
+//
+// For a scalar field, the first of these applies:
+//
+//   - a name override (see OptionAddNameOverride)
+//   - a function for the field's enum type
+//   - a function for the field's containing message type
+//   - a function for the field's kind (see OptionAddScalarFunc)
+//   - the default function (see OptionDefaultScalarFunc)
+//
+// You can effectively use multiple instances of this option as long as their
+// type name differs - otherwise, earlier ones will be overwritten by later
+// ones.
+func OptionAddScalarTypeFunc(type_ string, v ScalarFunc) Option {
+	return &optionAddScalarTypeFunc{key: type_, value: v}
+}
+
+type optionAddRepeatedOverride struct {
+	key   *PathPattern
+	value ContextOverrideFunc
+}
+
+func (o *optionAddRepeatedOverride) Type() OptionType {
+	return OptionTypeAddRepeatedOverride
+}
+
+func (o *optionAddRepeatedOverride) Apply(w *walker) {
+	w.repOverrides.add(o.key, o.value)
+}
+
+// OptionAddRepeatedOverride defines a post-processing for the given repeated
+// field as a whole. It is applied to the list of converted elements, after any
+// element overrides (see OptionAddNameOverride) have been applied. This allows
+// for sorting, deduplicating, truncating or aggregating the list.
+//
+// The name is a path, as for OptionAddNameOverride; the same precedence rules
+// apply. Both RepeatedFunc and ContextRepeatedFunc are accepted.
+//
+// You can effectively use multiple instances of this option as long as their
+// name differs - otherwise, earlier ones will be overwritten by later ones. It
+// panics if the path is invalid.
+func OptionAddRepeatedOverride(name string, v interface{}) Option {
+	var f ContextOverrideFunc
+	switch x := v.(type) {
+	case RepeatedFunc:
+		f = WithContext(FromRepeatedFunc(x))
+	case func(protoreflect.FieldDescriptor, []interface{}) interface{}:
+		f = WithContext(FromRepeatedFunc(x))
+	case ContextRepeatedFunc:
+		f = FromContextRepeatedFunc(x)
+	case func(*WalkContext, []interface{}) interface{}:
+		f = FromContextRepeatedFunc(x)
+	default:
+		panic(fmt.Sprintf("Valid options: RepeatedFunc, ContextRepeatedFunc, got %T", v))
+	}
+	return &optionAddRepeatedOverride{key: MustParsePathPattern(name), value: f}
+}
+
+type optionAddRepeatedTypeOverride struct {
+	key   string
+	value RepeatedFunc
+}
+
+func (o *optionAddRepeatedTypeOverride) Type() OptionType {
+	return OptionTypeAddRepeatedTypeOverride
+}
+
+func (o *optionAddRepeatedTypeOverride) Apply(w *walker) {
+	w.repTypeOverrides[o.key] = o.value
+}
+
+// OptionAddRepeatedTypeOverride defines a post-processing for repeated fields
+// as a whole, based on the type of their elements. The type name is expected
+// to be the full name of a message or enum type, i.e. 'acme.products.Anvil'.
+// Overrides set via OptionAddRepeatedOverride take precedence.
+//
+// You can effectively use multiple instances of this option as long as their
+// type name differs - otherwise, earlier ones will be overwritten by later
+// ones.
+func OptionAddRepeatedTypeOverride(type_ string, v RepeatedFunc) Option {
+	return &optionAddRepeatedTypeOverride{key: type_, value: v}
+}
+
 // NewWalker spawns a new Walker. The provided options will be processed in
 // sequence and later options may overwrite earlier ones.
 func NewWalker(options ...Option) Walker {
@@ -360,13 +564,16 @@ func NewWalker(options ...Option) Walker {
 			}
 			return m
 		},
-		mapFn:           func(fd protoreflect.FieldDescriptor, m map[interface{}]interface{}) interface{} { return m },
-		repFn:           func(_ protoreflect.FieldDescriptor, xs []interface{}) interface{} { return xs },
-		maxDepth:        defaultMaxRecurse,
-		maxDepthForName: map[string]int{},
-		typeOverrides:   map[string]MessageFunc{},
-		nameOverrides:   map[string]OverrideFunc{},
-		scalarFns:       map[protoreflect.Kind]ScalarFunc{},
+		mapFn:            func(fd protoreflect.FieldDescriptor, m map[interface{}]interface{}) interface{} { return m },
+		repFn:            func(_ protoreflect.FieldDescriptor, xs []interface{}) interface{} { return xs },
+		maxDepth:         defaultMaxRecurse,
+		maxDepthForName:  newPatternSet(),
+		typeOverrides:    map[string]MessageFunc{},
+		nameOverrides:    newPatternSet(),
+		repOverrides:     newPatternSet(),
+		repTypeOverrides: map[string]RepeatedFunc{},
+		scalarFns:        map[protoreflect.Kind]ScalarFunc{},
+		scalarTypeFns:    map[string]ScalarFunc{},
 	}
 	for _, option := range options {
 		option.Apply(w)
@@ -379,11 +586,62 @@ func NewWalker(options ...Option) Walker {
 
 func (w *walker) Apply(m proto.Message) interface{} {
 	mp := m.ProtoReflect()
-	return w.convertMessage(mp.Descriptor(), mp, w.maxDepth, "")
+	return w.build(w.plan(mp.Descriptor()), mp)
 }
 
 func (w *walker) ApplyDesc(d protoreflect.MessageDescriptor) interface{} {
-	return w.convertMessage(d, nil, w.maxDepth, "")
+	return w.build(w.plan(d), nil)
+}
+
+func (w *walker) Walk(m proto.Message, v Visitor) {
+	mp := m.ProtoReflect()
+	w.visit(w.plan(mp.Descriptor()), mp, v)
+}
+
+func (w *walker) WalkDesc(d protoreflect.MessageDescriptor, v Visitor) {
+	w.visit(w.plan(d), nil, v)
+}
+
+func (w *walker) Compile(md protoreflect.MessageDescriptor) Walker {
+	return &compiledWalker{walker: w, plan: w.plan(md)}
+}
+
+// A compiledWalker is a walker with a precomputed plan for one message type.
+type compiledWalker struct {
+	*walker
+	plan *messagePlan
+}
+
+func (c *compiledWalker) Apply(m proto.Message) interface{} {
+	mp := m.ProtoReflect()
+	if mp.Descriptor() != c.plan.md {
+		return c.walker.Apply(m)
+	}
+	return c.build(c.plan, mp)
+}
+
+func (c *compiledWalker) ApplyDesc(d protoreflect.MessageDescriptor) interface{} {
+	if d != c.plan.md {
+		return c.walker.ApplyDesc(d)
+	}
+	return c.build(c.plan, nil)
+}
+
+func (c *compiledWalker) Walk(m proto.Message, v Visitor) {
+	mp := m.ProtoReflect()
+	if mp.Descriptor() != c.plan.md {
+		c.walker.Walk(m, v)
+		return
+	}
+	c.visit(c.plan, mp, v)
+}
+
+func (c *compiledWalker) WalkDesc(d protoreflect.MessageDescriptor, v Visitor) {
+	if d != c.plan.md {
+		c.walker.WalkDesc(d, v)
+		return
+	}
+	c.visit(c.plan, nil, v)
 }
 
 func (w *walker) createName(parent string, name protoreflect.Name) string {
@@ -393,168 +651,215 @@ func (w *walker) createName(parent string, name protoreflect.Name) string {
 	return parent + "." + string(name)
 }
 
-func (w *walker) convertMessage(md protoreflect.MessageDescriptor, m protoreflect.Message, allowedDepth int, parent string) interface{} {
-	fds := md.Fields()
-	kvs := w.convertMessageFields(fds, m, allowedDepth, parent)
-	if w.keepOrder {
-		return kvs
-	}
-	result := make(map[string]interface{}, len(kvs))
-	for _, kv := range kvs {
-		result[kv.Key] = kv.Value
+// A buildState holds the builder and walk of a conversion.
+type buildState struct {
+	b builder
+	s walk
+}
+
+// build converts a message (or, if nil, a message descriptor) into a value.
+func (w *walker) build(mp *messagePlan, m protoreflect.Message) interface{} {
+	st, _ := w.builds.Get().(*buildState)
+	if st == nil {
+		st = &buildState{}
+		st.b.stack = make([]frame, 0, 8)
 	}
+	st.b = builder{w: w, desc: m == nil, stack: st.b.stack, ctx: &st.s.ctx}
+	st.s = walk{w: w, v: &st.b, ctx: WalkContext{Path: st.s.ctx.Path}}
+	st.s.root(mp, m)
+	result := st.b.result
+	// the stack and path are empty again; drop references to the message
+	st.b.result = nil
+	st.s.ctx = WalkContext{Path: st.s.ctx.Path}
+	w.builds.Put(st)
 	return result
 }
 
-func (w *walker) convertMessageFields(fds protoreflect.FieldDescriptors, m protoreflect.Message, allowedDepth int, parent string) []KeyValue {
-	xs := make([]protoreflect.FieldDescriptor, fds.Len())
-	for i := 0; i < len(xs); i += 1 {
-		xs[i] = fds.Get(i)
-	}
-	sort.Slice(xs, func(i, j int) bool {
-		return xs[i].Number() < xs[j].Number()
-	})
-	var kvs []KeyValue
-	for _, fd := range xs {
-		if m == nil {
-			kvs = append(kvs, KeyValue{string(fd.Name()), w.convertValue(fd, nil, allowedDepth-1, parent)})
-		} else {
-			v := m.Get(fd)
-			x := w.convertValue(fd, &v, allowedDepth-1, parent)
-			if x != nil {
-				kvs = append(kvs, KeyValue{string(fd.Name()), x})
-			}
-		}
-	}
-	return kvs
+// visit walks a Visitor over a message (or, if nil, a message descriptor).
+func (w *walker) visit(mp *messagePlan, m protoreflect.Message, v Visitor) {
+	s := walk{w: w, v: publicVisitor{v: v}, public: true}
+	s.skipper, _ = v.(MessageSkipper)
+	s.root(mp, m)
 }
 
-// convertValue converts a value.
-func (w *walker) convertValue(fd protoreflect.FieldDescriptor, v *protoreflect.Value, allowedDepth int, parent string) interface{} {
-	if fd.IsMap() {
-		return w.applyMapFn(fd, v, allowedDepth, parent)
-	}
-	if fd.Cardinality() == protoreflect.Repeated {
-		return w.applyRepFn(fd, v, allowedDepth, parent)
+type frameKind int
+
+const (
+	messageFrame = frameKind(iota)
+	listFrame
+	mapFrame
+)
+
+// A frame holds the converted children of a message, list or map.
+type frame struct {
+	kind   frameKind
+	kvs    []KeyValue
+	items  []interface{}
+	m      map[interface{}]interface{}
+	key    interface{}
+	hasKey bool
+}
+
+// A builder is the visitor that converts a message into a value, applying the
+// Walker's conversion functions and overrides.
+type builder struct {
+	w      *walker
+	ctx    *WalkContext
+	desc   bool
+	stack  []frame
+	result interface{}
+}
+
+// emit adds a converted value to the current frame.
+func (b *builder) emit(fp *fieldPlan, x interface{}) {
+	if len(b.stack) == 0 {
+		b.result = x
+		return
 	}
-	if fd.Kind() == protoreflect.MessageKind {
-		if v == nil {
-			return w.applyMessageFn(fd, nil, allowedDepth, parent)
+	f := &b.stack[len(b.stack)-1]
+	switch f.kind {
+	case messageFrame:
+		// descriptors keep all fields
+		if x != nil || b.desc {
+			f.kvs = append(f.kvs, KeyValue{fp.key, x})
 		}
-		return w.applyMessageFn(fd, v.Message(), allowedDepth, parent)
-	}
-	return w.convertNonRepeatedValue(fd, v, allowedDepth, parent)
-}
-
-// convertNonRepeatedValue converts a value that is assumed to not be repeated.
-// This is the case for items in a repeated field or map values. No checks are
-// (nor can be) performed on this assumption.
-func (w *walker) convertNonRepeatedValue(fd protoreflect.FieldDescriptor, v *protoreflect.Value, allowedDepth int, parent string) interface{} {
-	if fd.Kind() == protoreflect.MessageKind {
-		if v == nil {
-			return w.applyMessageFn(fd, nil, allowedDepth, parent)
+	case listFrame:
+		if x != nil {
+			f.items = append(f.items, x)
 		}
-		if !v.IsValid() {
-			return nil
+	case mapFrame:
+		if !f.hasKey {
+			// descriptors have no keys; use the key and value field names
+			f.m[fp.key] = x
+		} else if x != nil {
+			f.m[f.key] = x
 		}
-		return w.applyMessageFn(fd, v.Message(), allowedDepth, parent)
+		f.hasKey = false
 	}
-	return w.applyScalarFn(fd, v, parent)
 }
 
-func (w *walker) convertList(fd protoreflect.FieldDescriptor, v *protoreflect.Value, allowedDepth int, parent string) []interface{} {
-	if v == nil {
-		return nil
-	}
-	xs := v.List()
-	var ys []interface{}
-	for i := 0; i < xs.Len(); i += 1 {
-		x := xs.Get(i)
-		if y := w.convertNonRepeatedValue(fd, &x, allowedDepth, parent); y != nil {
-			ys = append(ys, y)
+// override returns the name override that applies to the current value.
+func (b *builder) override(fp *fieldPlan) ContextOverrideFunc {
+	return resolveOverride(b.ctx, fp.indexedOverrides, fp.override)
+}
+
+// repOverride returns the repeated override that applies to the current list.
+func (b *builder) repOverride(fp *fieldPlan) ContextOverrideFunc {
+	return resolveOverride(b.ctx, fp.indexedRepOverrides, fp.repOverride)
+}
+
+func resolveOverride(c *WalkContext, indexed []patternValue, fallback ContextOverrideFunc) ContextOverrideFunc {
+	for _, pv := range indexed {
+		if pv.pattern.Match(c) {
+			return pv.value.(ContextOverrideFunc)
 		}
 	}
-	return ys
+	return fallback
 }
 
-func (w *walker) convertMap(fd protoreflect.FieldDescriptor, v *protoreflect.Value, allowedDepth int, parent string) map[interface{}]interface{} {
-	name := w.createName(parent, fd.Name())
-	vfd := fd.MapValue()
-	m := make(map[interface{}]interface{})
-	if v == nil {
-		kfd := fd.MapKey()
-		m[string(kfd.Name())] = w.convertNonRepeatedValue(kfd, nil, allowedDepth, name)
-		m[string(vfd.Name())] = w.convertNonRepeatedValue(vfd, nil, allowedDepth, name)
-	} else {
-		rangeFn := func(k protoreflect.MapKey, iv protoreflect.Value) bool {
-			x := w.convertNonRepeatedValue(vfd, &iv, allowedDepth, name)
-			if x != nil {
-				m[k.Interface()] = x
-			}
-			return true
-		}
-		v.Map().Range(rangeFn)
+func (b *builder) pop() frame {
+	f := b.stack[len(b.stack)-1]
+	// the stack is reused; do not keep the frame's values alive
+	b.stack[len(b.stack)-1] = frame{}
+	b.stack = b.stack[:len(b.stack)-1]
+	return f
+}
+
+func (b *builder) enterMessage(_ *fieldPlan, mp *messagePlan) {
+	f := frame{kind: messageFrame}
+	if b.desc {
+		// descriptors keep all fields
+		f.kvs = make([]KeyValue, 0, len(mp.fields))
 	}
-	return m
+	b.stack = append(b.stack, f)
 }
 
-func (w *walker) applyScalarFn(fd protoreflect.FieldDescriptor, v *protoreflect.Value, parent string) interface{} {
-	if !w.keepEmpty && (v == nil || IsDefaultScalar(v)) {
-		return nil
+func (b *builder) exitMessage(fp *fieldPlan, _ *messagePlan) {
+	kvs := b.pop().kvs
+	if fp == nil {
+		b.emit(nil, b.convertRoot(kvs))
+		return
 	}
-	name := w.createName(parent, fd.Name())
-	if override := w.nameOverrides[name]; override != nil {
-		return override(fd, v)
+	// unset messages have been skipped; set ones are only kept on request
+	if !b.w.keepEmpty && len(kvs) == 0 && (b.desc || !b.w.keepSet) {
+		b.emit(fp, nil)
+		return
 	}
-	if fn := w.scalarFns[fd.Kind()]; fn != nil {
-		return fn(fd, v)
+	if override := b.override(fp); override != nil {
+		b.emit(fp, override(b.ctx, kvs))
+	} else if fp.typeOverride != nil {
+		b.emit(fp, fp.typeOverride(fp.fd, kvs))
+	} else {
+		b.emit(fp, b.w.messageFn(fp.fd, kvs))
 	}
-	return w.defltFn(fd, v)
 }
 
-func (w walker) applyRepFn(fd protoreflect.FieldDescriptor, v *protoreflect.Value, allowedDepth int, parent string) interface{} {
-	r := w.convertList(fd, v, allowedDepth, parent)
-	if !w.keepEmpty && len(r) == 0 {
-		return nil
+func (b *builder) convertRoot(kvs []KeyValue) interface{} {
+	if b.w.keepOrder {
+		return kvs
 	}
-	return w.repFn(fd, r)
+	result := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		result[kv.Key] = kv.Value
+	}
+	return result
 }
 
-func (w walker) applyMessageFn(fd protoreflect.FieldDescriptor, m protoreflect.Message, allowedDepth int, parent string) interface{} {
-	// only messages induce a risk of infinite recursion
-	if allowedDepth < 0 {
-		return nil
-	}
-	name := w.createName(parent, fd.Name())
-	if overrideDepth, ok := w.maxDepthForName[name]; ok {
-		allowedDepth = overrideDepth
+func (b *builder) scalar(fp *fieldPlan, v *protoreflect.Value) {
+	if override := b.override(fp); override != nil {
+		b.emit(fp, override(b.ctx, v))
+	} else {
+		b.emit(fp, fp.scalarFn(fp.fd, v))
 	}
+}
 
-	fds := fd.Message().Fields()
-	kvs := w.convertMessageFields(fds, m, allowedDepth, name)
-	if !w.keepEmpty && len(kvs) == 0 {
-		return nil
-	}
+func (b *builder) null(fp *fieldPlan) {
+	b.emit(fp, nil)
+}
+
+func (b *builder) enterList(*fieldPlan, int) {
+	b.stack = append(b.stack, frame{kind: listFrame})
+}
 
-	if override := w.nameOverrides[name]; override != nil {
-		return override(fd, kvs)
+func (b *builder) listItem(*fieldPlan, int) {
+}
+
+func (b *builder) exitList(fp *fieldPlan) {
+	items := b.pop().items
+	if !b.w.keepEmpty && len(items) == 0 {
+		b.emit(fp, nil)
+		return
 	}
-	if override := w.typeOverrides[string(fd.Message().FullName())]; override != nil {
-		return override(fd, kvs)
+	if override := b.repOverride(fp); override != nil {
+		b.emit(fp, override(b.ctx, items))
+	} else if fp.repTypeOverride != nil {
+		b.emit(fp, fp.repTypeOverride(fp.fd, items))
+	} else {
+		b.emit(fp, b.w.repFn(fp.fd, items))
 	}
-	return w.messageFn(fd, kvs)
 }
 
-func (w walker) applyMapFn(fd protoreflect.FieldDescriptor, v *protoreflect.Value, allowedDepth int, parent string) interface{} {
-	m := w.convertMap(fd, v, allowedDepth, parent)
-	if !w.keepEmpty && len(m) == 0 {
-		return nil
+func (b *builder) enterMap(_ *fieldPlan, n int) {
+	b.stack = append(b.stack, frame{kind: mapFrame, m: make(map[interface{}]interface{}, n)})
+}
+
+func (b *builder) mapEntry(_ *fieldPlan, k protoreflect.MapKey) {
+	f := &b.stack[len(b.stack)-1]
+	f.key = k.Interface()
+	f.hasKey = true
+}
+
+func (b *builder) exitMap(fp *fieldPlan) {
+	m := b.pop().m
+	if !b.w.keepEmpty && len(m) == 0 {
+		b.emit(fp, nil)
+		return
 	}
-	name := w.createName(parent, fd.Name())
-	if override := w.nameOverrides[name]; override != nil {
-		return override(fd, m)
+	if override := b.override(fp); override != nil {
+		b.emit(fp, override(b.ctx, m))
+	} else {
+		b.emit(fp, b.w.mapFn(fp.fd, m))
 	}
-	return w.mapFn(fd, m)
 }
 
 func IsDefaultScalar(v *protoreflect.Value) bool {
@@ -4,15 +4,21 @@
 package transforms
 
 import (
+	"fmt"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
 	"google.golang.org/protobuf/types/known/apipb"
+	"google.golang.org/protobuf/types/known/sourcecontextpb"
 	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"google.golang.org/protobuf/types/known/typepb"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -29,6 +35,16 @@ func TestWalker(t *testing.T) {
 			map[string]interface{}{"seconds": int64(1), "nanos": int32(2)},
 			"happy timestamp",
 		},
+		{
+			NewWalker(),
+			&descriptorpb.FieldDescriptorProto{Name: proto.String("foo")},
+			map[string]interface{}{
+				"name":  "foo",
+				"label": protoreflect.EnumNumber(1),
+				"type":  protoreflect.EnumNumber(1),
+			},
+			"proto2 defaults",
+		},
 		{
 			NewWalker(),
 			&timestamppb.Timestamp{Seconds: 0, Nanos: 2},
@@ -88,6 +104,71 @@ func TestWalker(t *testing.T) {
 			},
 			"map field",
 		},
+		{
+			NewWalker(),
+			&typepb.Type{Name: "foo", Oneofs: []string{"", "bar"}},
+			map[string]interface{}{"name": "foo", "oneofs": []interface{}{"bar"}},
+			"drop empty list items",
+		},
+		{
+			NewWalker(OptionKeepSet(true)),
+			&typepb.Type{Name: "foo", Oneofs: []string{"", "bar"}},
+			map[string]interface{}{"name": "foo", "oneofs": []interface{}{"", "bar"}},
+			"keep set: empty list items",
+		},
+		{
+			NewWalker(OptionKeepSet(true)),
+			&structpb.Struct{
+				Fields: map[string]*structpb.Value{
+					"foo": structpb.NewNullValue(),
+					"bar": structpb.NewNumberValue(0),
+				},
+			},
+			map[string]interface{}{
+				"fields": map[interface{}]interface{}{
+					"foo": map[string]interface{}{"null_value": protoreflect.EnumNumber(0)},
+					"bar": map[string]interface{}{"number_value": float64(0)},
+				},
+			},
+			"keep set: oneof fields",
+		},
+		{
+			NewWalker(),
+			&structpb.Struct{
+				Fields: map[string]*structpb.Value{
+					"foo": structpb.NewNumberValue(0),
+					"bar": structpb.NewNumberValue(1),
+				},
+			},
+			map[string]interface{}{
+				"fields": map[interface{}]interface{}{
+					"bar": map[string]interface{}{"number_value": float64(1)},
+				},
+			},
+			"drop empty map values",
+		},
+		{
+			NewWalker(),
+			&apipb.Api{Methods: []*apipb.Method{{}, {Name: "bar_method"}}, SourceContext: &sourcecontextpb.SourceContext{}},
+			map[string]interface{}{
+				"methods": []interface{}{
+					map[string]interface{}{"name": "bar_method"},
+				},
+			},
+			"drop empty messages",
+		},
+		{
+			NewWalker(OptionKeepSet(true)),
+			&apipb.Api{Methods: []*apipb.Method{{}, {Name: "bar_method"}}, SourceContext: &sourcecontextpb.SourceContext{}},
+			map[string]interface{}{
+				"methods": []interface{}{
+					map[string]interface{}{},
+					map[string]interface{}{"name": "bar_method"},
+				},
+				"source_context": map[string]interface{}{},
+			},
+			"keep set: empty messages",
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
@@ -419,6 +500,110 @@ func BenchmarkOptionAddNameOverride(b *testing.B) {
 	//	})
 }
 
+func BenchmarkOptionAddNameOverride_Compiled(b *testing.B) {
+	api := &apipb.Api{
+		Name: "foo",
+		Methods: []*apipb.Method{
+			{Name: "foo_method", RequestStreaming: true},
+			{Name: "bar_method"},
+		},
+	}
+	str := &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"foo": structpb.NewNumberValue(1.2),
+			"bar": structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{
+				structpb.NewStringValue("bla"),
+				structpb.NewStringValue("bus"),
+			}}),
+		},
+	}
+	cases := []struct {
+		walker Walker
+		input  proto.Message
+	}{
+		{
+			NewWalker(OptionAddNameOverride(
+				"methods.name",
+				func(_ protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+					return strings.ToUpper(v.String())
+				},
+			)).Compile(api.ProtoReflect().Descriptor()),
+			api,
+		},
+		{
+			NewWalker(OptionAddNameOverride(
+				"fields",
+				func(_ protoreflect.FieldDescriptor, m map[interface{}]interface{}) interface{} {
+					return len(m)
+				},
+			)).Compile(str.ProtoReflect().Descriptor()),
+			str,
+		},
+	}
+	for i := 0; i < b.N; i += 1 {
+		for _, c := range cases {
+			c.walker.Apply(c.input)
+		}
+	}
+}
+
+func BenchmarkApplyBatch(b *testing.B) {
+	walker := NewWalker(OptionAddNameOverride(
+		"methods.name",
+		func(_ protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+			return strings.ToUpper(v.String())
+		},
+	))
+	ms := make([]proto.Message, 1000)
+	for i := range ms {
+		ms[i] = &apipb.Api{
+			Name: "foo",
+			Methods: []*apipb.Method{
+				{Name: "foo_method", RequestStreaming: true},
+				{Name: "bar_method"},
+			},
+		}
+	}
+	for _, workers := range []int{1, 4, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i += 1 {
+				ApplyBatch(walker, ms, workers)
+			}
+		})
+	}
+}
+
+func BenchmarkApplyChan(b *testing.B) {
+	walker := NewWalker(OptionAddNameOverride(
+		"methods.name",
+		func(_ protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+			return strings.ToUpper(v.String())
+		},
+	))
+	m := &apipb.Api{
+		Name: "foo",
+		Methods: []*apipb.Method{
+			{Name: "foo_method", RequestStreaming: true},
+			{Name: "bar_method"},
+		},
+	}
+	for _, workers := range []int{1, 4, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i += 1 {
+				in := make(chan proto.Message)
+				go func() {
+					for j := 0; j < 1000; j += 1 {
+						in <- m
+					}
+					close(in)
+				}()
+				for range ApplyChan(walker, in, workers) {
+				}
+			}
+		})
+	}
+}
+
 func TestOptionAddScalarFunc(t *testing.T) {
 	cases := []struct {
 		walker   Walker
@@ -449,6 +634,73 @@ func TestOptionAddScalarFunc(t *testing.T) {
 	}
 }
 
+func TestOptionAddScalarTypeFunc(t *testing.T) {
+	enumName := func(fd protoreflect.FieldDescriptor, value *protoreflect.Value) interface{} {
+		return string(fd.Enum().Values().ByNumber(value.Enum()).Name())
+	}
+	constant := func(s string) ScalarFunc {
+		return func(_ protoreflect.FieldDescriptor, _ *protoreflect.Value) interface{} {
+			return s
+		}
+	}
+	input := &typepb.Field{
+		Kind:        typepb.Field_TYPE_STRING,
+		Cardinality: typepb.Field_CARDINALITY_OPTIONAL,
+		Number:      3,
+		Name:        "foo",
+	}
+
+	cases := []struct {
+		walker   Walker
+		expected interface{}
+		name     string
+	}{
+		{
+			NewWalker(OptionAddScalarTypeFunc("google.protobuf.Field.Kind", enumName)),
+			map[string]interface{}{
+				"kind":        "TYPE_STRING",
+				"cardinality": protoreflect.EnumNumber(1),
+				"number":      int32(3),
+				"name":        "foo",
+			},
+			"enum type",
+		},
+		{
+			NewWalker(OptionAddScalarTypeFunc("google.protobuf.Field", constant("x"))),
+			map[string]interface{}{
+				"kind":        "x",
+				"cardinality": "x",
+				"number":      "x",
+				"name":        "x",
+			},
+			"message type",
+		},
+		{
+			NewWalker(
+				OptionAddNameOverride("name", constant("name")),
+				OptionAddScalarFunc(protoreflect.EnumKind, constant("kind")),
+				OptionAddScalarFunc(protoreflect.Int32Kind, constant("kind")),
+				OptionAddScalarTypeFunc("google.protobuf.Field", constant("message")),
+				OptionAddScalarTypeFunc("google.protobuf.Field.Kind", enumName),
+			),
+			map[string]interface{}{
+				"kind":        "TYPE_STRING",
+				"cardinality": "message",
+				"number":      "message",
+				"name":        "name",
+			},
+			"precedence",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := c.walker.Apply(input); !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}
+
 func TestOptionKeepEmpty(t *testing.T) {
 	walker := NewWalker(OptionKeepEmpty(true))
 
@@ -764,6 +1016,27 @@ func BenchmarkOptionMaxDepth_Descriptor(b *testing.B) {
 	}
 }
 
+func BenchmarkOptionMaxDepth_Descriptor_Compiled(b *testing.B) {
+	api := (&apipb.Api{}).ProtoReflect().Descriptor()
+	value := (&structpb.Value{}).ProtoReflect().Descriptor()
+	str := (&structpb.Struct{}).ProtoReflect().Descriptor()
+	cases := []struct {
+		walker Walker
+		input  protoreflect.MessageDescriptor
+	}{
+		{NewWalker(OptionMaxDepth(-1)).Compile(api), api},
+		{NewWalker(OptionMaxDepth(0)).Compile(api), api},
+		{NewWalker(OptionMaxDepth(0)).Compile(value), value},
+		{NewWalker(OptionMaxDepth(1)).Compile(value), value},
+		{NewWalker(OptionMaxDepth(2)).Compile(str), str},
+	}
+	for i := 0; i < b.N; i += 1 {
+		for _, c := range cases {
+			c.walker.ApplyDesc(c.input)
+		}
+	}
+}
+
 func TestOptionMaxDepthForName(t *testing.T) {
 	apiInput := &apipb.Api{
 		Name: "foo",
@@ -828,3 +1101,262 @@ func TestOptionMaxDepthForName(t *testing.T) {
 		})
 	}
 }
+
+func TestWalker_Compile(t *testing.T) {
+	apiInput := &apipb.Api{
+		Name: "foo",
+		Methods: []*apipb.Method{
+			{
+				Name:             "foo_method",
+				RequestStreaming: true,
+				Options: []*typepb.Option{
+					{Name: "foo_opt"},
+				},
+			},
+			{Name: "bar_method"},
+		},
+	}
+	structInput := &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"foo": structpb.NewNumberValue(1.2),
+			"bar": structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{
+				structpb.NewStringValue("bla"),
+				structpb.NewStringValue("bus"),
+			}}),
+		},
+	}
+
+	cases := []struct {
+		walker Walker
+		input  proto.Message
+		name   string
+	}{
+		{NewWalker(), apiInput, "default"},
+		{NewWalker(), structInput, "map field"},
+		{NewWalker(OptionKeepOrder(true)), apiInput, "keep order"},
+		{NewWalker(OptionKeepEmpty(true), OptionMaxDepth(3)), structInput, "keep empty"},
+		{NewWalker(OptionMaxDepth(1)), apiInput, "max depth"},
+		{NewWalker(OptionMaxDepthForName("methods", 0)), apiInput, "max depth for name"},
+		{
+			NewWalker(OptionAddNameOverride(
+				"methods.name",
+				func(_ protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+					return strings.ToUpper(v.String())
+				},
+			)),
+			apiInput,
+			"name override",
+		},
+		{
+			NewWalker(OptionAddTypeOverride(
+				"google.protobuf.Option",
+				func(_ protoreflect.FieldDescriptor, kvs []KeyValue) interface{} { return len(kvs) },
+			)),
+			apiInput,
+			"type override",
+		},
+		{
+			NewWalker(OptionAddScalarFunc(
+				protoreflect.BoolKind,
+				func(_ protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} { return "yes" },
+			)),
+			apiInput,
+			"scalar func",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			md := c.input.ProtoReflect().Descriptor()
+			compiled := c.walker.Compile(md)
+			if expected, actual := c.walker.Apply(c.input), compiled.Apply(c.input); !reflect.DeepEqual(actual, expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, expected, actual)
+			}
+			if expected, actual := c.walker.ApplyDesc(md), compiled.ApplyDesc(md); !reflect.DeepEqual(actual, expected) {
+				t.Errorf("%s (descriptor): \nexpected %v, \ngot      %v", c.name, expected, actual)
+			}
+			// other message types are still accepted
+			other := &timestamppb.Timestamp{Seconds: 1, Nanos: 2}
+			if expected, actual := c.walker.Apply(other), compiled.Apply(other); !reflect.DeepEqual(actual, expected) {
+				t.Errorf("%s (other type): \nexpected %v, \ngot      %v", c.name, expected, actual)
+			}
+		})
+	}
+}
+
+func TestWalker_Concurrent(t *testing.T) {
+	inputs := []proto.Message{
+		&apipb.Api{
+			Name: "foo",
+			Methods: []*apipb.Method{
+				{Name: "foo_method", Options: []*typepb.Option{{Name: "foo_opt"}}},
+				{Name: "bar_method", RequestStreaming: true},
+			},
+		},
+		&structpb.Struct{
+			Fields: map[string]*structpb.Value{
+				"foo": structpb.NewNumberValue(1.2),
+				"bar": structpb.NewStructValue(&structpb.Struct{
+					Fields: map[string]*structpb.Value{"bla": structpb.NewBoolValue(true)},
+				}),
+			},
+		},
+		&timestamppb.Timestamp{Seconds: 1, Nanos: 2},
+	}
+	newWalker := func() Walker {
+		return NewWalker(
+			OptionMaxDepth(5),
+			OptionAddNameOverride(
+				"methods.name",
+				func(_ protoreflect.FieldDescriptor, v *protoreflect.Value) interface{} {
+					return strings.ToUpper(v.String())
+				},
+			),
+		)
+	}
+
+	var expected, expectedDesc []interface{}
+	for _, input := range inputs {
+		expected = append(expected, newWalker().Apply(input))
+		expectedDesc = append(expectedDesc, newWalker().ApplyDesc(input.ProtoReflect().Descriptor()))
+	}
+
+	walker := newWalker()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 16; i += 1 {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			for j := 0; j < 100; j += 1 {
+				k := (offset + j) % len(inputs)
+				if actual := walker.Apply(inputs[k]); !reflect.DeepEqual(actual, expected[k]) {
+					t.Errorf("expected %v, \ngot      %v", expected[k], actual)
+				}
+				if actual := walker.ApplyDesc(inputs[k].ProtoReflect().Descriptor()); !reflect.DeepEqual(actual, expectedDesc[k]) {
+					t.Errorf("expected %v, \ngot      %v", expectedDesc[k], actual)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestWalker_SameNameOtherDescriptor(t *testing.T) {
+	// build a second descriptor for google.protobuf.Timestamp
+	fdp := protodesc.ToFileDescriptorProto(timestamppb.File_google_protobuf_timestamp_proto)
+	fdp.MessageType[0].Field = fdp.MessageType[0].Field[:1]
+	file, err := protodesc.NewFile(fdp, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	md := file.Messages().Get(0)
+	dyn := dynamicpb.NewMessage(md)
+	dyn.Set(md.Fields().Get(0), protoreflect.ValueOfInt64(1))
+
+	walker := NewWalker()
+	expected := map[string]interface{}{"seconds": int64(1), "nanos": int32(2)}
+	if actual := walker.Apply(&timestamppb.Timestamp{Seconds: 1, Nanos: 2}); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, \ngot      %v", expected, actual)
+	}
+	expected = map[string]interface{}{"seconds": int64(1)}
+	if actual := walker.Apply(dyn); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, \ngot      %v", expected, actual)
+	}
+}
+
+func TestDescriptorFields(t *testing.T) {
+	// declared as name, number, label, type, type_name, extendee, ...
+	md := (&descriptorpb.FieldDescriptorProto{}).ProtoReflect().Descriptor()
+	var actual []string
+	for _, fd := range DescriptorFields(md) {
+		actual = append(actual, string(fd.Name()))
+	}
+	expected := []string{"name", "extendee", "number", "label", "type", "type_name", "default_value", "options", "oneof_index", "json_name", "proto3_optional"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, \ngot      %v", expected, actual)
+	}
+}
+
+func TestOptionAddRepeatedOverride(t *testing.T) {
+	last := func(n int) RepeatedFunc {
+		return func(_ protoreflect.FieldDescriptor, xs []interface{}) interface{} {
+			if len(xs) > n {
+				return xs[len(xs)-n:]
+			}
+			return xs
+		}
+	}
+	count := func(_ protoreflect.FieldDescriptor, xs []interface{}) interface{} {
+		return len(xs)
+	}
+	apiInput := &apipb.Api{
+		Name: "foo",
+		Methods: []*apipb.Method{
+			{Name: "foo_method", Options: []*typepb.Option{{Name: "foo_opt"}, {Name: "bar_opt"}}},
+			{Name: "bar_method", Options: []*typepb.Option{{Name: "bla_opt"}}},
+			{Name: "bla_method"},
+		},
+	}
+
+	cases := []struct {
+		walker   Walker
+		input    proto.Message
+		expected interface{}
+		name     string
+	}{
+		{
+			NewWalker(
+				OptionAddRepeatedOverride("methods", last(1)),
+				OptionAddNameOverride("methods", func(_ protoreflect.FieldDescriptor, kvs []KeyValue) interface{} {
+					return kvs[0].Value
+				}),
+			),
+			apiInput,
+			map[string]interface{}{
+				"name":    "foo",
+				"methods": []interface{}{"bla_method"},
+			},
+			"whole list after elements",
+		},
+		{
+			NewWalker(OptionAddRepeatedOverride(
+				"methods.options",
+				func(c *WalkContext, xs []interface{}) interface{} {
+					return fmt.Sprintf("%s:%d", c, len(xs))
+				},
+			)),
+			apiInput,
+			map[string]interface{}{
+				"name": "foo",
+				"methods": []interface{}{
+					map[string]interface{}{"name": "foo_method", "options": "methods[0].options:2"},
+					map[string]interface{}{"name": "bar_method", "options": "methods[1].options:1"},
+					map[string]interface{}{"name": "bla_method"},
+				},
+			},
+			"context",
+		},
+		{
+			NewWalker(
+				OptionAddRepeatedTypeOverride("google.protobuf.Option", count),
+				OptionAddRepeatedOverride("methods[1].options", last(0)),
+			),
+			apiInput,
+			map[string]interface{}{
+				"name": "foo",
+				"methods": []interface{}{
+					map[string]interface{}{"name": "foo_method", "options": 2},
+					map[string]interface{}{"name": "bar_method", "options": []interface{}{}},
+					map[string]interface{}{"name": "bla_method"},
+				},
+			},
+			"type override and name precedence",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := c.walker.Apply(c.input); !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("%s: \nexpected %v, \ngot      %v", c.name, c.expected, actual)
+			}
+		})
+	}
+}